@@ -7,6 +7,7 @@ require (
 	github.com/gomodule/redigo v1.8.9
 	github.com/redis/go-redis/v9 v9.0.5
 	github.com/stretchr/testify v1.8.4
+	golang.org/x/time v0.3.0
 )
 
 require (
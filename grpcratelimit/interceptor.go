@@ -0,0 +1,93 @@
+// Package grpcratelimit provides gRPC server interceptors which ratelimit calls with any of the local or Redis ratelimiters,
+// rejecting denied calls with codes.ResourceExhausted.
+//
+// The interceptors share httpratelimit's Limiter interface, so httpratelimit.LeakyBucket, httpratelimit.SlidingWindow and
+// httpratelimit.Local adapt the ratelimiters for them.
+package grpcratelimit
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/aidenwallis/go-ratelimiting/httpratelimit"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// RetryPushbackKey is the trailer gRPC clients read to delay their next retry attempt, it's set on denied calls to how many
+// milliseconds the caller should wait.
+const RetryPushbackKey = "grpc-retry-pushback-ms"
+
+// KeyFunc extracts the ratelimit key from a call, such as from its metadata with metadata.FromIncomingContext, or from the caller's
+// address with peer.FromContext. fullMethod is the full RPC method string, which is useful to ratelimit methods separately.
+type KeyFunc func(ctx context.Context, fullMethod string) string
+
+// UnaryServerInterceptor creates an interceptor which ratelimits unary calls with limiter, keyed by keyFunc. The decision is
+// available to the handler through httpratelimit.DecisionFromContext.
+func UnaryServerInterceptor(limiter httpratelimit.Limiter, keyFunc KeyFunc) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		decision, err := limiter.Allow(ctx, keyFunc(ctx, info.FullMethod))
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "ratelimiting call: %v", err)
+		}
+
+		if !decision.Allowed {
+			if md := pushback(decision); md != nil {
+				_ = grpc.SetTrailer(ctx, md)
+			}
+			return nil, errResourceExhausted
+		}
+
+		return handler(httpratelimit.WithDecision(ctx, decision), req)
+	}
+}
+
+// StreamServerInterceptor creates an interceptor which ratelimits streams with limiter, keyed by keyFunc. A token is taken when the
+// stream is opened, not per message.
+func StreamServerInterceptor(limiter httpratelimit.Limiter, keyFunc KeyFunc) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := ss.Context()
+
+		decision, err := limiter.Allow(ctx, keyFunc(ctx, info.FullMethod))
+		if err != nil {
+			return status.Errorf(codes.Internal, "ratelimiting call: %v", err)
+		}
+
+		if !decision.Allowed {
+			if md := pushback(decision); md != nil {
+				ss.SetTrailer(md)
+			}
+			return errResourceExhausted
+		}
+
+		return handler(srv, &decisionStream{ServerStream: ss, ctx: httpratelimit.WithDecision(ctx, decision)})
+	}
+}
+
+// decisionStream overrides the stream's context to carry the decision to the handler.
+type decisionStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *decisionStream) Context() context.Context {
+	return s.ctx
+}
+
+var errResourceExhausted = status.Error(codes.ResourceExhausted, "ratelimit exceeded")
+
+// pushback returns the trailer telling the caller how long to wait before retrying, or nil if the decision doesn't say.
+func pushback(decision *httpratelimit.Decision) metadata.MD {
+	wait := decision.RetryAfter
+	if wait <= 0 && !decision.ResetAt.IsZero() {
+		wait = time.Until(decision.ResetAt)
+	}
+	if wait <= 0 {
+		return nil
+	}
+
+	return metadata.Pairs(RetryPushbackKey, strconv.FormatInt(wait.Milliseconds(), 10))
+}
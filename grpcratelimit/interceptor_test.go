@@ -0,0 +1,114 @@
+package grpcratelimit_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aidenwallis/go-ratelimiting/grpcratelimit"
+	"github.com/aidenwallis/go-ratelimiting/httpratelimit"
+	"github.com/aidenwallis/go-ratelimiting/local"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// transportStream captures the trailer set by unary interceptors.
+type transportStream struct {
+	trailer metadata.MD
+}
+
+func (s *transportStream) Method() string                  { return "/test.Service/Method" }
+func (s *transportStream) SetHeader(metadata.MD) error     { return nil }
+func (s *transportStream) SendHeader(metadata.MD) error    { return nil }
+func (s *transportStream) SetTrailer(md metadata.MD) error { s.trailer = md; return nil }
+
+// serverStream captures the trailer set by stream interceptors.
+type serverStream struct {
+	grpc.ServerStream
+	ctx     context.Context
+	trailer metadata.MD
+}
+
+func (s *serverStream) Context() context.Context  { return s.ctx }
+func (s *serverStream) SetTrailer(md metadata.MD) { s.trailer = md }
+
+func keyByMethod(_ context.Context, fullMethod string) string {
+	return fullMethod
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	t.Parallel()
+
+	bucket := local.NewLeakyBucket(1, time.Minute)
+	interceptor := grpcratelimit.UnaryServerInterceptor(httpratelimit.Local(func(string) httpratelimit.LocalLimiter { return bucket }), keyByMethod)
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Service/Method"}
+	handler := func(ctx context.Context, _ interface{}) (interface{}, error) {
+		assert.Equal(t, 0, httpratelimit.DecisionFromContext(ctx).Remaining)
+		return "ok", nil
+	}
+
+	stream := &transportStream{}
+	ctx := grpc.NewContextWithServerTransportStream(context.Background(), stream)
+
+	resp, err := interceptor(ctx, nil, info, handler)
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", resp)
+	assert.Nil(t, stream.trailer)
+
+	resp, err = interceptor(ctx, nil, info, handler)
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Len(t, stream.trailer.Get(grpcratelimit.RetryPushbackKey), 1)
+	assert.NotEqual(t, "0", stream.trailer.Get(grpcratelimit.RetryPushbackKey)[0])
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	t.Parallel()
+
+	limiter := httpratelimit.LimiterFunc(func(_ context.Context, key string) (*httpratelimit.Decision, error) {
+		assert.Equal(t, "/test.Service/Stream", key)
+		return &httpratelimit.Decision{Allowed: false, RetryAfter: time.Millisecond * 1500}, nil
+	})
+	interceptor := grpcratelimit.StreamServerInterceptor(limiter, keyByMethod)
+
+	stream := &serverStream{ctx: context.Background()}
+	called := false
+	err := interceptor(nil, stream, &grpc.StreamServerInfo{FullMethod: "/test.Service/Stream"}, func(interface{}, grpc.ServerStream) error {
+		called = true
+		return nil
+	})
+
+	assert.False(t, called)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Equal(t, []string{"1500"}, stream.trailer.Get(grpcratelimit.RetryPushbackKey))
+}
+
+func TestInterceptors_Errors(t *testing.T) {
+	t.Parallel()
+
+	limiter := httpratelimit.LimiterFunc(func(context.Context, string) (*httpratelimit.Decision, error) {
+		return nil, assert.AnError
+	})
+
+	_, err := grpcratelimit.UnaryServerInterceptor(limiter, keyByMethod)(context.Background(), nil, &grpc.UnaryServerInfo{}, nil)
+	assert.Equal(t, codes.Internal, status.Code(err))
+
+	err = grpcratelimit.StreamServerInterceptor(limiter, keyByMethod)(nil, &serverStream{ctx: context.Background()}, &grpc.StreamServerInfo{}, nil)
+	assert.Equal(t, codes.Internal, status.Code(err))
+}
+
+func TestInterceptors_ResetAt(t *testing.T) {
+	t.Parallel()
+
+	limiter := httpratelimit.LimiterFunc(func(context.Context, string) (*httpratelimit.Decision, error) {
+		return &httpratelimit.Decision{Allowed: false, ResetAt: time.Now().Add(time.Minute)}, nil
+	})
+
+	stream := &serverStream{ctx: context.Background()}
+	err := grpcratelimit.StreamServerInterceptor(limiter, keyByMethod)(nil, stream, &grpc.StreamServerInfo{}, nil)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Len(t, stream.trailer.Get(grpcratelimit.RetryPushbackKey), 1, "pushback should fall back to ResetAt")
+}
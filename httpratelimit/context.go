@@ -0,0 +1,17 @@
+package httpratelimit
+
+import "context"
+
+type decisionKey struct{}
+
+// WithDecision returns a copy of ctx carrying decision, the middleware and the grpcratelimit interceptors attach their decision to
+// the context of the calls they allow, so downstream handlers can read it without running the limiter again.
+func WithDecision(ctx context.Context, decision *Decision) context.Context {
+	return context.WithValue(ctx, decisionKey{}, decision)
+}
+
+// DecisionFromContext returns the decision carried by ctx, or nil if there isn't one.
+func DecisionFromContext(ctx context.Context) *Decision {
+	decision, _ := ctx.Value(decisionKey{}).(*Decision)
+	return decision
+}
@@ -0,0 +1,102 @@
+package httpratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/aidenwallis/go-ratelimiting/local"
+	"github.com/aidenwallis/go-ratelimiting/redis"
+)
+
+// LeakyBucket creates a Limiter which takes a token per request from a Redis leaky bucket, options returns the bucket for a key.
+//
+// Retry-After is set from redis.UseLeakyBucketResponse.Decision, which is how long until the next token refills, or until the daily
+// quota resets if it's exhausted, or until the caller's cool-down ends if they're penalized.
+func LeakyBucket(limiter redis.LeakyBucket, options func(key string) *redis.LeakyBucketOptions) Limiter {
+	return LimiterFunc(func(ctx context.Context, key string) (*Decision, error) {
+		bucket := options(key)
+
+		resp, err := limiter.Use(ctx, bucket, 1)
+		if err != nil {
+			return nil, err
+		}
+
+		decision := resp.Decision(bucket)
+		return &Decision{
+			Allowed:    decision.Success,
+			Limit:      bucket.MaximumCapacity,
+			Remaining:  decision.Remaining,
+			ResetAt:    decision.ResetAt,
+			RetryAfter: decision.RetryAfter,
+		}, nil
+	})
+}
+
+// SlidingWindow creates a Limiter which takes a token per request from a Redis sliding window, options returns the window for a key.
+//
+// The sliding window doesn't report when its oldest token expires, so X-RateLimit-Reset is omitted, and Retry-After is set to the
+// window, which is when every token currently in it will have expired, or to when the caller's cool-down ends if they're penalized,
+// as redis.UseSlidingWindowResponse.Decision reports.
+func SlidingWindow(limiter redis.SlidingWindow, options func(key string) *redis.SlidingWindowOptions) Limiter {
+	return LimiterFunc(func(ctx context.Context, key string) (*Decision, error) {
+		bucket := options(key)
+
+		resp, err := limiter.Use(ctx, bucket)
+		if err != nil {
+			return nil, err
+		}
+
+		decision := resp.Decision(bucket)
+		return &Decision{
+			Allowed:    decision.Success,
+			Limit:      bucket.MaximumCapacity,
+			Remaining:  decision.Remaining,
+			RetryAfter: decision.RetryAfter,
+		}, nil
+	})
+}
+
+// LocalLimiter is a local ratelimiter that can back a Limiter, it's implemented by local.LeakyBucket, local.SlidingWindow and
+// local.Composite.
+type LocalLimiter interface {
+	// TryTakeWithResetAt will attempt to accquire a token, it will return a boolean indicating whether it was able to accquire a
+	// token or not, and the time at which you should next try.
+	TryTakeWithResetAt() (bool, time.Time)
+
+	// Describe will return the ratelimiter's effective configuration
+	Describe() local.LimiterInfo
+}
+
+// Local creates a Limiter which takes a token per request from a local ratelimiter, get returns the ratelimiter for a key, such as
+// from a local.Registry.
+//
+// X-RateLimit-Remaining is only set when the ratelimiter also implements Size() int, as local.LeakyBucket and local.SlidingWindow
+// do. A leaky bucket's size is the tokens it has left, while a sliding window's is the tokens already in the window, so it's
+// reported as the capacity left instead. X-RateLimit-Reset is only set when the request is denied, as the time the next token is available.
+func Local(get func(key string) LocalLimiter) Limiter {
+	return LimiterFunc(func(_ context.Context, key string) (*Decision, error) {
+		limiter := get(key)
+		allowed, resetAt := limiter.TryTakeWithResetAt()
+		info := limiter.Describe()
+
+		decision := &Decision{
+			Allowed:   allowed,
+			Limit:     info.Capacity,
+			Remaining: -1,
+		}
+
+		if sizer, ok := limiter.(interface{ Size() int }); ok {
+			decision.Remaining = sizer.Size()
+			if info.Algorithm == local.AlgorithmSlidingWindow {
+				decision.Remaining = info.Capacity - decision.Remaining
+			}
+		}
+
+		if !allowed {
+			decision.ResetAt = resetAt
+			decision.RetryAfter = time.Until(resetAt)
+		}
+
+		return decision, nil
+	})
+}
@@ -0,0 +1,117 @@
+// Package httpratelimit provides net/http middleware which ratelimits requests with any of the local or Redis ratelimiters, setting
+// the conventional X-RateLimit-* and Retry-After headers, and responding with 429 Too Many Requests when a request is denied.
+package httpratelimit
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Decision describes whether a request may proceed, and the ratelimit state used to populate the response headers.
+type Decision struct {
+	// Allowed is true when the request may proceed
+	Allowed bool
+
+	// Limit is how many requests may be made per window, the X-RateLimit-Limit header is omitted when this is 0.
+	Limit int
+
+	// Remaining is how many more requests may be made, the X-RateLimit-Remaining header is omitted when this is negative, which
+	// limiters use when they can't tell.
+	Remaining int
+
+	// ResetAt is when the ratelimit resets, the X-RateLimit-Reset header is omitted when this is zero.
+	ResetAt time.Time
+
+	// RetryAfter is how long a denied caller should wait before retrying, the Retry-After header is omitted when this is 0.
+	RetryAfter time.Duration
+}
+
+// Limiter decides whether the request identified by key may proceed. See LeakyBucket, SlidingWindow and Local for limiters backed
+// by this library's ratelimiters.
+type Limiter interface {
+	Allow(ctx context.Context, key string) (*Decision, error)
+}
+
+// LimiterFunc is an adapter to allow the use of ordinary functions as a Limiter.
+type LimiterFunc func(ctx context.Context, key string) (*Decision, error)
+
+// Allow calls f(ctx, key).
+func (f LimiterFunc) Allow(ctx context.Context, key string) (*Decision, error) {
+	return f(ctx, key)
+}
+
+// KeyFunc extracts the ratelimit key from a request, such as the client's IP address, or an API key.
+type KeyFunc func(r *http.Request) string
+
+// Middleware ratelimits requests before they reach the next handler.
+type Middleware struct {
+	// Limiter decides whether each request may proceed
+	Limiter Limiter
+
+	// KeyFunc extracts the ratelimit key from each request
+	KeyFunc KeyFunc
+
+	// DeniedHandler optionally writes the response for denied requests, the ratelimit headers have already been set when it's
+	// called. If this is not defined, a plain text 429 Too Many Requests response is written.
+	DeniedHandler func(w http.ResponseWriter, r *http.Request, decision *Decision)
+
+	// ErrorHandler optionally writes the response when the Limiter returns an error, which is useful to fail open by calling the
+	// next handler instead. If this is not defined, a plain text 500 Internal Server Error response is written.
+	ErrorHandler func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+// NewMiddleware creates a new middleware, which ratelimits requests with limiter, keyed by keyFunc.
+func NewMiddleware(limiter Limiter, keyFunc KeyFunc) *Middleware {
+	return &Middleware{
+		Limiter: limiter,
+		KeyFunc: keyFunc,
+	}
+}
+
+// Handler wraps next, only calling it when the Limiter allows the request. The decision is available to next through
+// DecisionFromContext.
+func (m *Middleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		decision, err := m.Limiter.Allow(r.Context(), m.KeyFunc(r))
+		if err != nil {
+			if m.ErrorHandler != nil {
+				m.ErrorHandler(w, r, err)
+				return
+			}
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		setHeaders(w.Header(), decision)
+
+		if !decision.Allowed {
+			if m.DeniedHandler != nil {
+				m.DeniedHandler(w, r, decision)
+				return
+			}
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(WithDecision(r.Context(), decision)))
+	})
+}
+
+func setHeaders(h http.Header, decision *Decision) {
+	if decision.Limit > 0 {
+		h.Set("X-RateLimit-Limit", strconv.Itoa(decision.Limit))
+	}
+	if decision.Remaining >= 0 {
+		h.Set("X-RateLimit-Remaining", strconv.Itoa(decision.Remaining))
+	}
+	if !decision.ResetAt.IsZero() {
+		h.Set("X-RateLimit-Reset", strconv.FormatInt(decision.ResetAt.Unix(), 10))
+	}
+	if !decision.Allowed && decision.RetryAfter > 0 {
+		// Retry-After only has a resolution of seconds, so round up to avoid callers retrying early
+		h.Set("Retry-After", strconv.Itoa(int(math.Ceil(decision.RetryAfter.Seconds()))))
+	}
+}
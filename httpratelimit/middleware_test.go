@@ -0,0 +1,217 @@
+package httpratelimit_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aidenwallis/go-ratelimiting/httpratelimit"
+	"github.com/aidenwallis/go-ratelimiting/local"
+	"github.com/aidenwallis/go-ratelimiting/redis"
+	"github.com/aidenwallis/go-ratelimiting/redis/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusNoContent)
+})
+
+func keyByHeader(r *http.Request) string {
+	return r.Header.Get("X-Key")
+}
+
+func serve(handler http.Handler, key string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Key", key)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestMiddleware_LeakyBucket(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(1700000000, 0)
+	limiter := httpratelimit.LeakyBucket(fake.NewLeakyBucket(fake.NewClock(now)), func(key string) *redis.LeakyBucketOptions {
+		return &redis.LeakyBucketOptions{KeyPrefix: key, MaximumCapacity: 2, WindowSeconds: 10}
+	})
+	handler := httpratelimit.NewMiddleware(limiter, keyByHeader).Handler(okHandler)
+
+	for i := 1; i >= 0; i-- {
+		rec := serve(handler, "a")
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.Equal(t, "2", rec.Header().Get("X-RateLimit-Limit"))
+		assert.Equal(t, strconv.Itoa(i), rec.Header().Get("X-RateLimit-Remaining"))
+		assert.Empty(t, rec.Header().Get("Retry-After"))
+	}
+
+	rec := serve(handler, "a")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "0", rec.Header().Get("X-RateLimit-Remaining"))
+	assert.Equal(t, "1700000010", rec.Header().Get("X-RateLimit-Reset"))
+	assert.Equal(t, "5", rec.Header().Get("Retry-After"), "a token refills every 5 seconds")
+
+	// keys are ratelimited independently
+	assert.Equal(t, http.StatusNoContent, serve(handler, "b").Code)
+}
+
+func TestMiddleware_LeakyBucketDailyQuota(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now().UTC()
+	limiter := httpratelimit.LeakyBucket(fake.NewLeakyBucket(fake.NewClock(now)), func(key string) *redis.LeakyBucketOptions {
+		return &redis.LeakyBucketOptions{KeyPrefix: key, MaximumCapacity: 2, WindowSeconds: 10, DailyQuota: 1}
+	})
+	handler := httpratelimit.NewMiddleware(limiter, keyByHeader).Handler(okHandler)
+
+	assert.Equal(t, http.StatusNoContent, serve(handler, "a").Code)
+
+	// the bucket still has a token, but the quota is spent until midnight UTC
+	rec := serve(handler, "a")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	retryAfter, err := strconv.Atoi(rec.Header().Get("Retry-After"))
+	assert.NoError(t, err)
+	midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	assert.InDelta(t, midnight.Sub(now).Seconds(), retryAfter, 2)
+}
+
+func TestMiddleware_SlidingWindow(t *testing.T) {
+	t.Parallel()
+
+	limiter := httpratelimit.SlidingWindow(fake.NewSlidingWindow(fake.NewClock(time.Now())), func(key string) *redis.SlidingWindowOptions {
+		return &redis.SlidingWindowOptions{Key: key, MaximumCapacity: 1, Window: time.Minute}
+	})
+	handler := httpratelimit.NewMiddleware(limiter, keyByHeader).Handler(okHandler)
+
+	assert.Equal(t, http.StatusNoContent, serve(handler, "a").Code)
+
+	rec := serve(handler, "a")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, "0", rec.Header().Get("X-RateLimit-Remaining"))
+	assert.Empty(t, rec.Header().Get("X-RateLimit-Reset"))
+	assert.Equal(t, "60", rec.Header().Get("Retry-After"))
+}
+
+func TestMiddleware_Local(t *testing.T) {
+	t.Parallel()
+
+	t.Run("leaky bucket", func(t *testing.T) {
+		t.Parallel()
+
+		bucket := local.NewLeakyBucket(1, time.Minute)
+		limiter := httpratelimit.Local(func(string) httpratelimit.LocalLimiter { return bucket })
+		handler := httpratelimit.NewMiddleware(limiter, keyByHeader).Handler(okHandler)
+
+		rec := serve(handler, "a")
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.Equal(t, "1", rec.Header().Get("X-RateLimit-Limit"))
+		assert.Equal(t, "0", rec.Header().Get("X-RateLimit-Remaining"))
+		assert.Empty(t, rec.Header().Get("X-RateLimit-Reset"))
+
+		rec = serve(handler, "a")
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		assert.NotEmpty(t, rec.Header().Get("X-RateLimit-Reset"))
+		assert.Equal(t, "60", rec.Header().Get("Retry-After"))
+	})
+
+	t.Run("sliding window", func(t *testing.T) {
+		t.Parallel()
+
+		window, err := local.NewSlidingWindow(3, time.Minute)
+		assert.NoError(t, err)
+		limiter := httpratelimit.Local(func(string) httpratelimit.LocalLimiter { return window })
+		handler := httpratelimit.NewMiddleware(limiter, keyByHeader).Handler(okHandler)
+
+		// the remaining capacity counts down as the window fills
+		for i := 2; i >= 0; i-- {
+			rec := serve(handler, "a")
+			assert.Equal(t, http.StatusNoContent, rec.Code)
+			assert.Equal(t, "3", rec.Header().Get("X-RateLimit-Limit"))
+			assert.Equal(t, strconv.Itoa(i), rec.Header().Get("X-RateLimit-Remaining"))
+		}
+
+		rec := serve(handler, "a")
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		assert.Equal(t, "0", rec.Header().Get("X-RateLimit-Remaining"))
+	})
+
+	t.Run("without size", func(t *testing.T) {
+		t.Parallel()
+
+		composite, err := local.NewComposite(1, time.Minute, 1, time.Minute)
+		assert.NoError(t, err)
+		limiter := httpratelimit.Local(func(string) httpratelimit.LocalLimiter { return composite })
+		handler := httpratelimit.NewMiddleware(limiter, keyByHeader).Handler(okHandler)
+
+		rec := serve(handler, "a")
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.Empty(t, rec.Header().Values("X-RateLimit-Remaining"))
+	})
+}
+
+func TestMiddleware_Context(t *testing.T) {
+	t.Parallel()
+
+	decision := &httpratelimit.Decision{Allowed: true, Limit: 5, Remaining: 4}
+	limiter := httpratelimit.LimiterFunc(func(context.Context, string) (*httpratelimit.Decision, error) {
+		return decision, nil
+	})
+
+	var got *httpratelimit.Decision
+	handler := httpratelimit.NewMiddleware(limiter, keyByHeader).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = httpratelimit.DecisionFromContext(r.Context())
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	assert.Equal(t, http.StatusNoContent, serve(handler, "a").Code)
+	assert.Same(t, decision, got)
+	assert.Nil(t, httpratelimit.DecisionFromContext(context.Background()))
+}
+
+func TestMiddleware_DeniedHandler(t *testing.T) {
+	t.Parallel()
+
+	limiter := httpratelimit.LimiterFunc(func(context.Context, string) (*httpratelimit.Decision, error) {
+		return &httpratelimit.Decision{Allowed: false, Limit: 5, Remaining: 0, RetryAfter: time.Millisecond * 1500}, nil
+	})
+	middleware := httpratelimit.NewMiddleware(limiter, keyByHeader)
+	middleware.DeniedHandler = func(w http.ResponseWriter, _ *http.Request, decision *httpratelimit.Decision) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte("slow down"))
+	}
+
+	rec := serve(middleware.Handler(okHandler), "a")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "slow down", rec.Body.String())
+	assert.Equal(t, "2", rec.Header().Get("Retry-After"), "Retry-After should round up")
+}
+
+func TestMiddleware_Errors(t *testing.T) {
+	t.Parallel()
+
+	limiter := httpratelimit.LimiterFunc(func(context.Context, string) (*httpratelimit.Decision, error) {
+		return nil, assert.AnError
+	})
+
+	t.Run("default", func(t *testing.T) {
+		t.Parallel()
+
+		rec := serve(httpratelimit.NewMiddleware(limiter, keyByHeader).Handler(okHandler), "a")
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	})
+
+	t.Run("fail open", func(t *testing.T) {
+		t.Parallel()
+
+		middleware := httpratelimit.NewMiddleware(limiter, keyByHeader)
+		middleware.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+			assert.ErrorIs(t, err, assert.AnError)
+			okHandler.ServeHTTP(w, r)
+		}
+		assert.Equal(t, http.StatusNoContent, serve(middleware.Handler(okHandler), "a").Code)
+	})
+}
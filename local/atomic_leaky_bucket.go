@@ -0,0 +1,334 @@
+package local
+
+import (
+	"context"
+	"encoding/json"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// atomicLeakyBucketSpins is how many times a take retries its compare-and-swap straight away before yielding to other goroutines
+const atomicLeakyBucketSpins = 4
+
+type atomicLeakyBucket struct {
+	// the int64 fields are accessed atomically, so they're kept first for alignment
+
+	// emptyAt is when the bucket was, or would have been, empty, in nanoseconds since epoch. The bucket gains a token every rate
+	// from then, up to max, so this single word packs both its tokens and when it was last filled, and can be swapped atomically.
+	emptyAt  int64
+	waiters  int64
+	granted  int64
+	denied   int64
+	taken    int64
+	refunded int64
+
+	initial int
+	max     int
+	rate    time.Duration
+	epoch   time.Time
+	opts    *options
+}
+
+// NewAtomicLeakyBucket creates a new leaky bucket ratelimiter which is lock-free, it behaves the same as NewLeakyBucket, except that
+// its state is a single word updated with compare-and-swap, rather than guarded by a mutex. This is faster for extremely hot
+// buckets under high parallelism, where the mutex is contended, and is otherwise no different, so prefer NewLeakyBucket unless
+// you've measured the mutex being a bottleneck.
+//
+// As tokens are filled continuously rather than by each call, LastFillTokens in Stats is always 1 once anything has been filled,
+// and LastFillAt is when the most recent token was filled.
+func NewAtomicLeakyBucket(tokensPerWindow int, window time.Duration, opts ...Option) LeakyBucket {
+	o := newOptions(opts)
+	r := &atomicLeakyBucket{
+		initial: o.startingTokens(tokensPerWindow),
+		max:     tokensPerWindow,
+		rate:    window / time.Duration(tokensPerWindow),
+		epoch:   o.now(),
+		opts:    o,
+	}
+	r.emptyAt = -int64(r.initial) * int64(r.rate)
+	return r
+}
+
+// TryTake will attempt to accquire a token, it will return a boolean indicating whether it was able to accquire a token or not.
+func (r *atomicLeakyBucket) TryTake() bool {
+	resp, _ := r.TryTakeWithDuration()
+	return resp
+}
+
+// TryTakeWithDuration will attempt to accquire a token, it will return a boolean indicating whether it was able to accquire a token
+// or not, and a duration for when you should next try.
+func (r *atomicLeakyBucket) TryTakeWithDuration() (bool, time.Duration) {
+	return r.TryTakeAt(r.opts.now())
+}
+
+// TryTakeAt is equivalent to TryTakeWithDuration, except it uses now as the current time rather than time.Now().
+func (r *atomicLeakyBucket) TryTakeAt(now time.Time) (bool, time.Duration) {
+	return r.tryTakeNAt(1, r.opts.reserve, now)
+}
+
+// TryTakeWithResetAt is equivalent to TryTakeWithDuration, except it returns the absolute time at which you should next try,
+// which avoids skew when the result is passed through layers that add their own latency. On success, this is the current time.
+func (r *atomicLeakyBucket) TryTakeWithResetAt() (bool, time.Time) {
+	now := r.opts.now()
+	success, resetAt, remaining := r.tryTake(1, r.opts.reserve, now)
+	r.opts.emitDecision(DecisionEvent{Allowed: success, Remaining: remaining, TakeAmount: 1})
+	if success {
+		return true, now
+	}
+	return false, r.epoch.Add(time.Duration(resetAt))
+}
+
+// TryTakeN will attempt to accquire n tokens atomically, either all tokens are taken, or none are. Requesting fewer than 1 token,
+// or more tokens than the bucket can hold, will never succeed.
+func (r *atomicLeakyBucket) TryTakeN(n int) bool {
+	resp, _ := r.TryTakeNWithDuration(n)
+	return resp
+}
+
+// TryTakeNWithDuration is equivalent to TryTakeN, except it also returns a duration for when you should next try, which is 0 when n
+// can never succeed.
+func (r *atomicLeakyBucket) TryTakeNWithDuration(n int) (bool, time.Duration) {
+	return r.tryTakeNAt(n, r.opts.reserve, r.opts.now())
+}
+
+// TryTakeHighPriority will attempt to accquire n tokens atomically, which may use the tokens reserved by WithReserve, see
+// PriorityTaker.
+func (r *atomicLeakyBucket) TryTakeHighPriority(n int) (bool, time.Duration) {
+	return r.tryTakeNAt(n, 0, r.opts.now())
+}
+
+// tryTakeNAt attempts to take n tokens as of now, leaving at least reserve tokens in the bucket, returning how long after now you
+// should next try.
+func (r *atomicLeakyBucket) tryTakeNAt(n, reserve int, now time.Time) (bool, time.Duration) {
+	success, resetAt, remaining := r.tryTake(n, reserve, now)
+	r.opts.emitDecision(DecisionEvent{Allowed: success, Remaining: remaining, TakeAmount: n})
+	if success {
+		return true, 0
+	}
+	return false, time.Duration(resetAt - r.since(now))
+}
+
+// tryTake attempts to take n tokens as of now, leaving at least reserve tokens in the bucket, returning when to next try, in
+// nanoseconds since epoch, and the remaining tokens alongside the result.
+func (r *atomicLeakyBucket) tryTake(n, reserve int, now time.Time) (bool, int64, int) {
+	nowNanos := r.since(now)
+
+	if n <= 0 || n > r.max {
+		// the take can never succeed, so there's no time worth trying again at
+		_, tokens := r.fill(atomic.LoadInt64(&r.emptyAt), nowNanos)
+		atomic.AddInt64(&r.denied, 1)
+		return false, nowNanos, tokens
+	}
+
+	for attempt := 0; ; attempt++ {
+		emptyAt := atomic.LoadInt64(&r.emptyAt)
+		base, tokens := r.fill(emptyAt, nowNanos)
+
+		if tokens < n+reserve {
+			if base < emptyAt {
+				// time has moved backwards, so keep the bucket filling from now, it doesn't matter if another goroutine got there first
+				atomic.CompareAndSwapInt64(&r.emptyAt, emptyAt, base)
+			}
+
+			// there aren't enough tokens, so nothing is taken
+			atomic.AddInt64(&r.denied, 1)
+			return false, base + int64(n+reserve)*int64(r.rate), tokens
+		}
+
+		if atomic.CompareAndSwapInt64(&r.emptyAt, emptyAt, base+int64(n)*int64(r.rate)) {
+			atomic.AddInt64(&r.granted, 1)
+			atomic.AddInt64(&r.taken, int64(n))
+			return true, nowNanos, tokens - n
+		}
+
+		// another goroutine changed the bucket first, so try again with its state, yielding if the bucket is heavily contended
+		if attempt >= atomicLeakyBucketSpins {
+			runtime.Gosched()
+		}
+	}
+}
+
+// fill returns the bucket's tokens as of now, alongside when it was empty, which is moved forwards when the bucket is full so it
+// can't fill beyond its capacity.
+func (r *atomicLeakyBucket) fill(emptyAt, now int64) (int64, int) {
+	if full := now - int64(r.max)*int64(r.rate); emptyAt < full {
+		emptyAt = full
+	}
+
+	if emptyAt > now {
+		// time has moved backwards, which only happens when now has no monotonic clock reading, such as a wall clock time passed
+		// to TryTakeAt after the system clock was stepped back. The bucket is treated as empty as of now, rather than waiting for
+		// the clock to catch back up with emptyAt.
+		emptyAt = now
+	}
+
+	return emptyAt, int((now - emptyAt) / int64(r.rate))
+}
+
+// since returns now in nanoseconds since the bucket's epoch.
+func (r *atomicLeakyBucket) since(now time.Time) int64 {
+	return int64(now.Sub(r.epoch))
+}
+
+// Wait will block the goroutine til a ratelimit token is available. You can use context to cancel the ratelimiter.
+func (r *atomicLeakyBucket) Wait(ctx context.Context) {
+	_ = r.wait(ctx)
+}
+
+// WaitFunc is equivalent to Wait except it calls a callback when it's able to accquire a token. If you cancel the context, cb is
+// not called. This function does spawn a goroutine per invocation.
+func (r *atomicLeakyBucket) WaitFunc(ctx context.Context, cb func()) {
+	go func(ctx context.Context, cb func()) {
+		if r.wait(ctx) {
+			cb()
+		}
+	}(ctx, cb)
+}
+
+// wait keeps trying to take a token, while also sleeping the goroutine while it waits for the next attempt.
+func (r *atomicLeakyBucket) wait(ctx context.Context) bool {
+	atomic.AddInt64(&r.waiters, 1)
+	defer atomic.AddInt64(&r.waiters, -1)
+
+	for {
+		available, duration := r.TryTakeWithDuration()
+		if available {
+			return true
+		}
+		if !r.awaitNextToken(ctx, duration) {
+			return false
+		}
+	}
+}
+
+func (r *atomicLeakyBucket) awaitNextToken(ctx context.Context, duration time.Duration) bool {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// QueueLength will return how many callers are currently blocked in Wait or WaitFunc, waiting for a token.
+func (r *atomicLeakyBucket) QueueLength() int {
+	return int(atomic.LoadInt64(&r.waiters))
+}
+
+// Refund gives back the most recently taken token, the bucket is never filled beyond its capacity.
+func (r *atomicLeakyBucket) Refund() {
+	now := r.since(r.opts.now())
+	for {
+		emptyAt := atomic.LoadInt64(&r.emptyAt)
+		base, tokens := r.fill(emptyAt, now)
+		if tokens >= r.max {
+			return
+		}
+		if atomic.CompareAndSwapInt64(&r.emptyAt, emptyAt, base-int64(r.rate)) {
+			atomic.AddInt64(&r.refunded, 1)
+			return
+		}
+	}
+}
+
+// Size will return how many tokens are currently available
+func (r *atomicLeakyBucket) Size() int {
+	_, tokens := r.fill(atomic.LoadInt64(&r.emptyAt), r.since(r.opts.now()))
+	return tokens
+}
+
+// Inspect will return how many tokens are currently available, alongside when the bucket will be full again.
+func (r *atomicLeakyBucket) Inspect() LeakyBucketInspection {
+	now := r.opts.now()
+	emptyAt, tokens := r.fill(atomic.LoadInt64(&r.emptyAt), r.since(now))
+
+	resetAt := now
+	if tokens < r.max {
+		resetAt = r.epoch.Add(time.Duration(emptyAt + int64(r.max)*int64(r.rate)))
+	}
+
+	return LeakyBucketInspection{RemainingTokens: tokens, ResetAt: resetAt}
+}
+
+// DurationUntil will return how long it will be until n tokens are available in the bucket, without taking any tokens. If n tokens
+// are already available, it returns 0. ErrExceedsCapacity is returned if n is more than the bucket can ever hold.
+func (r *atomicLeakyBucket) DurationUntil(n int) (time.Duration, error) {
+	if n > r.max {
+		return 0, ErrExceedsCapacity
+	}
+
+	now := r.since(r.opts.now())
+	emptyAt, tokens := r.fill(atomic.LoadInt64(&r.emptyAt), now)
+	if tokens >= n {
+		return 0, nil
+	}
+
+	return time.Duration(emptyAt + int64(n)*int64(r.rate) - now), nil
+}
+
+// Stats will return cumulative counters describing the bucket's behaviour since it was created. The counters are read
+// individually, so they may be momentarily inconsistent with each other while the bucket is in use.
+func (r *atomicLeakyBucket) Stats() LeakyBucketStats {
+	now := r.since(r.opts.now())
+	emptyAt := atomic.LoadInt64(&r.emptyAt)
+	_, tokens := r.fill(emptyAt, now)
+
+	stats := LeakyBucketStats{
+		Granted: atomic.LoadInt64(&r.granted),
+		Denied:  atomic.LoadInt64(&r.denied),
+	}
+
+	// tokens are only ever added by fills and refunds, and removed by takes, so the fills can be worked out from the rest
+	stats.TokensFilled = int64(tokens-r.initial) + atomic.LoadInt64(&r.taken) - atomic.LoadInt64(&r.refunded)
+	if stats.TokensFilled > 0 {
+		filled := (now - emptyAt) / int64(r.rate)
+		if filled > int64(r.max) {
+			filled = int64(r.max)
+		}
+		stats.LastFillTokens = 1
+		stats.LastFillAt = r.epoch.Add(time.Duration(emptyAt + filled*int64(r.rate))).UTC()
+	}
+
+	return stats
+}
+
+// Describe will return the bucket's effective configuration
+func (r *atomicLeakyBucket) Describe() LimiterInfo {
+	return LimiterInfo{
+		Algorithm:      AlgorithmLeakyBucket,
+		Capacity:       r.max,
+		Window:         r.rate * time.Duration(r.max),
+		RefillInterval: r.rate,
+	}
+}
+
+// Snapshot serializes the bucket's tokens, alongside when it was last filled, see Snapshotter.
+func (r *atomicLeakyBucket) Snapshot() ([]byte, error) {
+	emptyAt, tokens := r.fill(atomic.LoadInt64(&r.emptyAt), r.since(r.opts.now()))
+	lastFill := r.epoch.Add(time.Duration(emptyAt + int64(tokens)*int64(r.rate))).UTC()
+
+	s := newSnapshot(r.Describe())
+	s.Tokens = tokens
+	s.LastFill = &lastFill
+	return json.Marshal(s)
+}
+
+// Restore replaces the bucket's tokens, and when it was last filled, with those serialized by Snapshot, see Snapshotter.
+func (r *atomicLeakyBucket) Restore(data []byte) error {
+	s, err := parseSnapshot(data, r.Describe(), r.opts.now())
+	if err != nil {
+		return err
+	}
+
+	lastFill := r.since(r.opts.now())
+	if s.LastFill != nil {
+		lastFill = r.since(*s.LastFill)
+	}
+
+	atomic.StoreInt64(&r.emptyAt, lastFill-int64(s.Tokens)*int64(r.rate))
+	return nil
+}
@@ -0,0 +1,83 @@
+package local_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aidenwallis/go-ratelimiting/local"
+)
+
+func TestAtomicLeakyBucket(t *testing.T) {
+	t.Parallel()
+
+	t.Run("refunds tokens", func(t *testing.T) {
+		t.Parallel()
+
+		r := local.NewAtomicLeakyBucket(2, time.Minute)
+		assertValue(t, true, r.TryTakeN(2))
+
+		r.(local.Refunder).Refund()
+		assertValue(t, 1, r.Size())
+
+		// refunds never fill the bucket beyond its capacity
+		r.(local.Refunder).Refund()
+		r.(local.Refunder).Refund()
+		assertValue(t, 2, r.Size())
+		assertValue(t, int64(0), r.Stats().TokensFilled)
+	})
+
+	t.Run("never grants more than its capacity under contention", func(t *testing.T) {
+		t.Parallel()
+
+		r := local.NewAtomicLeakyBucket(1000, time.Hour)
+		granted := make(chan int, 8)
+
+		wg := sync.WaitGroup{}
+		for i := 0; i < cap(granted); i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				n := 0
+				for j := 0; j < 500; j++ {
+					if r.TryTake() {
+						n++
+					}
+				}
+				granted <- n
+			}()
+		}
+		wg.Wait()
+		close(granted)
+
+		total := 0
+		for n := range granted {
+			total += n
+		}
+		assertValue(t, 1000, total)
+		assertValue(t, 0, r.Size())
+	})
+}
+
+func BenchmarkLeakyBucket_TryTake(b *testing.B) {
+	constructors := map[string]func(int, time.Duration, ...local.Option) local.LeakyBucket{
+		"mutex":  local.NewLeakyBucket,
+		"atomic": local.NewAtomicLeakyBucket,
+	}
+
+	for name, newLeakyBucket := range constructors {
+		newLeakyBucket := newLeakyBucket
+
+		b.Run(name, func(b *testing.B) {
+			r := newLeakyBucket(1_000_000, time.Second)
+
+			b.SetParallelism(16)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					r.TryTake()
+				}
+			})
+		})
+	}
+}
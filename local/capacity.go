@@ -0,0 +1,21 @@
+package local
+
+// PerInstanceCapacity calculates a fair share of globalCapacity for a single instance, when the capacity is split evenly across
+// instanceCount instances. This is useful when local ratelimiters are used as a fallback for a distributed ratelimiter.
+//
+// The share is rounded down so that the instances combined never exceed globalCapacity, but every instance is given at least 1
+// token if globalCapacity is more than 0, so no instance is starved entirely. If instanceCount is less than 1, it's treated as 1.
+func PerInstanceCapacity(globalCapacity, instanceCount int) int {
+	if globalCapacity <= 0 {
+		return 0
+	}
+	if instanceCount < 1 {
+		instanceCount = 1
+	}
+
+	capacity := globalCapacity / instanceCount
+	if capacity < 1 {
+		return 1
+	}
+	return capacity
+}
@@ -0,0 +1,30 @@
+package local_test
+
+import (
+	"testing"
+
+	"github.com/aidenwallis/go-ratelimiting/local"
+)
+
+func TestPerInstanceCapacity(t *testing.T) {
+	testCases := map[string]struct {
+		globalCapacity int
+		instanceCount  int
+		expected       int
+	}{
+		"divides evenly":         {globalCapacity: 100, instanceCount: 4, expected: 25},
+		"rounds down":            {globalCapacity: 100, instanceCount: 3, expected: 33},
+		"never starves":          {globalCapacity: 2, instanceCount: 5, expected: 1},
+		"single instance":        {globalCapacity: 100, instanceCount: 1, expected: 100},
+		"invalid instance count": {globalCapacity: 100, instanceCount: 0, expected: 100},
+		"no capacity":            {globalCapacity: 0, instanceCount: 3, expected: 0},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			assertValue(t, testCase.expected, local.PerInstanceCapacity(testCase.globalCapacity, testCase.instanceCount))
+		})
+	}
+}
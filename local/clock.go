@@ -0,0 +1,71 @@
+package local
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Clock is a source of the current time for the ratelimiters, see WithClock.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+}
+
+// TickerClock is a Clock which reads the time once per tick from a single background goroutine, rather than on every call. Sharing
+// one between many ratelimiters, such as every ratelimiter created by a Registry's factory, means thousands of ratelimiters that are
+// each called frequently don't each read the system clock on every call.
+//
+// Its time lags behind the system clock by up to its resolution, so ratelimiters using it fill, and expire tokens, up to one
+// resolution late, and callers in Wait may wake up to one resolution after a token is available. A resolution well below the
+// ratelimiters' refill interval keeps this negligible.
+type TickerClock struct {
+	// closed is set once the clock is closed, it's accessed atomically
+	closed    int32
+	now       atomic.Value
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+var _ Clock = (*TickerClock)(nil)
+
+// NewTickerClock creates a clock which reads the time every resolution. Close must be called to stop its goroutine once the
+// ratelimiters using it are no longer used.
+func NewTickerClock(resolution time.Duration) *TickerClock {
+	c := &TickerClock{stop: make(chan struct{})}
+	c.now.Store(time.Now())
+	go c.tick(resolution)
+	return c
+}
+
+// Now returns the time as of the most recent tick.
+func (c *TickerClock) Now() time.Time {
+	if atomic.LoadInt32(&c.closed) == 1 {
+		return time.Now()
+	}
+	return c.now.Load().(time.Time)
+}
+
+// Close stops the background goroutine, after which Now reads the system clock on every call, so the ratelimiters using it keep
+// working.
+func (c *TickerClock) Close() {
+	c.closeOnce.Do(func() {
+		atomic.StoreInt32(&c.closed, 1)
+		close(c.stop)
+	})
+}
+
+// tick stores the time every resolution until the clock is closed.
+func (c *TickerClock) tick(resolution time.Duration) {
+	ticker := time.NewTicker(resolution)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			c.now.Store(time.Now())
+		}
+	}
+}
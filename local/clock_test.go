@@ -0,0 +1,132 @@
+package local_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aidenwallis/go-ratelimiting/local"
+)
+
+func TestTickerClock(t *testing.T) {
+	t.Parallel() // these tests run in parallel as they involve sleeping
+
+	t.Run("reads the time every tick", func(t *testing.T) {
+		t.Parallel()
+
+		clock := local.NewTickerClock(time.Millisecond * 10)
+		defer clock.Close()
+
+		first := clock.Now()
+		time.Sleep(time.Millisecond * 50)
+		assertValue(t, true, clock.Now().After(first))
+	})
+
+	t.Run("reads the system clock once closed", func(t *testing.T) {
+		t.Parallel()
+
+		clock := local.NewTickerClock(time.Hour)
+		clock.Close()
+
+		first := clock.Now()
+		time.Sleep(time.Millisecond)
+		assertValue(t, true, clock.Now().After(first))
+	})
+
+	t.Run("is shared by a registry's ratelimiters", func(t *testing.T) {
+		t.Parallel()
+
+		clock := &manualClock{now: time.Now()}
+		r := local.NewRegistry(func(string) local.RegistryLimiter {
+			return local.NewLeakyBucket(1, time.Minute, local.WithClock(clock))
+		}, 0, 0)
+
+		assertValue(t, true, r.Take("a"))
+		assertValue(t, true, r.Take("b"))
+		assertValue(t, false, r.Take("a"))
+		assertValue(t, false, r.Take("b"))
+
+		// every ratelimiter fills from the shared clock, rather than the system clock
+		clock.advance(time.Minute)
+		assertValue(t, true, r.Take("a"))
+		assertValue(t, true, r.Take("b"))
+	})
+}
+
+func TestWithClock(t *testing.T) {
+	t.Parallel()
+
+	constructors := map[string]func(int, time.Duration, ...local.Option) local.Limiter{
+		"leaky bucket": func(tokens int, window time.Duration, opts ...local.Option) local.Limiter {
+			return local.NewLeakyBucket(tokens, window, opts...)
+		},
+		"atomic leaky bucket": func(tokens int, window time.Duration, opts ...local.Option) local.Limiter {
+			return local.NewAtomicLeakyBucket(tokens, window, opts...)
+		},
+		"sliding window": func(capacity int, window time.Duration, opts ...local.Option) local.Limiter {
+			r, _ := local.NewSlidingWindow(capacity, window, opts...)
+			return r
+		},
+		"composite": func(tokens int, window time.Duration, opts ...local.Option) local.Limiter {
+			// the window is roomy enough that only the bucket limits the takes
+			r, _ := local.NewComposite(tokens, window, tokens*10, window, opts...)
+			return r
+		},
+	}
+
+	for name, constructor := range constructors {
+		constructor := constructor
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			clock := &manualClock{now: time.Now()}
+			r := constructor(2, time.Minute, local.WithClock(clock))
+			assertValue(t, true, r.TryTake())
+			assertValue(t, true, r.TryTake())
+			assertValue(t, false, r.TryTake())
+
+			// the system clock isn't read, so nothing is filled until the clock moves
+			clock.advance(time.Second * 29)
+			assertValue(t, false, r.TryTake())
+
+			clock.advance(time.Second * 31)
+			assertValue(t, true, r.TryTake())
+		})
+	}
+}
+
+func TestWithClock_MinInterval(t *testing.T) {
+	t.Parallel()
+
+	clock := &manualClock{now: time.Now()}
+	r, err := local.NewMinInterval(time.Minute, local.WithClock(clock))
+	assertNoError(t, err)
+	assertValue(t, true, r.TryTake())
+	assertValue(t, false, r.TryTake())
+
+	// the system clock isn't read, so no token is available until the clock moves
+	clock.advance(time.Second * 59)
+	assertValue(t, false, r.TryTake())
+
+	clock.advance(time.Second)
+	assertValue(t, true, r.TryTake())
+}
+
+// manualClock only moves when it's advanced
+type manualClock struct {
+	m   sync.Mutex
+	now time.Time
+}
+
+func (c *manualClock) Now() time.Time {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.now
+}
+
+func (c *manualClock) advance(d time.Duration) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.now = c.now.Add(d)
+}
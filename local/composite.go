@@ -0,0 +1,184 @@
+package local
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// Composite provides an interface for the composite ratelimiter.
+//
+// The composite ratelimiter applies a leaky bucket and a sliding window together, which is useful for quotas such as "no faster
+// than 10 per second sustained, and no more than 100 in any 60 seconds". A token is only taken when both allow it: both are checked
+// under their locks before either is changed, so a token is never taken from one and then refunded because the other denied it.
+type Composite interface {
+	// Wait will block the goroutine til a ratelimit token is available. You can use context to cancel the ratelimiter.
+	Wait(ctx context.Context)
+
+	// QueueLength will return how many callers are currently blocked in Wait, waiting for a token.
+	QueueLength() int
+
+	// TryTake will attempt to accquire a token, it will return a boolean indicating whether it was able to accquire a token or not.
+	TryTake() bool
+
+	// TryTakeWithDuration will attempt to accquire a token, it will return a boolean indicating whether it was able to accquire a
+	// token or not, and a duration for when you should next try.
+	TryTakeWithDuration() (bool, time.Duration)
+
+	// TryTakeAt is equivalent to TryTakeWithDuration, except it uses now as the current time rather than time.Now(), which lets
+	// tests and simulations step time precisely without sleeping. If now moves backwards, as a wall clock time can when the system
+	// clock is stepped back, no extra tokens are granted, and the ratelimiter carries on from the earlier time rather than waiting
+	// for the clock to catch back up.
+	TryTakeAt(now time.Time) (bool, time.Duration)
+
+	// TryTakeWithResetAt is equivalent to TryTakeWithDuration, except it returns the absolute time at which you should next try,
+	// which avoids skew when the result is passed through layers that add their own latency. On success, this is the current time.
+	TryTakeWithResetAt() (bool, time.Time)
+
+	// Describe will return the composite's effective configuration, the leaky bucket and sliding window are described in Components.
+	Describe() LimiterInfo
+}
+
+type composite struct {
+	// waiters is how many callers are blocked waiting for a token, it's accessed atomically so it's kept first for alignment
+	waiters int64
+	// bucket smooths the rate tokens are taken at
+	bucket *leakyBucket
+	// window caps how many tokens may be taken in any window
+	window *slidingWindow
+	// opts holds the optional behaviour configured for the ratelimiter
+	opts *options
+}
+
+// NewComposite creates a new composite ratelimiter, made of a leaky bucket allowing bucketTokens per bucketWindow, and a sliding
+// window allowing windowCapacity tokens per window. See the Composite interface for more info about what this ratelimiter does.
+func NewComposite(bucketTokens int, bucketWindow time.Duration, windowCapacity int, window time.Duration, opts ...Option) (Composite, error) {
+	if bucketTokens <= 0 || windowCapacity <= 0 {
+		return nil, ErrCapacity
+	}
+	if bucketWindow <= 0 || window <= 0 {
+		return nil, ErrDuration
+	}
+
+	o := newOptions(opts)
+	bucket := NewLeakyBucket(bucketTokens, bucketWindow).(*leakyBucket)
+	bucket.tokens = o.startingTokens(bucketTokens)
+	bucket.lastFill = o.now()
+
+	return &composite{
+		bucket: bucket,
+		window: &slidingWindow{
+			capacity: windowCapacity,
+			duration: window,
+			window:   []time.Time{},
+			opts:     newOptions(nil),
+		},
+		opts: o,
+	}, nil
+}
+
+// TryTake will attempt to accquire a token, it will return a boolean indicating whether it was able to accquire a token or not.
+func (r *composite) TryTake() bool {
+	resp, _ := r.TryTakeWithDuration()
+	return resp
+}
+
+// TryTakeWithDuration will attempt to accquire a token, it will return a boolean indicating whether it was able to accquire a
+// token or not, and a duration for when you should next try.
+func (r *composite) TryTakeWithDuration() (bool, time.Duration) {
+	return r.TryTakeAt(r.opts.now())
+}
+
+// TryTakeAt is equivalent to TryTakeWithDuration, except it uses now as the current time rather than time.Now().
+func (r *composite) TryTakeAt(now time.Time) (bool, time.Duration) {
+	success, resetAt := r.tryTakeAt(now)
+	if success {
+		return true, 0
+	}
+	return false, resetAt.Sub(now)
+}
+
+// TryTakeWithResetAt is equivalent to TryTakeWithDuration, except it returns the absolute time at which you should next try,
+// which avoids skew when the result is passed through layers that add their own latency. On success, this is the current time.
+func (r *composite) TryTakeWithResetAt() (bool, time.Time) {
+	return r.tryTakeAt(r.opts.now())
+}
+
+// tryTakeAt attempts to take a token as of now, returning when to next try.
+func (r *composite) tryTakeAt(now time.Time) (bool, time.Time) {
+	success, resetAt, remaining := r.tryTake(now)
+	r.opts.emitDecision(DecisionEvent{Allowed: success, Remaining: remaining, TakeAmount: 1})
+	return success, resetAt
+}
+
+// tryTake checks both ratelimiters under their locks as of now, and only takes a token from them if both have one available. It
+// returns when to next try, and the lowest remaining capacity of the two alongside the result.
+func (r *composite) tryTake(now time.Time) (bool, time.Time, int) {
+	// always lock in the same order, so concurrent callers can't deadlock
+	r.bucket.m.Lock()
+	defer r.bucket.m.Unlock()
+	r.window.m.Lock()
+	defer r.window.m.Unlock()
+
+	r.bucket.unsafeFillAt(now)
+	r.window.cleanAt(now)
+
+	allowed := true
+	resetAt := now
+
+	if r.bucket.tokens < 1 {
+		allowed = false
+		resetAt = r.bucket.lastFill.Add(r.bucket.rate)
+	}
+
+	if len(r.window.window) >= r.window.capacity {
+		allowed = false
+		if r.window.window[0].After(resetAt) {
+			resetAt = r.window.window[0]
+		}
+	}
+
+	if allowed {
+		r.bucket.tokens--
+		r.window.window = append(r.window.window, now.Add(r.window.duration))
+	}
+
+	remaining := r.window.capacity - len(r.window.window)
+	if r.bucket.tokens < remaining {
+		remaining = r.bucket.tokens
+	}
+
+	return allowed, resetAt, remaining
+}
+
+// Refund gives back the most recently taken token to both the leaky bucket and the sliding window.
+func (r *composite) Refund() {
+	r.bucket.Refund()
+	r.window.Refund()
+}
+
+// Wait will block the goroutine til a ratelimit token is available. You can use context to cancel the ratelimiter.
+func (r *composite) Wait(ctx context.Context) {
+	atomic.AddInt64(&r.waiters, 1)
+	defer atomic.AddInt64(&r.waiters, -1)
+
+	for {
+		available, duration := r.TryTakeWithDuration()
+		if available || !r.bucket.awaitNextToken(ctx, duration) {
+			return
+		}
+	}
+}
+
+// QueueLength will return how many callers are currently blocked in Wait, waiting for a token.
+func (r *composite) QueueLength() int {
+	return int(atomic.LoadInt64(&r.waiters))
+}
+
+// Describe will return the composite's effective configuration, the leaky bucket and sliding window are described in Components.
+func (r *composite) Describe() LimiterInfo {
+	return LimiterInfo{
+		Algorithm:  AlgorithmComposite,
+		Components: []LimiterInfo{r.bucket.Describe(), r.window.Describe()},
+	}
+}
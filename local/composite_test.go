@@ -0,0 +1,124 @@
+package local_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aidenwallis/go-ratelimiting/local"
+)
+
+func TestComposite(t *testing.T) {
+	t.Parallel() // these tests run in parallel as they involve blocking calls
+
+	t.Run("validates arguments correctly", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := local.NewComposite(0, time.Second, 1, time.Second)
+		assertValue(t, local.ErrCapacity.Error(), err.Error())
+
+		_, err = local.NewComposite(1, time.Second, 1, 0)
+		assertValue(t, local.ErrDuration.Error(), err.Error())
+	})
+
+	t.Run("only takes when both allow", func(t *testing.T) {
+		t.Parallel()
+
+		// the bucket fills every 50ms, but only 3 tokens may be taken each second
+		r, err := local.NewComposite(2, time.Millisecond*100, 3, time.Second)
+		assertNoError(t, err)
+
+		assertValue(t, true, r.TryTake())
+		assertValue(t, true, r.TryTake())
+
+		// the bucket is empty
+		success, duration := r.TryTakeWithDuration()
+		assertValue(t, false, success)
+		assertValue(t, true, duration > 0 && duration <= time.Millisecond*50)
+
+		time.Sleep(time.Millisecond * 110)
+		assertValue(t, true, r.TryTake())
+
+		// the bucket has refilled, but the window is full
+		time.Sleep(time.Millisecond * 110)
+		success, duration = r.TryTakeWithDuration()
+		assertValue(t, false, success)
+		assertValue(t, true, duration > time.Millisecond*500)
+	})
+
+	t.Run("steps time with TryTakeAt", func(t *testing.T) {
+		t.Parallel()
+
+		r, err := local.NewComposite(1, time.Second, 2, time.Minute)
+		assertNoError(t, err)
+		now := time.Now()
+
+		success, _ := r.TryTakeAt(now)
+		assertValue(t, true, success)
+
+		// the bucket is empty
+		success, duration := r.TryTakeAt(now)
+		assertValue(t, false, success)
+		assertValue(t, time.Second, duration)
+
+		success, _ = r.TryTakeAt(now.Add(time.Second))
+		assertValue(t, true, success)
+
+		// the bucket has refilled, but the window is full until the first token expires
+		success, duration = r.TryTakeAt(now.Add(time.Second * 2))
+		assertValue(t, false, success)
+		assertValue(t, time.Second*58, duration)
+	})
+
+	t.Run("starts the bucket with initial tokens", func(t *testing.T) {
+		t.Parallel()
+
+		r, err := local.NewComposite(5, time.Minute, 5, time.Minute, local.WithInitialTokens(0))
+		assertNoError(t, err)
+		assertValue(t, false, r.TryTake())
+	})
+
+	t.Run("gives absolute reset time of the later limiter", func(t *testing.T) {
+		t.Parallel()
+
+		r, _ := local.NewComposite(10, time.Millisecond*100, 1, time.Second)
+		start := time.Now()
+		assertValue(t, true, r.TryTake())
+
+		// the bucket has tokens, but the window is full until a second from now
+		success, resetAt := r.TryTakeWithResetAt()
+		assertValue(t, false, success)
+
+		delay := resetAt.Sub(start)
+		assertValue(t, true, delay >= time.Millisecond*950 && delay <= time.Millisecond*1050)
+	})
+
+	t.Run("blocks goroutine until token is available", func(t *testing.T) {
+		t.Parallel()
+
+		r, _ := local.NewComposite(1, time.Millisecond*100, 10, time.Second)
+		assertValue(t, true, r.TryTake())
+
+		start := time.Now()
+		r.Wait(context.Background())
+		duration := time.Since(start)
+		assertValue(t, true, duration >= time.Millisecond*90 && duration <= time.Millisecond*150)
+		assertValue(t, 0, r.QueueLength())
+	})
+
+	t.Run("calls decision hook", func(t *testing.T) {
+		t.Parallel()
+
+		events := []local.DecisionEvent{}
+		r, _ := local.NewComposite(2, time.Second, 1, time.Second, local.WithOnDecision(func(e local.DecisionEvent) {
+			events = append(events, e)
+		}))
+
+		r.TryTake()
+		r.TryTake()
+
+		assertValue(t, 2, len(events))
+		assertValue(t, local.DecisionEvent{Allowed: true, Remaining: 0, TakeAmount: 1}, events[0])
+		assertValue(t, local.DecisionEvent{Allowed: false, Remaining: 0, TakeAmount: 1}, events[1])
+	})
+}
@@ -0,0 +1,47 @@
+package local
+
+// Limiter is the minimal interface of a ratelimiter that tokens can be taken from one at a time, it's implemented by LeakyBucket,
+// SlidingWindow and Composite, and is simple to implement around other ratelimiters, such as a Redis bucket shared by a cluster.
+type Limiter interface {
+	// TryTake will attempt to accquire a token, it will return a boolean indicating whether it was able to accquire a token or not.
+	TryTake() bool
+}
+
+// Refunder is optionally implemented by a Limiter that can give back a token which was taken, but then not used. The ratelimiters
+// returned by NewLeakyBucket, NewSlidingWindow, NewComposite and NewMinInterval all implement it.
+type Refunder interface {
+	// Refund gives back the most recently taken token.
+	Refund()
+}
+
+type globalCap struct {
+	inner  Limiter
+	global Limiter
+}
+
+// GlobalCap wraps inner, which is typically one key's ratelimiter, so that a token must also be taken from global, which is shared
+// by every key. This provides a ceiling that no combination of keys can exceed, without wiring both checks up everywhere.
+//
+// Tokens are taken from global first, and only on success from inner. If inner denies the request, the global token is refunded
+// when global implements Refunder, otherwise it's consumed. GlobalCap allocates nothing but the wrapper, so it's fine to wrap each
+// key's ratelimiter with the same global one on every request.
+func GlobalCap(inner, global Limiter) Limiter {
+	return &globalCap{inner: inner, global: global}
+}
+
+// TryTake will attempt to accquire a token from both the global and inner ratelimiters, it will return a boolean indicating whether
+// it was able to accquire a token or not.
+func (r *globalCap) TryTake() bool {
+	if !r.global.TryTake() {
+		return false
+	}
+
+	if r.inner.TryTake() {
+		return true
+	}
+
+	if refunder, ok := r.global.(Refunder); ok {
+		refunder.Refund()
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+package local_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aidenwallis/go-ratelimiting/local"
+)
+
+func TestGlobalCap(t *testing.T) {
+	t.Run("caps every key", func(t *testing.T) {
+		global := local.NewLeakyBucket(3, time.Minute)
+		a := local.NewLeakyBucket(2, time.Minute)
+		b := local.NewLeakyBucket(2, time.Minute)
+
+		assertValue(t, true, local.GlobalCap(a, global).TryTake())
+		assertValue(t, true, local.GlobalCap(a, global).TryTake())
+		assertValue(t, true, local.GlobalCap(b, global).TryTake())
+
+		// b has a token left, but the global limit has been reached
+		assertValue(t, false, local.GlobalCap(b, global).TryTake())
+		assertValue(t, 1, b.Size())
+	})
+
+	t.Run("refunds the global token when the key denies", func(t *testing.T) {
+		global, _ := local.NewSlidingWindow(2, time.Minute)
+		a, _ := local.NewSlidingWindow(1, time.Minute)
+
+		assertValue(t, true, local.GlobalCap(a, global).TryTake())
+		assertValue(t, false, local.GlobalCap(a, global).TryTake())
+		assertValue(t, 1, global.Size())
+	})
+
+	t.Run("consumes the global token without a refunder", func(t *testing.T) {
+		global := &countingLimiter{}
+		a := local.NewLeakyBucket(1, time.Minute)
+
+		assertValue(t, true, local.GlobalCap(a, global).TryTake())
+		assertValue(t, false, local.GlobalCap(a, global).TryTake())
+		assertValue(t, 2, global.taken)
+	})
+}
+
+// countingLimiter always allows, counting how many tokens were taken
+type countingLimiter struct {
+	taken int
+}
+
+func (l *countingLimiter) TryTake() bool {
+	l.taken++
+	return true
+}
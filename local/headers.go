@@ -0,0 +1,16 @@
+package local
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// ToHeaders sets the X-RateLimit-Limit, X-RateLimit-Remaining and X-RateLimit-Reset headers on h from the inspection, using the
+// same conventions as the httpratelimit middleware. limit is the bucket's capacity, such as from Describe().Capacity.
+func (i LeakyBucketInspection) ToHeaders(h http.Header, limit int) {
+	h.Set("X-RateLimit-Limit", strconv.Itoa(limit))
+	h.Set("X-RateLimit-Remaining", strconv.Itoa(i.RemainingTokens))
+	if !i.ResetAt.IsZero() {
+		h.Set("X-RateLimit-Reset", strconv.FormatInt(i.ResetAt.Unix(), 10))
+	}
+}
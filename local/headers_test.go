@@ -0,0 +1,20 @@
+package local_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aidenwallis/go-ratelimiting/local"
+)
+
+func TestLeakyBucketInspection_ToHeaders(t *testing.T) {
+	t.Parallel()
+
+	h := http.Header{}
+	local.LeakyBucketInspection{RemainingTokens: 3, ResetAt: time.Unix(1700000000, 0)}.ToHeaders(h, 10)
+
+	assertValue(t, "10", h.Get("X-RateLimit-Limit"))
+	assertValue(t, "3", h.Get("X-RateLimit-Remaining"))
+	assertValue(t, "1700000000", h.Get("X-RateLimit-Reset"))
+}
@@ -0,0 +1,34 @@
+package local
+
+import "time"
+
+// Algorithm names reported in LimiterInfo.
+const (
+	AlgorithmLeakyBucket   = "leaky_bucket"
+	AlgorithmSlidingWindow = "sliding_window"
+	AlgorithmTrafficShaper = "traffic_shaper"
+	AlgorithmComposite     = "composite"
+	AlgorithmMinInterval   = "min_interval"
+)
+
+// LimiterInfo describes a ratelimiter's effective configuration, it's JSON serializable so it can be logged, or rendered on debug
+// endpoints and dashboards.
+type LimiterInfo struct {
+	// Algorithm is the name of the ratelimiting algorithm, such as AlgorithmLeakyBucket
+	Algorithm string `json:"algorithm"`
+
+	// Capacity is the max amount of tokens that may be taken per Window
+	Capacity int `json:"capacity"`
+
+	// Window is the duration Capacity applies to
+	Window time.Duration `json:"window"`
+
+	// RefillInterval is how often a single token is added back, for ratelimiters that refill at a constant rate
+	RefillInterval time.Duration `json:"refill_interval,omitempty"`
+
+	// QueueDepth is the max amount of requests that may be waiting, for ratelimiters with a bounded queue
+	QueueDepth int `json:"queue_depth,omitempty"`
+
+	// Components describes the ratelimiters that make up a composite ratelimiter
+	Components []LimiterInfo `json:"components,omitempty"`
+}
@@ -0,0 +1,56 @@
+package local_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aidenwallis/go-ratelimiting/local"
+)
+
+func TestDescribe(t *testing.T) {
+	leakyBucket := local.NewLeakyBucket(10, time.Second)
+	assertInfo(t, local.LimiterInfo{
+		Algorithm:      local.AlgorithmLeakyBucket,
+		Capacity:       10,
+		Window:         time.Second,
+		RefillInterval: time.Millisecond * 100,
+	}, leakyBucket.Describe())
+
+	slidingWindow, err := local.NewSlidingWindow(5, time.Minute)
+	assertNoError(t, err)
+	assertInfo(t, local.LimiterInfo{
+		Algorithm: local.AlgorithmSlidingWindow,
+		Capacity:  5,
+		Window:    time.Minute,
+	}, slidingWindow.Describe())
+
+	trafficShaper, err := local.NewTrafficShaper(10, time.Second, 3)
+	assertNoError(t, err)
+	assertInfo(t, local.LimiterInfo{
+		Algorithm:      local.AlgorithmTrafficShaper,
+		Capacity:       10,
+		Window:         time.Second,
+		RefillInterval: time.Millisecond * 100,
+		QueueDepth:     3,
+	}, trafficShaper.Describe())
+
+	composite, err := local.NewComposite(10, time.Second, 5, time.Minute)
+	assertNoError(t, err)
+	info := composite.Describe()
+	assertValue(t, local.AlgorithmComposite, info.Algorithm)
+	assertValue(t, 2, len(info.Components))
+	assertInfo(t, leakyBucket.Describe(), info.Components[0])
+	assertInfo(t, slidingWindow.Describe(), info.Components[1])
+
+	out, err := json.Marshal(slidingWindow.Describe())
+	assertNoError(t, err)
+	assertValue(t, `{"algorithm":"sliding_window","capacity":5,"window":60000000000}`, string(out))
+}
+
+func assertInfo(t *testing.T, expected, actualValue local.LimiterInfo) {
+	if !reflect.DeepEqual(expected, actualValue) {
+		t.Errorf("expected value %+v but got %+v", expected, actualValue)
+	}
+}
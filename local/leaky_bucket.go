@@ -2,11 +2,17 @@ package local
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"math"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// ErrExceedsCapacity is returned when more tokens are requested than the bucket could ever hold.
+var ErrExceedsCapacity = errors.New("requested tokens exceed maximum capacity")
+
 // LeakyBucket is a ratelimiter that fills a given bucket at a constant rate you define (calculated based on your window duration, and the max tokens)
 // that may exist in the window at any given time.
 //
@@ -23,57 +29,204 @@ type LeakyBucket interface {
 	Wait(ctx context.Context)
 
 	// WaitFunc is equivalent to Wait except it calls a callback when it's able to accquire a token. Iif you cancel the context, cb is not called. This
-	// function does spawn a goroutine per invocation. If you want something more efficient, consider writing your own implementation using TryTakeWithDuration()
+	// function does spawn a goroutine per invocation. If you want something more efficient, consider a Scheduler, or writing your own implementation using TryTakeWithDuration()
 	WaitFunc(ctx context.Context, cb func())
 
+	// QueueLength will return how many callers are currently blocked in Wait or WaitFunc, waiting for a token. This is useful for
+	// shedding load when the queue is already deep.
+	QueueLength() int
+
 	// Size will return how many tokens are currently available
 	Size() int
 
+	// Inspect will return how many tokens are currently available, alongside when the bucket will be full again. Both are read
+	// under the same lock, so they're consistent with each other, which is useful for rendering a countdown.
+	Inspect() LeakyBucketInspection
+
 	// Take will attempt to accquire a token, it will return a boolean indicating whether it was able to accquire a token or not.
 	TryTake() bool
 
 	// Take will attempt to accquire a token, it will return a boolean indicating whether it was able to accquire a token or not,
 	// and a duration for when you should next try.
 	TryTakeWithDuration() (bool, time.Duration)
+
+	// TryTakeAt is equivalent to TryTakeWithDuration, except it uses now as the current time rather than time.Now(), which lets
+	// tests and simulations step time precisely without sleeping. If now moves backwards, as a wall clock time can when the system
+	// clock is stepped back, no extra tokens are granted, and the ratelimiter carries on from the earlier time rather than waiting
+	// for the clock to catch back up.
+	TryTakeAt(now time.Time) (bool, time.Duration)
+
+	// TryTakeWithResetAt is equivalent to TryTakeWithDuration, except it returns the absolute time at which you should next try,
+	// which avoids skew when the result is passed through layers that add their own latency. On success, this is the current time.
+	TryTakeWithResetAt() (bool, time.Time)
+
+	// TryTakeN will attempt to accquire n tokens atomically, either all tokens are taken, or none are. Requesting fewer than 1 token,
+	// or more tokens than the bucket can hold, will never succeed.
+	TryTakeN(n int) bool
+
+	// TryTakeNWithDuration is equivalent to TryTakeN, except it also returns a duration for when you should next try, which is 0 when n
+	// can never succeed.
+	TryTakeNWithDuration(n int) (bool, time.Duration)
+
+	// DurationUntil will return how long it will be until n tokens are available in the bucket, without taking any tokens. If n tokens
+	// are already available, it returns 0. ErrExceedsCapacity is returned if n is more than the bucket can ever hold.
+	DurationUntil(n int) (time.Duration, error)
+
+	// Stats will return cumulative counters describing the bucket's behaviour since it was created, which is useful for graphing
+	// the ratelimiter without external instrumentation.
+	Stats() LeakyBucketStats
+
+	// Describe will return the bucket's effective configuration
+	Describe() LimiterInfo
+}
+
+// PriorityTaker is optionally implemented by a ratelimiter that can hold tokens back for high-priority traffic, see WithReserve. The
+// ratelimiters returned by NewLeakyBucket, NewAtomicLeakyBucket and NewTickingLeakyBucket all implement it.
+type PriorityTaker interface {
+	// TryTakeHighPriority will attempt to accquire n tokens atomically, which may use the reserved tokens that normal takes have to
+	// leave in the bucket. It returns whether the tokens were taken, and a duration for when you should next try.
+	TryTakeHighPriority(n int) (bool, time.Duration)
+}
+
+// LeakyBucketInspection describes a leaky bucket's current state, it's returned by LeakyBucket.Inspect().
+type LeakyBucketInspection struct {
+	// RemainingTokens is how many tokens are currently available
+	RemainingTokens int
+
+	// ResetAt is the time at which the bucket will be fully refilled, if nothing else is taken. If the bucket is already full, this
+	// is the current time.
+	ResetAt time.Time
+}
+
+// LeakyBucketStats describes a leaky bucket's behaviour since it was created.
+type LeakyBucketStats struct {
+	// TokensFilled is the total amount of tokens added back to the bucket by fills
+	TokensFilled int64
+
+	// LastFillTokens is how many tokens were added by the most recent fill that added any tokens
+	LastFillTokens int
+
+	// LastFillAt is when the most recent fill that added any tokens happened
+	LastFillAt time.Time
+
+	// Granted is how many attempts to take tokens succeeded
+	Granted int64
+
+	// Denied is how many attempts to take tokens were rejected
+	Denied int64
 }
 
 type leakyBucket struct {
+	// waiters is how many callers are blocked waiting for a token, it's accessed atomically so it's kept first for alignment
+	waiters  int64
 	max      int
 	tokens   int
 	rate     time.Duration
 	lastFill time.Time
 	m        sync.Mutex
+	opts     *options
+	stats    LeakyBucketStats
+	// ticking is true while a background goroutine fills the bucket, see NewTickingLeakyBucket, and tick is signalled on every fill
+	ticking bool
+	tick    *sync.Cond
 }
 
 // NewLeakyBucket creates a new leaky bucket ratelimiter. See the LeakyBucket interface for more info about what this ratelimiter does.
-func NewLeakyBucket(tokensPerWindow int, window time.Duration) LeakyBucket {
+//
+// New buckets start full, as the Redis leaky bucket does for a missing key, use WithInitialTokens to start with fewer tokens.
+func NewLeakyBucket(tokensPerWindow int, window time.Duration, opts ...Option) LeakyBucket {
 	tokenRate := window / time.Duration(tokensPerWindow)
+	o := newOptions(opts)
 
 	return &leakyBucket{
-		tokens:   tokensPerWindow,
-		lastFill: time.Now().UTC(),
+		tokens:   o.startingTokens(tokensPerWindow),
+		lastFill: o.now(),
 		max:      tokensPerWindow,
 		rate:     tokenRate,
+		opts:     o,
 	}
 }
 
 // TryTakeWithDuration will attempt to accquire a ratelimit window, it will return a boolean indicating whether it was able to accquire a token or not,
 // and a duration for when you should next try.
 func (r *leakyBucket) TryTakeWithDuration() (bool, time.Duration) {
+	return r.TryTakeAt(r.opts.now())
+}
+
+// TryTakeAt is equivalent to TryTakeWithDuration, except it uses now as the current time rather than time.Now().
+func (r *leakyBucket) TryTakeAt(now time.Time) (bool, time.Duration) {
+	return r.tryTakeNAt(1, r.opts.reserve, now)
+}
+
+// TryTakeWithResetAt is equivalent to TryTakeWithDuration, except it returns the absolute time at which you should next try,
+// which avoids skew when the result is passed through layers that add their own latency. On success, this is the current time.
+func (r *leakyBucket) TryTakeWithResetAt() (bool, time.Time) {
+	success, resetAt, remaining := r.tryTake(1, r.opts.reserve, r.opts.now())
+	r.opts.emitDecision(DecisionEvent{Allowed: success, Remaining: remaining, TakeAmount: 1})
+	return success, resetAt
+}
+
+// TryTakeN will attempt to accquire n tokens atomically, either all tokens are taken, or none are. Requesting fewer than 1 token,
+// or more tokens than the bucket can hold, will never succeed.
+func (r *leakyBucket) TryTakeN(n int) bool {
+	resp, _ := r.TryTakeNWithDuration(n)
+	return resp
+}
+
+// TryTakeNWithDuration is equivalent to TryTakeN, except it also returns a duration for when you should next try, which is 0 when n
+// can never succeed.
+func (r *leakyBucket) TryTakeNWithDuration(n int) (bool, time.Duration) {
+	return r.tryTakeNAt(n, r.opts.reserve, r.opts.now())
+}
+
+// TryTakeHighPriority will attempt to accquire n tokens atomically, which may use the tokens reserved by WithReserve, see
+// PriorityTaker.
+func (r *leakyBucket) TryTakeHighPriority(n int) (bool, time.Duration) {
+	return r.tryTakeNAt(n, 0, r.opts.now())
+}
+
+// tryTakeNAt attempts to take n tokens as of now, leaving at least reserve tokens in the bucket, returning how long after now you
+// should next try.
+func (r *leakyBucket) tryTakeNAt(n, reserve int, now time.Time) (bool, time.Duration) {
+	success, resetAt, remaining := r.tryTake(n, reserve, now)
+	r.opts.emitDecision(DecisionEvent{Allowed: success, Remaining: remaining, TakeAmount: n})
+	if success {
+		return true, 0
+	}
+	return false, resetAt.Sub(now)
+}
+
+// tryTake attempts to take n tokens under the lock as of now, leaving at least reserve tokens in the bucket, returning when to
+// next try and the remaining tokens alongside the result.
+func (r *leakyBucket) tryTake(n, reserve int, now time.Time) (bool, time.Time, int) {
 	r.m.Lock()
 	defer r.m.Unlock()
+	return r.unsafeTryTake(n, reserve, now)
+}
 
-	r.unsafeFill()
+// unsafeTryTake is equivalent to tryTake, but is not thread safe.
+//
+// Ensure you have locked the mutex outside of this function before calling it.
+func (r *leakyBucket) unsafeTryTake(n, reserve int, now time.Time) (bool, time.Time, int) {
+	r.unsafeFillAt(now)
 
-	if r.tokens < 1 {
-		// there isn't at least 1 oken, so nothing is available
-		return false, time.Until(r.lastFill.Add(r.rate))
+	if n <= 0 || n > r.max {
+		// the take can never succeed, so there's no time worth trying again at
+		r.stats.Denied++
+		return false, now, r.tokens
 	}
 
-	// take a token if there is one available
-	r.tokens--
+	if missing := n + reserve - r.tokens; missing > 0 {
+		// there aren't enough tokens, so nothing is taken
+		r.stats.Denied++
+		return false, r.lastFill.Add(r.rate * time.Duration(missing)), r.tokens
+	}
+
+	// take the tokens if they're available
+	r.tokens -= n
+	r.stats.Granted++
 
-	return true, 0
+	return true, now, r.tokens
 }
 
 // Take will attempt to accquire a ratelimit window, it will return a boolean indicating whether it was able to accquire a token or not.
@@ -90,6 +243,15 @@ func (r *leakyBucket) Wait(ctx context.Context) {
 // wait keeps trying to take a token, while also sleeping the goroutine while it waits for the next attempt. The wait functions just call this
 // under the hood.
 func (r *leakyBucket) wait(ctx context.Context) bool {
+	atomic.AddInt64(&r.waiters, 1)
+	defer atomic.AddInt64(&r.waiters, -1)
+
+	if r.tick != nil {
+		if success, ticking := r.waitForTick(ctx); ticking {
+			return success
+		}
+	}
+
 	for {
 		available, duration := r.TryTakeWithDuration()
 		if available {
@@ -101,6 +263,19 @@ func (r *leakyBucket) wait(ctx context.Context) bool {
 	}
 }
 
+// Refund gives back the most recently taken token, the bucket is never filled beyond its capacity.
+func (r *leakyBucket) Refund() {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.unsafeFill()
+	if r.tokens < r.max {
+		r.tokens++
+	}
+	if r.tick != nil {
+		r.tick.Broadcast()
+	}
+}
+
 // Size will return how many tokens are currently available
 func (r *leakyBucket) Size() int {
 	r.m.Lock()
@@ -109,8 +284,97 @@ func (r *leakyBucket) Size() int {
 	return r.tokens
 }
 
+// Inspect will return how many tokens are currently available, alongside when the bucket will be full again.
+func (r *leakyBucket) Inspect() LeakyBucketInspection {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	now := r.opts.now()
+	r.unsafeFillAt(now)
+
+	resetAt := now
+	if missing := r.max - r.tokens; missing > 0 {
+		resetAt = r.lastFill.Add(r.rate * time.Duration(missing))
+	}
+
+	return LeakyBucketInspection{RemainingTokens: r.tokens, ResetAt: resetAt}
+}
+
+// DurationUntil will return how long it will be until n tokens are available in the bucket, without taking any tokens. If n tokens
+// are already available, it returns 0. ErrExceedsCapacity is returned if n is more than the bucket can ever hold.
+func (r *leakyBucket) DurationUntil(n int) (time.Duration, error) {
+	if n > r.max {
+		return 0, ErrExceedsCapacity
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.unsafeFill()
+
+	missing := n - r.tokens
+	if missing <= 0 {
+		return 0, nil
+	}
+
+	return r.lastFill.Add(r.rate * time.Duration(missing)).Sub(r.opts.now()), nil
+}
+
+// Stats will return cumulative counters describing the bucket's behaviour since it was created.
+func (r *leakyBucket) Stats() LeakyBucketStats {
+	r.m.Lock()
+	defer r.m.Unlock()
+	return r.stats
+}
+
+// Describe will return the bucket's effective configuration
+func (r *leakyBucket) Describe() LimiterInfo {
+	return LimiterInfo{
+		Algorithm:      AlgorithmLeakyBucket,
+		Capacity:       r.max,
+		Window:         r.rate * time.Duration(r.max),
+		RefillInterval: r.rate,
+	}
+}
+
+// Snapshot serializes the bucket's tokens, alongside when it was last filled, see Snapshotter.
+func (r *leakyBucket) Snapshot() ([]byte, error) {
+	r.m.Lock()
+	r.unsafeFill()
+	lastFill := r.lastFill.UTC()
+	s := newSnapshot(r.Describe())
+	s.Tokens = r.tokens
+	s.LastFill = &lastFill
+	r.m.Unlock()
+
+	return json.Marshal(s)
+}
+
+// Restore replaces the bucket's tokens, and when it was last filled, with those serialized by Snapshot, see Snapshotter.
+func (r *leakyBucket) Restore(data []byte) error {
+	s, err := parseSnapshot(data, r.Describe(), r.opts.now())
+	if err != nil {
+		return err
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.tokens = s.Tokens
+	if s.LastFill != nil {
+		r.lastFill = *s.LastFill
+	}
+	if r.tick != nil {
+		r.tick.Broadcast()
+	}
+	return nil
+}
+
+// QueueLength will return how many callers are currently blocked in Wait or WaitFunc, waiting for a token.
+func (r *leakyBucket) QueueLength() int {
+	return int(atomic.LoadInt64(&r.waiters))
+}
+
 // WaitFunc is equivalent to Wait except it calls a callback when it's able to accquire a token. Iif you cancel the context, cb is not called. This
-// function does spawn a goroutine per invocation. If you want something more efficient, consider writing your own implementation using TryTakeWithDuration()
+// function does spawn a goroutine per invocation. If you want something more efficient, consider a Scheduler, or writing your own implementation using TryTakeWithDuration()
 func (r *leakyBucket) WaitFunc(ctx context.Context, cb func()) {
 	go func(ctx context.Context, cb func()) {
 		if r.wait(ctx) {
@@ -135,12 +399,47 @@ func (r *leakyBucket) awaitNextToken(ctx context.Context, duration time.Duration
 //
 // Ensure you have locked the mutex outside of this function before calling it.
 func (r *leakyBucket) unsafeFill() {
+	r.unsafeFillAt(r.opts.now())
+}
+
+// unsafeFillAt is equivalent to unsafeFill, except it fills the bucket up to now rather than time.Now().
+func (r *leakyBucket) unsafeFillAt(now time.Time) {
+	if now.Before(r.lastFill) {
+		// time has moved backwards, which only happens when now has no monotonic clock reading, such as a wall clock time passed to
+		// TryTakeAt after the system clock was stepped back. Nothing is filled, but filling restarts from now, rather than waiting
+		// for the clock to catch back up with lastFill.
+		if !r.ticking {
+			r.lastFill = now
+		}
+		return
+	}
+
 	if r.tokens >= r.max {
-		// bucket is already full
+		// bucket is already full, there's nothing to fill
 		return
 	}
 
-	tokensToFill := int(time.Since(r.lastFill) / r.rate)
-	r.tokens = int(math.Min(float64(r.tokens+tokensToFill), float64(r.max)))
-	r.lastFill = time.Now().UTC()
+	tokensToFill := 0
+	if r.opts.refill != nil {
+		if n := r.opts.refill(now); n > 0 {
+			tokensToFill += n
+		}
+	}
+
+	if !r.ticking {
+		// ticking buckets are filled over time in the background instead
+		if !r.opts.refillOnly {
+			tokensToFill += int(now.Sub(r.lastFill) / r.rate)
+		}
+		r.lastFill = now
+	}
+
+	filled := int(math.Min(float64(r.tokens+tokensToFill), float64(r.max))) - r.tokens
+	r.tokens += filled
+
+	if filled > 0 {
+		r.stats.TokensFilled += int64(filled)
+		r.stats.LastFillTokens = filled
+		r.stats.LastFillAt = now.UTC()
+	}
 }
@@ -11,98 +11,405 @@ import (
 func TestLeakyBucket(t *testing.T) {
 	t.Parallel() // these tests run in parallel as they involve blocking calls
 
-	t.Run("ratelimits properly", func(t *testing.T) {
-		t.Parallel()
-		r := local.NewLeakyBucket(10, time.Second*2)
+	// the lock-free bucket must behave the same as the mutex one
+	constructors := map[string]func(int, time.Duration, ...local.Option) local.LeakyBucket{
+		"mutex":  local.NewLeakyBucket,
+		"atomic": local.NewAtomicLeakyBucket,
+	}
 
-		assertValue(t, 10, r.Size())
+	for name, newLeakyBucket := range constructors {
+		newLeakyBucket := newLeakyBucket
 
-		for i := 0; i < 10; i++ {
-			assertValue(t, true, r.TryTake())
-		}
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
 
-		assertValue(t, 0, r.Size())
+			t.Run("ratelimits properly", func(t *testing.T) {
+				t.Parallel()
+				r := newLeakyBucket(10, time.Second*2)
 
-		// should be ratelimited now
-		assertValue(t, false, r.TryTake())
-	})
+				assertValue(t, 10, r.Size())
 
-	t.Run("blocks goroutine until token is available", func(t *testing.T) {
-		t.Parallel()
+				for i := 0; i < 10; i++ {
+					assertValue(t, true, r.TryTake())
+				}
 
-		r := local.NewLeakyBucket(10, time.Second)
+				assertValue(t, 0, r.Size())
 
-		for i := 0; i < 10; i++ {
-			assertValue(t, true, r.TryTake())
-		}
+				// should be ratelimited now
+				assertValue(t, false, r.TryTake())
+			})
 
-		start := time.Now()
-		r.Wait(context.Background())
+			t.Run("blocks goroutine until token is available", func(t *testing.T) {
+				t.Parallel()
 
-		// kind of hacky but works, timing sleeps isn't great because golangs runtime won't be perfectly accurate, and i didn't want to stub the entire clock
-		duration := time.Since(start)
-		assertValue(t, 0, r.Size()) // we just used the last token
+				r := newLeakyBucket(10, time.Second)
 
-		// given 10 a second, we should be replenishing 1 token every 100ms, this lets us check that it's roughly correct.
-		// if this is wrong, we probably fucked up the tokenRate math
-		assertValue(t, true, duration >= time.Millisecond*95 && duration <= time.Millisecond*105)
-	})
+				for i := 0; i < 10; i++ {
+					assertValue(t, true, r.TryTake())
+				}
 
-	t.Run("does not call cb if context is cancelled before token is available", func(t *testing.T) {
-		t.Parallel()
+				start := time.Now()
+				r.Wait(context.Background())
 
-		ctx, cancel := context.WithCancel(context.Background())
+				// kind of hacky but works, timing sleeps isn't great because golangs runtime won't be perfectly accurate, and i didn't want to stub the entire clock
+				duration := time.Since(start)
+				assertValue(t, 0, r.Size()) // we just used the last token
 
-		r := local.NewLeakyBucket(2, time.Millisecond*250)
-		for i := 0; i < 2; i++ {
-			assertValue(t, true, r.TryTake())
-		}
+				// given 10 a second, we should be replenishing 1 token every 100ms, this lets us check that it's roughly correct.
+				// if this is wrong, we probably fucked up the tokenRate math
+				assertValue(t, true, duration >= time.Millisecond*95 && duration <= time.Millisecond*105)
+			})
 
-		wasCalled := false
-		r.WaitFunc(ctx, func() { wasCalled = true })
-		cancel()
+			t.Run("does not call cb if context is cancelled before token is available", func(t *testing.T) {
+				t.Parallel()
 
-		// just in case some weird shit is going on, again, hacky but works
-		time.Sleep(time.Millisecond * 500)
-		assertValue(t, false, wasCalled)
-	})
+				ctx, cancel := context.WithCancel(context.Background())
+
+				r := newLeakyBucket(2, time.Millisecond*250)
+				for i := 0; i < 2; i++ {
+					assertValue(t, true, r.TryTake())
+				}
+
+				wasCalled := false
+				r.WaitFunc(ctx, func() { wasCalled = true })
+				cancel()
+
+				// just in case some weird shit is going on, again, hacky but works
+				time.Sleep(time.Millisecond * 500)
+				assertValue(t, false, wasCalled)
+			})
+
+			t.Run("gives roughly correct take duration", func(t *testing.T) {
+				t.Parallel()
+
+				r := newLeakyBucket(2, time.Second)
+				for i := 0; i < 2; i++ {
+					success, duration := r.TryTakeWithDuration()
+					assertValue(t, true, success)
+					assertValue(t, 0, duration)
+				}
+
+				success, duration := r.TryTakeWithDuration()
+				assertValue(t, false, success)
+				assertValue(t, true, duration >= time.Millisecond*450 && duration <= time.Millisecond*550)
+			})
+
+			t.Run("gives absolute reset time", func(t *testing.T) {
+				t.Parallel()
+
+				r := newLeakyBucket(2, time.Second)
+				start := time.Now()
+				for i := 0; i < 2; i++ {
+					success, resetAt := r.TryTakeWithResetAt()
+					assertValue(t, true, success)
+					assertValue(t, false, resetAt.Before(start))
+				}
+
+				success, resetAt := r.TryTakeWithResetAt()
+				assertValue(t, false, success)
+
+				// the reset time is fixed when the call is made, so waiting doesn't change it
+				time.Sleep(time.Millisecond * 100)
+				delay := resetAt.Sub(start)
+				assertValue(t, true, delay >= time.Millisecond*450 && delay <= time.Millisecond*550)
+			})
+
+			t.Run("reports duration until n tokens are available", func(t *testing.T) {
+				t.Parallel()
+
+				r := newLeakyBucket(10, time.Second)
+
+				duration, err := r.DurationUntil(10)
+				assertNoError(t, err)
+				assertValue(t, 0, duration)
+
+				for i := 0; i < 10; i++ {
+					assertValue(t, true, r.TryTake())
+				}
+
+				// tokens fill every 100ms, so 5 tokens should take roughly 500ms
+				duration, err = r.DurationUntil(5)
+				assertNoError(t, err)
+				assertValue(t, true, duration >= time.Millisecond*450 && duration <= time.Millisecond*500)
+				assertValue(t, 0, r.Size()) // no tokens should be taken
+
+				_, err = r.DurationUntil(11)
+				assertValue(t, local.ErrExceedsCapacity.Error(), err.Error())
+			})
+
+			t.Run("takes n tokens atomically", func(t *testing.T) {
+				t.Parallel()
+
+				r := newLeakyBucket(10, time.Second)
+				assertValue(t, true, r.TryTakeN(7))
+				assertValue(t, 3, r.Size())
+
+				// not enough tokens, none should be taken
+				success, duration := r.TryTakeNWithDuration(5)
+				assertValue(t, false, success)
+				assertValue(t, true, duration >= time.Millisecond*150 && duration <= time.Millisecond*200)
+				assertValue(t, 3, r.Size())
+
+				assertValue(t, true, r.TryTakeN(3))
+				assertValue(t, false, r.TryTakeN(11))
+			})
+
+			t.Run("never takes fewer than 1 or more than capacity", func(t *testing.T) {
+				t.Parallel()
+
+				r := newLeakyBucket(10, time.Second)
+				assertValue(t, true, r.TryTakeN(5))
+
+				for _, n := range []int{0, -5, 11} {
+					success, duration := r.TryTakeNWithDuration(n)
+					assertValue(t, false, success)
+					assertValue(t, time.Duration(0), duration)
+					assertValue(t, 5, r.Size())
+				}
+			})
+
+			t.Run("inspects tokens and reset time", func(t *testing.T) {
+				t.Parallel()
+
+				r := newLeakyBucket(2, time.Second*2)
+
+				before := time.Now()
+				inspection := r.Inspect()
+				assertValue(t, 2, inspection.RemainingTokens)
+				assertValue(t, true, !inspection.ResetAt.Before(before) && time.Since(inspection.ResetAt) >= 0)
+
+				assertValue(t, true, r.TryTakeN(2))
+
+				// a token fills every second, so the bucket is full again 2 seconds after the empty bucket was filled
+				inspection = r.Inspect()
+				assertValue(t, 0, inspection.RemainingTokens)
+				assertValue(t, true, time.Until(inspection.ResetAt) > time.Millisecond*1900 && time.Until(inspection.ResetAt) <= time.Second*2)
+			})
+
+			t.Run("steps time with TryTakeAt", func(t *testing.T) {
+				t.Parallel()
+
+				r := newLeakyBucket(2, time.Second*2)
+				now := time.Now()
+
+				for i := 0; i < 2; i++ {
+					success, duration := r.TryTakeAt(now)
+					assertValue(t, true, success)
+					assertValue(t, time.Duration(0), duration)
+				}
+
+				success, duration := r.TryTakeAt(now)
+				assertValue(t, false, success)
+				assertValue(t, time.Second, duration)
+
+				success, _ = r.TryTakeAt(now.Add(time.Second))
+				assertValue(t, true, success)
+			})
+
+			t.Run("calls decision hook", func(t *testing.T) {
+				t.Parallel()
+
+				events := []local.DecisionEvent{}
+				r := newLeakyBucket(2, time.Second, local.WithOnDecision(func(e local.DecisionEvent) {
+					events = append(events, e)
+				}))
 
-	t.Run("gives roughly correct take duration", func(t *testing.T) {
+				for i := 0; i < 3; i++ {
+					r.TryTake()
+				}
+
+				assertValue(t, 3, len(events))
+				assertValue(t, local.DecisionEvent{Allowed: true, Remaining: 1, TakeAmount: 1}, events[0])
+				assertValue(t, local.DecisionEvent{Allowed: true, Remaining: 0, TakeAmount: 1}, events[1])
+				assertValue(t, local.DecisionEvent{Allowed: false, Remaining: 0, TakeAmount: 1}, events[2])
+			})
+
+			t.Run("starts with initial tokens", func(t *testing.T) {
+				t.Parallel()
+
+				assertValue(t, 0, newLeakyBucket(5, time.Minute, local.WithInitialTokens(0)).Size())
+				assertValue(t, 2, newLeakyBucket(5, time.Minute, local.WithInitialTokens(2)).Size())
+				assertValue(t, 5, newLeakyBucket(5, time.Minute, local.WithInitialTokens(10)).Size())
+				assertValue(t, 0, newLeakyBucket(5, time.Minute, local.WithInitialTokens(-1)).Size())
+
+				r := newLeakyBucket(5, time.Minute, local.WithInitialTokens(0))
+				assertValue(t, false, r.TryTake())
+				ok, _ := r.TryTakeAt(time.Now().Add(time.Minute / 5))
+				assertValue(t, true, ok)
+			})
+
+			t.Run("reports queue length", func(t *testing.T) {
+				t.Parallel()
+
+				r := newLeakyBucket(1, time.Millisecond*200)
+				assertValue(t, true, r.TryTake())
+				assertValue(t, 0, r.QueueLength())
+
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+
+				ch := make(chan struct{}, 3)
+				for i := 0; i < 3; i++ {
+					r.WaitFunc(ctx, func() { ch <- struct{}{} })
+				}
+
+				time.Sleep(time.Millisecond * 50)
+				assertValue(t, 3, r.QueueLength())
+
+				<-ch
+				time.Sleep(time.Millisecond * 50)
+				assertValue(t, 2, r.QueueLength())
+			})
+
+			t.Run("reports stats", func(t *testing.T) {
+				t.Parallel()
+
+				r := newLeakyBucket(2, time.Millisecond*200)
+				assertValue(t, true, r.TryTakeN(2))
+				assertValue(t, false, r.TryTake())
+
+				stats := r.Stats()
+				assertValue(t, int64(1), stats.Granted)
+				assertValue(t, int64(1), stats.Denied)
+				assertValue(t, int64(0), stats.TokensFilled)
+
+				// one token is filled every 100ms
+				time.Sleep(time.Millisecond * 110)
+				assertValue(t, true, r.TryTake())
+
+				stats = r.Stats()
+				assertValue(t, int64(2), stats.Granted)
+				assertValue(t, int64(1), stats.TokensFilled)
+				assertValue(t, 1, stats.LastFillTokens)
+				assertValue(t, false, stats.LastFillAt.IsZero())
+			})
+
+			t.Run("calls callback in waitFunc", func(t *testing.T) {
+				t.Parallel()
+
+				r := newLeakyBucket(2, time.Second)
+				for i := 0; i < 2; i++ {
+					assertValue(t, true, r.TryTake())
+				}
+
+				ch := make(chan struct{}, 1)
+				defer close(ch)
+
+				start := time.Now()
+				r.WaitFunc(context.Background(), func() {
+					ch <- struct{}{}
+				})
+
+				<-ch
+
+				duration := time.Since(start)
+
+				// 2 a second means we fill at a constant rate of 500ms, so this checks that it roughly makes sense
+				assertValue(t, true, duration >= time.Millisecond*450 && duration <= time.Millisecond*550)
+			})
+
+			t.Run("survives the clock stepping backwards", func(t *testing.T) {
+				t.Parallel()
+
+				r := newLeakyBucket(10, time.Second)
+
+				// Round(0) strips the monotonic clock reading, as a wall clock time wouldn't have one
+				now := time.Now().Round(0)
+				for i := 0; i < 10; i++ {
+					success, _ := r.TryTakeAt(now)
+					assertValue(t, true, success)
+				}
+
+				// the clock is stepped back an hour, which mustn't grant any tokens
+				now = now.Add(-time.Hour)
+				success, retryIn := r.TryTakeAt(now)
+				assertValue(t, false, success)
+				assertValue(t, true, retryIn <= time.Millisecond*100)
+
+				// nor should the bucket wait an hour for the clock to catch back up before it fills again
+				success, _ = r.TryTakeAt(now.Add(time.Millisecond * 100))
+				assertValue(t, true, success)
+				success, _ = r.TryTakeAt(now.Add(time.Millisecond * 100))
+				assertValue(t, false, success)
+			})
+
+			t.Run("reserves tokens for high priority takes", func(t *testing.T) {
+				t.Parallel()
+				r := newLeakyBucket(5, time.Minute, local.WithReserve(2))
+
+				// normal takes must leave the reserve in the bucket
+				assertValue(t, true, r.TryTakeN(3))
+				success, retryIn := r.TryTakeWithDuration()
+				assertValue(t, false, success)
+				assertValue(t, true, retryIn > 0 && retryIn <= time.Second*12)
+
+				// while high priority takes may use it
+				success, _ = r.(local.PriorityTaker).TryTakeHighPriority(2)
+				assertValue(t, true, success)
+				assertValue(t, 0, r.Size())
+
+				success, retryIn = r.(local.PriorityTaker).TryTakeHighPriority(1)
+				assertValue(t, false, success)
+				assertValue(t, true, retryIn > 0 && retryIn <= time.Second*12)
+			})
+		})
+	}
+}
+
+func TestLeakyBucket_Refill(t *testing.T) {
+	t.Parallel()
+
+	t.Run("adds external tokens on top of the time based fill", func(t *testing.T) {
 		t.Parallel()
 
-		r := local.NewLeakyBucket(2, time.Second)
-		for i := 0; i < 2; i++ {
-			success, duration := r.TryTakeWithDuration()
-			assertValue(t, true, success)
-			assertValue(t, 0, duration)
-		}
+		budget := 0
+		r := local.NewLeakyBucket(5, time.Hour, local.WithInitialTokens(0), local.WithRefill(func(time.Time) int {
+			n := budget
+			budget = 0
+			return n
+		}))
+		assertValue(t, false, r.TryTake())
+
+		budget = 3
+		assertValue(t, true, r.TryTakeN(3))
+		assertValue(t, 0, r.Size())
 
-		success, duration := r.TryTakeWithDuration()
-		assertValue(t, false, success)
-		assertValue(t, true, duration >= time.Millisecond*450 && duration <= time.Millisecond*550)
+		// external tokens are capped at the bucket's capacity
+		budget = 10
+		assertValue(t, 5, r.Size())
+		assertValue(t, int64(8), r.Stats().TokensFilled)
 	})
 
-	t.Run("calls callback in waitFunc", func(t *testing.T) {
+	t.Run("isn't called while the bucket is full", func(t *testing.T) {
 		t.Parallel()
 
-		r := local.NewLeakyBucket(2, time.Second)
-		for i := 0; i < 2; i++ {
-			assertValue(t, true, r.TryTake())
-		}
+		calls := 0
+		r := local.NewLeakyBucket(5, time.Hour, local.WithRefill(func(time.Time) int {
+			calls++
+			return 0
+		}))
+		assertValue(t, 5, r.Size())
+		assertValue(t, 0, calls)
 
-		ch := make(chan struct{}, 1)
-		defer close(ch)
+		assertValue(t, true, r.TryTake())
+		assertValue(t, 4, r.Size())
+		assertValue(t, 1, calls)
+	})
 
-		start := time.Now()
-		r.WaitFunc(context.Background(), func() {
-			ch <- struct{}{}
-		})
+	t.Run("only fills from the external source", func(t *testing.T) {
+		t.Parallel()
 
-		<-ch
+		budget := 0
+		r := local.NewLeakyBucket(10, time.Millisecond*10, local.WithInitialTokens(0), local.WithRefillOnly(func(time.Time) int {
+			n := budget
+			budget = 0
+			return n
+		}))
 
-		duration := time.Since(start)
+		time.Sleep(time.Millisecond * 20)
+		assertValue(t, 0, r.Size())
 
-		// 2 a second means we fill at a constant rate of 500ms, so this checks that it roughly makes sense
-		assertValue(t, true, duration >= time.Millisecond*450 && duration <= time.Millisecond*550)
+		budget = 2
+		assertValue(t, 2, r.Size())
 	})
 }
@@ -0,0 +1,161 @@
+package local
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MinInterval provides an interface for the minimum interval ratelimiter.
+//
+// The minimum interval ratelimiter enforces a gap between successive takes, regardless of overall volume. For example, with an
+// interval of 500ms, no two tokens are ever taken within 500ms of each other, which is a common requirement of third party APIs
+// that neither a leaky bucket nor a sliding window expresses directly.
+type MinInterval interface {
+	// Wait will block the goroutine til a ratelimit token is available. You can use context to cancel the ratelimiter.
+	Wait(ctx context.Context)
+
+	// QueueLength will return how many callers are currently blocked in Wait, waiting for a token.
+	QueueLength() int
+
+	// TryTake will attempt to accquire a token, it will return a boolean indicating whether it was able to accquire a token or not.
+	TryTake() bool
+
+	// TryTakeWithDuration will attempt to accquire a token, it will return a boolean indicating whether it was able to accquire a
+	// token or not, and a duration for when you should next try.
+	TryTakeWithDuration() (bool, time.Duration)
+
+	// TryTakeAt is equivalent to TryTakeWithDuration, except it uses now as the current time rather than time.Now(), which lets
+	// tests and simulations step time precisely without sleeping. If now moves backwards, as a wall clock time can when the system
+	// clock is stepped back, no extra tokens are granted, and the ratelimiter carries on from the earlier time rather than waiting
+	// for the clock to catch back up.
+	TryTakeAt(now time.Time) (bool, time.Duration)
+
+	// TryTakeWithResetAt is equivalent to TryTakeWithDuration, except it returns the absolute time at which you should next try,
+	// which avoids skew when the result is passed through layers that add their own latency. On success, this is the current time.
+	TryTakeWithResetAt() (bool, time.Time)
+
+	// Describe will return the ratelimiter's effective configuration
+	Describe() LimiterInfo
+}
+
+type minInterval struct {
+	// waiters is how many callers are blocked waiting for a token, it's accessed atomically so it's kept first for alignment
+	waiters int64
+	// interval is the minimum gap between successive takes
+	interval time.Duration
+	// m is the shared mutex to ensure calls are thread safe.
+	m sync.Mutex
+	// lastTake is when the most recent token was taken, and previousTake is when the one before it was, so it can be refunded
+	lastTake     time.Time
+	previousTake time.Time
+	// opts holds the optional behaviour configured for the ratelimiter
+	opts *options
+}
+
+// NewMinInterval creates a new minimum interval ratelimiter, which allows a token to be taken at most once per interval. See the
+// MinInterval interface for more info about what this ratelimiter does.
+func NewMinInterval(interval time.Duration, opts ...Option) (MinInterval, error) {
+	if interval <= 0 {
+		return nil, ErrDuration
+	}
+
+	return &minInterval{
+		interval: interval,
+		opts:     newOptions(opts),
+	}, nil
+}
+
+// Wait will block the goroutine til a ratelimit token is available. You can use context to cancel the ratelimiter.
+func (r *minInterval) Wait(ctx context.Context) {
+	atomic.AddInt64(&r.waiters, 1)
+	defer atomic.AddInt64(&r.waiters, -1)
+
+	for {
+		available, duration := r.TryTakeWithDuration()
+		if available {
+			return
+		}
+
+		timer := time.NewTimer(duration)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// QueueLength will return how many callers are currently blocked in Wait, waiting for a token.
+func (r *minInterval) QueueLength() int {
+	return int(atomic.LoadInt64(&r.waiters))
+}
+
+// Describe will return the ratelimiter's effective configuration
+func (r *minInterval) Describe() LimiterInfo {
+	return LimiterInfo{
+		Algorithm: AlgorithmMinInterval,
+		Capacity:  1,
+		Window:    r.interval,
+	}
+}
+
+// Refund gives back the most recently taken token, so the next take is only spaced from the one before it.
+func (r *minInterval) Refund() {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.lastTake = r.previousTake
+	r.previousTake = time.Time{}
+}
+
+// TryTake will attempt to accquire a token, it will return a boolean indicating whether it was able to accquire a token or not.
+func (r *minInterval) TryTake() bool {
+	resp, _ := r.TryTakeWithDuration()
+	return resp
+}
+
+// TryTakeWithDuration will attempt to accquire a token, it will return a boolean indicating whether it was able to accquire a token
+// or not, and a duration for when you should next try.
+func (r *minInterval) TryTakeWithDuration() (bool, time.Duration) {
+	return r.TryTakeAt(r.opts.now())
+}
+
+// TryTakeAt is equivalent to TryTakeWithDuration, except it uses now as the current time rather than time.Now().
+func (r *minInterval) TryTakeAt(now time.Time) (bool, time.Duration) {
+	success, resetAt := r.tryTake(now)
+	if success {
+		return true, 0
+	}
+	return false, resetAt.Sub(now)
+}
+
+// TryTakeWithResetAt is equivalent to TryTakeWithDuration, except it returns the absolute time at which you should next try,
+// which avoids skew when the result is passed through layers that add their own latency. On success, this is the current time.
+func (r *minInterval) TryTakeWithResetAt() (bool, time.Time) {
+	return r.tryTake(r.opts.now())
+}
+
+// tryTake attempts to take a token as of now, returning when to next try alongside the result.
+func (r *minInterval) tryTake(now time.Time) (bool, time.Time) {
+	r.m.Lock()
+	if now.Before(r.lastTake) {
+		// time has moved backwards, which only happens when now has no monotonic clock reading, such as a wall clock time passed
+		// to TryTakeAt after the system clock was stepped back. The last take is treated as happening now, rather than waiting
+		// for the clock to catch back up with it.
+		r.lastTake = now
+	}
+	nextTake := r.lastTake.Add(r.interval)
+	success := r.lastTake.IsZero() || !now.Before(nextTake)
+	if success {
+		r.previousTake = r.lastTake
+		r.lastTake = now
+		nextTake = now
+	}
+	r.m.Unlock()
+
+	// either way, no token is available until the interval has passed
+	r.opts.emitDecision(DecisionEvent{Allowed: success, Remaining: 0, TakeAmount: 1})
+	return success, nextTake
+}
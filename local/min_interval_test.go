@@ -0,0 +1,99 @@
+package local_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aidenwallis/go-ratelimiting/local"
+)
+
+func TestMinInterval(t *testing.T) {
+	t.Parallel() // these tests run in parallel as they involve blocking calls
+
+	t.Run("validates arguments correctly", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := local.NewMinInterval(0)
+		assertValue(t, local.ErrDuration.Error(), err.Error())
+	})
+
+	t.Run("spaces takes by the interval", func(t *testing.T) {
+		t.Parallel()
+
+		r, err := local.NewMinInterval(time.Millisecond * 500)
+		assertNoError(t, err)
+
+		now := time.Now()
+		success, duration := r.TryTakeAt(now)
+		assertValue(t, true, success)
+		assertValue(t, time.Duration(0), duration)
+
+		success, duration = r.TryTakeAt(now.Add(time.Millisecond * 200))
+		assertValue(t, false, success)
+		assertValue(t, time.Millisecond*300, duration)
+
+		success, _ = r.TryTakeAt(now.Add(time.Millisecond * 500))
+		assertValue(t, true, success)
+
+		// the interval is measured from the last successful take, not the last attempt
+		success, duration = r.TryTakeAt(now.Add(time.Millisecond * 900))
+		assertValue(t, false, success)
+		assertValue(t, time.Millisecond*100, duration)
+	})
+
+	t.Run("refunds the last take", func(t *testing.T) {
+		t.Parallel()
+
+		r, err := local.NewMinInterval(time.Minute)
+		assertNoError(t, err)
+
+		assertValue(t, true, r.TryTake())
+		r.(local.Refunder).Refund()
+		assertValue(t, true, r.TryTake())
+		assertValue(t, false, r.TryTake())
+	})
+
+	t.Run("blocks goroutine until token is available", func(t *testing.T) {
+		t.Parallel()
+
+		r, err := local.NewMinInterval(time.Millisecond * 50)
+		assertNoError(t, err)
+
+		start := time.Now()
+		r.Wait(context.Background())
+		r.Wait(context.Background())
+		assertValue(t, true, time.Since(start) >= time.Millisecond*50)
+		assertValue(t, 0, r.QueueLength())
+	})
+
+	t.Run("describes itself", func(t *testing.T) {
+		t.Parallel()
+
+		r, err := local.NewMinInterval(time.Second)
+		assertNoError(t, err)
+		assertInfo(t, local.LimiterInfo{Algorithm: local.AlgorithmMinInterval, Capacity: 1, Window: time.Second}, r.Describe())
+	})
+
+	t.Run("survives the clock stepping backwards", func(t *testing.T) {
+		t.Parallel()
+
+		r, err := local.NewMinInterval(time.Second)
+		assertNoError(t, err)
+
+		// Round(0) strips the monotonic clock reading, as a wall clock time wouldn't have one
+		now := time.Now().Round(0)
+		success, _ := r.TryTakeAt(now)
+		assertValue(t, true, success)
+
+		// the clock is stepped back an hour, which mustn't allow a take early
+		now = now.Add(-time.Hour)
+		success, retryIn := r.TryTakeAt(now)
+		assertValue(t, false, success)
+		assertValue(t, time.Second, retryIn)
+
+		// nor should it wait an hour for the clock to catch back up
+		success, _ = r.TryTakeAt(now.Add(time.Second))
+		assertValue(t, true, success)
+	})
+}
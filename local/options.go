@@ -0,0 +1,137 @@
+package local
+
+import "time"
+
+// Option configures optional behaviour of the local ratelimiters.
+type Option func(*options)
+
+type options struct {
+	// onDecision is called after every attempt to take a token
+	onDecision func(DecisionEvent)
+
+	// initialTokens is how many tokens leaky buckets start with, nil means they start full
+	initialTokens *int
+
+	// refill is called whenever a leaky bucket is filled, and returns how many tokens to add from an external source
+	refill func(now time.Time) int
+
+	// refillOnly stops leaky buckets filling over time, so they're only filled by refill
+	refillOnly bool
+
+	// clock is where ratelimiters read the current time from, nil means time.Now
+	clock Clock
+
+	// reserve is how many tokens normal takes must leave in leaky buckets, which only high-priority takes may use
+	reserve int
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// DecisionEvent describes the outcome of an attempt to take tokens from a ratelimiter.
+type DecisionEvent struct {
+	// Allowed is true when the tokens were taken
+	Allowed bool
+
+	// Remaining is how many tokens are left in the ratelimiter after the decision
+	Remaining int
+
+	// TakeAmount is how many tokens were requested
+	TakeAmount int
+}
+
+// WithOnDecision sets a hook which is called synchronously after every attempt to take a token, which is useful for audit logging.
+// Wait calls the hook for every attempt it makes, including the ones that were denied.
+//
+// The hook is called after the ratelimiter's lock has been released, so it's safe to call back into the ratelimiter.
+func WithOnDecision(fn func(DecisionEvent)) Option {
+	return func(o *options) {
+		o.onDecision = fn
+	}
+}
+
+// WithInitialTokens sets how many tokens leaky buckets start with, clamped to between 0 and the bucket's capacity. By default,
+// buckets start full, as the Redis leaky bucket does, which permits an immediate burst, starting with fewer tokens makes new buckets
+// earn them over time instead, like redis.LeakyBucketOptions.StartEmpty and WarmStart. This only affects local.NewLeakyBucket,
+// local.NewTickingLeakyBucket, local.NewAtomicLeakyBucket and the leaky bucket of local.NewComposite.
+func WithInitialTokens(n int) Option {
+	return func(o *options) {
+		o.initialTokens = &n
+	}
+}
+
+// WithRefill sets a callback which adds tokens to leaky buckets from an external source, such as a shared quota that a service
+// periodically hands out, on top of the tokens filled over time. It's called with the current time whenever the bucket is filled,
+// which is on every take, and returns how many tokens to add, which are capped at the bucket's capacity. It isn't called while the
+// bucket is full, so an external budget isn't drawn down only to be discarded.
+//
+// The callback is called while the bucket's lock is held, so it must not call back into the bucket, and should return quickly,
+// such as by reading a counter that's topped up asynchronously. This only affects local.NewLeakyBucket and
+// local.NewTickingLeakyBucket.
+func WithRefill(fn func(now time.Time) int) Option {
+	return func(o *options) {
+		o.refill = fn
+		o.refillOnly = false
+	}
+}
+
+// WithRefillOnly is equivalent to WithRefill, except leaky buckets are only filled by fn, rather than also being filled over time.
+// The bucket's window then only sets how often Wait checks for new tokens, except for local.NewTickingLeakyBucket, which is still
+// filled over time in the background.
+func WithRefillOnly(fn func(now time.Time) int) Option {
+	return func(o *options) {
+		o.refill = fn
+		o.refillOnly = true
+	}
+}
+
+// WithClock sets where ratelimiters read the current time from, rather than reading the system clock on every call. This is useful
+// to share a TickerClock between many ratelimiters, such as every ratelimiter created by a Registry's factory. It doesn't affect the
+// methods that take the current time as an argument, such as TryTakeAt. This only affects local.NewLeakyBucket,
+// local.NewAtomicLeakyBucket, local.NewTickingLeakyBucket, local.NewSlidingWindow, local.NewComposite and local.NewMinInterval.
+func WithClock(clock Clock) Option {
+	return func(o *options) {
+		o.clock = clock
+	}
+}
+
+// WithReserve sets how many tokens normal takes must leave in leaky buckets, which keeps headroom for high-priority traffic: a
+// normal take only succeeds if at least n tokens would remain afterwards, while TryTakeHighPriority may use the whole bucket, see
+// PriorityTaker. This matches MinimumReserve of the Redis leaky bucket. A reserve of at least the bucket's capacity means only
+// high-priority takes ever succeed. This only affects local.NewLeakyBucket, local.NewAtomicLeakyBucket and
+// local.NewTickingLeakyBucket.
+func WithReserve(n int) Option {
+	return func(o *options) {
+		o.reserve = n
+	}
+}
+
+// now returns the current time from the configured clock.
+func (o *options) now() time.Time {
+	if o.clock == nil {
+		return time.Now()
+	}
+	return o.clock.Now()
+}
+
+// startingTokens returns how many tokens a leaky bucket holding up to max tokens starts with.
+func (o *options) startingTokens(max int) int {
+	if o.initialTokens == nil || *o.initialTokens > max {
+		return max
+	}
+	if *o.initialTokens < 0 {
+		return 0
+	}
+	return *o.initialTokens
+}
+
+func (o *options) emitDecision(event DecisionEvent) {
+	if o.onDecision != nil {
+		o.onDecision(event)
+	}
+}
@@ -0,0 +1,140 @@
+package local
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// QueueingLimiter queues work in front of a TokenSource, running it as tokens become available, with a bounded queue to give
+// callers backpressure.
+//
+// It's equivalent to calling Wait before each piece of work, except callers are served in the order they arrived, and once
+// queueDepth callers are waiting, any more are rejected immediately with ErrQueueFull rather than joining an ever growing queue.
+// While anything is queued, a single goroutine takes tokens from the source on its behalf, it exits once the queue is empty.
+type QueueingLimiter interface {
+	// Do enqueues fn and blocks the goroutine until a token has been taken for it, then runs fn on the calling goroutine and returns
+	// nil. ErrQueueFull is returned immediately if the queue is full. If the context is cancelled before fn's turn, fn is not run,
+	// no token is taken for it, and the context's error is returned.
+	Do(ctx context.Context, fn func()) error
+
+	// QueueLength will return how many callers are currently blocked in Do, waiting for a token.
+	QueueLength() int
+}
+
+type queueingLimiter struct {
+	// source is where tokens are taken from
+	source TokenSource
+	// queueDepth is the maximum amount of callers that may be waiting at any time
+	queueDepth int
+	// m is the shared mutex to ensure calls are thread safe.
+	m sync.Mutex
+	// queue holds the waiting callers, in the order they arrived
+	queue []chan struct{}
+	// dispatching is true while the dispatcher goroutine is running
+	dispatching bool
+}
+
+// NewQueueingLimiter creates a new queueing limiter taking tokens from source, which allows at most queueDepth callers to wait at
+// once. See the QueueingLimiter interface for more info about what this does.
+func NewQueueingLimiter(source TokenSource, queueDepth int) (QueueingLimiter, error) {
+	if queueDepth <= 0 {
+		return nil, ErrQueueDepth
+	}
+
+	return &queueingLimiter{source: source, queueDepth: queueDepth}, nil
+}
+
+// Do enqueues fn and blocks the goroutine until a token has been taken for it, then runs fn on the calling goroutine and returns
+// nil. ErrQueueFull is returned immediately if the queue is full. If the context is cancelled before fn's turn, fn is not run, no
+// token is taken for it, and the context's error is returned.
+func (r *queueingLimiter) Do(ctx context.Context, fn func()) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	ch := make(chan struct{}, 1)
+
+	r.m.Lock()
+	if len(r.queue) >= r.queueDepth {
+		// queue is full, reject immediately
+		r.m.Unlock()
+		return ErrQueueFull
+	}
+	r.queue = append(r.queue, ch)
+	if !r.dispatching {
+		r.dispatching = true
+		go r.dispatch()
+	}
+	r.m.Unlock()
+
+	select {
+	case <-ch:
+	case <-ctx.Done():
+		if r.dequeue(ch) {
+			return ctx.Err()
+		}
+		// the token was taken for fn while the context was being cancelled, so use it rather than waste it
+		<-ch
+	}
+
+	fn()
+	return nil
+}
+
+// QueueLength will return how many callers are currently blocked in Do, waiting for a token.
+func (r *queueingLimiter) QueueLength() int {
+	r.m.Lock()
+	defer r.m.Unlock()
+	return len(r.queue)
+}
+
+// dequeue removes ch from the queue, returning false if it had already been released.
+func (r *queueingLimiter) dequeue(ch chan struct{}) bool {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	for i, queued := range r.queue {
+		if queued == ch {
+			r.queue = append(r.queue[:i], r.queue[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// dispatch takes tokens from the source and hands them to the waiting callers, until nothing is waiting.
+func (r *queueingLimiter) dispatch() {
+	for {
+		r.m.Lock()
+		if len(r.queue) == 0 {
+			r.dispatching = false
+			r.m.Unlock()
+			return
+		}
+		r.m.Unlock()
+
+		available, duration := r.source.TryTakeWithDuration()
+		if !available {
+			if duration <= 0 {
+				// avoid spinning if the source can't say when its next token is due
+				duration = time.Millisecond
+			}
+			time.Sleep(duration)
+			continue
+		}
+
+		r.m.Lock()
+		if len(r.queue) == 0 {
+			// every caller cancelled while the token was being taken
+			r.dispatching = false
+			r.m.Unlock()
+			return
+		}
+
+		ch := r.queue[0]
+		r.queue = r.queue[1:]
+		ch <- struct{}{}
+		r.m.Unlock()
+	}
+}
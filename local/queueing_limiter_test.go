@@ -0,0 +1,118 @@
+package local_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aidenwallis/go-ratelimiting/local"
+)
+
+func TestQueueingLimiter(t *testing.T) {
+	t.Parallel() // these tests run in parallel as they involve blocking calls
+
+	t.Run("validates arguments correctly", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := local.NewQueueingLimiter(local.NewLeakyBucket(1, time.Second), 0)
+		assertValue(t, local.ErrQueueDepth.Error(), err.Error())
+	})
+
+	t.Run("runs work at the token rate", func(t *testing.T) {
+		t.Parallel()
+
+		r, err := local.NewQueueingLimiter(local.NewLeakyBucket(10, time.Second, local.WithInitialTokens(0)), 5)
+		assertNoError(t, err)
+
+		start := time.Now()
+		calls := 0
+		for i := 0; i < 3; i++ {
+			assertNoError(t, r.Do(context.Background(), func() { calls++ }))
+		}
+
+		// each call waits 100ms for the next token to be filled
+		duration := time.Since(start)
+		assertValue(t, 3, calls)
+		assertValue(t, true, duration >= time.Millisecond*295 && duration <= time.Millisecond*400)
+	})
+
+	t.Run("runs queued work in the order it arrived", func(t *testing.T) {
+		t.Parallel()
+
+		r, _ := local.NewQueueingLimiter(local.NewLeakyBucket(20, time.Second, local.WithInitialTokens(0)), 5)
+
+		m := sync.Mutex{}
+		order := []int{}
+
+		wg := sync.WaitGroup{}
+		for i := 0; i < 3; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_ = r.Do(context.Background(), func() {
+					m.Lock()
+					defer m.Unlock()
+					order = append(order, i)
+				})
+			}(i)
+
+			// give each goroutine time to enqueue before the next
+			time.Sleep(time.Millisecond * 10)
+		}
+		wg.Wait()
+
+		assertValue(t, 3, len(order))
+		for i, v := range order {
+			assertValue(t, i, v)
+		}
+	})
+
+	t.Run("rejects when the queue is full", func(t *testing.T) {
+		t.Parallel()
+
+		r, _ := local.NewQueueingLimiter(local.NewLeakyBucket(1, time.Millisecond*300, local.WithInitialTokens(0)), 2)
+
+		wg := sync.WaitGroup{}
+		for i := 0; i < 2; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_ = r.Do(context.Background(), func() {})
+			}()
+		}
+
+		// give the goroutines time to enqueue
+		time.Sleep(time.Millisecond * 50)
+		assertValue(t, 2, r.QueueLength())
+
+		called := false
+		err := r.Do(context.Background(), func() { called = true })
+		assertValue(t, true, errors.Is(err, local.ErrQueueFull))
+		assertValue(t, false, called)
+
+		wg.Wait()
+		assertValue(t, 0, r.QueueLength())
+	})
+
+	t.Run("cancelled work is not run and leaves the queue", func(t *testing.T) {
+		t.Parallel()
+
+		r, _ := local.NewQueueingLimiter(local.NewLeakyBucket(1, time.Hour, local.WithInitialTokens(0)), 1)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+		defer cancel()
+
+		called := false
+		err := r.Do(ctx, func() { called = true })
+		assertValue(t, true, errors.Is(err, context.DeadlineExceeded))
+		assertValue(t, false, called)
+		assertValue(t, 0, r.QueueLength())
+
+		// an already cancelled context is rejected without queueing
+		cancel()
+		assertValue(t, true, errors.Is(r.Do(ctx, func() { called = true }), context.DeadlineExceeded))
+		assertValue(t, false, called)
+	})
+}
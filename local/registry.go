@@ -0,0 +1,210 @@
+package local
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// RegistryLimiter is a ratelimiter that can be held in a Registry, it's implemented by LeakyBucket, SlidingWindow, Composite and
+// MinInterval.
+type RegistryLimiter interface {
+	Limiter
+
+	// Wait will block the goroutine til a ratelimit token is available. You can use context to cancel the ratelimiter.
+	Wait(ctx context.Context)
+
+	// QueueLength will return how many callers are currently blocked in Wait, waiting for a token.
+	QueueLength() int
+}
+
+// Registry holds a ratelimiter per key, such as one per user, creating them lazily from a factory the first time a key is used.
+//
+// So that memory doesn't grow unbounded as keys churn, ratelimiters that haven't been used for longer than the idle TTL are evicted,
+// and the total number of ratelimiters can be capped, evicting the least recently used. Like the ratelimiters themselves, the
+// registry doesn't run a goroutine to do this, it evicts lazily as it's called. Ratelimiters that are in use by Take, AllowAll or
+// Wait, or that have callers blocked in Wait, are never evicted, so the registry may go over its cap while they're used. A
+// ratelimiter returned by Get isn't protected once Get returns, so prefer Take and Wait when the registry is capped.
+//
+// An evicted key starts again from a fresh ratelimiter the next time it's used, so the idle TTL should be at least as long as the
+// ratelimiter's window, at which point a fresh ratelimiter is equivalent to the evicted one.
+type Registry interface {
+	// Get will return the ratelimiter for key, creating it with the factory if it doesn't exist.
+	Get(key string) RegistryLimiter
+
+	// Take will attempt to accquire a token from key's ratelimiter, it will return a boolean indicating whether it was able to
+	// accquire a token or not.
+	Take(key string) bool
+
+	// AllowAll will attempt to accquire a token from each key's ratelimiter, such as a user, IP address and API key for one request.
+	// Either a token is taken from every ratelimiter, or none are: if any denies, the tokens already taken are refunded and the first
+	// key that denied is returned.
+	AllowAll(keys []string) (bool, string)
+
+	// Wait will block the goroutine til a token is available from key's ratelimiter. You can use context to cancel the wait.
+	Wait(ctx context.Context, key string)
+
+	// Len will return how many ratelimiters are currently held in the registry.
+	Len() int
+}
+
+type registry struct {
+	// factory creates the ratelimiter for a key the first time it's used
+	factory func(key string) RegistryLimiter
+	// idleTTL is how long a ratelimiter may go unused before it's evicted, 0 disables idle eviction
+	idleTTL time.Duration
+	// maxSize caps how many ratelimiters are held, 0 disables the cap
+	maxSize int
+	// m is the shared mutex to ensure calls are thread safe.
+	m sync.Mutex
+	// entries indexes the elements of lru by key
+	entries map[string]*list.Element
+	// lru holds a *registryEntry per key, ordered from most to least recently used
+	lru *list.List
+}
+
+type registryEntry struct {
+	key      string
+	limiter  RegistryLimiter
+	lastUsed time.Time
+	// pins is how many calls are currently using the ratelimiter, which keeps it from being evicted
+	pins int
+}
+
+// NewRegistry creates a new registry, which creates ratelimiters with factory. Ratelimiters unused for longer than idleTTL are evicted,
+// and no more than maxSize ratelimiters are held, values less than or equal to 0 disable either. See the Registry interface for more
+// info about what this does.
+func NewRegistry(factory func(key string) RegistryLimiter, idleTTL time.Duration, maxSize int) Registry {
+	return &registry{
+		factory: factory,
+		idleTTL: idleTTL,
+		maxSize: maxSize,
+		entries: map[string]*list.Element{},
+		lru:     list.New(),
+	}
+}
+
+// Get will return the ratelimiter for key, creating it with the factory if it doesn't exist.
+func (r *registry) Get(key string) RegistryLimiter {
+	r.m.Lock()
+	defer r.m.Unlock()
+	return r.unsafeGet(key).limiter
+}
+
+// pin returns the entry for key, like Get, and keeps it from being evicted until it's passed to unpin, so a concurrent call for
+// another key can't evict it while it's being used outside of the lock.
+func (r *registry) pin(key string) *registryEntry {
+	r.m.Lock()
+	defer r.m.Unlock()
+	entry := r.unsafeGet(key)
+	entry.pins++
+	return entry
+}
+
+// unpin releases an entry returned by pin.
+func (r *registry) unpin(entry *registryEntry) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	entry.pins--
+}
+
+// unsafeGet returns the entry for key, creating it with the factory if it doesn't exist, and marks it as used. Ensure you have
+// locked the mutex outside of this function before calling it.
+func (r *registry) unsafeGet(key string) *registryEntry {
+	now := time.Now()
+
+	if el, ok := r.entries[key]; ok {
+		entry := el.Value.(*registryEntry)
+		entry.lastUsed = now
+		r.lru.MoveToFront(el)
+		r.unsafeEvict(now, el)
+		return entry
+	}
+
+	entry := &registryEntry{key: key, limiter: r.factory(key), lastUsed: now}
+	el := r.lru.PushFront(entry)
+	r.entries[key] = el
+	r.unsafeEvict(now, el)
+	return entry
+}
+
+// unsafeEvict removes idle ratelimiters, and the least recently used ones while the registry is over its cap. The ratelimiter in
+// keep is about to be returned, so it's never evicted, even if that leaves the registry over its cap because every other ratelimiter
+// has waiters. Ensure you have locked the mutex outside of this function before calling it.
+func (r *registry) unsafeEvict(now time.Time, keep *list.Element) {
+	for n := r.lru.Len(); n > 0; n-- {
+		el := r.lru.Back()
+		if el == keep {
+			// everything older has waiters, and evicting keep would detach it from the registry while it's still being used
+			return
+		}
+		entry := el.Value.(*registryEntry)
+
+		idle := r.idleTTL > 0 && now.Sub(entry.lastUsed) >= r.idleTTL
+		full := r.maxSize > 0 && r.lru.Len() > r.maxSize
+		if !idle && !full {
+			return
+		}
+
+		if entry.pins > 0 || entry.limiter.QueueLength() > 0 {
+			// evicting a ratelimiter that's in use would let the key start again from a fresh one, so treat it as used
+			entry.lastUsed = now
+			r.lru.MoveToFront(el)
+			continue
+		}
+
+		r.lru.Remove(el)
+		delete(r.entries, entry.key)
+	}
+}
+
+// Take will attempt to accquire a token from key's ratelimiter, it will return a boolean indicating whether it was able to accquire
+// a token or not.
+func (r *registry) Take(key string) bool {
+	entry := r.pin(key)
+	defer r.unpin(entry)
+	return entry.limiter.TryTake()
+}
+
+// AllowAll will attempt to accquire a token from each key's ratelimiter, either a token is taken from every ratelimiter, or none are.
+// If any denies, the tokens already taken are refunded and the first key that denied is returned.
+//
+// Ratelimiters that don't implement Refunder can't give back their token, so it's consumed.
+func (r *registry) AllowAll(keys []string) (bool, string) {
+	taken := make([]RegistryLimiter, 0, len(keys))
+
+	for _, key := range keys {
+		entry := r.pin(key)
+		defer r.unpin(entry)
+
+		if entry.limiter.TryTake() {
+			taken = append(taken, entry.limiter)
+			continue
+		}
+
+		// refund in reverse, so limiters taken from more than once give back their most recent token first
+		for i := len(taken) - 1; i >= 0; i-- {
+			if refunder, ok := taken[i].(Refunder); ok {
+				refunder.Refund()
+			}
+		}
+		return false, key
+	}
+
+	return true, ""
+}
+
+// Wait will block the goroutine til a token is available from key's ratelimiter. You can use context to cancel the wait.
+func (r *registry) Wait(ctx context.Context, key string) {
+	entry := r.pin(key)
+	defer r.unpin(entry)
+	entry.limiter.Wait(ctx)
+}
+
+// Len will return how many ratelimiters are currently held in the registry.
+func (r *registry) Len() int {
+	r.m.Lock()
+	defer r.m.Unlock()
+	return r.lru.Len()
+}
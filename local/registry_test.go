@@ -0,0 +1,176 @@
+package local_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aidenwallis/go-ratelimiting/local"
+)
+
+func TestRegistry(t *testing.T) {
+	t.Parallel() // these tests run in parallel as they involve blocking calls
+
+	newBucket := func(string) local.RegistryLimiter { return local.NewLeakyBucket(1, time.Minute) }
+
+	t.Run("creates a ratelimiter per key", func(t *testing.T) {
+		t.Parallel()
+
+		r := local.NewRegistry(newBucket, 0, 0)
+		assertValue(t, true, r.Take("a"))
+		assertValue(t, false, r.Take("a"))
+		assertValue(t, true, r.Take("b"))
+		assertValue(t, 2, r.Len())
+		assertValue(t, true, r.Get("a") == r.Get("a"))
+	})
+
+	t.Run("takes from every key or none", func(t *testing.T) {
+		t.Parallel()
+
+		r := local.NewRegistry(newBucket, 0, 0)
+		assertValue(t, true, r.Take("ip"))
+
+		allowed, denied := r.AllowAll([]string{"user", "apikey", "ip"})
+		assertValue(t, false, allowed)
+		assertValue(t, "ip", denied)
+
+		// user and apikey were refunded
+		allowed, denied = r.AllowAll([]string{"user", "apikey"})
+		assertValue(t, true, allowed)
+		assertValue(t, "", denied)
+
+		allowed, denied = r.AllowAll([]string{"user"})
+		assertValue(t, false, allowed)
+		assertValue(t, "user", denied)
+	})
+
+	t.Run("evicts idle ratelimiters", func(t *testing.T) {
+		t.Parallel()
+
+		r := local.NewRegistry(newBucket, time.Millisecond*20, 0)
+		assertValue(t, true, r.Take("a"))
+		assertValue(t, false, r.Take("a"))
+
+		time.Sleep(time.Millisecond * 30)
+
+		// using another key evicts a, which starts again from a fresh ratelimiter
+		r.Take("b")
+		assertValue(t, 1, r.Len())
+		assertValue(t, true, r.Take("a"))
+	})
+
+	t.Run("evicts the least recently used over the cap", func(t *testing.T) {
+		t.Parallel()
+
+		r := local.NewRegistry(newBucket, 0, 2)
+		r.Take("a")
+		r.Take("b")
+		r.Take("a")
+		r.Take("c") // b is the least recently used
+
+		assertValue(t, 2, r.Len())
+		assertValue(t, false, r.Take("a"))
+		assertValue(t, true, r.Take("b"))
+	})
+
+	t.Run("doesn't evict ratelimiters with waiters", func(t *testing.T) {
+		t.Parallel()
+
+		r := local.NewRegistry(func(string) local.RegistryLimiter {
+			return local.NewLeakyBucket(1, time.Millisecond*100)
+		}, 0, 1)
+		assertValue(t, true, r.Take("a"))
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.Wait(context.Background(), "a")
+		}()
+
+		for r.Get("a").QueueLength() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		r.Take("b")
+		assertValue(t, 1, r.Get("a").QueueLength())
+		wg.Wait()
+	})
+
+	t.Run("doesn't evict the ratelimiter it returns", func(t *testing.T) {
+		t.Parallel()
+
+		r := local.NewRegistry(newBucket, 0, 1)
+		assertValue(t, true, r.Take("a"))
+
+		var wg sync.WaitGroup
+		defer wg.Wait()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.Wait(ctx, "a")
+		}()
+
+		for r.Get("a").QueueLength() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		// a can't be evicted while it has a waiter, so b is held over the cap, rather than starting fresh on every call
+		assertValue(t, true, r.Take("b"))
+		assertValue(t, false, r.Take("b"))
+		assertValue(t, 2, r.Len())
+	})
+	t.Run("doesn't evict a ratelimiter while it's taken from", func(t *testing.T) {
+		t.Parallel()
+
+		taking := make(chan struct{})
+		release := make(chan struct{})
+		limiters := map[string]*gatedLimiter{}
+		r := local.NewRegistry(func(key string) local.RegistryLimiter {
+			limiter := &gatedLimiter{LeakyBucket: local.NewLeakyBucket(1, time.Minute)}
+			if _, ok := limiters[key]; !ok && key == "a" {
+				limiter.taking, limiter.release = taking, release
+			}
+			limiters[key] = limiter
+			return limiter
+		}, 0, 1)
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assertValue(t, true, r.Take("a"))
+		}()
+
+		// a has been looked up, and is taking its token outside of the registry's lock, when b pushes the registry over its cap
+		<-taking
+		assertValue(t, true, r.Take("b"))
+		close(release)
+		wg.Wait()
+
+		// a keeps its state, rather than starting again from a fresh ratelimiter
+		assertValue(t, false, r.Take("a"))
+		assertValue(t, true, r.Get("a") == local.RegistryLimiter(limiters["a"]))
+	})
+}
+
+// gatedLimiter blocks TryTake until release is closed, after signalling taking, when they're set
+type gatedLimiter struct {
+	local.LeakyBucket
+	taking  chan struct{}
+	release chan struct{}
+}
+
+func (l *gatedLimiter) TryTake() bool {
+	if l.taking != nil {
+		l.taking <- struct{}{}
+		l.taking = nil
+		<-l.release
+	}
+	return l.LeakyBucket.TryTake()
+}
@@ -0,0 +1,142 @@
+package local
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+)
+
+// Scheduler runs callbacks once a token has been taken for them from a TokenSource. It's equivalent to calling WaitFunc for each
+// callback, except WaitFunc spawns a goroutine and timer per call, whereas a Scheduler holds every pending callback in a single
+// min-heap, ordered by when it was scheduled, and fires them from one goroutine with one timer. This makes it far cheaper when
+// thousands of callers are waiting on the same ratelimiter.
+//
+// The goroutine only runs while callbacks are pending, it exits once the heap is empty. As callbacks are invoked from this
+// goroutine one at a time, they should return quickly, handing off any long running work.
+type Scheduler interface {
+	// Schedule calls cb once a token has been taken for it, callbacks are called in the order they were scheduled. If ctx is cancelled
+	// first, cb is not called, and no token is taken for it.
+	Schedule(ctx context.Context, cb func())
+
+	// QueueLength will return how many callbacks are pending. Callbacks whose context has been cancelled are counted until the
+	// scheduler reaches them.
+	QueueLength() int
+}
+
+type scheduler struct {
+	// source is where tokens are taken from
+	source TokenSource
+	// m is the shared mutex to ensure calls are thread safe.
+	m sync.Mutex
+	// pending is a min-heap of the callbacks waiting for a token
+	pending scheduledCallbacks
+	// seq is incremented for each scheduled callback, it breaks ties between callbacks scheduled at the same time
+	seq uint64
+	// dispatching is true while the dispatcher goroutine is running
+	dispatching bool
+}
+
+type scheduledCallback struct {
+	ctx     context.Context
+	cb      func()
+	readyAt time.Time
+	seq     uint64
+}
+
+// scheduledCallbacks implements heap.Interface, ordering callbacks by when they're ready.
+type scheduledCallbacks []*scheduledCallback
+
+func (c scheduledCallbacks) Len() int { return len(c) }
+
+func (c scheduledCallbacks) Less(i, j int) bool {
+	if c[i].readyAt.Equal(c[j].readyAt) {
+		return c[i].seq < c[j].seq
+	}
+	return c[i].readyAt.Before(c[j].readyAt)
+}
+
+func (c scheduledCallbacks) Swap(i, j int) { c[i], c[j] = c[j], c[i] }
+
+func (c *scheduledCallbacks) Push(v interface{}) { *c = append(*c, v.(*scheduledCallback)) }
+
+func (c *scheduledCallbacks) Pop() interface{} {
+	old := *c
+	v := old[len(old)-1]
+	old[len(old)-1] = nil
+	*c = old[:len(old)-1]
+	return v
+}
+
+// NewScheduler creates a new scheduler taking tokens from source. See the Scheduler interface for more info about what this does.
+func NewScheduler(source TokenSource) Scheduler {
+	return &scheduler{source: source}
+}
+
+// Schedule calls cb once a token has been taken for it, callbacks are called in the order they were scheduled. If ctx is cancelled
+// first, cb is not called, and no token is taken for it.
+func (s *scheduler) Schedule(ctx context.Context, cb func()) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.seq++
+	heap.Push(&s.pending, &scheduledCallback{ctx: ctx, cb: cb, readyAt: time.Now(), seq: s.seq})
+
+	if !s.dispatching {
+		s.dispatching = true
+		go s.dispatch()
+	}
+}
+
+// QueueLength will return how many callbacks are pending. Callbacks whose context has been cancelled are counted until the
+// scheduler reaches them.
+func (s *scheduler) QueueLength() int {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return len(s.pending)
+}
+
+// dispatch takes tokens from the source and invokes the pending callbacks, until the heap is empty.
+func (s *scheduler) dispatch() {
+	var timer *time.Timer
+
+	for {
+		s.m.Lock()
+		for len(s.pending) > 0 && s.pending[0].ctx.Err() != nil {
+			// cancelled callbacks are discarded without taking a token
+			heap.Pop(&s.pending)
+		}
+
+		if len(s.pending) == 0 {
+			s.dispatching = false
+			s.m.Unlock()
+			return
+		}
+
+		next := s.pending[0]
+		wait := time.Until(next.readyAt)
+		if wait <= 0 {
+			available, duration := s.source.TryTakeWithDuration()
+			if available {
+				heap.Pop(&s.pending)
+				s.m.Unlock()
+				next.cb()
+				continue
+			}
+
+			wait = duration
+			if wait <= 0 {
+				// avoid spinning if the source can't say when its next token is due
+				wait = time.Millisecond
+			}
+		}
+		s.m.Unlock()
+
+		if timer == nil {
+			timer = time.NewTimer(wait)
+		} else {
+			timer.Reset(wait)
+		}
+		<-timer.C
+	}
+}
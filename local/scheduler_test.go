@@ -0,0 +1,79 @@
+package local_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aidenwallis/go-ratelimiting/local"
+)
+
+func TestScheduler(t *testing.T) {
+	t.Parallel() // these tests run in parallel as they involve blocking calls
+
+	t.Run("calls callbacks in order as tokens are available", func(t *testing.T) {
+		t.Parallel()
+
+		source := &manualSource{}
+		s := local.NewScheduler(source)
+
+		called := make(chan int, 3)
+		for i := 0; i < 3; i++ {
+			i := i
+			s.Schedule(context.Background(), func() { called <- i })
+		}
+		assertValue(t, 3, s.QueueLength())
+
+		source.add(2)
+		assertValue(t, 0, <-called)
+		assertValue(t, 1, <-called)
+
+		select {
+		case <-called:
+			t.Fatal("callback should not be called without a token")
+		case <-time.After(time.Millisecond * 20):
+		}
+		assertValue(t, 1, s.QueueLength())
+
+		source.add(1)
+		assertValue(t, 2, <-called)
+	})
+
+	t.Run("waits for the source to refill", func(t *testing.T) {
+		t.Parallel()
+
+		s := local.NewScheduler(local.NewLeakyBucket(1, time.Millisecond*50))
+
+		start := time.Now()
+		done := make(chan time.Duration, 2)
+		for i := 0; i < 2; i++ {
+			s.Schedule(context.Background(), func() { done <- time.Since(start) })
+		}
+
+		assertValue(t, true, <-done < time.Millisecond*10)
+		duration := <-done
+		assertValue(t, true, duration >= time.Millisecond*40 && duration <= time.Millisecond*100)
+		assertValue(t, 0, s.QueueLength())
+	})
+
+	t.Run("skips cancelled callbacks without taking a token", func(t *testing.T) {
+		t.Parallel()
+
+		source := &manualSource{}
+		s := local.NewScheduler(source)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		s.Schedule(ctx, func() { t.Error("cancelled callback should not be called") })
+
+		called := make(chan struct{}, 1)
+		s.Schedule(context.Background(), func() { called <- struct{}{} })
+
+		cancel()
+		source.add(1)
+		<-called
+
+		for s.QueueLength() > 0 {
+			time.Sleep(time.Millisecond)
+		}
+	})
+}
@@ -2,8 +2,11 @@ package local
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -15,6 +18,10 @@ var (
 	ErrDuration = errors.New("duration must be more than 0")
 )
 
+// minWaitInterval is the shortest a caller in Wait sleeps between attempts. With a tiny window, or a clock that lags behind the
+// timer, the next token can be due immediately, and sleeping for no time at all would spin the waiting goroutines.
+const minWaitInterval = time.Millisecond
+
 // SlidingWindow provides an interface for the sliding window ratelimiter.
 //
 // The sliding window ratelimiter is a fixed size window that holds a set of timestamps. When a token is taken, the current time is added to the window.
@@ -24,9 +31,13 @@ type SlidingWindow interface {
 	Wait(ctx context.Context)
 
 	// WaitFunc is equivalent to Wait except it calls a callback when it's able to accquire a token. Iif you cancel the context, cb is not called. This
-	// function does spawn a goroutine per invocation. If you want something more efficient, consider writing your own implementation using TryTakeWithDuration()
+	// function does spawn a goroutine per invocation. If you want something more efficient, consider a Scheduler, or writing your own implementation using TryTakeWithDuration()
 	WaitFunc(ctx context.Context, cb func())
 
+	// QueueLength will return how many callers are currently blocked in Wait or WaitFunc, waiting for a token. This is useful for
+	// shedding load when the queue is already deep.
+	QueueLength() int
+
 	// Size will return how many items are currently sitting in the window
 	Size() int
 
@@ -36,9 +47,33 @@ type SlidingWindow interface {
 	// Take will attempt to accquire a ratelimit window, it will return a boolean indicating whether it was able to accquire a token or not,
 	// and a duration for when you should next try.
 	TryTakeWithDuration() (bool, time.Duration)
+
+	// TryTakeAt is equivalent to TryTakeWithDuration, except it uses now as the current time rather than time.Now(), which lets
+	// tests and simulations step time precisely without sleeping. If now moves backwards, as a wall clock time can when the system
+	// clock is stepped back, no extra tokens are granted, and the ratelimiter carries on from the earlier time rather than waiting
+	// for the clock to catch back up.
+	TryTakeAt(now time.Time) (bool, time.Duration)
+
+	// TryTakeWithResetAt is equivalent to TryTakeWithDuration, except it returns the absolute time at which you should next try,
+	// which avoids skew when the result is passed through layers that add their own latency. On success, this is the current time,
+	// otherwise it's when the oldest token in the window expires, opening the next slot, which suits X-RateLimit-Reset.
+	TryTakeWithResetAt() (bool, time.Time)
+
+	// TryTakeN will attempt to accquire n tokens atomically, either all tokens are taken, or none are. Requesting fewer than 1 token,
+	// or more tokens than the window can hold, will never succeed.
+	TryTakeN(n int) bool
+
+	// TryTakeNWithDuration is equivalent to TryTakeN, except it also returns a duration for when you should next try, which is 0 when n
+	// can never succeed.
+	TryTakeNWithDuration(n int) (bool, time.Duration)
+
+	// Describe will return the window's effective configuration
+	Describe() LimiterInfo
 }
 
 type slidingWindow struct {
+	// waiters is how many callers are blocked waiting for a token, it's accessed atomically so it's kept first for alignment
+	waiters int64
 	// capacity is the max size of the window
 	capacity int
 	// duration is how long the token exists in the window for
@@ -47,10 +82,12 @@ type slidingWindow struct {
 	m sync.Mutex
 	// window stores a set of timestamps of when the tokens in the window expire.
 	window []time.Time
+	// opts holds the optional behaviour configured for the ratelimiter
+	opts *options
 }
 
 // NewSlidingWindow creates a new sliding window ratelimiter. See the SlidingWindow interface for more info about what this ratelimiter does.
-func NewSlidingWindow(capacity int, duration time.Duration) (SlidingWindow, error) {
+func NewSlidingWindow(capacity int, duration time.Duration, opts ...Option) (SlidingWindow, error) {
 	if capacity <= 0 {
 		return nil, ErrCapacity
 	}
@@ -63,14 +100,33 @@ func NewSlidingWindow(capacity int, duration time.Duration) (SlidingWindow, erro
 		duration: duration,
 		m:        sync.Mutex{},
 		window:   []time.Time{},
+		opts:     newOptions(opts),
 	}, nil
 }
 
+// NewSlidingWindowShared creates a new sliding window ratelimiter which enforces a fair share of globalCapacity, when the capacity
+// is split across instanceCount instances. See PerInstanceCapacity for how the share is calculated.
+func NewSlidingWindowShared(globalCapacity, instanceCount int, duration time.Duration, opts ...Option) (SlidingWindow, error) {
+	return NewSlidingWindow(PerInstanceCapacity(globalCapacity, instanceCount), duration, opts...)
+}
+
 // clean cleans up the current ratelimit window
 func (r *slidingWindow) clean() {
-	now := time.Now()
+	r.cleanAt(r.opts.now())
+}
+
+// cleanAt is equivalent to clean, except it removes the tokens that have expired as of now rather than time.Now().
+func (r *slidingWindow) cleanAt(now time.Time) {
 	toRemove := 0
 
+	// tokens can't expire more than a window from now unless time has moved backwards, which only happens when now has no
+	// monotonic clock reading, such as a wall clock time passed to TryTakeAt after the system clock was stepped back. They're
+	// brought forwards to expire a window from now, rather than staying in the window until the clock catches back up.
+	latest := now.Add(r.duration)
+	for i := len(r.window) - 1; i >= 0 && r.window[i].After(latest); i-- {
+		r.window[i] = latest
+	}
+
 	// find how many keys should be removed from the window.
 	for _, ts := range r.window {
 		if ts.After(now) {
@@ -91,19 +147,39 @@ func (r *slidingWindow) Wait(ctx context.Context) {
 // wait keeps trying to take a token, while also sleeping the goroutine while it waits for the next attempt. The wait functions just call this
 // under the hood.
 func (r *slidingWindow) wait(ctx context.Context) bool {
+	atomic.AddInt64(&r.waiters, 1)
+	defer atomic.AddInt64(&r.waiters, -1)
+
 	for {
 		available, duration := r.TryTakeWithDuration()
 		if available {
 			return true
 		}
+		if duration < minWaitInterval {
+			duration = minWaitInterval
+		}
 		if !r.awaitNextToken(ctx, duration) {
 			return false
 		}
 	}
 }
 
+// Describe will return the window's effective configuration
+func (r *slidingWindow) Describe() LimiterInfo {
+	return LimiterInfo{
+		Algorithm: AlgorithmSlidingWindow,
+		Capacity:  r.capacity,
+		Window:    r.duration,
+	}
+}
+
+// QueueLength will return how many callers are currently blocked in Wait or WaitFunc, waiting for a token.
+func (r *slidingWindow) QueueLength() int {
+	return int(atomic.LoadInt64(&r.waiters))
+}
+
 // WaitFunc is equivalent to Wait except it calls a callback when it's able to accquire a token. Iif you cancel the context, cb is not called. This
-// function does spawn a goroutine per invocation. If you want something more efficient, consider writing your own implementation using TryTakeWithDuration()
+// function does spawn a goroutine per invocation. If you want something more efficient, consider a Scheduler, or writing your own implementation using TryTakeWithDuration()
 func (r *slidingWindow) WaitFunc(ctx context.Context, cb func()) {
 	go func(ctx context.Context, cb func()) {
 		if r.wait(ctx) {
@@ -124,6 +200,51 @@ func (r *slidingWindow) awaitNextToken(ctx context.Context, duration time.Durati
 	}
 }
 
+// Refund gives back the most recently taken token, by removing it from the window.
+func (r *slidingWindow) Refund() {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.clean()
+	if len(r.window) > 0 {
+		r.window = r.window[:len(r.window)-1]
+	}
+}
+
+// Snapshot serializes when each token in the window expires, see Snapshotter.
+func (r *slidingWindow) Snapshot() ([]byte, error) {
+	r.m.Lock()
+	r.clean()
+	s := newSnapshot(r.Describe())
+	s.ExpiresAt = make([]time.Time, len(r.window))
+	for i, ts := range r.window {
+		s.ExpiresAt[i] = ts.UTC()
+	}
+	r.m.Unlock()
+
+	return json.Marshal(s)
+}
+
+// Restore replaces the tokens in the window with those serialized by Snapshot, see Snapshotter.
+func (r *slidingWindow) Restore(data []byte) error {
+	s, err := parseSnapshot(data, r.Describe(), r.opts.now())
+	if err != nil {
+		return err
+	}
+
+	window := s.ExpiresAt
+	sort.Slice(window, func(i, j int) bool { return window[i].Before(window[j]) })
+	if len(window) > r.capacity {
+		// the window can never hold more than its capacity, so only the latest tokens are kept
+		window = window[len(window)-r.capacity:]
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.window = append([]time.Time{}, window...)
+	r.clean()
+	return nil
+}
+
 // Size will return how many items are currently sitting in the window
 func (r *slidingWindow) Size() int {
 	r.m.Lock()
@@ -141,18 +262,70 @@ func (r *slidingWindow) TryTake() bool {
 // Take will attempt to accquire a ratelimit window, it will return a boolean indicating whether it was able to accquire a token or not,
 // and a duration for when you should next try.
 func (r *slidingWindow) TryTakeWithDuration() (bool, time.Duration) {
+	return r.TryTakeAt(r.opts.now())
+}
+
+// TryTakeAt is equivalent to TryTakeWithDuration, except it uses now as the current time rather than time.Now().
+func (r *slidingWindow) TryTakeAt(now time.Time) (bool, time.Duration) {
+	return r.tryTakeNAt(1, now)
+}
+
+// TryTakeWithResetAt is equivalent to TryTakeWithDuration, except it returns the absolute time at which you should next try,
+// which avoids skew when the result is passed through layers that add their own latency. On success, this is the current time.
+func (r *slidingWindow) TryTakeWithResetAt() (bool, time.Time) {
+	success, resetAt, remaining := r.tryTake(1, r.opts.now())
+	r.opts.emitDecision(DecisionEvent{Allowed: success, Remaining: remaining, TakeAmount: 1})
+	return success, resetAt
+}
+
+// TryTakeN will attempt to accquire n tokens atomically, either all tokens are taken, or none are. Requesting fewer than 1 token,
+// or more tokens than the window can hold, will never succeed.
+func (r *slidingWindow) TryTakeN(n int) bool {
+	resp, _ := r.TryTakeNWithDuration(n)
+	return resp
+}
+
+// TryTakeNWithDuration is equivalent to TryTakeN, except it also returns a duration for when you should next try, which is 0 when n
+// can never succeed.
+func (r *slidingWindow) TryTakeNWithDuration(n int) (bool, time.Duration) {
+	return r.tryTakeNAt(n, r.opts.now())
+}
+
+// tryTakeNAt attempts to take n tokens as of now, returning how long after now you should next try.
+func (r *slidingWindow) tryTakeNAt(n int, now time.Time) (bool, time.Duration) {
+	success, resetAt, remaining := r.tryTake(n, now)
+	r.opts.emitDecision(DecisionEvent{Allowed: success, Remaining: remaining, TakeAmount: n})
+	if success {
+		return true, 0
+	}
+	return false, resetAt.Sub(now)
+}
+
+// tryTake attempts to take n tokens under the lock as of now, returning when to next try and the remaining capacity alongside the
+// result.
+func (r *slidingWindow) tryTake(n int, now time.Time) (bool, time.Time, int) {
 	r.m.Lock()
 	defer r.m.Unlock()
 
 	// cleanup any items
-	r.clean()
+	r.cleanAt(now)
+
+	remaining := r.capacity - len(r.window)
 
-	if len(r.window) >= r.capacity {
-		// ratelimit is not available
-		return false, time.Until(r.window[0])
+	if n <= 0 || n > r.capacity {
+		// the take can never succeed, so there's no time worth trying again at
+		return false, now, remaining
 	}
 
-	// else add the token
-	r.window = append(r.window, time.Now().Add(r.duration))
-	return true, 0
+	if missing := n - remaining; missing > 0 {
+		// ratelimit is not available, n tokens are free once the oldest missing tokens expire
+		return false, r.window[missing-1], remaining
+	}
+
+	// else add the tokens
+	expiresAt := now.Add(r.duration)
+	for i := 0; i < n; i++ {
+		r.window = append(r.window, expiresAt)
+	}
+	return true, now, r.capacity - len(r.window)
 }
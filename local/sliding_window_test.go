@@ -2,6 +2,7 @@ package local_test
 
 import (
 	"context"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -21,6 +22,21 @@ func TestSlidingWindow(t *testing.T) {
 		assertValue(t, local.ErrDuration.Error(), err.Error())
 	})
 
+	t.Run("shares capacity across instances", func(t *testing.T) {
+		t.Parallel()
+
+		r, err := local.NewSlidingWindowShared(30, 3, time.Second*2)
+		assertNoError(t, err)
+
+		for i := 0; i < 10; i++ {
+			assertValue(t, true, r.TryTake())
+		}
+		assertValue(t, false, r.TryTake())
+
+		_, err = local.NewSlidingWindowShared(0, 3, time.Second)
+		assertValue(t, local.ErrCapacity.Error(), err.Error())
+	})
+
 	t.Run("ratelimits properly", func(t *testing.T) {
 		t.Parallel()
 		r, err := local.NewSlidingWindow(10, time.Second*2)
@@ -90,6 +106,134 @@ func TestSlidingWindow(t *testing.T) {
 		assertValue(t, true, duration >= time.Millisecond*950 && duration <= time.Millisecond*1050)
 	})
 
+	t.Run("gives absolute reset time", func(t *testing.T) {
+		t.Parallel()
+
+		r, _ := local.NewSlidingWindow(2, time.Second)
+		start := time.Now()
+		for i := 0; i < 2; i++ {
+			success, _ := r.TryTakeWithResetAt()
+			assertValue(t, true, success)
+		}
+
+		success, resetAt := r.TryTakeWithResetAt()
+		assertValue(t, false, success)
+
+		delay := resetAt.Sub(start)
+		assertValue(t, true, delay >= time.Millisecond*950 && delay <= time.Millisecond*1050)
+	})
+
+	t.Run("resets when the oldest token expires", func(t *testing.T) {
+		t.Parallel()
+
+		r, _ := local.NewSlidingWindow(2, time.Second)
+		start := time.Now()
+		assertValue(t, true, r.TryTake())
+
+		// the second token expires later, but the first slot opens as soon as the oldest token expires
+		time.Sleep(time.Millisecond * 300)
+		assertValue(t, true, r.TryTake())
+
+		success, resetAt := r.TryTakeWithResetAt()
+		assertValue(t, false, success)
+
+		delay := resetAt.Sub(start)
+		assertValue(t, true, delay >= time.Millisecond*950 && delay <= time.Millisecond*1050)
+	})
+
+	t.Run("takes n tokens atomically", func(t *testing.T) {
+		t.Parallel()
+
+		r, _ := local.NewSlidingWindow(5, time.Second)
+		assertValue(t, true, r.TryTakeN(3))
+		time.Sleep(time.Millisecond * 100)
+		assertValue(t, true, r.TryTake())
+
+		// only 1 slot is free, so none should be taken
+		success, duration := r.TryTakeNWithDuration(2)
+		assertValue(t, false, success)
+		assertValue(t, 4, r.Size())
+
+		// the first batch of 3 frees up the slots
+		assertValue(t, true, duration >= time.Millisecond*850 && duration <= time.Millisecond*950)
+
+		assertValue(t, true, r.TryTakeN(1))
+		assertValue(t, false, r.TryTakeN(6))
+	})
+
+	t.Run("never takes fewer than 1 or more than capacity", func(t *testing.T) {
+		t.Parallel()
+
+		r, _ := local.NewSlidingWindow(5, time.Second)
+		assertValue(t, true, r.TryTakeN(2))
+
+		for _, n := range []int{0, -2, 6} {
+			success, duration := r.TryTakeNWithDuration(n)
+			assertValue(t, false, success)
+			assertValue(t, time.Duration(0), duration)
+			assertValue(t, 2, r.Size())
+		}
+	})
+
+	t.Run("steps time with TryTakeAt", func(t *testing.T) {
+		t.Parallel()
+
+		now := time.Now()
+		r, err := local.NewSlidingWindow(1, time.Minute)
+		assertNoError(t, err)
+
+		success, _ := r.TryTakeAt(now)
+		assertValue(t, true, success)
+
+		success, duration := r.TryTakeAt(now.Add(time.Second * 30))
+		assertValue(t, false, success)
+		assertValue(t, time.Second*30, duration)
+
+		success, _ = r.TryTakeAt(now.Add(time.Minute))
+		assertValue(t, true, success)
+	})
+
+	t.Run("calls decision hook", func(t *testing.T) {
+		t.Parallel()
+
+		events := []local.DecisionEvent{}
+		r, _ := local.NewSlidingWindow(2, time.Second, local.WithOnDecision(func(e local.DecisionEvent) {
+			events = append(events, e)
+		}))
+
+		for i := 0; i < 3; i++ {
+			r.TryTake()
+		}
+
+		assertValue(t, 3, len(events))
+		assertValue(t, local.DecisionEvent{Allowed: true, Remaining: 1, TakeAmount: 1}, events[0])
+		assertValue(t, local.DecisionEvent{Allowed: true, Remaining: 0, TakeAmount: 1}, events[1])
+		assertValue(t, local.DecisionEvent{Allowed: false, Remaining: 0, TakeAmount: 1}, events[2])
+	})
+
+	t.Run("reports queue length", func(t *testing.T) {
+		t.Parallel()
+
+		r, _ := local.NewSlidingWindow(1, time.Millisecond*200)
+		assertValue(t, true, r.TryTake())
+		assertValue(t, 0, r.QueueLength())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		ch := make(chan struct{}, 3)
+		for i := 0; i < 3; i++ {
+			r.WaitFunc(ctx, func() { ch <- struct{}{} })
+		}
+
+		time.Sleep(time.Millisecond * 50)
+		assertValue(t, 3, r.QueueLength())
+
+		<-ch
+		time.Sleep(time.Millisecond * 50)
+		assertValue(t, 2, r.QueueLength())
+	})
+
 	t.Run("calls callback in waitFunc", func(t *testing.T) {
 		t.Parallel()
 
@@ -111,6 +255,57 @@ func TestSlidingWindow(t *testing.T) {
 		duration := time.Since(start)
 		assertValue(t, true, duration >= time.Millisecond*950 && duration <= time.Millisecond*1050)
 	})
+
+	t.Run("survives the clock stepping backwards", func(t *testing.T) {
+		t.Parallel()
+
+		r, err := local.NewSlidingWindow(2, time.Second)
+		assertNoError(t, err)
+
+		// Round(0) strips the monotonic clock reading, as a wall clock time wouldn't have one
+		now := time.Now().Round(0)
+		for i := 0; i < 2; i++ {
+			success, _ := r.TryTakeAt(now)
+			assertValue(t, true, success)
+		}
+
+		// the clock is stepped back an hour, which mustn't free up the window
+		now = now.Add(-time.Hour)
+		success, retryIn := r.TryTakeAt(now)
+		assertValue(t, false, success)
+		assertValue(t, time.Second, retryIn)
+
+		// nor should the tokens stay in the window for an hour until the clock catches back up
+		success, _ = r.TryTakeAt(now.Add(time.Second))
+		assertValue(t, true, success)
+	})
+
+	t.Run("does not spin waiting on a sub-millisecond window", func(t *testing.T) {
+		t.Parallel()
+
+		// the clock never moves, so the token never expires, and every attempt finds it due a nanosecond from now
+		clock := &manualClock{now: time.Now()}
+		var attempts int64
+		r, err := local.NewSlidingWindow(1, time.Nanosecond, local.WithClock(clock), local.WithOnDecision(func(local.DecisionEvent) {
+			atomic.AddInt64(&attempts, 1)
+		}))
+		assertNoError(t, err)
+		assertValue(t, true, r.TryTake())
+		atomic.StoreInt64(&attempts, 0)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+		defer cancel()
+
+		start := time.Now()
+		r.Wait(ctx)
+		elapsed := time.Since(start)
+
+		// every attempt after the first is made at least a millisecond after the last, rather than as fast as the waiter can loop
+		maxAttempts := int64(elapsed/time.Millisecond) + 1
+		if got := atomic.LoadInt64(&attempts); got > maxAttempts {
+			t.Errorf("expected at most %d attempts in %s but got %d", maxAttempts, elapsed, got)
+		}
+	})
 }
 
 func assertValue[T comparable](t *testing.T, expected, actualValue T) {
@@ -0,0 +1,73 @@
+package local
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrSnapshotMismatch is returned when restoring a snapshot which was taken from a ratelimiter with a different algorithm, capacity
+// or window.
+var ErrSnapshotMismatch = errors.New("snapshot doesn't match the ratelimiter's configuration")
+
+// Snapshotter is optionally implemented by a ratelimiter whose state can be saved and restored, which is useful to keep callers'
+// ratelimits across a graceful restart, rather than resetting them. The ratelimiters returned by NewLeakyBucket, NewAtomicLeakyBucket,
+// NewTickingLeakyBucket and NewSlidingWindow all implement it, and a snapshot of either leaky bucket can be restored into the other.
+//
+// Snapshots hold wall clock times, so they're only accurate when restored on a host with a similar clock.
+type Snapshotter interface {
+	// Snapshot serializes the ratelimiter's current state, alongside its configuration.
+	Snapshot() ([]byte, error)
+
+	// Restore replaces the ratelimiter's state with one serialized by Snapshot. ErrSnapshotMismatch is returned if the snapshot was
+	// taken from a ratelimiter with a different algorithm, capacity or window, in which case the state is left as it was.
+	Restore(data []byte) error
+}
+
+// snapshot is the serialized state of a ratelimiter, alongside the configuration it was taken with.
+type snapshot struct {
+	Algorithm string        `json:"algorithm"`
+	Capacity  int           `json:"capacity"`
+	Window    time.Duration `json:"window"`
+
+	// Tokens is how many tokens were in the leaky bucket, and LastFill is when it last gained one
+	Tokens   int        `json:"tokens,omitempty"`
+	LastFill *time.Time `json:"last_fill,omitempty"`
+
+	// ExpiresAt is when each token in the sliding window expires, oldest first
+	ExpiresAt []time.Time `json:"expires_at,omitempty"`
+}
+
+// newSnapshot creates a snapshot of a ratelimiter configured as info describes.
+func newSnapshot(info LimiterInfo) snapshot {
+	return snapshot{Algorithm: info.Algorithm, Capacity: info.Capacity, Window: info.Window}
+}
+
+// parseSnapshot decodes data, and checks that it was taken from a ratelimiter configured as info describes. Times after now, the
+// ratelimiter's current time, such as from a host whose clock was ahead, are brought back to now.
+func parseSnapshot(data []byte, info LimiterInfo, now time.Time) (*snapshot, error) {
+	s := &snapshot{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("decoding snapshot: %w", err)
+	}
+
+	if s.Algorithm != info.Algorithm || s.Capacity != info.Capacity || s.Window != info.Window {
+		return nil, fmt.Errorf(
+			"%w: snapshot is %s with %d per %s, but the ratelimiter is %s with %d per %s",
+			ErrSnapshotMismatch, s.Algorithm, s.Capacity, s.Window, info.Algorithm, info.Capacity, info.Window,
+		)
+	}
+
+	if s.LastFill != nil && s.LastFill.After(now) {
+		s.LastFill = &now
+	}
+
+	if s.Tokens < 0 {
+		s.Tokens = 0
+	} else if s.Tokens > s.Capacity {
+		s.Tokens = s.Capacity
+	}
+
+	return s, nil
+}
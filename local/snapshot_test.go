@@ -0,0 +1,146 @@
+package local_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aidenwallis/go-ratelimiting/local"
+)
+
+func TestSnapshotter(t *testing.T) {
+	t.Parallel()
+
+	constructors := map[string]func(int, time.Duration, ...local.Option) local.LeakyBucket{
+		"mutex":  local.NewLeakyBucket,
+		"atomic": local.NewAtomicLeakyBucket,
+	}
+
+	for name, constructor := range constructors {
+		constructor := constructor
+
+		t.Run(name+" leaky bucket", func(t *testing.T) {
+			t.Parallel()
+
+			r := constructor(5, time.Hour)
+			assertValue(t, true, r.TryTakeN(3))
+
+			data, err := r.(local.Snapshotter).Snapshot()
+			assertNoError(t, err)
+
+			// a snapshot can be restored into either leaky bucket
+			for restoreName, restoreConstructor := range constructors {
+				restored := restoreConstructor(5, time.Hour)
+				assertNoError(t, restored.(local.Snapshotter).Restore(data))
+				assertValue(t, 2, restored.Size())
+
+				// the fill carries on from when the snapshot was taken, rather than from when it was restored
+				inspection := restored.Inspect()
+				if d := time.Until(inspection.ResetAt); d <= 35*time.Minute || d > 36*time.Minute {
+					t.Errorf("%s: expected the bucket to be full in 36m but got %s", restoreName, d)
+				}
+			}
+		})
+	}
+
+	for name, constructor := range constructors {
+		constructor := constructor
+
+		t.Run(name+" leaky bucket restores against its own clock", func(t *testing.T) {
+			t.Parallel()
+
+			r := constructor(5, time.Hour)
+			assertValue(t, true, r.TryTakeN(5))
+
+			data, err := r.(local.Snapshotter).Snapshot()
+			assertNoError(t, err)
+
+			// the snapshot was taken an hour after the restoring bucket's clock, so it's brought back to that clock's now
+			clock := &manualClock{now: time.Now().Add(-time.Hour)}
+			restored := constructor(5, time.Hour, local.WithClock(clock))
+			assertNoError(t, restored.(local.Snapshotter).Restore(data))
+
+			// filling carries on from the restoring bucket's clock, rather than waiting for it to reach the snapshot's
+			clock.advance(time.Hour)
+			assertValue(t, 5, restored.Size())
+		})
+	}
+
+	t.Run("ticking leaky bucket", func(t *testing.T) {
+		t.Parallel()
+
+		r := local.NewTickingLeakyBucket(5, time.Hour)
+		defer r.Close()
+		assertValue(t, true, r.TryTakeN(4))
+
+		data, err := r.(local.Snapshotter).Snapshot()
+		assertNoError(t, err)
+
+		restored := local.NewTickingLeakyBucket(5, time.Hour)
+		defer restored.Close()
+		assertNoError(t, restored.(local.Snapshotter).Restore(data))
+		assertValue(t, 1, restored.Size())
+	})
+
+	t.Run("sliding window", func(t *testing.T) {
+		t.Parallel()
+
+		r, err := local.NewSlidingWindow(3, time.Hour)
+		assertNoError(t, err)
+		assertValue(t, true, r.TryTakeN(2))
+
+		data, err := r.(local.Snapshotter).Snapshot()
+		assertNoError(t, err)
+
+		restored, err := local.NewSlidingWindow(3, time.Hour)
+		assertNoError(t, err)
+		assertValue(t, true, restored.TryTake())
+		assertNoError(t, restored.(local.Snapshotter).Restore(data))
+		assertValue(t, 2, restored.Size())
+
+		// the restored tokens still expire an hour after they were taken
+		success, retryIn := restored.TryTakeNWithDuration(2)
+		assertValue(t, false, success)
+		if retryIn <= time.Hour-time.Minute || retryIn > time.Hour {
+			t.Errorf("expected to retry in an hour but got %s", retryIn)
+		}
+	})
+
+	t.Run("rejects mismatched configuration", func(t *testing.T) {
+		t.Parallel()
+
+		leaky := local.NewLeakyBucket(5, time.Hour)
+		data, err := leaky.(local.Snapshotter).Snapshot()
+		assertNoError(t, err)
+
+		window, err := local.NewSlidingWindow(5, time.Hour)
+		assertNoError(t, err)
+
+		testCases := map[string]local.Snapshotter{
+			"capacity":  local.NewLeakyBucket(6, time.Hour).(local.Snapshotter),
+			"window":    local.NewAtomicLeakyBucket(5, time.Minute).(local.Snapshotter),
+			"algorithm": window.(local.Snapshotter),
+		}
+
+		for name, r := range testCases {
+			if err := r.Restore(data); !errors.Is(err, local.ErrSnapshotMismatch) {
+				t.Errorf("%s: expected ErrSnapshotMismatch but got %v", name, err)
+			}
+		}
+
+		// the state is left as it was
+		assertValue(t, 0, window.Size())
+	})
+
+	t.Run("rejects invalid data", func(t *testing.T) {
+		t.Parallel()
+
+		r := local.NewLeakyBucket(5, time.Hour)
+		assertValue(t, true, r.TryTake())
+
+		if err := r.(local.Snapshotter).Restore([]byte("{")); err == nil {
+			t.Error("expected an error restoring invalid data")
+		}
+		assertValue(t, 4, r.Size())
+	})
+}
@@ -0,0 +1,51 @@
+package local
+
+import "context"
+
+// SpilloverLimiter is a Limiter that routes the requests it rejects to an overflow handler, such as a slower backend, rather than
+// only rejecting them.
+type SpilloverLimiter interface {
+	// TryTake will attempt to accquire a token, calling the overflow handler with context.Background() if one isn't available. It
+	// will return a boolean indicating whether it was able to accquire a token or not.
+	TryTake() bool
+
+	// TryTakeOrElse will attempt to accquire a token, calling fallback with ctx instead of the overflow handler if one isn't
+	// available, so that the request's context reaches it. It will return a boolean indicating whether it was able to accquire a
+	// token or not.
+	TryTakeOrElse(ctx context.Context, fallback func(ctx context.Context)) bool
+}
+
+type spillover struct {
+	limiter  Limiter
+	overflow func(ctx context.Context)
+}
+
+var _ Limiter = (*spillover)(nil)
+
+// Spillover wraps limiter, so that overflow is called whenever a token isn't available, which routes the overflow elsewhere, such
+// as to a slower backend, rather than only rejecting it. This keeps the overflow handling attached to the ratelimiter, rather than
+// repeated in every caller's branch on TryTake.
+//
+// The handler is called synchronously, before TryTake or TryTakeOrElse returns false, and after the ratelimiter's lock has been
+// released, so it's safe to call back into the ratelimiter. Wrap the ratelimiter once, and use TryTakeOrElse to pass each request's
+// context through to its handler.
+func Spillover(limiter Limiter, overflow func(ctx context.Context)) SpilloverLimiter {
+	return &spillover{limiter: limiter, overflow: overflow}
+}
+
+// TryTake will attempt to accquire a token, calling overflow with context.Background() if one isn't available. It will return a
+// boolean indicating whether it was able to accquire a token or not.
+func (r *spillover) TryTake() bool {
+	return r.TryTakeOrElse(context.Background(), r.overflow)
+}
+
+// TryTakeOrElse will attempt to accquire a token, calling fallback with ctx if one isn't available. It will return a boolean
+// indicating whether it was able to accquire a token or not.
+func (r *spillover) TryTakeOrElse(ctx context.Context, fallback func(ctx context.Context)) bool {
+	if r.limiter.TryTake() {
+		return true
+	}
+
+	fallback(ctx)
+	return false
+}
@@ -0,0 +1,60 @@
+package local_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aidenwallis/go-ratelimiting/local"
+)
+
+func TestSpillover(t *testing.T) {
+	t.Run("calls overflow when a token isn't available", func(t *testing.T) {
+		overflowed := 0
+		r := local.Spillover(local.NewLeakyBucket(2, time.Minute), func(context.Context) { overflowed++ })
+
+		assertValue(t, true, r.TryTake())
+		assertValue(t, true, r.TryTake())
+		assertValue(t, 0, overflowed)
+
+		assertValue(t, false, r.TryTake())
+		assertValue(t, false, r.TryTake())
+		assertValue(t, 2, overflowed)
+	})
+
+	t.Run("can call back into the ratelimiter", func(t *testing.T) {
+		bucket := local.NewLeakyBucket(1, time.Minute)
+		r := local.Spillover(bucket, func(context.Context) { assertValue(t, 0, bucket.Size()) })
+
+		assertValue(t, true, r.TryTake())
+		assertValue(t, false, r.TryTake())
+	})
+
+	t.Run("wraps any limiter", func(t *testing.T) {
+		overflowed := 0
+		global := local.NewLeakyBucket(1, time.Minute)
+		r := local.Spillover(local.GlobalCap(local.NewLeakyBucket(2, time.Minute), global), func(context.Context) { overflowed++ })
+
+		assertValue(t, true, r.TryTake())
+		assertValue(t, false, r.TryTake())
+		assertValue(t, 1, overflowed)
+	})
+
+	t.Run("passes the request's context to the fallback", func(t *testing.T) {
+		type contextKey struct{}
+
+		overflowed := 0
+		r := local.Spillover(local.NewLeakyBucket(1, time.Minute), func(context.Context) { overflowed++ })
+		ctx := context.WithValue(context.Background(), contextKey{}, "request")
+
+		got := ""
+		fallback := func(ctx context.Context) { got, _ = ctx.Value(contextKey{}).(string) }
+
+		assertValue(t, true, r.TryTakeOrElse(ctx, fallback))
+		assertValue(t, "", got)
+
+		assertValue(t, false, r.TryTakeOrElse(ctx, fallback))
+		assertValue(t, "request", got)
+		assertValue(t, 0, overflowed)
+	})
+}
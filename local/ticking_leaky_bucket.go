@@ -0,0 +1,126 @@
+package local
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// TickingLeakyBucket is a LeakyBucket which is filled by a background goroutine, rather than lazily as it's called.
+//
+// The goroutine adds a token every refill interval and wakes the callers blocked in Wait, so Size is never stale, and waiters are
+// released as soon as a token is added, rather than each running their own timer. This trades a goroutine per bucket for crisper
+// timing and cheaper wakeups when many callers are waiting.
+//
+// As the bucket is only filled by the goroutine, TryTakeAt does not fill the bucket up to the given time.
+type TickingLeakyBucket interface {
+	LeakyBucket
+
+	// Close stops the background goroutine, after which the bucket fills lazily, like one created by NewLeakyBucket.
+	Close()
+}
+
+type tickingLeakyBucket struct {
+	*leakyBucket
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewTickingLeakyBucket creates a new leaky bucket ratelimiter, which is filled by a background goroutine. Close must be called to
+// stop the goroutine once the bucket is no longer used. See the TickingLeakyBucket interface for more info about what this does.
+func NewTickingLeakyBucket(tokensPerWindow int, window time.Duration, opts ...Option) TickingLeakyBucket {
+	bucket := NewLeakyBucket(tokensPerWindow, window, opts...).(*leakyBucket)
+	bucket.ticking = true
+	bucket.tick = sync.NewCond(&bucket.m)
+
+	r := &tickingLeakyBucket{leakyBucket: bucket, stop: make(chan struct{})}
+	go r.fill()
+	return r
+}
+
+// Close stops the background goroutine, after which the bucket fills lazily.
+func (r *tickingLeakyBucket) Close() {
+	r.closeOnce.Do(func() {
+		close(r.stop)
+
+		r.m.Lock()
+		defer r.m.Unlock()
+		r.ticking = false
+		r.lastFill = r.opts.now()
+		r.tick.Broadcast() // waiters fall back to waiting lazily
+	})
+}
+
+// fill adds a token every refill interval until the bucket is closed.
+func (r *tickingLeakyBucket) fill() {
+	ticker := time.NewTicker(r.rate)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case now := <-ticker.C:
+			r.addToken(now)
+		}
+	}
+}
+
+// addToken adds a single token to the bucket, and wakes any waiters.
+func (r *leakyBucket) addToken(now time.Time) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if !r.ticking {
+		return
+	}
+
+	r.lastFill = now
+	if r.tokens < r.max {
+		r.tokens++
+		r.stats.TokensFilled++
+		r.stats.LastFillTokens = 1
+		r.stats.LastFillAt = now.UTC()
+		r.tick.Broadcast()
+	}
+}
+
+// waitForTick blocks until the background goroutine adds a token, and takes it. It returns false for ticking when the bucket was
+// closed before a token was taken, in which case the caller should wait lazily instead.
+func (r *leakyBucket) waitForTick(ctx context.Context) (success bool, ticking bool) {
+	if done := ctx.Done(); done != nil {
+		stop := make(chan struct{})
+		defer close(stop)
+
+		go func() {
+			select {
+			case <-done:
+				// wake the waiter so it notices the context is cancelled
+				r.m.Lock()
+				r.tick.Broadcast()
+				r.m.Unlock()
+			case <-stop:
+			}
+		}()
+	}
+
+	r.m.Lock()
+	for r.ticking && r.tokens < 1+r.opts.reserve && ctx.Err() == nil {
+		r.tick.Wait()
+	}
+
+	if !r.ticking {
+		r.m.Unlock()
+		return false, false
+	}
+	if ctx.Err() != nil {
+		r.m.Unlock()
+		return false, true
+	}
+
+	_, _, remaining := r.unsafeTryTake(1, r.opts.reserve, r.opts.now())
+	r.m.Unlock()
+
+	r.opts.emitDecision(DecisionEvent{Allowed: true, Remaining: remaining, TakeAmount: 1})
+	return true, true
+}
@@ -0,0 +1,108 @@
+package local_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aidenwallis/go-ratelimiting/local"
+)
+
+func TestTickingLeakyBucket(t *testing.T) {
+	t.Parallel() // these tests run in parallel as they involve blocking calls
+
+	t.Run("fills in the background", func(t *testing.T) {
+		t.Parallel()
+
+		r := local.NewTickingLeakyBucket(2, time.Millisecond*100)
+		defer r.Close()
+
+		assertValue(t, true, r.TryTakeN(2))
+		assertValue(t, 0, r.Size())
+
+		time.Sleep(time.Millisecond * 120)
+		assertValue(t, 2, r.Size())
+		assertValue(t, int64(2), r.Stats().TokensFilled)
+	})
+
+	t.Run("releases waiters as tokens are added", func(t *testing.T) {
+		t.Parallel()
+
+		r := local.NewTickingLeakyBucket(1, time.Millisecond*20)
+		defer r.Close()
+		assertValue(t, true, r.TryTake())
+
+		start := time.Now()
+		var wg sync.WaitGroup
+		for i := 0; i < 3; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				r.Wait(context.Background())
+			}()
+		}
+		wg.Wait()
+
+		assertValue(t, true, time.Since(start) >= time.Millisecond*40)
+		assertValue(t, 0, r.QueueLength())
+		assertValue(t, int64(4), r.Stats().Granted)
+	})
+
+	t.Run("cancels waiters", func(t *testing.T) {
+		t.Parallel()
+
+		r := local.NewTickingLeakyBucket(1, time.Hour)
+		defer r.Close()
+		assertValue(t, true, r.TryTake())
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+		defer cancel()
+
+		r.Wait(ctx)
+		assertValue(t, 0, r.Size())
+	})
+
+	t.Run("waiters leave the reserve", func(t *testing.T) {
+		t.Parallel()
+
+		r := local.NewTickingLeakyBucket(2, time.Hour, local.WithReserve(1))
+		defer r.Close()
+		assertValue(t, true, r.TryTake())
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+		defer cancel()
+
+		r.Wait(ctx)
+		assertValue(t, 1, r.Size())
+
+		success, _ := r.(local.PriorityTaker).TryTakeHighPriority(1)
+		assertValue(t, true, success)
+	})
+
+	t.Run("fills lazily once closed", func(t *testing.T) {
+		t.Parallel()
+
+		r := local.NewTickingLeakyBucket(1, time.Millisecond*50)
+		assertValue(t, true, r.TryTake())
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			r.Wait(context.Background())
+		}()
+
+		for r.QueueLength() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		r.Close()
+		r.Close() // closing twice is safe
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("waiter was not released after closing")
+		}
+	})
+}
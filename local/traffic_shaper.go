@@ -0,0 +1,223 @@
+package local
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrQueueDepth is returned when the traffic shaper or queueing limiter queue depth provided is less than or equal to 0
+	ErrQueueDepth = errors.New("queue depth must be more than 0")
+
+	// ErrQueueFull is returned by TrafficShaper.Submit and QueueingLimiter.Do when the queue already holds the maximum amount of pending requests
+	ErrQueueFull = errors.New("queue is full")
+)
+
+// TrafficShaper provides an interface for the traffic shaping ratelimiter.
+//
+// The traffic shaper combines a leaky bucket's constant output rate with a bounded input queue. Requests are submitted into the
+// queue and released one at a time at the leaky bucket rate, so callers are smoothed out to a steady rate rather than being
+// allowed to burst. Once the queue holds queueDepth pending requests, any further submissions are rejected immediately, giving
+// callers backpressure rather than an unbounded wait.
+//
+// For example, if you allow 10 tokens per a window of 1 second with a queue depth of 5, a request is released every 100ms, and
+// at most 5 requests may be waiting for their turn at any time.
+type TrafficShaper interface {
+	// Submit enqueues a request and blocks the goroutine until it is released by the shaper. ErrQueueFull is returned immediately
+	// if the queue is full. If the context is cancelled before the request is released, the context's error is returned, and the
+	// requests behind it are brought forward to take its release.
+	Submit(ctx context.Context) error
+
+	// Pending will return how many requests are currently waiting in the queue
+	Pending() int
+
+	// Describe will return the traffic shaper's effective configuration
+	Describe() LimiterInfo
+}
+
+type trafficShaper struct {
+	// capacity is how many requests are released per window
+	capacity int
+	// window is the duration capacity applies to
+	window time.Duration
+	// queueDepth is the maximum amount of requests that may be pending at any time
+	queueDepth int
+	// rate is how often a request is released from the queue
+	rate time.Duration
+	// m is the shared mutex to ensure calls are thread safe.
+	m sync.Mutex
+	// lastRelease is when the most recently released request was released.
+	lastRelease time.Time
+	// queue holds the requests waiting to be released, in the order they're released
+	queue []*trafficShaperSlot
+}
+
+// trafficShaperSlot is a request waiting in the queue.
+type trafficShaperSlot struct {
+	// submittedAt is when the request was submitted, it's never released before then
+	submittedAt time.Time
+	// releaseAt is when the request is released, it's guarded by the shaper's mutex
+	releaseAt time.Time
+	// moved is signalled when releaseAt is brought forward, as a request ahead of it was cancelled
+	moved chan struct{}
+}
+
+// NewTrafficShaper creates a new traffic shaping ratelimiter. See the TrafficShaper interface for more info about what this ratelimiter does.
+func NewTrafficShaper(tokensPerWindow int, window time.Duration, queueDepth int) (TrafficShaper, error) {
+	if tokensPerWindow <= 0 {
+		return nil, ErrCapacity
+	}
+	if window <= 0 {
+		return nil, ErrDuration
+	}
+	if queueDepth <= 0 {
+		return nil, ErrQueueDepth
+	}
+
+	return &trafficShaper{
+		capacity:   tokensPerWindow,
+		window:     window,
+		queueDepth: queueDepth,
+		rate:       window / time.Duration(tokensPerWindow),
+	}, nil
+}
+
+// Submit enqueues a request and blocks the goroutine until it is released by the shaper. ErrQueueFull is returned immediately
+// if the queue is full. If the context is cancelled before the request is released, the context's error is returned, and the
+// requests behind it are brought forward to take its release.
+func (r *trafficShaper) Submit(ctx context.Context) error {
+	slot, ok := r.reserve()
+	if !ok {
+		return ErrQueueFull
+	}
+
+	for {
+		timer := time.NewTimer(time.Until(r.releaseAt(slot)))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			r.cancel(slot)
+			return ctx.Err()
+		case <-slot.moved:
+			// a request ahead was cancelled, so wait for the new release time instead
+			timer.Stop()
+		case <-timer.C:
+			r.release(slot)
+			return nil
+		}
+	}
+}
+
+// Pending will return how many requests are currently waiting in the queue
+func (r *trafficShaper) Pending() int {
+	r.m.Lock()
+	defer r.m.Unlock()
+	return len(r.queue)
+}
+
+// Describe will return the traffic shaper's effective configuration
+func (r *trafficShaper) Describe() LimiterInfo {
+	return LimiterInfo{
+		Algorithm:      AlgorithmTrafficShaper,
+		Capacity:       r.capacity,
+		Window:         r.window,
+		RefillInterval: r.rate,
+		QueueDepth:     r.queueDepth,
+	}
+}
+
+// reserve claims a slot at the back of the queue, which is released a rate after the request ahead of it.
+func (r *trafficShaper) reserve() (*trafficShaperSlot, bool) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if len(r.queue) >= r.queueDepth {
+		// queue is full, reject immediately
+		return nil, false
+	}
+
+	slot := &trafficShaperSlot{submittedAt: time.Now(), moved: make(chan struct{}, 1)}
+	r.queue = append(r.queue, slot)
+	r.unsafeSchedule(len(r.queue) - 1)
+
+	return slot, true
+}
+
+// releaseAt returns when slot is released.
+func (r *trafficShaper) releaseAt(slot *trafficShaperSlot) time.Time {
+	r.m.Lock()
+	defer r.m.Unlock()
+	return slot.releaseAt
+}
+
+// release frees the slot claimed by reserve once it's been released.
+func (r *trafficShaper) release(slot *trafficShaperSlot) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if slot.releaseAt.After(r.lastRelease) {
+		r.lastRelease = slot.releaseAt
+	}
+	r.unsafeRemove(slot)
+}
+
+// cancel frees the slot claimed by reserve when the caller gives up, bringing forward the requests behind it, so they aren't
+// delayed by a release that nobody uses.
+func (r *trafficShaper) cancel(slot *trafficShaperSlot) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if i := r.unsafeRemove(slot); i >= 0 {
+		r.unsafeSchedule(i)
+	}
+}
+
+// unsafeRemove removes slot from the queue, returning where it was, or -1 if it wasn't queued.
+//
+// Ensure you have locked the mutex outside of this function before calling it.
+func (r *trafficShaper) unsafeRemove(slot *trafficShaperSlot) int {
+	for i, queued := range r.queue {
+		if queued == slot {
+			r.queue = append(r.queue[:i], r.queue[i+1:]...)
+			return i
+		}
+	}
+	return -1
+}
+
+// unsafeSchedule works out when the slots from index i onwards in the queue are released, each slot is released a rate after the
+// slot ahead of it, but never before it was submitted. Slots whose release is brought forward are signalled.
+//
+// Ensure you have locked the mutex outside of this function before calling it.
+func (r *trafficShaper) unsafeSchedule(i int) {
+	for ; i < len(r.queue); i++ {
+		slot := r.queue[i]
+
+		previous := r.lastRelease
+		if i > 0 {
+			previous = r.queue[i-1].releaseAt
+		}
+
+		releaseAt := slot.submittedAt
+		if next := previous.Add(r.rate); !previous.IsZero() && next.After(releaseAt) {
+			releaseAt = next
+		}
+
+		if slot.releaseAt.IsZero() {
+			slot.releaseAt = releaseAt
+			continue
+		}
+
+		if releaseAt.Before(slot.releaseAt) {
+			slot.releaseAt = releaseAt
+			select {
+			case slot.moved <- struct{}{}:
+			default:
+				// the slot has already been signalled, and reads its new release time once it wakes
+			}
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package local_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aidenwallis/go-ratelimiting/local"
+)
+
+func TestTrafficShaper(t *testing.T) {
+	t.Parallel() // these tests run in parallel as they involve blocking calls
+
+	t.Run("validates arguments correctly", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := local.NewTrafficShaper(0, time.Second, 1)
+		assertValue(t, local.ErrCapacity.Error(), err.Error())
+
+		_, err = local.NewTrafficShaper(10, 0, 1)
+		assertValue(t, local.ErrDuration.Error(), err.Error())
+
+		_, err = local.NewTrafficShaper(10, time.Second, 0)
+		assertValue(t, local.ErrQueueDepth.Error(), err.Error())
+	})
+
+	t.Run("releases requests at a constant rate", func(t *testing.T) {
+		t.Parallel()
+
+		r, err := local.NewTrafficShaper(10, time.Second, 5)
+		assertNoError(t, err)
+
+		start := time.Now()
+		for i := 0; i < 3; i++ {
+			assertNoError(t, r.Submit(context.Background()))
+		}
+
+		// the first request is released immediately, then each one after is released 100ms apart
+		duration := time.Since(start)
+		assertValue(t, true, duration >= time.Millisecond*195 && duration <= time.Millisecond*250)
+	})
+
+	t.Run("rejects when the queue is full", func(t *testing.T) {
+		t.Parallel()
+
+		r, _ := local.NewTrafficShaper(1, time.Millisecond*500, 2)
+
+		wg := sync.WaitGroup{}
+		for i := 0; i < 2; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_ = r.Submit(context.Background())
+			}()
+		}
+
+		// give the goroutines time to enqueue, the second one will be held for 500ms
+		time.Sleep(time.Millisecond * 50)
+		assertValue(t, 1, r.Pending())
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = r.Submit(context.Background())
+		}()
+		time.Sleep(time.Millisecond * 50)
+		assertValue(t, 2, r.Pending())
+
+		start := time.Now()
+		assertValue(t, local.ErrQueueFull.Error(), r.Submit(context.Background()).Error())
+		assertValue(t, true, time.Since(start) < time.Millisecond*10)
+
+		wg.Wait()
+		assertValue(t, 0, r.Pending())
+	})
+
+	t.Run("returns context error when cancelled", func(t *testing.T) {
+		t.Parallel()
+
+		r, _ := local.NewTrafficShaper(1, time.Second, 2)
+		assertNoError(t, r.Submit(context.Background()))
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+		defer cancel()
+
+		assertValue(t, context.DeadlineExceeded.Error(), r.Submit(ctx).Error())
+		assertValue(t, 0, r.Pending())
+	})
+
+	t.Run("gives a cancelled request's release to the requests behind it", func(t *testing.T) {
+		t.Parallel()
+
+		r, _ := local.NewTrafficShaper(10, time.Second, 5)
+		start := time.Now()
+		assertNoError(t, r.Submit(context.Background()))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancelled := make(chan error, 1)
+		go func() {
+			cancelled <- r.Submit(ctx)
+		}()
+
+		for r.Pending() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		released := make(chan time.Duration, 1)
+		go func() {
+			assertNoError(t, r.Submit(context.Background()))
+			released <- time.Since(start)
+		}()
+
+		for r.Pending() < 2 {
+			time.Sleep(time.Millisecond)
+		}
+
+		// the second request gives up, so the third is released 100ms after the first rather than 200ms
+		cancel()
+		assertValue(t, context.Canceled.Error(), (<-cancelled).Error())
+
+		duration := <-released
+		assertValue(t, true, duration >= time.Millisecond*95 && duration <= time.Millisecond*150)
+		assertValue(t, 0, r.Pending())
+
+		// the next request is released a rate after the third, rather than a rate after the cancelled one
+		assertNoError(t, r.Submit(context.Background()))
+		duration = time.Since(start)
+		assertValue(t, true, duration >= time.Millisecond*195 && duration <= time.Millisecond*250)
+	})
+}
@@ -0,0 +1,227 @@
+package local
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrWeight is returned when registering a class with a weight less than or equal to 0
+var ErrWeight = errors.New("weight must be more than 0")
+
+// TokenSource is a ratelimiter that tokens can be taken from, it's implemented by LeakyBucket, SlidingWindow and Composite.
+type TokenSource interface {
+	TryTakeWithDuration() (bool, time.Duration)
+}
+
+// WeightedScheduler shares the tokens from a single TokenSource between multiple classes of traffic, such as interactive, batch and
+// background requests.
+//
+// When demand exceeds supply, queued requests are released in proportion to their class's weight: a class with a weight of 3 is
+// released 3 tokens for every 1 given to a class with a weight of 1. Classes that have been idle don't bank credit, so a class
+// can't starve the others after a quiet period. When only one class is waiting, it receives every token.
+//
+// If a request is cancelled after a token was taken for it, the token is handed to the next waiting request, or refunded to the
+// source if nothing is waiting. Sources that don't implement Refunder can't give back their token, so it's consumed.
+//
+// While any requests are queued, a single goroutine dispatches tokens to them, it exits once the queues are empty.
+type WeightedScheduler interface {
+	// Register adds a new class of traffic with the given weight. ErrWeight is returned if weight is less than or equal to 0.
+	Register(weight int) (WeightedClass, error)
+}
+
+// WeightedClass is a class of traffic registered with a WeightedScheduler.
+type WeightedClass interface {
+	// Wait will block the goroutine til a ratelimit token is dispatched to this class. You can use context to cancel the wait.
+	Wait(ctx context.Context)
+
+	// QueueLength will return how many callers in this class are currently blocked in Wait, waiting for a token.
+	QueueLength() int
+
+	// TryTake will attempt to accquire a token, it will return a boolean indicating whether it was able to accquire a token or not.
+	// TryTake never jumps the queue, so it fails whenever requests from any class are already waiting.
+	TryTake() bool
+}
+
+type weightedScheduler struct {
+	// source is where tokens are taken from
+	source TokenSource
+	// m is the shared mutex to ensure calls are thread safe.
+	m sync.Mutex
+	// classes are the registered classes, in registration order which is used to break ties
+	classes []*weightedClass
+	// virtualTime is the finish tag of the most recently served request, idle classes are brought forward to it
+	virtualTime float64
+	// dispatching is true while the dispatcher goroutine is running
+	dispatching bool
+}
+
+type weightedClass struct {
+	scheduler *weightedScheduler
+	// weight is how many tokens this class receives relative to the other classes
+	weight int
+	// finish is the virtual time at which this class's next request is due to be served
+	finish float64
+	// queue holds the waiting requests, in the order they arrived
+	queue []chan struct{}
+}
+
+// NewWeightedScheduler creates a new weighted scheduler taking tokens from source. See the WeightedScheduler interface for more
+// info about what this does.
+func NewWeightedScheduler(source TokenSource) WeightedScheduler {
+	return &weightedScheduler{source: source}
+}
+
+// Register adds a new class of traffic with the given weight. ErrWeight is returned if weight is less than or equal to 0.
+func (s *weightedScheduler) Register(weight int) (WeightedClass, error) {
+	if weight <= 0 {
+		return nil, ErrWeight
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	class := &weightedClass{scheduler: s, weight: weight, finish: s.virtualTime}
+	s.classes = append(s.classes, class)
+	return class, nil
+}
+
+// unsafeNext returns the waiting class with the earliest finish tag, or nil if nothing is waiting. Ensure you have locked the
+// mutex outside of this function before calling it.
+func (s *weightedScheduler) unsafeNext() *weightedClass {
+	var next *weightedClass
+	for _, class := range s.classes {
+		if len(class.queue) > 0 && (next == nil || class.finish < next.finish) {
+			next = class
+		}
+	}
+	return next
+}
+
+// unsafeServe charges class for a token. Ensure you have locked the mutex outside of this function before calling it.
+func (s *weightedScheduler) unsafeServe(class *weightedClass) {
+	s.virtualTime = class.finish
+	class.finish += 1 / float64(class.weight)
+}
+
+// unsafeDeliver hands a token to the request at the front of class's queue. Ensure you have locked the mutex outside of this function
+// before calling it.
+func (s *weightedScheduler) unsafeDeliver(class *weightedClass) {
+	s.unsafeServe(class)
+	ch := class.queue[0]
+	class.queue = class.queue[1:]
+	ch <- struct{}{}
+}
+
+// unsafeGiveBack hands a token that was taken but won't be used to the next waiting class, or refunds it to the source if nothing is
+// waiting. Ensure you have locked the mutex outside of this function before calling it.
+func (s *weightedScheduler) unsafeGiveBack() {
+	if class := s.unsafeNext(); class != nil {
+		s.unsafeDeliver(class)
+		return
+	}
+
+	if refunder, ok := s.source.(Refunder); ok {
+		refunder.Refund()
+	}
+}
+
+// dispatch takes tokens from the source and hands them to the waiting classes, until nothing is waiting.
+func (s *weightedScheduler) dispatch() {
+	for {
+		s.m.Lock()
+		if s.unsafeNext() == nil {
+			s.dispatching = false
+			s.m.Unlock()
+			return
+		}
+		s.m.Unlock()
+
+		available, duration := s.source.TryTakeWithDuration()
+		if !available {
+			if duration <= 0 {
+				// avoid spinning if the source can't say when its next token is due
+				duration = time.Millisecond
+			}
+			time.Sleep(duration)
+			continue
+		}
+
+		s.m.Lock()
+		class := s.unsafeNext()
+		if class == nil {
+			// every waiter cancelled while the token was being taken
+			s.unsafeGiveBack()
+			s.dispatching = false
+			s.m.Unlock()
+			return
+		}
+
+		s.unsafeDeliver(class)
+		s.m.Unlock()
+	}
+}
+
+// Wait will block the goroutine til a ratelimit token is dispatched to this class. You can use context to cancel the wait.
+func (c *weightedClass) Wait(ctx context.Context) {
+	s := c.scheduler
+	ch := make(chan struct{}, 1)
+
+	s.m.Lock()
+	if len(c.queue) == 0 && c.finish < s.virtualTime {
+		// idle classes don't bank credit
+		c.finish = s.virtualTime
+	}
+	c.queue = append(c.queue, ch)
+	if !s.dispatching {
+		s.dispatching = true
+		go s.dispatch()
+	}
+	s.m.Unlock()
+
+	select {
+	case <-ch:
+	case <-ctx.Done():
+		s.m.Lock()
+		defer s.m.Unlock()
+		for i, queued := range c.queue {
+			if queued == ch {
+				c.queue = append(c.queue[:i], c.queue[i+1:]...)
+				return
+			}
+		}
+
+		// the token was dispatched as the context was cancelled, so pass it on rather than losing it
+		s.unsafeGiveBack()
+	}
+}
+
+// QueueLength will return how many callers in this class are currently blocked in Wait, waiting for a token.
+func (c *weightedClass) QueueLength() int {
+	c.scheduler.m.Lock()
+	defer c.scheduler.m.Unlock()
+	return len(c.queue)
+}
+
+// TryTake will attempt to accquire a token, it will return a boolean indicating whether it was able to accquire a token or not.
+// TryTake never jumps the queue, so it fails whenever requests from any class are already waiting.
+func (c *weightedClass) TryTake() bool {
+	s := c.scheduler
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.unsafeNext() != nil {
+		return false
+	}
+
+	if available, _ := s.source.TryTakeWithDuration(); !available {
+		return false
+	}
+
+	if c.finish < s.virtualTime {
+		c.finish = s.virtualTime
+	}
+	s.unsafeServe(c)
+	return true
+}
@@ -0,0 +1,167 @@
+package local_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aidenwallis/go-ratelimiting/local"
+)
+
+// manualSource only hands out tokens once they're added by the test
+type manualSource struct {
+	m      sync.Mutex
+	tokens int
+}
+
+func (s *manualSource) add(n int) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.tokens += n
+}
+
+func (s *manualSource) TryTakeWithDuration() (bool, time.Duration) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.tokens > 0 {
+		s.tokens--
+		return true, 0
+	}
+	return false, time.Millisecond
+}
+
+// gatedSource holds every take until the test opens the gate, and counts the tokens refunded to it
+type gatedSource struct {
+	taking   chan struct{}
+	gate     chan struct{}
+	refunded int32
+}
+
+func (s *gatedSource) TryTakeWithDuration() (bool, time.Duration) {
+	s.taking <- struct{}{}
+	<-s.gate
+	return true, 0
+}
+
+func (s *gatedSource) Refund() {
+	atomic.AddInt32(&s.refunded, 1)
+}
+
+func TestWeightedScheduler(t *testing.T) {
+	t.Parallel() // these tests run in parallel as they involve blocking calls
+
+	t.Run("validates weight", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := local.NewWeightedScheduler(&manualSource{}).Register(0)
+		assertValue(t, local.ErrWeight.Error(), err.Error())
+	})
+
+	t.Run("dispatches tokens proportional to weight", func(t *testing.T) {
+		t.Parallel()
+
+		source := &manualSource{}
+		s := local.NewWeightedScheduler(source)
+		heavy, _ := s.Register(3)
+		light, _ := s.Register(1)
+
+		served := make(chan string, 16)
+		for i := 0; i < 8; i++ {
+			go func() {
+				heavy.Wait(context.Background())
+				served <- "heavy"
+			}()
+			go func() {
+				light.Wait(context.Background())
+				served <- "light"
+			}()
+		}
+
+		for heavy.QueueLength() < 8 || light.QueueLength() < 8 {
+			time.Sleep(time.Millisecond)
+		}
+
+		source.add(8)
+		counts := map[string]int{}
+		for i := 0; i < 8; i++ {
+			counts[<-served]++
+		}
+
+		assertValue(t, 6, counts["heavy"])
+		assertValue(t, 2, counts["light"])
+
+		// release the rest, so the dispatcher exits
+		source.add(8)
+		for i := 0; i < 8; i++ {
+			<-served
+		}
+	})
+
+	t.Run("try take does not jump the queue", func(t *testing.T) {
+		t.Parallel()
+
+		source := &manualSource{}
+		s := local.NewWeightedScheduler(source)
+		a, _ := s.Register(1)
+		b, _ := s.Register(1)
+
+		source.add(1)
+		assertValue(t, true, a.TryTake())
+		assertValue(t, false, a.TryTake())
+
+		done := make(chan struct{})
+		go func() {
+			b.Wait(context.Background())
+			close(done)
+		}()
+		for b.QueueLength() < 1 {
+			time.Sleep(time.Millisecond)
+		}
+
+		assertValue(t, false, a.TryTake())
+		source.add(1)
+		<-done
+	})
+
+	t.Run("cancelled waiters leave the queue", func(t *testing.T) {
+		t.Parallel()
+
+		s := local.NewWeightedScheduler(&manualSource{})
+		a, _ := s.Register(1)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+		defer cancel()
+
+		a.Wait(ctx)
+		assertValue(t, 0, a.QueueLength())
+	})
+
+	t.Run("gives back tokens taken for cancelled waiters", func(t *testing.T) {
+		t.Parallel()
+
+		source := &gatedSource{taking: make(chan struct{}), gate: make(chan struct{})}
+		s := local.NewWeightedScheduler(source)
+		a, _ := s.Register(1)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			a.Wait(ctx)
+			close(done)
+		}()
+
+		// the waiter gives up while the dispatcher is taking its token
+		<-source.taking
+		cancel()
+		<-done
+		close(source.gate)
+
+		deadline := time.Now().Add(time.Second)
+		for atomic.LoadInt32(&source.refunded) == 0 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		assertValue(t, int32(1), atomic.LoadInt32(&source.refunded))
+	})
+}
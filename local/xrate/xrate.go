@@ -0,0 +1,217 @@
+// Package xrate provides interop between the local ratelimiters and [golang.org/x/time/rate].
+//
+// NewLeakyBucket lets you pass an existing *rate.Limiter anywhere a local.LeakyBucket is expected, and Wrap exposes any of the
+// local ratelimiters behind the rate.Limiter style Allow and Wait methods, so call sites written against rate.Limiter can be
+// migrated incrementally.
+//
+// [golang.org/x/time/rate]: https://pkg.go.dev/golang.org/x/time/rate
+package xrate
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/aidenwallis/go-ratelimiting/local"
+	"golang.org/x/time/rate"
+)
+
+type leakyBucket struct {
+	// waiters is how many callers are blocked waiting for a token, it's accessed atomically so it's kept first for alignment
+	waiters int64
+	// granted and denied count attempts to take tokens, they're accessed atomically
+	granted int64
+	denied  int64
+	limiter *rate.Limiter
+}
+
+var _ local.LeakyBucket = (*leakyBucket)(nil)
+
+// NewLeakyBucket creates a local.LeakyBucket backed by an existing *rate.Limiter. The limiter's burst is used as the bucket size.
+func NewLeakyBucket(limiter *rate.Limiter) local.LeakyBucket {
+	return &leakyBucket{limiter: limiter}
+}
+
+// Wait will block the goroutine til a ratelimit token is available. You can use context to cancel the ratelimiter.
+func (r *leakyBucket) Wait(ctx context.Context) {
+	_ = r.wait(ctx)
+}
+
+// WaitFunc is equivalent to Wait except it calls a callback when it's able to accquire a token. If you cancel the context, cb is not called.
+func (r *leakyBucket) WaitFunc(ctx context.Context, cb func()) {
+	go func(ctx context.Context, cb func()) {
+		if r.wait(ctx) == nil {
+			cb()
+		}
+	}(ctx, cb)
+}
+
+func (r *leakyBucket) wait(ctx context.Context) error {
+	atomic.AddInt64(&r.waiters, 1)
+	defer atomic.AddInt64(&r.waiters, -1)
+
+	if err := r.limiter.Wait(ctx); err != nil {
+		return err
+	}
+	atomic.AddInt64(&r.granted, 1)
+	return nil
+}
+
+// Stats will return cumulative counters of granted and denied attempts. Fills are managed by rate.Limiter, so TokensFilled,
+// LastFillTokens and LastFillAt are not tracked.
+func (r *leakyBucket) Stats() local.LeakyBucketStats {
+	return local.LeakyBucketStats{
+		Granted: atomic.LoadInt64(&r.granted),
+		Denied:  atomic.LoadInt64(&r.denied),
+	}
+}
+
+// Describe will return the limiter's effective configuration. The limiter's burst is reported as the capacity, and the window
+// is how long an empty bucket takes to refill.
+func (r *leakyBucket) Describe() local.LimiterInfo {
+	info := local.LimiterInfo{
+		Algorithm: local.AlgorithmLeakyBucket,
+		Capacity:  r.limiter.Burst(),
+	}
+
+	if limit := r.limiter.Limit(); limit > 0 && limit != rate.Inf {
+		info.RefillInterval = time.Duration(float64(time.Second) / float64(limit))
+		info.Window = info.RefillInterval * time.Duration(info.Capacity)
+	}
+
+	return info
+}
+
+// record counts the outcome of an attempt to take tokens.
+func (r *leakyBucket) record(success bool) bool {
+	if success {
+		atomic.AddInt64(&r.granted, 1)
+	} else {
+		atomic.AddInt64(&r.denied, 1)
+	}
+	return success
+}
+
+// QueueLength will return how many callers are currently blocked in Wait or WaitFunc, waiting for a token.
+func (r *leakyBucket) QueueLength() int {
+	return int(atomic.LoadInt64(&r.waiters))
+}
+
+// Size will return how many whole tokens are currently available
+func (r *leakyBucket) Size() int {
+	tokens := int(r.limiter.Tokens())
+	if tokens < 0 {
+		return 0
+	}
+	return tokens
+}
+
+// Inspect will return how many whole tokens are currently available, alongside when the bucket will be full again.
+func (r *leakyBucket) Inspect() local.LeakyBucketInspection {
+	now := time.Now()
+	tokens := r.limiter.TokensAt(now)
+
+	inspection := local.LeakyBucketInspection{ResetAt: now}
+	if tokens > 0 {
+		inspection.RemainingTokens = int(tokens)
+	}
+
+	if missing := float64(r.limiter.Burst()) - tokens; missing > 0 && r.limiter.Limit() != rate.Inf && r.limiter.Limit() > 0 {
+		inspection.ResetAt = now.Add(time.Duration(missing / float64(r.limiter.Limit()) * float64(time.Second)))
+	}
+
+	return inspection
+}
+
+// TryTake will attempt to accquire a token, it will return a boolean indicating whether it was able to accquire a token or not.
+func (r *leakyBucket) TryTake() bool {
+	return r.record(r.limiter.Allow())
+}
+
+// TryTakeWithDuration will attempt to accquire a token, it will return a boolean indicating whether it was able to accquire a token or not,
+// and a duration for when you should next try.
+func (r *leakyBucket) TryTakeWithDuration() (bool, time.Duration) {
+	return r.TryTakeAt(time.Now())
+}
+
+// TryTakeAt is equivalent to TryTakeWithDuration, except it uses now as the current time rather than time.Now().
+func (r *leakyBucket) TryTakeAt(now time.Time) (bool, time.Duration) {
+	return r.tryTakeAt(now, 1)
+}
+
+// TryTakeWithResetAt is equivalent to TryTakeWithDuration, except it returns the absolute time at which you should next try. On
+// success, this is the current time.
+func (r *leakyBucket) TryTakeWithResetAt() (bool, time.Time) {
+	now := time.Now()
+	success, duration := r.tryTakeAt(now, 1)
+	return success, now.Add(duration)
+}
+
+// TryTakeN will attempt to accquire n tokens atomically, either all tokens are taken, or none are.
+func (r *leakyBucket) TryTakeN(n int) bool {
+	return r.record(r.limiter.AllowN(time.Now(), n))
+}
+
+// TryTakeNWithDuration is equivalent to TryTakeN, except it also returns a duration for when you should next try.
+func (r *leakyBucket) TryTakeNWithDuration(n int) (bool, time.Duration) {
+	return r.tryTakeAt(time.Now(), n)
+}
+
+// tryTakeAt attempts to take n tokens at now, returning how long after now you should next try.
+func (r *leakyBucket) tryTakeAt(now time.Time, n int) (bool, time.Duration) {
+	reservation := r.limiter.ReserveN(now, n)
+	if !reservation.OK() {
+		return r.record(false), rate.InfDuration
+	}
+
+	if delay := reservation.DelayFrom(now); delay > 0 {
+		// the tokens aren't available right now, give them back
+		reservation.CancelAt(now)
+		return r.record(false), delay
+	}
+
+	return r.record(true), 0
+}
+
+// DurationUntil will return how long it will be until n tokens are available in the bucket, without taking any tokens.
+func (r *leakyBucket) DurationUntil(n int) (time.Duration, error) {
+	if n > r.limiter.Burst() {
+		return 0, local.ErrExceedsCapacity
+	}
+
+	reservation := r.limiter.ReserveN(time.Now(), n)
+	defer reservation.Cancel()
+
+	return reservation.Delay(), nil
+}
+
+// Takeable is implemented by all of the local ratelimiters.
+type Takeable interface {
+	TryTake() bool
+	Wait(ctx context.Context)
+}
+
+// Limiter exposes a local ratelimiter behind the same Allow and Wait methods as *rate.Limiter.
+type Limiter struct {
+	limiter Takeable
+}
+
+// Wrap creates a Limiter from a local ratelimiter.
+func Wrap(limiter Takeable) *Limiter {
+	return &Limiter{limiter: limiter}
+}
+
+// Allow reports whether a token was able to be taken from the ratelimiter.
+func (l *Limiter) Allow() bool {
+	return l.limiter.TryTake()
+}
+
+// Wait blocks until a token was taken from the ratelimiter. It returns the context's error if the context is cancelled first.
+func (l *Limiter) Wait(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	l.limiter.Wait(ctx)
+	return ctx.Err()
+}
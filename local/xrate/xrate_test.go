@@ -0,0 +1,168 @@
+package xrate_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aidenwallis/go-ratelimiting/local"
+	"github.com/aidenwallis/go-ratelimiting/local/xrate"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+)
+
+func TestLeakyBucket(t *testing.T) {
+	t.Parallel()
+
+	t.Run("takes tokens", func(t *testing.T) {
+		t.Parallel()
+
+		// 10 tokens a second, with a bucket size of 2
+		r := xrate.NewLeakyBucket(rate.NewLimiter(rate.Every(time.Millisecond*100), 2))
+		assert.Equal(t, 2, r.Size())
+
+		assert.True(t, r.TryTake())
+
+		success, duration := r.TryTakeWithDuration()
+		assert.True(t, success)
+		assert.Zero(t, duration)
+
+		success, duration = r.TryTakeWithDuration()
+		assert.False(t, success)
+		assert.InDelta(t, time.Millisecond*100, duration, float64(time.Millisecond*10))
+		assert.Equal(t, 0, r.Size())
+
+		stats := r.Stats()
+		assert.Equal(t, int64(2), stats.Granted)
+		assert.Equal(t, int64(1), stats.Denied)
+	})
+
+	t.Run("inspects tokens and reset time", func(t *testing.T) {
+		t.Parallel()
+
+		r := xrate.NewLeakyBucket(rate.NewLimiter(rate.Every(time.Second), 2))
+		assert.True(t, r.TryTakeN(2))
+
+		inspection := r.Inspect()
+		assert.Equal(t, 0, inspection.RemainingTokens)
+		assert.WithinDuration(t, time.Now().Add(time.Second*2), inspection.ResetAt, time.Millisecond*100)
+	})
+
+	t.Run("steps time with TryTakeAt", func(t *testing.T) {
+		t.Parallel()
+
+		now := time.Now()
+		r := xrate.NewLeakyBucket(rate.NewLimiter(rate.Every(time.Second), 1))
+
+		success, _ := r.TryTakeAt(now)
+		assert.True(t, success)
+
+		success, duration := r.TryTakeAt(now)
+		assert.False(t, success)
+		assert.Equal(t, time.Second, duration)
+
+		success, _ = r.TryTakeAt(now.Add(time.Second))
+		assert.True(t, success)
+	})
+
+	t.Run("takes n tokens", func(t *testing.T) {
+		t.Parallel()
+
+		r := xrate.NewLeakyBucket(rate.NewLimiter(rate.Every(time.Millisecond*100), 5))
+		assert.True(t, r.TryTakeN(3))
+
+		success, duration := r.TryTakeNWithDuration(3)
+		assert.False(t, success)
+		assert.InDelta(t, time.Millisecond*100, duration, float64(time.Millisecond*10))
+		assert.True(t, r.TryTakeN(2))
+
+		success, duration = r.TryTakeNWithDuration(6)
+		assert.False(t, success)
+		assert.Equal(t, rate.InfDuration, duration)
+	})
+
+	t.Run("gives absolute reset time", func(t *testing.T) {
+		t.Parallel()
+
+		r := xrate.NewLeakyBucket(rate.NewLimiter(rate.Every(time.Millisecond*100), 1))
+		start := time.Now()
+		assert.True(t, r.TryTake())
+
+		success, resetAt := r.TryTakeWithResetAt()
+		assert.False(t, success)
+		assert.WithinDuration(t, start.Add(time.Millisecond*100), resetAt, time.Millisecond*10)
+	})
+
+	t.Run("describes configuration", func(t *testing.T) {
+		t.Parallel()
+
+		r := xrate.NewLeakyBucket(rate.NewLimiter(rate.Every(time.Millisecond*100), 5))
+		assert.Equal(t, local.LimiterInfo{
+			Algorithm:      local.AlgorithmLeakyBucket,
+			Capacity:       5,
+			Window:         time.Millisecond * 500,
+			RefillInterval: time.Millisecond * 100,
+		}, r.Describe())
+	})
+
+	t.Run("reports duration until n tokens", func(t *testing.T) {
+		t.Parallel()
+
+		r := xrate.NewLeakyBucket(rate.NewLimiter(rate.Every(time.Millisecond*100), 5))
+		for i := 0; i < 5; i++ {
+			assert.True(t, r.TryTake())
+		}
+
+		duration, err := r.DurationUntil(5)
+		assert.NoError(t, err)
+		assert.InDelta(t, time.Millisecond*500, duration, float64(time.Millisecond*10))
+		assert.False(t, r.TryTake(), "no tokens should be taken")
+
+		_, err = r.DurationUntil(6)
+		assert.ErrorIs(t, err, local.ErrExceedsCapacity)
+	})
+
+	t.Run("waits for tokens", func(t *testing.T) {
+		t.Parallel()
+
+		r := xrate.NewLeakyBucket(rate.NewLimiter(rate.Every(time.Millisecond*100), 1))
+		assert.True(t, r.TryTake())
+
+		start := time.Now()
+		r.Wait(context.Background())
+		assert.InDelta(t, time.Millisecond*100, time.Since(start), float64(time.Millisecond*20))
+
+		ch := make(chan struct{}, 1)
+		r.WaitFunc(context.Background(), func() { ch <- struct{}{} })
+		<-ch
+	})
+}
+
+func TestLimiter(t *testing.T) {
+	t.Parallel()
+
+	t.Run("allows tokens", func(t *testing.T) {
+		t.Parallel()
+
+		window, err := local.NewSlidingWindow(1, time.Second)
+		assert.NoError(t, err)
+
+		l := xrate.Wrap(window)
+		assert.True(t, l.Allow())
+		assert.False(t, l.Allow())
+	})
+
+	t.Run("waits for tokens", func(t *testing.T) {
+		t.Parallel()
+
+		l := xrate.Wrap(local.NewLeakyBucket(1, time.Millisecond*100))
+		assert.NoError(t, l.Wait(context.Background()))
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+		defer cancel()
+		assert.ErrorIs(t, l.Wait(ctx), context.DeadlineExceeded)
+
+		cancel()
+		assert.ErrorIs(t, l.Wait(ctx), context.DeadlineExceeded)
+	})
+}
@@ -10,6 +10,8 @@ import "context"
 // Alternatively, if you ship your own Redis implementation, you can build your own wrapper compatible with this interface to consume this
 // package.
 //
+// Adapters may optionally implement [io.Closer], in which case closing a ratelimiter will also close the adapter.
+//
 // [go-redis]: https://github.com/redis/go-redis
 // [redigo]: https://github.com/gomodule/redigo
 type Adapter interface {
@@ -18,3 +20,35 @@ type Adapter interface {
 	// See https://redis.io/commands/eval
 	Eval(ctx context.Context, script string, keys []string, args []interface{}) (output interface{}, err error)
 }
+
+// FunctionAdapter is an optional extension to Adapter, adding support for Redis functions. Functions are available from Redis 7.0,
+// and are useful in environments where EVAL is restricted, or where you'd rather scripts be loaded once during deployment.
+//
+// Both bundled adapters implement this interface.
+type FunctionAdapter interface {
+	Adapter
+
+	// FCall adds support for the redis FCALL command
+	//
+	// See https://redis.io/commands/fcall
+	FCall(ctx context.Context, function string, keys []string, args []interface{}) (output interface{}, err error)
+
+	// FunctionLoad adds support for the redis FUNCTION LOAD command, it should always pass REPLACE so an existing library is updated.
+	//
+	// See https://redis.io/commands/function-load
+	FunctionLoad(ctx context.Context, code string) error
+}
+
+type idempotentKey struct{}
+
+// WithIdempotent marks ctx as belonging to a script call which is safe to run more than once, such as an inspect. Decorators, such
+// as the retry adapter, use this to decide whether a failed call may be retried without double counting.
+func WithIdempotent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, idempotentKey{}, true)
+}
+
+// IsIdempotent reports whether ctx was marked with WithIdempotent.
+func IsIdempotent(ctx context.Context) bool {
+	v, _ := ctx.Value(idempotentKey{}).(bool)
+	return v
+}
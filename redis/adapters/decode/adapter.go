@@ -0,0 +1,151 @@
+// Package decode provides an adapter decorator which normalizes the values returned by scripts before the ratelimiters read them,
+// so clients and proxies that box Lua numbers differently can be used without the ratelimiters failing to parse their responses.
+package decode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/aidenwallis/go-ratelimiting/redis/adapters"
+)
+
+// ErrFunctionsUnsupported is returned by FCall and FunctionLoad when the wrapped adapter does not implement adapters.FunctionAdapter.
+var ErrFunctionsUnsupported = errors.New("wrapped adapter does not support redis functions")
+
+// Decoder converts the raw value returned by a script into the shapes the ratelimiters expect: Lua numbers as int64, Lua strings as
+// string or []byte, and Lua tables as []interface{} of those.
+type Decoder interface {
+	Decode(v interface{}) (interface{}, error)
+}
+
+// DecoderFunc is a function which implements Decoder.
+type DecoderFunc func(v interface{}) (interface{}, error)
+
+// Decode calls f(v).
+func (f DecoderFunc) Decode(v interface{}) (interface{}, error) {
+	return f(v)
+}
+
+// Default is the Decoder used when none is set. It converts every integer type, and floats with no fraction, to int64, recursing
+// into tables. Strings are left alone, so numeric strings such as SCAN cursors stay as strings.
+var Default Decoder = DecoderFunc(normalize)
+
+// Adapter decorates another adapter, passing the value returned by every script call through Decoder.
+type Adapter struct {
+	// Adapter is the wrapped adapter
+	Adapter adapters.Adapter
+
+	// Decoder converts the values returned by scripts. If this is not defined, Default is used.
+	Decoder Decoder
+}
+
+var (
+	_ adapters.Adapter         = (*Adapter)(nil)
+	_ adapters.FunctionAdapter = (*Adapter)(nil)
+	_ io.Closer                = (*Adapter)(nil)
+)
+
+// NewAdapter creates a new decoding adapter wrapping adapter, which passes every script's return value through decoder. If decoder
+// is nil, Default is used.
+func NewAdapter(adapter adapters.Adapter, decoder Decoder) *Adapter {
+	return &Adapter{
+		Adapter: adapter,
+		Decoder: decoder,
+	}
+}
+
+// Eval runs the script on the wrapped adapter, and decodes its return value.
+func (a *Adapter) Eval(ctx context.Context, script string, keys []string, args []interface{}) (interface{}, error) {
+	return a.decode(a.Adapter.Eval(ctx, script, keys, args))
+}
+
+// FCall calls the function on the wrapped adapter, and decodes its return value. ErrFunctionsUnsupported is returned if the
+// wrapped adapter does not support functions.
+func (a *Adapter) FCall(ctx context.Context, function string, keys []string, args []interface{}) (interface{}, error) {
+	functionAdapter, ok := a.Adapter.(adapters.FunctionAdapter)
+	if !ok {
+		return nil, ErrFunctionsUnsupported
+	}
+	return a.decode(functionAdapter.FCall(ctx, function, keys, args))
+}
+
+// FunctionLoad loads the library on the wrapped adapter. ErrFunctionsUnsupported is returned if the wrapped adapter does not
+// support functions.
+func (a *Adapter) FunctionLoad(ctx context.Context, code string) error {
+	functionAdapter, ok := a.Adapter.(adapters.FunctionAdapter)
+	if !ok {
+		return ErrFunctionsUnsupported
+	}
+	return functionAdapter.FunctionLoad(ctx, code)
+}
+
+// Close closes the wrapped adapter, if it implements io.Closer.
+func (a *Adapter) Close() error {
+	if closer, ok := a.Adapter.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (a *Adapter) decode(v interface{}, err error) (interface{}, error) {
+	if err != nil {
+		return v, err
+	}
+
+	decoder := a.Decoder
+	if decoder == nil {
+		decoder = Default
+	}
+
+	out, err := decoder.Decode(v)
+	if err != nil {
+		return nil, fmt.Errorf("decoding response: %w", err)
+	}
+	return out, nil
+}
+
+func normalize(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case int:
+		return int64(v), nil
+	case int8:
+		return int64(v), nil
+	case int16:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case uint:
+		return int64(v), nil
+	case uint8:
+		return int64(v), nil
+	case uint16:
+		return int64(v), nil
+	case uint32:
+		return int64(v), nil
+	case uint64:
+		return int64(v), nil
+	case float32:
+		return normalize(float64(v))
+	case float64:
+		if v != math.Trunc(v) || math.IsInf(v, 0) {
+			// Redis truncates Lua numbers to integers, so this isn't one, leave it for the caller to reject
+			return v, nil
+		}
+		return int64(v), nil
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, arg := range v {
+			value, err := normalize(arg)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = value
+		}
+		return out, nil
+	default:
+		return v, nil
+	}
+}
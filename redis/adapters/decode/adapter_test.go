@@ -0,0 +1,115 @@
+package decode_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aidenwallis/go-ratelimiting/redis"
+	"github.com/aidenwallis/go-ratelimiting/redis/adapters/decode"
+	goredisadapter "github.com/aidenwallis/go-ratelimiting/redis/adapters/go-redis"
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+type staticAdapter struct {
+	out interface{}
+	err error
+}
+
+func (a *staticAdapter) Eval(_ context.Context, _ string, _ []string, _ []interface{}) (interface{}, error) {
+	return a.out, a.err
+}
+
+func TestAdapter_Eval(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		in       interface{}
+		expected interface{}
+	}{
+		"int":              {in: 5, expected: int64(5)},
+		"uint64":           {in: uint64(5), expected: int64(5)},
+		"whole float":      {in: float64(5), expected: int64(5)},
+		"fractional float": {in: 5.5, expected: 5.5},
+		"string":           {in: "0", expected: "0"},
+		"nil":              {in: nil, expected: nil},
+		"table":            {in: []interface{}{int32(1), []byte("a"), []interface{}{float64(2)}}, expected: []interface{}{int64(1), []byte("a"), []interface{}{int64(2)}}},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			out, err := decode.NewAdapter(&staticAdapter{out: testCase.in}, nil).Eval(context.Background(), "", nil, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, testCase.expected, out)
+		})
+	}
+
+	t.Run("passes through errors", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := decode.NewAdapter(&staticAdapter{err: assert.AnError}, nil).Eval(context.Background(), "", nil, nil)
+		assert.ErrorIs(t, err, assert.AnError)
+	})
+
+	t.Run("custom decoder", func(t *testing.T) {
+		t.Parallel()
+
+		// a proxy which returns every number as a string
+		adapter := &staticAdapter{out: []interface{}{"1", "59", "0", "0", "0"}}
+		decoder := decode.DecoderFunc(func(v interface{}) (interface{}, error) {
+			args := v.([]interface{})
+			out := make([]interface{}, len(args))
+			for i, arg := range args {
+				n, err := strconv.ParseInt(arg.(string), 10, 64)
+				if err != nil {
+					return nil, err
+				}
+				out[i] = n
+			}
+			return out, nil
+		})
+
+		limiter := redis.NewSlidingWindow(decode.NewAdapter(adapter, decoder))
+		resp, err := limiter.Use(context.Background(), &redis.SlidingWindowOptions{Key: "test", MaximumCapacity: 60, Window: time.Minute})
+		assert.NoError(t, err)
+		assert.True(t, resp.Success)
+		assert.Equal(t, 1, resp.RemainingCapacity)
+
+		adapter.out = []interface{}{"foo"}
+		_, err = limiter.Use(context.Background(), &redis.SlidingWindowOptions{Key: "test", MaximumCapacity: 60, Window: time.Minute})
+		assert.ErrorIs(t, err, strconv.ErrSyntax)
+	})
+}
+
+func TestAdapter_Functions(t *testing.T) {
+	t.Parallel()
+
+	t.Run("unsupported", func(t *testing.T) {
+		t.Parallel()
+
+		adapter := decode.NewAdapter(&staticAdapter{}, nil)
+		_, err := adapter.FCall(context.Background(), "", nil, nil)
+		assert.ErrorIs(t, err, decode.ErrFunctionsUnsupported)
+		assert.ErrorIs(t, adapter.FunctionLoad(context.Background(), ""), decode.ErrFunctionsUnsupported)
+		assert.NoError(t, adapter.Close())
+	})
+
+	t.Run("supported", func(t *testing.T) {
+		t.Parallel()
+
+		mr := miniredis.RunT(t)
+		adapter := decode.NewAdapter(goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: mr.Addr()})), nil)
+
+		// miniredis doesn't support functions, but the call should still reach it
+		_, err := adapter.FCall(context.Background(), "fn", nil, nil)
+		assert.Error(t, err)
+		assert.NoError(t, adapter.Close())
+	})
+}
@@ -2,6 +2,7 @@ package goredis
 
 import (
 	"context"
+	"io"
 
 	"github.com/aidenwallis/go-ratelimiting/redis/adapters"
 	"github.com/redis/go-redis/v9"
@@ -14,10 +15,21 @@ type Adapter struct {
 	Client *redis.Client
 }
 
-var _ adapters.Adapter = (*Adapter)(nil)
+var (
+	_ adapters.Adapter         = (*Adapter)(nil)
+	_ adapters.FunctionAdapter = (*Adapter)(nil)
+	_ io.Closer                = (*Adapter)(nil)
+)
 
 // NewAdapter creates a new adapter using the [go-redis] client.
 //
+// Scripts run against whichever logical database the client is configured with, to use a dedicated database for your ratelimits,
+// set DB in the client's options.
+//
+// [go-redis] ignores context deadlines unless ContextTimeoutEnabled is set in the client's options, in which case a script that's
+// still running once the deadline passes returns [context.DeadlineExceeded]. Otherwise, only the client's ReadTimeout and
+// WriteTimeout bound how long a call can block for, so set those if you can't enable context timeouts.
+//
 // [go-redis]: https://github.com/redis/go-redis
 func NewAdapter(client *redis.Client) *Adapter {
 	return &Adapter{
@@ -29,3 +41,20 @@ func NewAdapter(client *redis.Client) *Adapter {
 func (a *Adapter) Eval(ctx context.Context, script string, keys []string, args []interface{}) (interface{}, error) {
 	return a.Client.Eval(ctx, script, keys, args...).Result()
 }
+
+// FCall defines adapter compatibility for the redis FCALL command
+func (a *Adapter) FCall(ctx context.Context, function string, keys []string, args []interface{}) (interface{}, error) {
+	return a.Client.FCall(ctx, function, keys, args...).Result()
+}
+
+// FunctionLoad defines adapter compatibility for the redis FUNCTION LOAD REPLACE command
+func (a *Adapter) FunctionLoad(ctx context.Context, code string) error {
+	return a.Client.FunctionLoadReplace(ctx, code).Err()
+}
+
+// Close closes the underlying [go-redis] client.
+//
+// [go-redis]: https://github.com/redis/go-redis
+func (a *Adapter) Close() error {
+	return a.Client.Close()
+}
@@ -1,15 +1,34 @@
 package goredis_test
 
 import (
+	"context"
 	"testing"
 
 	goredis "github.com/aidenwallis/go-ratelimiting/redis/adapters/go-redis"
 	"github.com/aidenwallis/go-ratelimiting/redis/adapters/internal/adaptertests"
 	"github.com/alicebob/miniredis/v2"
 	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestAdapter(t *testing.T) {
 	mr := miniredis.RunT(t)
 	adaptertests.BattletestAdapter(t, mr, goredis.NewAdapter(redis.NewClient(&redis.Options{Addr: mr.Addr()})))
 }
+
+func TestAdapter_DB(t *testing.T) {
+	mr := miniredis.RunT(t)
+	adaptertests.BattletestAdapterDB(t, mr, 3, goredis.NewAdapter(redis.NewClient(&redis.Options{Addr: mr.Addr(), DB: 3})))
+}
+
+func TestAdapter_Close(t *testing.T) {
+	mr := miniredis.RunT(t)
+	adapter := goredis.NewAdapter(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	assert.NoError(t, adapter.Close())
+	assert.Error(t, adapter.Client.Ping(context.Background()).Err())
+}
+
+func TestAdapter_Deadline(t *testing.T) {
+	mr := miniredis.RunT(t)
+	adaptertests.BattletestDeadline(t, mr, goredis.NewAdapter(redis.NewClient(&redis.Options{Addr: mr.Addr(), ContextTimeoutEnabled: true})))
+}
@@ -0,0 +1,24 @@
+//go:build integration
+
+package goredis_test
+
+import (
+	"testing"
+
+	goredis "github.com/aidenwallis/go-ratelimiting/redis/adapters/go-redis"
+	"github.com/aidenwallis/go-ratelimiting/redis/adapters/internal/adaptertests"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestAdapter_Integration(t *testing.T) {
+	for name, protocol := range map[string]int{"resp2": 2, "resp3": 3} {
+		protocol := protocol
+
+		t.Run(name, func(t *testing.T) {
+			client := redis.NewClient(&redis.Options{Addr: adaptertests.LiveAddr(t), Protocol: protocol})
+			t.Cleanup(func() { _ = client.Close() })
+
+			adaptertests.BattletestLiveAdapter(t, goredis.NewAdapter(client))
+		})
+	}
+}
@@ -3,6 +3,7 @@ package adaptertests
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/aidenwallis/go-ratelimiting/redis/adapters"
 	"github.com/alicebob/miniredis/v2"
@@ -11,6 +12,11 @@ import (
 
 // BattletestAdapter is a helper to quickly test that an adapter is functioning correctly
 func BattletestAdapter(t *testing.T, mr *miniredis.Miniredis, adapter adapters.Adapter) {
+	BattletestAdapterDB(t, mr, 0, adapter)
+}
+
+// BattletestAdapterDB is equivalent to BattletestAdapter, except it asserts the adapter's scripts ran against the given logical database
+func BattletestAdapterDB(t *testing.T, mr *miniredis.Miniredis, db int, adapter adapters.Adapter) {
 	// Script is a test script used for testing that adapters are working properly
 	const Script = `
 redis.call("set", tostring(KEYS[1]), tostring(ARGV[1]))
@@ -25,7 +31,23 @@ return 1
 
 	assert.EqualValues(t, 1, out.(int64))
 
-	getValue, err := mr.Get(key)
+	getValue, err := mr.DB(db).Get(key)
 	assert.NoError(t, err)
 	assert.Equal(t, value, getValue)
 }
+
+// BattletestDeadline is a helper to test that an adapter gives up on a script once its context's deadline passes, rather than
+// hanging while redis is unresponsive
+func BattletestDeadline(t *testing.T, mr *miniredis.Miniredis, adapter adapters.Adapter) {
+	// miniredis holds its lock while handling each command, so holding it blocks every command until it's released
+	mr.Lock()
+	defer mr.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := adapter.Eval(ctx, "return 1", []string{}, []interface{}{})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+}
@@ -0,0 +1,93 @@
+package adaptertests
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/aidenwallis/go-ratelimiting/redis/adapters"
+	"github.com/stretchr/testify/assert"
+)
+
+// LiveAddrEnv is the environment variable holding the address of the real Redis server integration tests run against
+const LiveAddrEnv = "REDIS_ADDR"
+
+// LiveAddr returns the address of the real Redis server to run integration tests against, skipping the test if it isn't set
+func LiveAddr(t *testing.T) string {
+	addr := os.Getenv(LiveAddrEnv)
+	if addr == "" {
+		t.Skip(LiveAddrEnv + " is not set, skipping integration test")
+	}
+	return addr
+}
+
+// BattletestLiveAdapter is equivalent to BattletestAdapter, except it runs against a real Redis server, so it reads values back
+// through the adapter rather than from miniredis. It also asserts the adapter decodes replies the same way real Redis encodes them,
+// which miniredis doesn't always emulate, such as Lua numbers being truncated to integers.
+func BattletestLiveAdapter(t *testing.T, adapter adapters.Adapter) {
+	const (
+		setScript = `
+redis.call("set", tostring(KEYS[1]), tostring(ARGV[1]))
+return 1
+`
+		getScript = `return redis.call("get", KEYS[1])`
+		delScript = `return redis.call("del", KEYS[1])`
+	)
+
+	ctx := context.Background()
+	key := "go-ratelimiting:adaptertests:" + t.Name()
+	value := "value"
+
+	t.Cleanup(func() {
+		_, _ = adapter.Eval(context.Background(), delScript, []string{key}, []interface{}{})
+	})
+
+	out, err := adapter.Eval(ctx, setScript, []string{key}, []interface{}{value})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, out.(int64))
+
+	out, err = adapter.Eval(ctx, getScript, []string{key}, []interface{}{})
+	assert.NoError(t, err)
+	assertBulkString(t, value, out)
+
+	// Lua numbers are converted to integers by Redis, dropping their fraction, and the scripts rely on this when returning
+	// computed values
+	out, err = adapter.Eval(ctx, `return {1, "2", 3.7}`, []string{}, []interface{}{})
+	assert.NoError(t, err)
+	if assert.IsType(t, []interface{}{}, out) && assert.Len(t, out, 3) {
+		reply := out.([]interface{})
+		assert.Equal(t, int64(1), reply[0])
+		assertBulkString(t, "2", reply[1])
+		assert.Equal(t, int64(3), reply[2])
+	}
+
+	// TIME replies with seconds and microseconds as bulk strings, which the scripts convert with tonumber
+	out, err = adapter.Eval(ctx, `return redis.call("time")`, []string{}, []interface{}{})
+	assert.NoError(t, err)
+	if assert.IsType(t, []interface{}{}, out) && assert.Len(t, out, 2) {
+		for _, v := range out.([]interface{}) {
+			s, ok := bulkString(v)
+			assert.True(t, ok, "expected a bulk string, got %T", v)
+			assert.Regexp(t, "^[0-9]+$", s)
+		}
+	}
+}
+
+// assertBulkString asserts v is the bulk string expected
+func assertBulkString(t *testing.T, expected string, v interface{}) {
+	s, ok := bulkString(v)
+	assert.True(t, ok, "expected a bulk string, got %T", v)
+	assert.Equal(t, expected, s)
+}
+
+// bulkString converts a bulk string reply, which some clients return as a string, and others as a []byte
+func bulkString(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case []byte:
+		return string(v), true
+	default:
+		return "", false
+	}
+}
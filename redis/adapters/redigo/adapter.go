@@ -2,6 +2,10 @@ package redigo
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
 
 	"github.com/aidenwallis/go-ratelimiting/redis/adapters"
 	"github.com/gomodule/redigo/redis"
@@ -14,18 +18,76 @@ type Adapter struct {
 	Conn redis.Conn
 }
 
-var _ adapters.Adapter = (*Adapter)(nil)
+var (
+	_ adapters.Adapter         = (*Adapter)(nil)
+	_ adapters.FunctionAdapter = (*Adapter)(nil)
+	_ io.Closer                = (*Adapter)(nil)
+)
 
 // NewAdapter creates a new adapter using the [redigo] client.
 //
+// Context deadlines are honoured as long as conn implements [redis.ConnWithContext], which connections from [redis.Dial] do, a
+// script that's still running once the deadline passes returns [context.DeadlineExceeded]. redigo closes the connection when this
+// happens, so every later call on the adapter fails, use NewPoolAdapter if you need to recover from timeouts.
+//
 // [redigo]: https://github.com/gomodule/redigo
 func NewAdapter(conn redis.Conn) *Adapter {
 	return &Adapter{Conn: conn}
 }
 
+// NewAdapterWithDB creates a new adapter using the [redigo] client, scoped to the given logical database.
+//
+// This issues a SELECT on conn, which changes the database for every user of that connection, so conn should be dedicated to this
+// adapter rather than shared. Alternatively, you can dial the connection with [redis.DialDatabase] and use NewAdapter.
+//
+// [redigo]: https://github.com/gomodule/redigo
+func NewAdapterWithDB(conn redis.Conn, db int) (*Adapter, error) {
+	if _, err := conn.Do("SELECT", db); err != nil {
+		return nil, fmt.Errorf("selecting database %d: %w", db, err)
+	}
+	return NewAdapter(conn), nil
+}
+
 // Eval defines adapter compatibility for the redis EVAL command
 func (a *Adapter) Eval(ctx context.Context, script string, keys []string, args []interface{}) (interface{}, error) {
-	return redis.DoContext(a.Conn, ctx, "EVAL", buildEvalArgs(script, keys, args...)...)
+	return doContext(ctx, a.Conn, "EVAL", buildEvalArgs(script, keys, args...)...)
+}
+
+// FCall defines adapter compatibility for the redis FCALL command
+func (a *Adapter) FCall(ctx context.Context, function string, keys []string, args []interface{}) (interface{}, error) {
+	return doContext(ctx, a.Conn, "FCALL", buildEvalArgs(function, keys, args...)...)
+}
+
+// FunctionLoad defines adapter compatibility for the redis FUNCTION LOAD REPLACE command
+func (a *Adapter) FunctionLoad(ctx context.Context, code string) error {
+	_, err := doContext(ctx, a.Conn, "FUNCTION", "LOAD", "REPLACE", code)
+	return err
+}
+
+// Close closes the underlying [redigo] connection.
+//
+// [redigo]: https://github.com/gomodule/redigo
+func (a *Adapter) Close() error {
+	return a.Conn.Close()
+}
+
+// doContext runs the command on conn, giving up once ctx is done. redigo sets the connection's read deadline from ctx's deadline, so
+// the read can time out fractionally before ctx itself is done, the context's error is returned in that case, so callers can always
+// check for context.DeadlineExceeded.
+func doContext(ctx context.Context, conn redis.Conn, command string, args ...interface{}) (interface{}, error) {
+	out, err := redis.DoContext(conn, ctx, command, args...)
+	if err == nil {
+		return out, nil
+	}
+
+	ctxErr := ctx.Err()
+	if deadline, ok := ctx.Deadline(); ok && ctxErr == nil && !time.Now().Before(deadline) {
+		ctxErr = context.DeadlineExceeded
+	}
+	if ctxErr != nil && !errors.Is(err, ctxErr) {
+		return nil, fmt.Errorf("%w: %v", ctxErr, err)
+	}
+	return nil, err
 }
 
 func buildEvalArgs(script string, keys []string, args ...interface{}) []interface{} {
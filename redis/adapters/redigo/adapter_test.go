@@ -18,3 +18,46 @@ func TestAdapter(t *testing.T) {
 
 	adaptertests.BattletestAdapter(t, mr, redigo.NewAdapter(conn))
 }
+
+func TestAdapter_Close(t *testing.T) {
+	mr := miniredis.RunT(t)
+
+	conn, err := redis.Dial("tcp", mr.Addr())
+	assert.NoError(t, err)
+
+	adapter := redigo.NewAdapter(conn)
+	assert.NoError(t, adapter.Close())
+	assert.Error(t, adapter.Conn.Err())
+}
+
+func TestAdapterWithDB(t *testing.T) {
+	mr := miniredis.RunT(t)
+
+	conn, err := redis.Dial("tcp", mr.Addr())
+	assert.NoError(t, err)
+
+	adapter, err := redigo.NewAdapterWithDB(conn, 2)
+	assert.NoError(t, err)
+
+	adaptertests.BattletestAdapterDB(t, mr, 2, adapter)
+}
+
+func TestAdapterWithDB_Error(t *testing.T) {
+	mr := miniredis.RunT(t)
+
+	conn, err := redis.Dial("tcp", mr.Addr())
+	assert.NoError(t, err)
+
+	adapter, err := redigo.NewAdapterWithDB(conn, -1)
+	assert.Nil(t, adapter)
+	assert.ErrorContains(t, err, "selecting database -1")
+}
+
+func TestAdapter_Deadline(t *testing.T) {
+	mr := miniredis.RunT(t)
+
+	conn, err := redis.Dial("tcp", mr.Addr())
+	assert.NoError(t, err)
+
+	adaptertests.BattletestDeadline(t, mr, redigo.NewAdapter(conn))
+}
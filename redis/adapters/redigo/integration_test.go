@@ -0,0 +1,28 @@
+//go:build integration
+
+package redigo_test
+
+import (
+	"testing"
+
+	"github.com/aidenwallis/go-ratelimiting/redis/adapters/internal/adaptertests"
+	"github.com/aidenwallis/go-ratelimiting/redis/adapters/redigo"
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdapter_Integration(t *testing.T) {
+	conn, err := redis.Dial("tcp", adaptertests.LiveAddr(t))
+	assert.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	adaptertests.BattletestLiveAdapter(t, redigo.NewAdapter(conn))
+}
+
+func TestPoolAdapter_Integration(t *testing.T) {
+	addr := adaptertests.LiveAddr(t)
+	pool := &redis.Pool{Dial: func() (redis.Conn, error) { return redis.Dial("tcp", addr) }}
+	t.Cleanup(func() { _ = pool.Close() })
+
+	adaptertests.BattletestLiveAdapter(t, redigo.NewPoolAdapter(pool))
+}
@@ -0,0 +1,68 @@
+package redigo
+
+import (
+	"context"
+	"io"
+
+	"github.com/aidenwallis/go-ratelimiting/redis/adapters"
+	"github.com/gomodule/redigo/redis"
+)
+
+// PoolAdapter is a [redigo] implementation compatible with [github.com/aidenwallis/go-ratelimiting/redis/adapters], which borrows a
+// connection from a pool for every command, so concurrent calls don't share a single connection.
+//
+// [redigo]: https://github.com/gomodule/redigo
+type PoolAdapter struct {
+	Pool *redis.Pool
+}
+
+var (
+	_ adapters.Adapter         = (*PoolAdapter)(nil)
+	_ adapters.FunctionAdapter = (*PoolAdapter)(nil)
+	_ io.Closer                = (*PoolAdapter)(nil)
+)
+
+// NewPoolAdapter creates a new adapter using a [redigo] connection pool.
+//
+// Context deadlines are honoured, a script that's still running once the deadline passes returns [context.DeadlineExceeded], and
+// the timed out connection is discarded rather than returned to the pool. Dialing only honours the deadline if the pool is
+// configured with DialContext rather than Dial.
+//
+// [redigo]: https://github.com/gomodule/redigo
+func NewPoolAdapter(pool *redis.Pool) *PoolAdapter {
+	return &PoolAdapter{Pool: pool}
+}
+
+// Eval defines adapter compatibility for the redis EVAL command
+func (a *PoolAdapter) Eval(ctx context.Context, script string, keys []string, args []interface{}) (interface{}, error) {
+	return a.do(ctx, "EVAL", buildEvalArgs(script, keys, args...)...)
+}
+
+// FCall defines adapter compatibility for the redis FCALL command
+func (a *PoolAdapter) FCall(ctx context.Context, function string, keys []string, args []interface{}) (interface{}, error) {
+	return a.do(ctx, "FCALL", buildEvalArgs(function, keys, args...)...)
+}
+
+// FunctionLoad defines adapter compatibility for the redis FUNCTION LOAD REPLACE command
+func (a *PoolAdapter) FunctionLoad(ctx context.Context, code string) error {
+	_, err := a.do(ctx, "FUNCTION", "LOAD", "REPLACE", code)
+	return err
+}
+
+// Close closes the underlying [redigo] pool.
+//
+// [redigo]: https://github.com/gomodule/redigo
+func (a *PoolAdapter) Close() error {
+	return a.Pool.Close()
+}
+
+// do borrows a connection from the pool for a single command, and returns it to the pool afterwards.
+func (a *PoolAdapter) do(ctx context.Context, command string, args ...interface{}) (interface{}, error) {
+	conn, err := a.Pool.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	return doContext(ctx, conn, command, args...)
+}
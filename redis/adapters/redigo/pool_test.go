@@ -0,0 +1,70 @@
+package redigo_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/aidenwallis/go-ratelimiting/redis/adapters/internal/adaptertests"
+	"github.com/aidenwallis/go-ratelimiting/redis/adapters/redigo"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+func newPool(mr *miniredis.Miniredis) *redis.Pool {
+	addr := mr.Addr()
+	return &redis.Pool{
+		MaxIdle: 4,
+		Dial: func() (redis.Conn, error) {
+			return redis.Dial("tcp", addr)
+		},
+	}
+}
+
+func TestPoolAdapter(t *testing.T) {
+	mr := miniredis.RunT(t)
+
+	adaptertests.BattletestAdapter(t, mr, redigo.NewPoolAdapter(newPool(mr)))
+}
+
+func TestPoolAdapter_Concurrent(t *testing.T) {
+	mr := miniredis.RunT(t)
+	adapter := redigo.NewPoolAdapter(newPool(mr))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := adapter.Eval(context.Background(), "return redis.call('incr', KEYS[1])", []string{"counter"}, nil)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	v, err := mr.Get("counter")
+	assert.NoError(t, err)
+	assert.Equal(t, "20", v)
+}
+
+func TestPoolAdapter_Close(t *testing.T) {
+	mr := miniredis.RunT(t)
+
+	adapter := redigo.NewPoolAdapter(newPool(mr))
+	assert.NoError(t, adapter.Close())
+
+	_, err := adapter.Eval(context.Background(), "return 1", nil, nil)
+	assert.EqualError(t, err, "redigo: get on closed pool")
+}
+
+func TestPoolAdapter_Deadline(t *testing.T) {
+	mr := miniredis.RunT(t)
+	adapter := redigo.NewPoolAdapter(newPool(mr))
+	adaptertests.BattletestDeadline(t, mr, adapter)
+
+	// the timed out connection is discarded, so the pool recovers
+	out, err := adapter.Eval(context.Background(), "return 1", nil, nil)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, out)
+}
@@ -0,0 +1,193 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/aidenwallis/go-ratelimiting/redis/adapters"
+)
+
+const (
+	// DefaultMaxRetries is how many times a call is retried when Adapter.MaxRetries is not set
+	DefaultMaxRetries = 3
+
+	// DefaultBaseDelay is the delay before the first retry when Adapter.BaseDelay is not set, it doubles on every retry after
+	DefaultBaseDelay = time.Millisecond * 50
+
+	// DefaultMaxDelay is the longest delay between retries when Adapter.MaxDelay is not set
+	DefaultMaxDelay = time.Second
+)
+
+// ErrFunctionsUnsupported is returned by FCall and FunctionLoad when the wrapped adapter does not implement adapters.FunctionAdapter.
+var ErrFunctionsUnsupported = errors.New("wrapped adapter does not support redis functions")
+
+// Adapter decorates another adapter, retrying calls which fail with transient errors, such as a reset connection or a timeout.
+// Retries back off exponentially with full jitter, and stop early if waiting would pass the context's deadline.
+//
+// Retrying a call which takes tokens may double count: if Redis ran the script but the connection dropped before the reply arrived,
+// the retry takes the tokens a second time. So by default only calls marked with adapters.WithIdempotent are retried, which
+// includes inspects, reservation commits and cancels, health checks, and takes made with an IdempotencyKey. Set RetryUnsafe to retry
+// every call.
+type Adapter struct {
+	// Adapter is the wrapped adapter
+	Adapter adapters.Adapter
+
+	// MaxRetries is how many times a failed call is retried, defaults to DefaultMaxRetries
+	MaxRetries int
+
+	// BaseDelay is the delay before the first retry, defaults to DefaultBaseDelay
+	BaseDelay time.Duration
+
+	// MaxDelay caps the delay between retries, defaults to DefaultMaxDelay
+	MaxDelay time.Duration
+
+	// RetryUnsafe retries calls which are not marked as idempotent, accepting that tokens may be double counted
+	RetryUnsafe bool
+
+	// IsRetryable decides whether an error is transient, defaults to IsRetryable
+	IsRetryable func(err error) bool
+}
+
+var (
+	_ adapters.Adapter         = (*Adapter)(nil)
+	_ adapters.FunctionAdapter = (*Adapter)(nil)
+)
+
+// NewAdapter creates a new retrying adapter wrapping adapter, using the default retry settings.
+func NewAdapter(adapter adapters.Adapter) *Adapter {
+	return &Adapter{
+		Adapter:     adapter,
+		MaxRetries:  DefaultMaxRetries,
+		BaseDelay:   DefaultBaseDelay,
+		MaxDelay:    DefaultMaxDelay,
+		IsRetryable: IsRetryable,
+	}
+}
+
+// Eval runs the script on the wrapped adapter, retrying transient errors.
+func (a *Adapter) Eval(ctx context.Context, script string, keys []string, args []interface{}) (interface{}, error) {
+	return a.do(ctx, func() (interface{}, error) {
+		return a.Adapter.Eval(ctx, script, keys, args)
+	})
+}
+
+// FCall calls the function on the wrapped adapter, retrying transient errors. ErrFunctionsUnsupported is returned if the wrapped
+// adapter does not support functions.
+func (a *Adapter) FCall(ctx context.Context, function string, keys []string, args []interface{}) (interface{}, error) {
+	functionAdapter, ok := a.Adapter.(adapters.FunctionAdapter)
+	if !ok {
+		return nil, ErrFunctionsUnsupported
+	}
+
+	return a.do(ctx, func() (interface{}, error) {
+		return functionAdapter.FCall(ctx, function, keys, args)
+	})
+}
+
+// FunctionLoad loads the library on the wrapped adapter, retrying transient errors as loading with REPLACE is always safe to repeat.
+// ErrFunctionsUnsupported is returned if the wrapped adapter does not support functions.
+func (a *Adapter) FunctionLoad(ctx context.Context, code string) error {
+	functionAdapter, ok := a.Adapter.(adapters.FunctionAdapter)
+	if !ok {
+		return ErrFunctionsUnsupported
+	}
+
+	_, err := a.do(adapters.WithIdempotent(ctx), func() (interface{}, error) {
+		return nil, functionAdapter.FunctionLoad(ctx, code)
+	})
+	return err
+}
+
+// Close closes the wrapped adapter, if it implements io.Closer.
+func (a *Adapter) Close() error {
+	if closer, ok := a.Adapter.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (a *Adapter) do(ctx context.Context, fn func() (interface{}, error)) (interface{}, error) {
+	out, err := fn()
+	if err == nil || (!a.RetryUnsafe && !adapters.IsIdempotent(ctx)) {
+		return out, err
+	}
+
+	isRetryable := a.IsRetryable
+	if isRetryable == nil {
+		isRetryable = IsRetryable
+	}
+
+	for attempt := 0; attempt < a.MaxRetries && isRetryable(err) && ctx.Err() == nil; attempt++ {
+		if !a.wait(ctx, a.delay(attempt)) {
+			break
+		}
+
+		out, err = fn()
+		if err == nil {
+			return out, nil
+		}
+	}
+
+	return out, err
+}
+
+// delay returns how long to wait before the given retry, using exponential backoff with full jitter.
+func (a *Adapter) delay(attempt int) time.Duration {
+	base, maxDelay := a.BaseDelay, a.MaxDelay
+	if base <= 0 {
+		base = DefaultBaseDelay
+	}
+	if maxDelay <= 0 {
+		maxDelay = DefaultMaxDelay
+	}
+
+	delay := maxDelay
+	if attempt < 32 && base<<attempt < maxDelay {
+		delay = base << attempt
+	}
+
+	return time.Duration(rand.Int63n(int64(delay) + 1))
+}
+
+// wait blocks for delay. It returns false if ctx is cancelled while waiting, or without waiting at all if ctx would hit its deadline first.
+func (a *Adapter) wait(ctx context.Context, delay time.Duration) bool {
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+		return false
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// IsRetryable reports whether err is a transient error worth retrying: network timeouts, reset or refused connections, unexpected
+// EOFs, and NOSCRIPT replies from a flushed script cache. Context errors are never retryable.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	if strings.HasPrefix(err.Error(), "NOSCRIPT") {
+		return true
+	}
+
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,134 @@
+package retry_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/aidenwallis/go-ratelimiting/redis/adapters"
+	"github.com/aidenwallis/go-ratelimiting/redis/adapters/retry"
+	"github.com/stretchr/testify/assert"
+)
+
+type flakyAdapter struct {
+	calls  int
+	errors []error
+}
+
+func (a *flakyAdapter) Eval(_ context.Context, _ string, _ []string, _ []interface{}) (interface{}, error) {
+	a.calls++
+	if a.calls <= len(a.errors) {
+		return nil, a.errors[a.calls-1]
+	}
+	return int64(1), nil
+}
+
+func newAdapter(inner adapters.Adapter) *retry.Adapter {
+	adapter := retry.NewAdapter(inner)
+	adapter.BaseDelay = time.Millisecond
+	adapter.MaxDelay = time.Millisecond * 5
+	return adapter
+}
+
+func TestAdapter_Eval(t *testing.T) {
+	t.Parallel()
+
+	t.Run("retries idempotent calls", func(t *testing.T) {
+		t.Parallel()
+
+		inner := &flakyAdapter{errors: []error{io.EOF, syscall.ECONNRESET}}
+		out, err := newAdapter(inner).Eval(adapters.WithIdempotent(context.Background()), "", nil, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), out)
+		assert.Equal(t, 3, inner.calls)
+	})
+
+	t.Run("does not retry unsafe calls by default", func(t *testing.T) {
+		t.Parallel()
+
+		inner := &flakyAdapter{errors: []error{io.EOF}}
+		_, err := newAdapter(inner).Eval(context.Background(), "", nil, nil)
+		assert.ErrorIs(t, err, io.EOF)
+		assert.Equal(t, 1, inner.calls)
+	})
+
+	t.Run("retries unsafe calls when enabled", func(t *testing.T) {
+		t.Parallel()
+
+		inner := &flakyAdapter{errors: []error{io.EOF}}
+		adapter := newAdapter(inner)
+		adapter.RetryUnsafe = true
+
+		_, err := adapter.Eval(context.Background(), "", nil, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, inner.calls)
+	})
+
+	t.Run("stops after max retries", func(t *testing.T) {
+		t.Parallel()
+
+		inner := &flakyAdapter{errors: []error{io.EOF, io.EOF, io.EOF, io.EOF, io.EOF}}
+		_, err := newAdapter(inner).Eval(adapters.WithIdempotent(context.Background()), "", nil, nil)
+		assert.ErrorIs(t, err, io.EOF)
+		assert.Equal(t, 1+retry.DefaultMaxRetries, inner.calls)
+	})
+
+	t.Run("does not retry permanent errors", func(t *testing.T) {
+		t.Parallel()
+
+		inner := &flakyAdapter{errors: []error{errors.New("ERR syntax error")}}
+		_, err := newAdapter(inner).Eval(adapters.WithIdempotent(context.Background()), "", nil, nil)
+		assert.EqualError(t, err, "ERR syntax error")
+		assert.Equal(t, 1, inner.calls)
+	})
+
+	t.Run("does not wait past the context deadline", func(t *testing.T) {
+		t.Parallel()
+
+		inner := &flakyAdapter{errors: []error{io.EOF, io.EOF}}
+		adapter := newAdapter(inner)
+		adapter.BaseDelay = time.Hour
+		adapter.MaxDelay = time.Hour
+
+		ctx, cancel := context.WithTimeout(adapters.WithIdempotent(context.Background()), time.Millisecond*50)
+		defer cancel()
+
+		start := time.Now()
+		_, err := adapter.Eval(ctx, "", nil, nil)
+		assert.ErrorIs(t, err, io.EOF)
+		assert.Less(t, time.Since(start), time.Millisecond*50)
+	})
+}
+
+func TestAdapter_FCall(t *testing.T) {
+	_, err := retry.NewAdapter(&flakyAdapter{}).FCall(context.Background(), "foo", nil, nil)
+	assert.ErrorIs(t, err, retry.ErrFunctionsUnsupported)
+	assert.ErrorIs(t, retry.NewAdapter(&flakyAdapter{}).FunctionLoad(context.Background(), ""), retry.ErrFunctionsUnsupported)
+}
+
+func TestIsRetryable(t *testing.T) {
+	testCases := map[string]struct {
+		err      error
+		expected bool
+	}{
+		"nil":               {err: nil, expected: false},
+		"eof":               {err: io.EOF, expected: true},
+		"wrapped reset":     {err: fmt.Errorf("read: %w", syscall.ECONNRESET), expected: true},
+		"noscript":          {err: errors.New("NOSCRIPT No matching script."), expected: true},
+		"context cancelled": {err: context.Canceled, expected: false},
+		"context deadline":  {err: context.DeadlineExceeded, expected: false},
+		"redis error":       {err: errors.New("WRONGTYPE Operation against a key holding the wrong kind of value"), expected: false},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, testCase.expected, retry.IsRetryable(testCase.err))
+		})
+	}
+}
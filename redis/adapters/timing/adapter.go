@@ -0,0 +1,91 @@
+// Package timing provides an adapter decorator which reports how long each script call takes, so the ratelimiters' Redis latency
+// can be measured separately from other Redis usage on the same client.
+package timing
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/aidenwallis/go-ratelimiting/redis/adapters"
+)
+
+// ErrFunctionsUnsupported is returned by FCall and FunctionLoad when the wrapped adapter does not implement adapters.FunctionAdapter.
+var ErrFunctionsUnsupported = errors.New("wrapped adapter does not support redis functions")
+
+// Adapter decorates another adapter, calling OnEval after every script call with how long it took, and the error it returned.
+//
+// When wrapping the retry adapter, OnEval measures the call including its retries, wrap the inner adapter instead to measure each
+// attempt.
+type Adapter struct {
+	// Adapter is the wrapped adapter
+	Adapter adapters.Adapter
+
+	// OnEval is called synchronously after every Eval and FCall with the elapsed time, and the error returned, if any. If this is not
+	// defined, calls are passed through without being timed.
+	OnEval func(duration time.Duration, err error)
+}
+
+var (
+	_ adapters.Adapter         = (*Adapter)(nil)
+	_ adapters.FunctionAdapter = (*Adapter)(nil)
+	_ io.Closer                = (*Adapter)(nil)
+)
+
+// NewAdapter creates a new timing adapter wrapping adapter, which reports every script call to onEval.
+func NewAdapter(adapter adapters.Adapter, onEval func(duration time.Duration, err error)) *Adapter {
+	return &Adapter{
+		Adapter: adapter,
+		OnEval:  onEval,
+	}
+}
+
+// Eval runs the script on the wrapped adapter, reporting how long it took to OnEval.
+func (a *Adapter) Eval(ctx context.Context, script string, keys []string, args []interface{}) (interface{}, error) {
+	return a.do(func() (interface{}, error) {
+		return a.Adapter.Eval(ctx, script, keys, args)
+	})
+}
+
+// FCall calls the function on the wrapped adapter, reporting how long it took to OnEval. ErrFunctionsUnsupported is returned if the
+// wrapped adapter does not support functions.
+func (a *Adapter) FCall(ctx context.Context, function string, keys []string, args []interface{}) (interface{}, error) {
+	functionAdapter, ok := a.Adapter.(adapters.FunctionAdapter)
+	if !ok {
+		return nil, ErrFunctionsUnsupported
+	}
+
+	return a.do(func() (interface{}, error) {
+		return functionAdapter.FCall(ctx, function, keys, args)
+	})
+}
+
+// FunctionLoad loads the library on the wrapped adapter, it isn't reported to OnEval as it's not a script call. ErrFunctionsUnsupported
+// is returned if the wrapped adapter does not support functions.
+func (a *Adapter) FunctionLoad(ctx context.Context, code string) error {
+	functionAdapter, ok := a.Adapter.(adapters.FunctionAdapter)
+	if !ok {
+		return ErrFunctionsUnsupported
+	}
+	return functionAdapter.FunctionLoad(ctx, code)
+}
+
+// Close closes the wrapped adapter, if it implements io.Closer.
+func (a *Adapter) Close() error {
+	if closer, ok := a.Adapter.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (a *Adapter) do(fn func() (interface{}, error)) (interface{}, error) {
+	if a.OnEval == nil {
+		return fn()
+	}
+
+	start := time.Now()
+	out, err := fn()
+	a.OnEval(time.Since(start), err)
+	return out, err
+}
@@ -0,0 +1,82 @@
+package timing_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	goredisadapter "github.com/aidenwallis/go-ratelimiting/redis/adapters/go-redis"
+	"github.com/aidenwallis/go-ratelimiting/redis/adapters/timing"
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+type slowAdapter struct {
+	err error
+}
+
+func (a *slowAdapter) Eval(_ context.Context, _ string, _ []string, _ []interface{}) (interface{}, error) {
+	time.Sleep(time.Millisecond * 10)
+	return int64(1), a.err
+}
+
+func TestAdapter_Eval(t *testing.T) {
+	t.Parallel()
+
+	t.Run("reports duration and error", func(t *testing.T) {
+		t.Parallel()
+
+		var durations []time.Duration
+		var errs []error
+		adapter := timing.NewAdapter(&slowAdapter{err: assert.AnError}, func(duration time.Duration, err error) {
+			durations = append(durations, duration)
+			errs = append(errs, err)
+		})
+
+		out, err := adapter.Eval(context.Background(), "", nil, nil)
+		assert.Equal(t, int64(1), out)
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.Len(t, durations, 1)
+		assert.GreaterOrEqual(t, durations[0], time.Millisecond*10)
+		assert.Equal(t, []error{assert.AnError}, errs)
+	})
+
+	t.Run("passes through without a hook", func(t *testing.T) {
+		t.Parallel()
+
+		out, err := timing.NewAdapter(&slowAdapter{}, nil).Eval(context.Background(), "", nil, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), out)
+	})
+}
+
+func TestAdapter_Functions(t *testing.T) {
+	t.Parallel()
+
+	t.Run("unsupported", func(t *testing.T) {
+		t.Parallel()
+
+		adapter := timing.NewAdapter(&slowAdapter{}, nil)
+		_, err := adapter.FCall(context.Background(), "", nil, nil)
+		assert.ErrorIs(t, err, timing.ErrFunctionsUnsupported)
+		assert.ErrorIs(t, adapter.FunctionLoad(context.Background(), ""), timing.ErrFunctionsUnsupported)
+		assert.NoError(t, adapter.Close())
+	})
+
+	t.Run("supported", func(t *testing.T) {
+		t.Parallel()
+
+		calls := 0
+		mr := miniredis.RunT(t)
+		adapter := timing.NewAdapter(goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: mr.Addr()})), func(time.Duration, error) {
+			calls++
+		})
+
+		// miniredis doesn't support functions, but the call should still be timed
+		_, err := adapter.FCall(context.Background(), "fn", nil, nil)
+		assert.Error(t, err)
+		assert.Equal(t, 1, calls)
+		assert.NoError(t, adapter.Close())
+	})
+}
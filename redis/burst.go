@@ -0,0 +1,58 @@
+package redis
+
+import "time"
+
+// slidingWindowBurstScript is concatenated into the sliding window Use scripts after a token is taken from the window, it draws a
+// token from the burst pool instead when the window is full. The pool is a leaky bucket stored in burstKey, which starts full and
+// refills a token every burstRefill milliseconds. The burst key is the companion key claimed after the idempotency key, and it
+// expects now, success, replayed and penaltyUntil to be defined.
+const slidingWindowBurstScript = `
+local burstMax = tonumber(ARGV[11])
+local burstRefill = tonumber(ARGV[12])
+local burstKey = companionKey(burstMax > 0)
+local usedBurst = 0
+
+if (success == 0 and not replayed and penaltyUntil == 0 and burstMax > 0) then
+	local burstNow = tonumber(now)
+	local pool = redis.call("hmget", burstKey, "tokens", "last_fill")
+	local burstTokens = tonumber(pool[1] or burstMax)
+	local lastFill = tonumber(pool[2] or burstNow)
+
+	local refilled = math.floor((burstNow - lastFill) / burstRefill)
+	if (refilled > 0) then
+		burstTokens = burstTokens + refilled
+		lastFill = lastFill + refilled * burstRefill
+	end
+	if (burstTokens >= burstMax) then
+		-- a full pool doesn't bank time towards its next token
+		burstTokens = burstMax
+		lastFill = burstNow
+	end
+
+	if (burstTokens >= 1) then
+		burstTokens = burstTokens - 1
+		success = 1
+		usedBurst = 1
+		redis.call("hset", burstKey, "tokens", burstTokens, "last_fill", lastFill)
+		redis.call("pexpire", burstKey, (burstMax - burstTokens) * burstRefill) -- the pool is full again once the key expires
+	end
+end
+`
+
+func burstKey(key string) string {
+	return key + "::burst"
+}
+
+// burstEnabled returns whether the burst pool is enabled, which it is when both its capacity and refill interval are set.
+func burstEnabled(capacity int, refill time.Duration) bool {
+	return capacity > 0 && refill.Milliseconds() > 0
+}
+
+// burstArgs returns the burst pool's capacity and refill interval in milliseconds read by slidingWindowBurstScript, the pool is
+// disabled unless both are set.
+func burstArgs(capacity int, refill time.Duration) []interface{} {
+	if !burstEnabled(capacity, refill) {
+		return []interface{}{0, 0}
+	}
+	return []interface{}{capacity, refill.Milliseconds()}
+}
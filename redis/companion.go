@@ -0,0 +1,38 @@
+package redis
+
+// companionKeyScript is concatenated into the Use scripts before any companion key is read. Companion keys are only passed for the
+// features that are enabled, after the bucket's own keys, so a bucket that doesn't use them stays in a single Redis Cluster slot.
+// Each feature claims its key with companionKey, from the last key backwards, so they must be claimed in the reverse order of
+// companionKeys: penalty, idempotency, quota, burst, then peak.
+const companionKeyScript = `
+local lastCompanionKey = #KEYS + 1
+local function companionKey(enabled)
+	if (not enabled) then
+		return nil
+	end
+	lastCompanionKey = lastCompanionKey - 1
+	return KEYS[lastCompanionKey]
+end
+`
+
+// companionKeys returns the companion keys passed to the Use scripts after the bucket's own keys, only including the keys of the
+// features that are enabled.
+func companionKeys(prefix string, trackPeak, burst, dailyQuota bool, idempotency string, penalty bool) []string {
+	var keys []string
+	if trackPeak {
+		keys = append(keys, peakKey(prefix))
+	}
+	if burst {
+		keys = append(keys, burstKey(prefix))
+	}
+	if dailyQuota {
+		keys = append(keys, dailyQuotaKey(prefix))
+	}
+	if idempotency != "" {
+		keys = append(keys, idempotencyKey(prefix, idempotency))
+	}
+	if penalty {
+		keys = append(keys, penaltyKey(prefix))
+	}
+	return keys
+}
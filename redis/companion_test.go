@@ -0,0 +1,118 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aidenwallis/go-ratelimiting/redis/adapters"
+	goredisadapter "github.com/aidenwallis/go-ratelimiting/redis/adapters/go-redis"
+	redigoadapter "github.com/aidenwallis/go-ratelimiting/redis/adapters/redigo"
+	"github.com/alicebob/miniredis/v2"
+	redigo "github.com/gomodule/redigo/redis"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompanionKeys(t *testing.T) {
+	ctx := context.Background()
+	resp := []interface{}{int64(1), int64(59), int64(0), int64(0), int64(0), int64(0), int64(0), int64(0), int64(1)}
+
+	t.Run("single key buckets only send their own key", func(t *testing.T) {
+		opts := leakyBucketOptions()
+		opts.SingleKey = true
+
+		for _, bucket := range []*LeakyBucketOptions{opts, opts.Compile()} {
+			adapter := &mockAdapter{returnValue: resp}
+			_, err := NewLeakyBucket(adapter).Use(ctx, bucket, 1)
+			assert.NoError(t, err)
+			assert.Equal(t, []string{opts.KeyPrefix}, adapter.keys)
+		}
+	})
+
+	t.Run("only enabled features send their keys", func(t *testing.T) {
+		opts := leakyBucketOptions()
+		opts.SingleKey = true
+		opts.DailyQuota = 100
+		opts.PenaltyThreshold = 3
+		opts.PenaltyDuration = time.Minute
+
+		for _, bucket := range []*LeakyBucketOptions{opts, opts.Compile()} {
+			adapter := &mockAdapter{returnValue: resp}
+			_, err := NewLeakyBucket(adapter).Use(ctx, bucket, 1)
+			assert.NoError(t, err)
+			assert.Equal(t, []string{opts.KeyPrefix, dailyQuotaKey(opts.KeyPrefix), penaltyKey(opts.KeyPrefix)}, adapter.keys)
+		}
+	})
+
+	t.Run("sliding windows only send enabled features' keys", func(t *testing.T) {
+		opts := slidingWindowOptions()
+		adapter := &mockAdapter{returnValue: []interface{}{int64(1), int64(1), int64(0), int64(0), int64(0)}}
+
+		_, err := NewSlidingWindow(adapter).Use(ctx, opts)
+		assert.NoError(t, err)
+		assert.Equal(t, slidingWindowKeys(opts.Key), adapter.keys)
+
+		opts.BurstCapacity = 2
+		opts.BurstRefill = time.Second
+		opts.TrackPeak = true
+		_, err = NewSlidingWindow(adapter).Use(ctx, opts)
+		assert.NoError(t, err)
+		assert.Equal(t, append(slidingWindowKeys(opts.Key), peakKey(opts.Key), burstKey(opts.Key)), adapter.keys)
+	})
+}
+
+func TestCompanionKeys_Scripts(t *testing.T) {
+	testCases := map[string]func(*miniredis.Miniredis) adapters.Adapter{
+		"go-redis": func(t *miniredis.Miniredis) adapters.Adapter {
+			return goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: t.Addr()}))
+		},
+		"redigo": func(t *miniredis.Miniredis) adapters.Adapter {
+			conn, err := redigo.Dial("tcp", t.Addr())
+			if err != nil {
+				panic(err)
+			}
+			return redigoadapter.NewAdapter(conn)
+		},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Now().UTC()
+			mr := miniredis.RunT(t)
+			limiter := NewLeakyBucket(testCase(mr))
+			limiter.nowFunc = func() time.Time { return now }
+
+			// every other feature is enabled, so each script has to find its key without the idempotency key
+			opts := leakyBucketOptions()
+			opts.SingleKey = true
+			opts.TrackPeak = true
+			opts.DailyQuota = 100
+			opts.PenaltyThreshold = 1
+			opts.PenaltyDuration = time.Minute
+
+			resp, err := limiter.Use(ctx, opts, opts.MaximumCapacity)
+			assert.NoError(t, err)
+			assert.True(t, resp.Success)
+			assert.Equal(t, 40, resp.QuotaRemaining)
+
+			resp, err = limiter.Use(ctx, opts, 1)
+			assert.NoError(t, err)
+			assert.False(t, resp.Success)
+			assert.Equal(t, now.Add(time.Minute).UnixMilli(), resp.PenaltyUntil.UnixMilli())
+
+			peak, err := mr.Get(peakKey(opts.KeyPrefix))
+			assert.NoError(t, err)
+			assert.Equal(t, "60", peak)
+
+			quota, err := mr.Get(dailyQuotaKey(opts.KeyPrefix))
+			assert.NoError(t, err)
+			assert.Equal(t, "60", quota)
+
+			assert.True(t, mr.Exists(penaltyKey(opts.KeyPrefix)))
+		})
+	}
+}
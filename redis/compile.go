@@ -0,0 +1,76 @@
+package redis
+
+import "time"
+
+// compiledLeakyBucketOptions holds the values Compile derives from a LeakyBucketOptions, alongside the fields they were derived from,
+// so they're only used while those fields are unchanged.
+type compiledLeakyBucketOptions struct {
+	keyPrefix       string
+	singleKey       bool
+	maximumCapacity int
+	windowSeconds   int
+	warmStart       float64
+	startEmpty      bool
+
+	// stateKeys are the keys the bucket is stored in
+	stateKeys       []string
+	refillRate      float64
+	warmStartTokens int
+}
+
+// Compile returns a copy of the options with the values that Use derives from them computed up front, such as the names of the
+// bucket's keys and its refill rate, so they aren't rebuilt on every call. This is worthwhile on hot paths which use the same
+// options millions of times, such as options cached per policy, and is otherwise no different from using the options directly.
+//
+// The derived values are only used while KeyPrefix, SingleKey, MaximumCapacity, WindowSeconds, WarmStart and StartEmpty are unchanged, so
+// modifying the copy is safe, but loses the benefit until it's compiled again. IdempotencyKey, TTLJitterPercent and the options that
+// enable companion keys, such as TrackPeak, are still applied per call.
+func (o *LeakyBucketOptions) Compile() *LeakyBucketOptions {
+	compiled := *o
+	compiled.compiled = nil
+
+	compiled.compiled = &compiledLeakyBucketOptions{
+		keyPrefix:       o.KeyPrefix,
+		singleKey:       o.SingleKey,
+		maximumCapacity: o.MaximumCapacity,
+		windowSeconds:   o.WindowSeconds,
+		warmStart:       o.WarmStart,
+		startEmpty:      o.StartEmpty,
+		stateKeys:       compiled.keys(),
+		refillRate:      getRefillRate(o.MaximumCapacity, o.WindowSeconds),
+		warmStartTokens: compiled.warmStartTokens(),
+	}
+
+	return &compiled
+}
+
+// compiledOptions returns the values derived by Compile, or nil if the options weren't compiled, or have changed since.
+func (o *LeakyBucketOptions) compiledOptions() *compiledLeakyBucketOptions {
+	c := o.compiled
+	if c == nil || c.keyPrefix != o.KeyPrefix || c.singleKey != o.SingleKey || c.maximumCapacity != o.MaximumCapacity ||
+		c.windowSeconds != o.WindowSeconds || c.warmStart != o.WarmStart || c.startEmpty != o.StartEmpty {
+		return nil
+	}
+	return c
+}
+
+// useKeys returns the keys passed to the Use scripts, which are the bucket's keys followed by the companion keys of the features
+// that are enabled.
+func (o *LeakyBucketOptions) useKeys() []string {
+	companions := companionKeys(o.KeyPrefix, o.TrackPeak, false, o.DailyQuota > 0, o.IdempotencyKey, penaltyEnabled(o.PenaltyThreshold, o.PenaltyDuration))
+	if len(companions) == 0 {
+		return o.keys()
+	}
+	return append(o.keys(), companions...)
+}
+
+// resetAt returns when the bucket will be fully refilled, given when it was last filled and its remaining tokens.
+func (o *LeakyBucketOptions) resetAt(lastFilled, remaining int) time.Time {
+	rate := 0.0
+	if c := o.compiledOptions(); c != nil {
+		rate = c.refillRate
+	} else {
+		rate = getRefillRate(o.MaximumCapacity, o.WindowSeconds)
+	}
+	return leakyBucketFillTime(lastFilled, remaining, o.MaximumCapacity, o.WindowSeconds, rate)
+}
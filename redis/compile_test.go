@@ -0,0 +1,87 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	goredisadapter "github.com/aidenwallis/go-ratelimiting/redis/adapters/go-redis"
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLeakyBucketOptions_Compile(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+	limiter := NewLeakyBucket(goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: miniredis.RunT(t).Addr()})))
+	limiter.nowFunc = func() time.Time { return now }
+
+	opts := leakyBucketOptions()
+	opts.WarmStart = 0.5
+	compiled := opts.Compile()
+	assert.Nil(t, opts.compiled, "the original options shouldn't be modified")
+	assert.Equal(t, opts.useKeys(), compiled.useKeys())
+	assert.Equal(t, opts.keys(), compiled.keys())
+	assert.Equal(t, 30, compiled.warmStartTokens())
+
+	for i := 0; i < 2; i++ {
+		resp, err := limiter.Use(ctx, compiled, 10)
+		assert.NoError(t, err)
+		assert.True(t, resp.Success)
+		assert.Equal(t, 20-i*10, resp.RemainingTokens)
+		assert.Equal(t, opts.resetAt(int(now.Unix()), resp.RemainingTokens), resp.ResetAt)
+	}
+
+	t.Run("appending to keys doesn't modify the compiled options", func(t *testing.T) {
+		keys := compiled.keys()
+		_ = append(keys, "foo")
+		assert.Equal(t, opts.useKeys(), compiled.useKeys())
+	})
+
+	t.Run("idempotency keys are applied per call", func(t *testing.T) {
+		withKey := *compiled
+		withKey.IdempotencyKey = "request"
+		assert.Contains(t, withKey.useKeys(), idempotencyKey(opts.KeyPrefix, "request"))
+	})
+
+	t.Run("changed options aren't compiled", func(t *testing.T) {
+		changed := *compiled
+		changed.KeyPrefix = "other-bucket"
+		assert.Nil(t, changed.compiledOptions())
+		assert.Equal(t, leakyBucketKeys("other-bucket"), changed.keys())
+
+		resp, err := limiter.Use(ctx, &changed, 10)
+		assert.NoError(t, err)
+		assert.Equal(t, 20, resp.RemainingTokens)
+
+		changed = *compiled
+		changed.SingleKey = true
+		assert.Equal(t, []string{opts.KeyPrefix}, changed.keys())
+	})
+}
+
+func BenchmarkLeakyBucketImpl_Use(b *testing.B) {
+	ctx := context.Background()
+	limiter := NewLeakyBucket(&mockAdapter{
+		returnValue: []interface{}{int64(1), int64(59), int64(0), int64(0), int64(0), int64(0), int64(0), int64(0), int64(1)},
+	})
+
+	testCases := map[string]*LeakyBucketOptions{
+		"options":  leakyBucketOptions(),
+		"compiled": leakyBucketOptions().Compile(),
+	}
+
+	for name, opts := range testCases {
+		opts := opts
+
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := limiter.Use(ctx, opts, 1); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
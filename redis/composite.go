@@ -0,0 +1,307 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/aidenwallis/go-ratelimiting/redis/adapters"
+)
+
+// Composite defines an interface compatible with CompositeImpl
+//
+// A composite ratelimiter applies a leaky bucket and a sliding window together, which is useful for quotas such as "no faster
+// than 10 per second sustained, and no more than 100 in any 60 seconds". Tokens are only taken when both allow it.
+type Composite interface {
+	// Use atomically attempts to take takeAmount tokens from both the leaky bucket and the sliding window. Either the tokens are
+	// taken from both, or from neither.
+	Use(ctx context.Context, bucket *CompositeOptions, takeAmount int) (*UseCompositeResponse, error)
+}
+
+// CompositeImpl implements a composite ratelimiter in Redis with Lua. This struct is compatible with the Composite interface.
+//
+// Both checks run in a single script, so there's never a moment where one structure has been decremented without the other.
+type CompositeImpl struct {
+	// Adapter defines the Redis adapter
+	Adapter adapters.Adapter
+
+	// OnDecision is an optional hook which is called synchronously after every successful call to Redis that takes tokens, which is
+	// useful for audit logging. It is not called when Redis returns an error.
+	OnDecision func(DecisionEvent)
+
+	// Logger is optionally used to log debugging information, such as the raw response when Redis returns something unexpected.
+	Logger Logger
+
+	// UseFunctions runs the ratelimiter's scripts as Redis functions with FCALL rather than EVAL. The adapter must implement
+	// adapters.FunctionAdapter, and the library must be loaded with LoadFunctions() first.
+	UseFunctions bool
+
+	// nowFunc is a private helper used to mock out time changes in unit testing
+	//
+	// if this is not defined, it falls back to time.Now()
+	nowFunc func() time.Time
+}
+
+var _ Composite = (*CompositeImpl)(nil)
+
+// CompositeOptions defines the options available to a composite ratelimiter.
+type CompositeOptions struct {
+	// KeyPrefix defines the prefix for the Redis keys used by both the leaky bucket and the sliding window
+	KeyPrefix string
+
+	// BucketCapacity defines the max size of the leaky bucket
+	BucketCapacity int
+
+	// BucketWindowSeconds defines how long it takes to fully refill the leaky bucket, the bucket refills at a rate of
+	// BucketCapacity/BucketWindowSeconds tokens per second.
+	BucketWindowSeconds int
+
+	// WindowCapacity defines the max amount of tokens that may be taken in any sliding Window
+	WindowCapacity int
+
+	// Window defines the size of the sliding window, resolution is available up to milliseconds.
+	Window time.Duration
+
+	// BucketWarmStart optionally sets the fraction of BucketCapacity a new leaky bucket starts with, rather than starting full, see
+	// LeakyBucketOptions.WarmStart.
+	BucketWarmStart float64
+
+	// BucketMaxFillLookback optionally caps how far back the leaky bucket's fill looks when it was last filled long ago, see
+	// LeakyBucketOptions.MaxFillLookback.
+	BucketMaxFillLookback time.Duration
+}
+
+// leakyBucket returns the options of the composite's leaky bucket.
+func (o *CompositeOptions) leakyBucket() *LeakyBucketOptions {
+	return &LeakyBucketOptions{
+		KeyPrefix:       o.KeyPrefix,
+		MaximumCapacity: o.BucketCapacity,
+		WindowSeconds:   o.BucketWindowSeconds,
+		WarmStart:       o.BucketWarmStart,
+		MaxFillLookback: o.BucketMaxFillLookback,
+	}
+}
+
+// NewComposite creates a new composite ratelimiter instance
+func NewComposite(adapter adapters.Adapter) *CompositeImpl {
+	return &CompositeImpl{
+		Adapter: adapter,
+		nowFunc: time.Now,
+	}
+}
+
+// HealthCheck verifies that the adapter is able to run Lua scripts against Redis, and that responses are returned in the shape
+// this ratelimiter expects. This is useful as a readiness probe, as some managed Redis variants disable scripting.
+func (r *CompositeImpl) HealthCheck(ctx context.Context) error {
+	return healthCheck(ctx, r.Adapter, r.UseFunctions)
+}
+
+// Close releases the resources held by the adapter, if the adapter implements io.Closer. Otherwise, it does nothing.
+func (r *CompositeImpl) Close() error {
+	return closeAdapter(r.Adapter)
+}
+
+// eval runs script through the adapter, using FCALL when UseFunctions is set.
+func (r *CompositeImpl) eval(ctx context.Context, script string, keys []string, args []interface{}) (interface{}, error) {
+	return evalScript(ctx, r.Adapter, r.UseFunctions, script, keys, args)
+}
+
+func (r *CompositeImpl) now() time.Time {
+	if r.nowFunc == nil {
+		return time.Now()
+	}
+	return r.nowFunc()
+}
+
+// UseCompositeResponse defines the response parameters for Composite.Use()
+type UseCompositeResponse struct {
+	// Success is true when the tokens were taken from both the leaky bucket and the sliding window
+	Success bool
+
+	// RemainingTokens defines how many tokens are left in the leaky bucket
+	RemainingTokens int
+
+	// ResetAt is the time at which the leaky bucket will be fully refilled
+	ResetAt time.Time
+
+	// RemainingCapacity defines how many tokens may still be taken in the sliding window
+	RemainingCapacity int
+}
+
+// windowCountScript keeps a running total of the tokens in the composite's sliding window in countKey, so a take doesn't need to
+// scan every member. Each take is stored as a single member carrying how many tokens it took after its last colon, so the sorted
+// set grows with requests rather than tokens, and only the members that have expired are read, to take their tokens off the total.
+// Members without a count, such as those stored by older versions, stand for a single token, and if the total is missing, such as
+// for windows stored by older versions, it's counted from the unexpired members once. It expects key, countKey and now to be
+// defined.
+const windowCountScript = `
+local function memberTokens(member)
+	local count = string.match(member, ":(%d+)$")
+	if (count) then
+		return tonumber(count)
+	end
+	return 1
+end
+
+local tokens = tonumber(redis.call("get", countKey))
+if (tokens == nil) then
+	tokens = 0
+	for _, member in ipairs(redis.call("zrangebyscore", key, "(" .. now, "+inf")) do
+		tokens = tokens + memberTokens(member)
+	end
+else
+	for _, member in ipairs(redis.call("zrangebyscore", key, "-inf", now)) do
+		tokens = tokens - memberTokens(member)
+	end
+	if (tokens < 0) then
+		tokens = 0
+	end
+end
+redis.call("zremrangebyscore", key, "-inf", now) -- clear expired tokens
+local total = tokens
+`
+
+// compositeUseScript fills the leaky bucket and clears expired tokens from the sliding window, then takes the tokens from both if
+// both have room for them.
+var compositeUseScript = newScript(`
+local tokensKey = KEYS[1]
+local lastFillKey = KEYS[2]
+local remainderKey = KEYS[3]
+local key = KEYS[4]
+local compactedKey = KEYS[5]
+local countKey = KEYS[6]
+local capacity = tonumber(ARGV[1])
+local bucketWindow = tonumber(ARGV[2])
+local nowSeconds = tonumber(ARGV[3])
+local take = tonumber(ARGV[4])
+local now = ARGV[5]
+local expiresAt = ARGV[6]
+local window = ARGV[7]
+local max = tonumber(ARGV[8])
+local member = ARGV[9]
+
+local function fill(capacity, window, now, warmStart, maxLookback, tokens, lastFilled, remainder)
+` + leakyBucketFillScript + `
+	return tokens, lastFilled, remainder
+end
+
+local bucketTokens, lastFilled, remainder = fill(
+	capacity, bucketWindow, nowSeconds, tonumber(ARGV[10]), tonumber(ARGV[11]),
+	tonumber(redis.call("get", tokensKey)), tonumber(redis.call("get", lastFillKey)), tonumber(redis.call("get", remainderKey))
+)
+` + legacyScoresScript + windowCountScript + compactedTokensScript + `
+local success = 0
+
+if (bucketTokens >= take and tokens + take <= max) then
+	-- both have room: take from the bucket, and add a single member counting every token to the window
+	bucketTokens = bucketTokens - take
+	redis.call("zadd", key, expiresAt, member)
+	tokens = tokens + take
+	total = total + take
+	success = 1
+end
+
+-- the window and its total are kept for the same time, so neither outlives the other
+redis.call("expire", key, window)
+redis.call("set", countKey, tostring(total), "EX", window)
+
+redis.call("set", tokensKey, tostring(bucketTokens), "EX", bucketWindow)
+redis.call("set", lastFillKey, tostring(lastFilled), "EX", bucketWindow)
+redis.call("set", remainderKey, tostring(remainder), "EX", bucketWindow)
+
+return {success, bucketTokens, lastFilled, tokens}
+`)
+
+// Use atomically attempts to take takeAmount tokens from both the leaky bucket and the sliding window. Either the tokens are
+// taken from both, or from neither.
+//
+// If takeAmount is more than either capacity, ErrTakeExceedsCapacity is returned without querying Redis, as the take could never
+// succeed. If it's less than 1, ErrInvalidTakeAmount is returned, as nothing would be taken.
+func (r *CompositeImpl) Use(ctx context.Context, bucket *CompositeOptions, takeAmount int) (*UseCompositeResponse, error) {
+	if takeAmount < 1 {
+		return nil, ErrInvalidTakeAmount
+	}
+	if takeAmount > bucket.BucketCapacity || takeAmount > bucket.WindowCapacity {
+		return nil, ErrTakeExceedsCapacity
+	}
+
+	now := r.now()
+	expiresAt := now.Add(bucket.Window).UnixMilli()
+
+	id, err := newMemberID()
+	if err != nil {
+		return nil, fmt.Errorf("generating member id: %w", err)
+	}
+
+	leakyBucket := bucket.leakyBucket()
+	resp, err := r.eval(ctx, compositeUseScript, compositeKeys(bucket.KeyPrefix), []interface{}{
+		bucket.BucketCapacity, bucket.BucketWindowSeconds, now.UTC().Unix(), takeAmount,
+		now.UnixMilli(), expiresAt, int(math.Ceil(bucket.Window.Seconds())), bucket.WindowCapacity, fmt.Sprintf("%d-%s:%d", expiresAt, id, takeAmount),
+		leakyBucket.warmStartTokens(), leakyBucket.maxFillLookbackSeconds(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query redis adapter: %w", err)
+	}
+
+	output, err := parseUseCompositeResponse(resp)
+	if err != nil {
+		logUnexpectedResponse(r.Logger, bucket.KeyPrefix, resp, err)
+		return nil, parsingError(compositeUseScript, err)
+	}
+
+	remainingCapacity := 0
+	if v := bucket.WindowCapacity - output.windowTokens; v > remainingCapacity {
+		remainingCapacity = v
+	}
+
+	remaining := output.bucketTokens
+	if remainingCapacity < remaining {
+		remaining = remainingCapacity
+	}
+
+	emitDecision(r.OnDecision, DecisionEvent{
+		Key:        bucket.KeyPrefix,
+		Allowed:    output.success,
+		Remaining:  remaining,
+		TakeAmount: takeAmount,
+	})
+
+	return &UseCompositeResponse{
+		Success:           output.success,
+		RemainingTokens:   output.bucketTokens,
+		ResetAt:           calculateLeakyBucketFillTime(output.lastFilled, output.bucketTokens, bucket.BucketCapacity, bucket.BucketWindowSeconds),
+		RemainingCapacity: remainingCapacity,
+	}, nil
+}
+
+// compositeKeys returns the leaky bucket keys followed by the sliding window keys for prefix, and the key holding the running total
+// of the tokens in the window.
+func compositeKeys(prefix string) []string {
+	return append(append(leakyBucketKeys(prefix), slidingWindowKeys(prefix+"::window")...), prefix+"::window::count")
+}
+
+type useCompositeOutput struct {
+	success      bool
+	bucketTokens int
+	lastFilled   int
+	windowTokens int
+}
+
+func parseUseCompositeResponse(v interface{}) (*useCompositeOutput, error) {
+	ints, err := parseRedisInt64Slice(v)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ints) != 4 {
+		return nil, fmt.Errorf("expected 4 args but got %d", len(ints))
+	}
+
+	return &useCompositeOutput{
+		success:      ints[0] == 1,
+		bucketTokens: int(ints[1]),
+		lastFilled:   int(ints[2]),
+		windowTokens: int(ints[3]),
+	}, nil
+}
@@ -0,0 +1,207 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aidenwallis/go-ratelimiting/redis/adapters"
+	goredisadapter "github.com/aidenwallis/go-ratelimiting/redis/adapters/go-redis"
+	redigoadapter "github.com/aidenwallis/go-ratelimiting/redis/adapters/redigo"
+	"github.com/alicebob/miniredis/v2"
+	redigo "github.com/gomodule/redigo/redis"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func compositeOptions() *CompositeOptions {
+	return &CompositeOptions{
+		KeyPrefix:           "composite",
+		BucketCapacity:      2,
+		BucketWindowSeconds: 2,
+		WindowCapacity:      3,
+		Window:              time.Minute,
+	}
+}
+
+func TestUseComposite(t *testing.T) {
+	testCases := map[string]func(*miniredis.Miniredis) adapters.Adapter{
+		"go-redis": func(t *miniredis.Miniredis) adapters.Adapter {
+			return goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: t.Addr()}))
+		},
+		"redigo": func(t *miniredis.Miniredis) adapters.Adapter {
+			conn, err := redigo.Dial("tcp", t.Addr())
+			if err != nil {
+				panic(err)
+			}
+			return redigoadapter.NewAdapter(conn)
+		},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Now().UTC()
+			limiter := NewComposite(testCase(miniredis.RunT(t)))
+			limiter.nowFunc = func() time.Time { return now }
+
+			{
+				resp, err := limiter.Use(ctx, compositeOptions(), 2)
+				assert.NoError(t, err)
+				assert.True(t, resp.Success)
+				assert.Equal(t, 0, resp.RemainingTokens)
+				assert.Equal(t, 1, resp.RemainingCapacity)
+			}
+
+			{
+				// the leaky bucket is empty, so nothing should be taken from the window either
+				resp, err := limiter.Use(ctx, compositeOptions(), 1)
+				assert.NoError(t, err)
+				assert.False(t, resp.Success)
+				assert.Equal(t, 1, resp.RemainingCapacity)
+			}
+
+			// the bucket refills, but the window only has room for one more token
+			limiter.nowFunc = func() time.Time { return now.Add(time.Second * 2) }
+
+			{
+				resp, err := limiter.Use(ctx, compositeOptions(), 2)
+				assert.NoError(t, err)
+				assert.False(t, resp.Success)
+				assert.Equal(t, 2, resp.RemainingTokens, "the bucket should not be decremented")
+				assert.Equal(t, 1, resp.RemainingCapacity)
+			}
+
+			{
+				resp, err := limiter.Use(ctx, compositeOptions(), 1)
+				assert.NoError(t, err)
+				assert.True(t, resp.Success)
+				assert.Equal(t, 1, resp.RemainingTokens)
+				assert.Equal(t, 0, resp.RemainingCapacity)
+			}
+		})
+	}
+}
+
+func TestUseComposite_CountedMembers(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+	mr := miniredis.RunT(t)
+	limiter := NewComposite(goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: mr.Addr()})))
+	limiter.nowFunc = func() time.Time { return now }
+
+	opts := compositeOptions()
+	windowKey := compositeKeys(opts.KeyPrefix)[3]
+	countKey := compositeKeys(opts.KeyPrefix)[5]
+
+	// a member left by an older version, without a running total, stands for a single token
+	_, err := mr.ZAdd(windowKey, float64(now.Add(time.Minute).UnixMilli()), "legacy-member")
+	assert.NoError(t, err)
+
+	resp, err := limiter.Use(ctx, opts, 2)
+	assert.NoError(t, err)
+	assert.True(t, resp.Success)
+	assert.Equal(t, 0, resp.RemainingCapacity)
+
+	members, err := mr.ZMembers(windowKey)
+	assert.NoError(t, err)
+	assert.Len(t, members, 2, "the take should be stored in a single member")
+
+	total, err := mr.Get(countKey)
+	assert.NoError(t, err)
+	assert.Equal(t, "3", total)
+
+	// once the members expire, their tokens are taken off the running total
+	now = now.Add(2 * time.Minute)
+	resp, err = limiter.Use(ctx, opts, 1)
+	assert.NoError(t, err)
+	assert.True(t, resp.Success)
+	assert.Equal(t, 2, resp.RemainingCapacity)
+
+	total, err = mr.Get(countKey)
+	assert.NoError(t, err)
+	assert.Equal(t, "1", total)
+	assert.Equal(t, mr.TTL(windowKey), mr.TTL(countKey))
+}
+
+func TestUseComposite_LeakyBucketFill(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+	limiter := NewComposite(goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: miniredis.RunT(t).Addr()})))
+	limiter.nowFunc = func() time.Time { return now }
+
+	opts := compositeOptions()
+	opts.BucketCapacity = 10
+	opts.BucketWindowSeconds = 10
+	opts.WindowCapacity = 100
+	opts.BucketWarmStart = 0.5
+	opts.BucketMaxFillLookback = 3 * time.Second
+
+	// the bucket starts half full
+	resp, err := limiter.Use(ctx, opts, 1)
+	assert.NoError(t, err)
+	assert.True(t, resp.Success)
+	assert.Equal(t, 4, resp.RemainingTokens)
+
+	resp, err = limiter.Use(ctx, opts, 4)
+	assert.NoError(t, err)
+	assert.True(t, resp.Success)
+	assert.Equal(t, 0, resp.RemainingTokens)
+
+	// the bucket has been idle for 8 seconds, but only fills for 3 of them
+	now = now.Add(8 * time.Second)
+	resp, err = limiter.Use(ctx, opts, 1)
+	assert.NoError(t, err)
+	assert.True(t, resp.Success)
+	assert.Equal(t, 2, resp.RemainingTokens)
+}
+
+func TestUseComposite_Errors(t *testing.T) {
+	testCases := map[string]struct {
+		errorMessage string
+		mockAdapter  adapters.Adapter
+	}{
+		"redis error": {
+			errorMessage: "failed to query redis adapter: " + assert.AnError.Error(),
+			mockAdapter: &mockAdapter{
+				returnError: assert.AnError,
+			},
+		},
+		"parsing error": {
+			errorMessage: "parsing redis response from script " + scriptSHA(compositeUseScript) + ": expected 4 args but got 3",
+			mockAdapter: &mockAdapter{
+				returnValue: []interface{}{int64(1), int64(2), int64(3)},
+			},
+		},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			out, err := NewComposite(testCase.mockAdapter).Use(context.Background(), compositeOptions(), 1)
+			assert.Nil(t, out)
+			assert.EqualError(t, err, testCase.errorMessage)
+		})
+	}
+}
+
+func TestUseComposite_ExceedsCapacity(t *testing.T) {
+	adapter := &mockAdapter{}
+	out, err := NewComposite(adapter).Use(context.Background(), compositeOptions(), 3)
+	assert.Nil(t, out)
+	assert.ErrorIs(t, err, ErrTakeExceedsCapacity)
+	assert.False(t, adapter.called, "redis should not be queried")
+}
+
+func TestUseComposite_InvalidTakeAmount(t *testing.T) {
+	for _, takeAmount := range []int{0, -1} {
+		adapter := &mockAdapter{}
+		out, err := NewComposite(adapter).Use(context.Background(), compositeOptions(), takeAmount)
+		assert.Nil(t, out)
+		assert.ErrorIs(t, err, ErrInvalidTakeAmount)
+		assert.False(t, adapter.called, "redis should not be queried")
+	}
+}
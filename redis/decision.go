@@ -0,0 +1,53 @@
+package redis
+
+import "time"
+
+// Decision is the outcome of a call to Use in a shape shared by every algorithm, so code that handles several algorithms can read
+// it without knowing which one made it. The algorithm specific details remain on the Use responses.
+type Decision struct {
+	// Success is true when the tokens were taken
+	Success bool
+
+	// Remaining is how many more tokens may be taken
+	Remaining int
+
+	// ResetAt is when the ratelimiter will be fully replenished, it's zero when the algorithm doesn't report it.
+	ResetAt time.Time
+
+	// RetryAfter is how long to wait before trying again when the take was denied, it's 0 when the take succeeded.
+	RetryAfter time.Duration
+}
+
+// Decision returns the outcome of the call in the shape shared by every algorithm. bucket must be the options the response was
+// returned for, as it's used to work out RetryAfter.
+//
+// RetryAfter is how long until a single token can be taken, the same delay WaitUse would sleep for: when the caller's cool-down ends
+// if they're penalized, when the daily quota resets at midnight UTC if it's exhausted, and otherwise when the next token refills.
+func (r *UseLeakyBucketResponse) Decision(bucket *LeakyBucketOptions) Decision {
+	d := Decision{Success: r.Success, Remaining: r.RemainingTokens, ResetAt: r.ResetAt}
+	if !r.Success {
+		d.RetryAfter = leakyBucketRetryAfter(time.Now(), bucket, 1, r)
+	}
+	return d
+}
+
+// Decision returns the outcome of the call in the shape shared by every algorithm. bucket must be the options the response was
+// returned for, as it's used to work out RetryAfter.
+//
+// The sliding window doesn't report when its oldest token expires, so ResetAt is zero, and RetryAfter is the window, or when the
+// caller's cool-down ends if they're penalized.
+func (r *UseSlidingWindowResponse) Decision(bucket *SlidingWindowOptions) Decision {
+	d := Decision{Success: r.Success, Remaining: r.RemainingCapacity}
+	if !r.Success {
+		d.RetryAfter = retryAfter(bucket.Window, r.PenaltyUntil)
+	}
+	return d
+}
+
+// retryAfter returns fallback, unless the caller is cooling down until penaltyUntil, in which case it's how long until it ends.
+func retryAfter(fallback time.Duration, penaltyUntil time.Time) time.Duration {
+	if penaltyUntil.IsZero() {
+		return fallback
+	}
+	return time.Until(penaltyUntil)
+}
@@ -0,0 +1,69 @@
+package redis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecision(t *testing.T) {
+	t.Parallel()
+
+	resetAt := time.Unix(1700000000, 0)
+
+	testCases := map[string]struct {
+		decision func() Decision
+		expected Decision
+	}{
+		"leaky bucket allowed": {
+			decision: func() Decision {
+				return (&UseLeakyBucketResponse{Success: true, RemainingTokens: 59, ResetAt: resetAt}).Decision(leakyBucketOptions())
+			},
+			expected: Decision{Success: true, Remaining: 59, ResetAt: resetAt},
+		},
+		"leaky bucket denied": {
+			decision: func() Decision {
+				return (&UseLeakyBucketResponse{ResetAt: resetAt}).Decision(leakyBucketOptions())
+			},
+			expected: Decision{ResetAt: resetAt, RetryAfter: time.Second},
+		},
+		"sliding window allowed": {
+			decision: func() Decision {
+				return (&UseSlidingWindowResponse{Success: true, RemainingCapacity: 59}).Decision(slidingWindowOptions())
+			},
+			expected: Decision{Success: true, Remaining: 59},
+		},
+		"sliding window denied": {
+			decision: func() Decision {
+				return (&UseSlidingWindowResponse{}).Decision(slidingWindowOptions())
+			},
+			expected: Decision{RetryAfter: time.Minute},
+		},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, testCase.expected, testCase.decision())
+		})
+	}
+
+	t.Run("daily quota exhausted", func(t *testing.T) {
+		t.Parallel()
+
+		now := time.Now()
+		d := (&UseLeakyBucketResponse{RemainingTokens: 59, DeniedByQuota: true}).Decision(leakyBucketOptions())
+		assert.InDelta(t, quotaResetAt(now).Sub(now), d.RetryAfter, float64(time.Second))
+	})
+
+	t.Run("penalized", func(t *testing.T) {
+		t.Parallel()
+
+		penaltyUntil := time.Now().Add(time.Minute * 5)
+		d := (&UseSlidingWindowResponse{PenaltyUntil: penaltyUntil}).Decision(slidingWindowOptions())
+		assert.InDelta(t, time.Minute*5, d.RetryAfter, float64(time.Second))
+	})
+}
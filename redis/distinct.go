@@ -0,0 +1,183 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aidenwallis/go-ratelimiting/redis/adapters"
+)
+
+// Distinct defines an interface compatible with DistinctImpl
+//
+// A distinct ratelimiter limits how many different values may be seen for a key within a window, rather than how many requests
+// are made, such as "no more than 5 distinct source IPs may use an API key per hour". A value that's already in the window is
+// always allowed, however often it's used, while new values are denied once the window holds the maximum.
+type Distinct interface {
+	// Use atomically attempts to add value to the window, which succeeds if it's already there, or there's room for another value.
+	Use(ctx context.Context, bucket *DistinctOptions, value string) (*UseDistinctResponse, error)
+}
+
+// DistinctImpl implements a distinct ratelimiter in Redis with Lua. This struct is compatible with the Distinct interface.
+//
+// The values are stored in a sorted set, scored by when they leave the window, so every value is counted exactly. This costs
+// memory for each value in the window, which is bounded by MaximumDistinct, as denied values aren't stored.
+type DistinctImpl struct {
+	// Adapter defines the Redis adapter
+	Adapter adapters.Adapter
+
+	// OnDecision is an optional hook which is called synchronously after every successful call to Redis that takes tokens, which is
+	// useful for audit logging. It is not called when Redis returns an error.
+	OnDecision func(DecisionEvent)
+
+	// Logger is optionally used to log debugging information, such as the raw response when Redis returns something unexpected.
+	Logger Logger
+
+	// UseFunctions runs the ratelimiter's scripts as Redis functions with FCALL rather than EVAL. The adapter must implement
+	// adapters.FunctionAdapter, and the library must be loaded with LoadFunctions() first.
+	UseFunctions bool
+
+	// nowFunc is a private helper used to mock out time changes in unit testing
+	//
+	// if this is not defined, it falls back to time.Now()
+	nowFunc func() time.Time
+}
+
+var _ Distinct = (*DistinctImpl)(nil)
+
+// DistinctOptions defines the options available to a distinct ratelimiter.
+type DistinctOptions struct {
+	// Key defines the Redis key used for this ratelimiter
+	Key string
+
+	// MaximumDistinct defines how many different values may be in the window at once.
+	MaximumDistinct int
+
+	// Window defines how long a value stays in the window after it was last used, resolution is available up to milliseconds.
+	Window time.Duration
+}
+
+// NewDistinct creates a new distinct ratelimiter instance
+func NewDistinct(adapter adapters.Adapter) *DistinctImpl {
+	return &DistinctImpl{
+		Adapter: adapter,
+		nowFunc: time.Now,
+	}
+}
+
+// HealthCheck verifies that the adapter is able to run Lua scripts against Redis, and that responses are returned in the shape
+// this ratelimiter expects. This is useful as a readiness probe, as some managed Redis variants disable scripting.
+func (r *DistinctImpl) HealthCheck(ctx context.Context) error {
+	return healthCheck(ctx, r.Adapter, r.UseFunctions)
+}
+
+// Close releases the resources held by the adapter, if the adapter implements io.Closer. Otherwise, it does nothing.
+func (r *DistinctImpl) Close() error {
+	return closeAdapter(r.Adapter)
+}
+
+// eval runs script through the adapter, using FCALL when UseFunctions is set.
+func (r *DistinctImpl) eval(ctx context.Context, script string, keys []string, args []interface{}) (interface{}, error) {
+	return evalScript(ctx, r.Adapter, r.UseFunctions, script, keys, args)
+}
+
+func (r *DistinctImpl) now() time.Time {
+	if r.nowFunc == nil {
+		return time.Now()
+	}
+	return r.nowFunc()
+}
+
+// UseDistinctResponse defines the response parameters for Distinct.Use()
+type UseDistinctResponse struct {
+	// Success is true when the value was already in the window, or was added to it
+	Success bool
+
+	// Distinct is how many different values are in the window, including the value when it was added
+	Distinct int
+
+	// RemainingDistinct is how many more new values may be added to the window
+	RemainingDistinct int
+}
+
+// distinctUseScript clears values which have left the window, then adds the value in ARGV[4] to it, or refreshes when it leaves the
+// window if it's already there, as long as the window holds fewer than ARGV[3] values.
+var distinctUseScript = newScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local max = tonumber(ARGV[3])
+local value = ARGV[4]
+
+redis.call("zremrangebyscore", key, "-inf", now) -- clear values which have left the window
+
+local distinct = tonumber(redis.call("zcard", key))
+local seen = redis.call("zscore", key, value)
+local success = 0
+
+if (seen or distinct < max) then
+	if (not seen) then
+		distinct = distinct + 1
+	end
+	redis.call("zadd", key, now + window, value)
+	redis.call("pexpire", key, window)
+	success = 1
+end
+
+return {success, distinct}
+`)
+
+// Use atomically attempts to add value to the window, which succeeds if it's already there, or there's room for another value.
+// Using a value that's already in the window keeps it there for another Window.
+func (r *DistinctImpl) Use(ctx context.Context, bucket *DistinctOptions, value string) (*UseDistinctResponse, error) {
+	args := []interface{}{r.now().UnixMilli(), bucket.Window.Milliseconds(), bucket.MaximumDistinct, value}
+	resp, err := r.eval(ctx, distinctUseScript, []string{bucket.Key}, args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query redis adapter: %w", err)
+	}
+
+	output, err := parseUseDistinctResponse(resp)
+	if err != nil {
+		logUnexpectedResponse(r.Logger, bucket.Key, resp, err)
+		return nil, parsingError(distinctUseScript, err)
+	}
+
+	remaining := 0
+	if v := bucket.MaximumDistinct - output.distinct; v > 0 {
+		remaining = v
+	}
+
+	emitDecision(r.OnDecision, DecisionEvent{
+		Key:        bucket.Key,
+		Allowed:    output.success,
+		Remaining:  remaining,
+		TakeAmount: 1,
+	})
+
+	return &UseDistinctResponse{
+		Success:           output.success,
+		Distinct:          output.distinct,
+		RemainingDistinct: remaining,
+	}, nil
+}
+
+type useDistinctOutput struct {
+	success  bool
+	distinct int
+}
+
+func parseUseDistinctResponse(v interface{}) (*useDistinctOutput, error) {
+	ints, err := parseRedisInt64Slice(v)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ints) != 2 {
+		return nil, fmt.Errorf("expected 2 args but got %d", len(ints))
+	}
+
+	return &useDistinctOutput{
+		success:  ints[0] == 1,
+		distinct: int(ints[1]),
+	}, nil
+}
@@ -0,0 +1,104 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aidenwallis/go-ratelimiting/redis/adapters"
+	goredisadapter "github.com/aidenwallis/go-ratelimiting/redis/adapters/go-redis"
+	redigoadapter "github.com/aidenwallis/go-ratelimiting/redis/adapters/redigo"
+	"github.com/alicebob/miniredis/v2"
+	redigo "github.com/gomodule/redigo/redis"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func distinctOptions() *DistinctOptions {
+	return &DistinctOptions{
+		Key:             "distinct",
+		MaximumDistinct: 2,
+		Window:          time.Hour,
+	}
+}
+
+func TestUseDistinct(t *testing.T) {
+	testCases := map[string]func(*miniredis.Miniredis) adapters.Adapter{
+		"go-redis": func(t *miniredis.Miniredis) adapters.Adapter {
+			return goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: t.Addr()}))
+		},
+		"redigo": func(t *miniredis.Miniredis) adapters.Adapter {
+			conn, err := redigo.Dial("tcp", t.Addr())
+			if err != nil {
+				panic(err)
+			}
+			return redigoadapter.NewAdapter(conn)
+		},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Now().UTC()
+			mr := miniredis.RunT(t)
+			limiter := NewDistinct(testCase(mr))
+			limiter.nowFunc = func() time.Time { return now }
+
+			use := func(value string, expected *UseDistinctResponse) {
+				t.Helper()
+				resp, err := limiter.Use(ctx, distinctOptions(), value)
+				assert.NoError(t, err)
+				assert.Equal(t, expected, resp)
+			}
+
+			use("10.0.0.1", &UseDistinctResponse{Success: true, Distinct: 1, RemainingDistinct: 1})
+			use("10.0.0.1", &UseDistinctResponse{Success: true, Distinct: 1, RemainingDistinct: 1})
+			use("10.0.0.2", &UseDistinctResponse{Success: true, Distinct: 2, RemainingDistinct: 0})
+			assert.Equal(t, time.Hour, mr.TTL("distinct"))
+
+			// a third value is denied, but values already in the window are still allowed
+			use("10.0.0.3", &UseDistinctResponse{Success: false, Distinct: 2, RemainingDistinct: 0})
+			now = now.Add(time.Minute * 30)
+			use("10.0.0.1", &UseDistinctResponse{Success: true, Distinct: 2, RemainingDistinct: 0})
+
+			// the second value leaves the window an hour after it was used, but the first was used again since
+			now = now.Add(time.Minute * 30)
+			use("10.0.0.3", &UseDistinctResponse{Success: true, Distinct: 2, RemainingDistinct: 0})
+			members, err := mr.ZMembers("distinct")
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"10.0.0.1", "10.0.0.3"}, members)
+		})
+	}
+}
+
+func TestUseDistinct_Errors(t *testing.T) {
+	testCases := map[string]struct {
+		errorMessage string
+		mockAdapter  adapters.Adapter
+	}{
+		"redis error": {
+			errorMessage: "failed to query redis adapter: " + assert.AnError.Error(),
+			mockAdapter: &mockAdapter{
+				returnError: assert.AnError,
+			},
+		},
+		"parsing error": {
+			errorMessage: "parsing redis response from script " + scriptSHA(distinctUseScript) + ": expected 2 args but got 3",
+			mockAdapter: &mockAdapter{
+				returnValue: []interface{}{int64(1), int64(2), int64(3)},
+			},
+		},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			out, err := NewDistinct(testCase.mockAdapter).Use(context.Background(), distinctOptions(), "value")
+			assert.Nil(t, out)
+			assert.EqualError(t, err, testCase.errorMessage)
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aidenwallis/go-ratelimiting/redis/adapters"
+	"github.com/aidenwallis/go-ratelimiting/redis/script"
+)
+
+// enumerateKeysBatchSize is the COUNT hint given to each SCAN
+const enumerateKeysBatchSize = 500
+
+// enumerateKeysScript runs a single SCAN iteration, and returns the cursor and the keys it found.
+var enumerateKeysScript = newScript(`
+local cursor = ARGV[1]
+local pattern = ARGV[2]
+local count = ARGV[3]
+
+local resp = redis.call("scan", cursor, "match", pattern, "count", count)
+return {resp[1], resp[2]}
+`)
+
+// EnumerateKeys calls fn with the key and remaining tokens of every bucket whose key starts with prefix, such as for an admin view
+// of which callers are currently being throttled. The options for each bucket are looked up with the OptionsResolver, which is
+// required, and then the bucket is inspected, which doesn't take any tokens. If fn returns an error, enumeration stops and the error
+// is returned.
+//
+// Keys are found using SCAN in batches, one batch per script call, so Redis is never blocked by a full KEYS sweep. SCAN may return a
+// key more than once, so fn may be called more than once for a bucket, and buckets created or expiring during the enumeration may or
+// may not be included. Buckets stored with SingleKey aren't found, as they have no companion key to match on. As SCAN only covers
+// a single node, when running against Redis Cluster this only enumerates keys on the node the adapter is connected to.
+func (r *LeakyBucketImpl) EnumerateKeys(ctx context.Context, prefix string, fn func(key string, remaining int) error) error {
+	if r.OptionsResolver == nil {
+		return ErrNoOptionsResolver
+	}
+
+	// every bucket has a tokens key, so they're found through that, without matching the other keys that share its prefix
+	pattern := tokensKey(escapeGlob(prefix) + "*")
+	cursor := "0"
+
+	for {
+		resp, err := r.eval(adapters.WithIdempotent(ctx), enumerateKeysScript, []string{}, []interface{}{cursor, pattern, enumerateKeysBatchSize})
+		if err != nil {
+			return fmt.Errorf("failed to query redis adapter: %w", err)
+		}
+
+		next, keys, err := parseEnumerateKeysResponse(resp)
+		if err != nil {
+			logUnexpectedResponse(r.Logger, prefix, resp, err)
+			return parsingError(enumerateKeysScript, err)
+		}
+
+		for _, key := range keys {
+			key = strings.TrimSuffix(key, tokensKey(""))
+
+			bucket, err := r.OptionsResolver(ctx, key)
+			if err != nil {
+				return fmt.Errorf("resolving options: %w", err)
+			}
+
+			inspect, err := r.Inspect(ctx, bucket)
+			if err != nil {
+				return err
+			}
+
+			if err := fn(key, inspect.RemainingTokens); err != nil {
+				return err
+			}
+		}
+
+		if next == "0" {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+func parseEnumerateKeysResponse(v interface{}) (string, []string, error) {
+	args, ok := v.([]interface{})
+	if !ok {
+		return "", nil, fmt.Errorf("expected []interface{} but got %T", v)
+	}
+
+	if len(args) != 2 {
+		return "", nil, fmt.Errorf("expected 2 args but got %d", len(args))
+	}
+
+	cursor, ok := bulkString(args[0])
+	if !ok {
+		return "", nil, fmt.Errorf("expected string in args[0] but got %T", args[0])
+	}
+
+	rawKeys, ok := args[1].([]interface{})
+	if !ok {
+		return "", nil, fmt.Errorf("expected []interface{} in args[1] but got %T", args[1])
+	}
+
+	keys := make([]string, len(rawKeys))
+	for i, rawKey := range rawKeys {
+		if keys[i], ok = bulkString(rawKey); !ok {
+			return "", nil, fmt.Errorf("expected string in args[1][%d] but got %T", i, rawKey)
+		}
+	}
+
+	return cursor, keys, nil
+}
+
+// bulkString converts a bulk string, which adapters may return as either a string or []byte
+func bulkString(v interface{}) (string, bool) {
+	s, err := script.String(v, nil)
+	return s, err == nil
+}
+
+// integer converts an integer reply, which adapters may return as an int64, or a string or []byte holding a whole number
+func integer(v interface{}) (int64, bool) {
+	n, err := script.Int64(v, nil)
+	return n, err == nil
+}
@@ -0,0 +1,124 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aidenwallis/go-ratelimiting/redis/adapters"
+	goredisadapter "github.com/aidenwallis/go-ratelimiting/redis/adapters/go-redis"
+	redigoadapter "github.com/aidenwallis/go-ratelimiting/redis/adapters/redigo"
+	"github.com/alicebob/miniredis/v2"
+	redigo "github.com/gomodule/redigo/redis"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnumerateKeys(t *testing.T) {
+	testCases := map[string]func(*miniredis.Miniredis) adapters.Adapter{
+		"go-redis": func(t *miniredis.Miniredis) adapters.Adapter {
+			return goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: t.Addr()}))
+		},
+		"redigo": func(t *miniredis.Miniredis) adapters.Adapter {
+			conn, err := redigo.Dial("tcp", t.Addr())
+			if err != nil {
+				panic(err)
+			}
+			return redigoadapter.NewAdapter(conn)
+		},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			limiter := NewLeakyBucket(testCase(miniredis.RunT(t)))
+			limiter.OptionsResolver = func(_ context.Context, key string) (*LeakyBucketOptions, error) {
+				return &LeakyBucketOptions{KeyPrefix: key, MaximumCapacity: 10, WindowSeconds: 60, TrackPeak: true}, nil
+			}
+
+			for key, take := range map[string]int{"tenant:[1]:a": 3, "tenant:[1]:b": 10, "tenant:[2]:a": 1} {
+				_, err := limiter.UseKey(ctx, key, take)
+				assert.NoError(t, err)
+			}
+
+			remaining := map[string]int{}
+			assert.NoError(t, limiter.EnumerateKeys(ctx, "tenant:[1]:", func(key string, tokens int) error {
+				remaining[key] = tokens
+				return nil
+			}))
+			assert.Equal(t, map[string]int{"tenant:[1]:a": 7, "tenant:[1]:b": 0}, remaining)
+
+			stop := errors.New("stop")
+			calls := 0
+			assert.ErrorIs(t, limiter.EnumerateKeys(ctx, "tenant:", func(string, int) error {
+				calls++
+				return stop
+			}), stop)
+			assert.Equal(t, 1, calls)
+		})
+	}
+}
+
+func TestEnumerateKeys_Errors(t *testing.T) {
+	ctx := context.Background()
+	noop := func(string, int) error { return nil }
+
+	t.Run("no options resolver", func(t *testing.T) {
+		assert.ErrorIs(t, NewLeakyBucket(&mockAdapter{}).EnumerateKeys(ctx, "", noop), ErrNoOptionsResolver)
+	})
+
+	resolver := func(_ context.Context, key string) (*LeakyBucketOptions, error) {
+		return &LeakyBucketOptions{KeyPrefix: key, MaximumCapacity: 10, WindowSeconds: 60}, nil
+	}
+
+	testCases := map[string]struct {
+		errorMessage string
+		mockAdapter  *mockAdapter
+		resolver     func(context.Context, string) (*LeakyBucketOptions, error)
+	}{
+		"adapter error": {
+			errorMessage: "failed to query redis adapter: boom",
+			mockAdapter:  &mockAdapter{returnError: errors.New("boom")},
+			resolver:     resolver,
+		},
+		"invalid response": {
+			errorMessage: "parsing redis response from script " + scriptSHA(enumerateKeysScript) + ": expected 2 args but got 1",
+			mockAdapter:  &mockAdapter{returnValue: []interface{}{"0"}},
+			resolver:     resolver,
+		},
+		"invalid cursor": {
+			errorMessage: "parsing redis response from script " + scriptSHA(enumerateKeysScript) + ": expected string in args[0] but got int64",
+			mockAdapter:  &mockAdapter{returnValue: []interface{}{int64(0), []interface{}{}}},
+			resolver:     resolver,
+		},
+		"invalid keys": {
+			errorMessage: "parsing redis response from script " + scriptSHA(enumerateKeysScript) + ": expected []interface{} in args[1] but got string",
+			mockAdapter:  &mockAdapter{returnValue: []interface{}{"0", "foo"}},
+			resolver:     resolver,
+		},
+		"invalid key": {
+			errorMessage: "parsing redis response from script " + scriptSHA(enumerateKeysScript) + ": expected string in args[1][0] but got int64",
+			mockAdapter:  &mockAdapter{returnValue: []interface{}{"0", []interface{}{int64(1)}}},
+			resolver:     resolver,
+		},
+		"resolver error": {
+			errorMessage: "resolving options: boom",
+			mockAdapter:  &mockAdapter{returnValue: []interface{}{"0", []interface{}{"foo::tokens"}}},
+			resolver: func(context.Context, string) (*LeakyBucketOptions, error) {
+				return nil, errors.New("boom")
+			},
+		},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			limiter := NewLeakyBucket(testCase.mockAdapter)
+			limiter.OptionsResolver = testCase.resolver
+			assert.EqualError(t, limiter.EnumerateKeys(ctx, "", noop), testCase.errorMessage)
+		})
+	}
+}
@@ -0,0 +1,42 @@
+// Package fake provides in-memory implementations of the Redis ratelimiters, for unit testing code that depends on them without
+// running Redis.
+//
+// The fakes share a Clock, which only moves when you tell it to, so your tests can fast-forward time deterministically.
+package fake
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is a manually controlled clock used by the fake ratelimiters.
+type Clock struct {
+	m   sync.Mutex
+	now time.Time
+}
+
+// NewClock creates a new clock, set to the given time.
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+// Now returns the clock's current time.
+func (c *Clock) Now() time.Time {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.now
+}
+
+// Set moves the clock to the given time.
+func (c *Clock) Set(now time.Time) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.now = now
+}
+
+// Advance moves the clock forward by d.
+func (c *Clock) Advance(d time.Duration) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.now = c.now.Add(d)
+}
@@ -0,0 +1,481 @@
+package fake_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aidenwallis/go-ratelimiting/redis"
+	"github.com/aidenwallis/go-ratelimiting/redis/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClock(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	clock := fake.NewClock(now)
+	assert.Equal(t, now, clock.Now())
+
+	clock.Advance(time.Minute)
+	assert.Equal(t, now.Add(time.Minute), clock.Now())
+
+	clock.Set(now)
+	assert.Equal(t, now, clock.Now())
+}
+
+func TestLeakyBucket(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+	clock := fake.NewClock(now)
+	limiter := fake.NewLeakyBucket(clock)
+
+	opts := &redis.LeakyBucketOptions{KeyPrefix: "test-bucket", MaximumCapacity: 60, WindowSeconds: 60}
+
+	{
+		resp, err := limiter.Inspect(ctx, opts)
+		assert.NoError(t, err)
+		assert.Equal(t, 60, resp.RemainingTokens)
+		assert.Equal(t, now.Unix(), resp.ResetAt.Unix())
+	}
+
+	for i := 1; i <= 2; i++ {
+		resp, err := limiter.Use(ctx, opts, 1)
+		assert.NoError(t, err)
+		assert.True(t, resp.Success)
+		assert.Equal(t, 60-i, resp.RemainingTokens)
+		assert.Equal(t, now.Add(time.Second*time.Duration(i)).Unix(), resp.ResetAt.Unix())
+	}
+
+	{
+		resp, err := limiter.Use(ctx, opts, 59)
+		assert.NoError(t, err)
+		assert.False(t, resp.Success)
+		assert.Equal(t, 58, resp.RemainingTokens)
+	}
+
+	clock.Advance(time.Second * 3)
+
+	{
+		resp, err := limiter.Use(ctx, opts, 1)
+		assert.NoError(t, err)
+		assert.True(t, resp.Success)
+		assert.Equal(t, 59, resp.RemainingTokens)
+		assert.Equal(t, now.Add(time.Second*4).Unix(), resp.ResetAt.Unix())
+	}
+
+	{
+		resp, err := limiter.Use(ctx, opts, 61)
+		assert.Nil(t, resp)
+		assert.ErrorIs(t, err, redis.ErrTakeExceedsCapacity)
+	}
+
+	{
+		resp, err := limiter.Use(ctx, opts, -1)
+		assert.Nil(t, resp)
+		assert.ErrorIs(t, err, redis.ErrInvalidTakeAmount)
+	}
+}
+
+func TestLeakyBucket_StartEmpty(t *testing.T) {
+	ctx := context.Background()
+	clock := fake.NewClock(time.Unix(1700000000, 0))
+	limiter := fake.NewLeakyBucket(clock)
+	opts := &redis.LeakyBucketOptions{KeyPrefix: "test-bucket", MaximumCapacity: 60, WindowSeconds: 60, StartEmpty: true}
+
+	resp, err := limiter.Use(ctx, opts, 1)
+	assert.NoError(t, err)
+	assert.False(t, resp.Success)
+	assert.Equal(t, 0, resp.RemainingTokens)
+
+	// from then on, the bucket fills at its usual rate
+	clock.Advance(time.Second * 2)
+	resp, err = limiter.Use(ctx, opts, 1)
+	assert.NoError(t, err)
+	assert.True(t, resp.Success)
+	assert.Equal(t, 1, resp.RemainingTokens)
+}
+
+func TestLeakyBucket_UseAny(t *testing.T) {
+	ctx := context.Background()
+	limiter := fake.NewLeakyBucket(fake.NewClock(time.Unix(1700000000, 0)))
+
+	buckets := []*redis.LeakyBucketOptions{
+		{KeyPrefix: "a", MaximumCapacity: 10, WindowSeconds: 10},
+		{KeyPrefix: "b", MaximumCapacity: 4, WindowSeconds: 4},
+	}
+
+	expected := []struct {
+		take      int
+		index     int
+		remaining int
+	}{
+		{take: 2, index: 0, remaining: 8},
+		{take: 2, index: 1, remaining: 2},
+		{take: 5, index: 0, remaining: 3},
+		{take: 4, index: -1, remaining: 2},
+	}
+
+	for i, e := range expected {
+		index, resp, err := limiter.UseAny(ctx, buckets, e.take)
+		assert.NoError(t, err)
+		assert.Equal(t, e.index, index, "use %d", i)
+		assert.Equal(t, e.index != -1, resp.Success, "use %d", i)
+		assert.Equal(t, e.remaining, resp.RemainingTokens, "use %d", i)
+	}
+
+	_, _, err := limiter.UseAny(ctx, nil, 1)
+	assert.ErrorIs(t, err, redis.ErrNoBuckets)
+}
+
+func TestLeakyBucket_RefundBatch(t *testing.T) {
+	ctx := context.Background()
+	limiter := fake.NewLeakyBucket(fake.NewClock(time.Unix(1700000000, 0)))
+
+	a := &redis.LeakyBucketOptions{KeyPrefix: "a", MaximumCapacity: 10, WindowSeconds: 10}
+	b := &redis.LeakyBucketOptions{KeyPrefix: "b", MaximumCapacity: 4, WindowSeconds: 4}
+
+	for _, bucket := range []*redis.LeakyBucketOptions{a, b} {
+		_, err := limiter.Use(ctx, bucket, 3)
+		assert.NoError(t, err)
+	}
+
+	remaining, err := limiter.RefundBatch(ctx, []redis.BucketRefund{{Bucket: a, Amount: 2}, {Bucket: b, Amount: 10}})
+	assert.NoError(t, err)
+	assert.Equal(t, []int{9, 4}, remaining)
+
+	resp, err := limiter.Inspect(ctx, a)
+	assert.NoError(t, err)
+	assert.Equal(t, 9, resp.RemainingTokens)
+}
+
+func TestLeakyBucket_MinimumReserve(t *testing.T) {
+	ctx := context.Background()
+	bucket := fake.NewLeakyBucket(fake.NewClock(time.Unix(1700000000, 0)))
+	opts := &redis.LeakyBucketOptions{KeyPrefix: "test-bucket", MaximumCapacity: 60, WindowSeconds: 60, MinimumReserve: 10}
+
+	resp, err := bucket.Use(ctx, opts, 50)
+	assert.NoError(t, err)
+	assert.True(t, resp.Success)
+
+	resp, err = bucket.Use(ctx, opts, 1)
+	assert.NoError(t, err)
+	assert.False(t, resp.Success)
+	assert.True(t, resp.DeniedByReserve)
+	assert.Equal(t, 10, resp.RemainingTokens)
+}
+
+func TestLeakyBucket_DailyQuota(t *testing.T) {
+	ctx := context.Background()
+	clock := fake.NewClock(time.Date(2023, 6, 1, 18, 0, 0, 0, time.UTC))
+	bucket := fake.NewLeakyBucket(clock)
+	opts := &redis.LeakyBucketOptions{KeyPrefix: "test-bucket", MaximumCapacity: 60, WindowSeconds: 60, DailyQuota: 2}
+
+	resp, err := bucket.Use(ctx, opts, 2)
+	assert.NoError(t, err)
+	assert.True(t, resp.Success)
+
+	resp, err = bucket.Use(ctx, opts, 1)
+	assert.NoError(t, err)
+	assert.False(t, resp.Success)
+	assert.True(t, resp.DeniedByQuota)
+
+	// the quota resets at midnight UTC
+	clock.Advance(time.Hour * 6)
+	resp, err = bucket.Use(ctx, opts, 1)
+	assert.NoError(t, err)
+	assert.True(t, resp.Success)
+	assert.Equal(t, 1, resp.QuotaRemaining)
+}
+
+func TestLeakyBucket_RemainingTokensFloat(t *testing.T) {
+	ctx := context.Background()
+	clock := fake.NewClock(time.Unix(1700000000, 0))
+	bucket := fake.NewLeakyBucket(clock)
+	opts := &redis.LeakyBucketOptions{KeyPrefix: "test-bucket", MaximumCapacity: 10, WindowSeconds: 60}
+
+	_, err := bucket.Use(ctx, opts, 10)
+	assert.NoError(t, err)
+
+	clock.Advance(time.Second * 3)
+	resp, err := bucket.Use(ctx, opts, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.5, resp.RemainingTokensFloat)
+}
+
+func TestLeakyBucket_PartialOK(t *testing.T) {
+	ctx := context.Background()
+	bucket := fake.NewLeakyBucket(fake.NewClock(time.Unix(1700000000, 0)))
+	opts := &redis.LeakyBucketOptions{KeyPrefix: "test-bucket", MaximumCapacity: 10, WindowSeconds: 60, PartialOK: true}
+
+	resp, err := bucket.Use(ctx, opts, 8)
+	assert.NoError(t, err)
+	assert.Equal(t, 8, resp.Taken)
+
+	resp, err = bucket.Use(ctx, opts, 8)
+	assert.NoError(t, err)
+	assert.True(t, resp.Success)
+	assert.Equal(t, 2, resp.Taken)
+	assert.Equal(t, 0, resp.RemainingTokens)
+}
+
+func TestLeakyBucket_WarmStart(t *testing.T) {
+	ctx := context.Background()
+	clock := fake.NewClock(time.Unix(1700000000, 0))
+	bucket := fake.NewLeakyBucket(clock)
+	opts := &redis.LeakyBucketOptions{KeyPrefix: "test-bucket", MaximumCapacity: 60, WindowSeconds: 60, WarmStart: 0.5}
+
+	resp, err := bucket.Use(ctx, opts, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 29, resp.RemainingTokens)
+
+	clock.Advance(2 * time.Second)
+
+	resp, err = bucket.Use(ctx, opts, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 30, resp.RemainingTokens)
+}
+
+func TestLeakyBucket_MaxFillLookback(t *testing.T) {
+	ctx := context.Background()
+	clock := fake.NewClock(time.Unix(1700000000, 0))
+	bucket := fake.NewLeakyBucket(clock)
+	opts := &redis.LeakyBucketOptions{KeyPrefix: "test-bucket", MaximumCapacity: 60, WindowSeconds: 60, MaxFillLookback: 5 * time.Second}
+
+	resp, err := bucket.Use(ctx, opts, 60)
+	assert.NoError(t, err)
+	assert.True(t, resp.Success)
+
+	// the bucket has been idle for 30 seconds, but only fills for 5 of them
+	clock.Advance(30 * time.Second)
+
+	resp, err = bucket.Use(ctx, opts, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, resp.RemainingTokens)
+}
+
+func TestLeakyBucket_ZeroTake(t *testing.T) {
+	ctx := context.Background()
+	clock := fake.NewClock(time.Unix(1700000000, 0))
+	bucket := fake.NewLeakyBucket(clock)
+	opts := &redis.LeakyBucketOptions{KeyPrefix: "test-bucket", MaximumCapacity: 60, WindowSeconds: 60, MinimumReserve: 55}
+
+	_, err := bucket.Use(ctx, opts, 5)
+	assert.NoError(t, err)
+
+	clock.Advance(3 * time.Second)
+
+	resp, err := bucket.Use(ctx, opts, 0)
+	assert.NoError(t, err)
+	assert.True(t, resp.Success)
+	assert.Equal(t, 0, resp.Taken)
+	assert.Equal(t, 58, resp.RemainingTokens)
+}
+
+func TestLeakyBucket_TrackPeak(t *testing.T) {
+	ctx := context.Background()
+	clock := fake.NewClock(time.Unix(1700000000, 0))
+	bucket := fake.NewLeakyBucket(clock)
+	opts := &redis.LeakyBucketOptions{KeyPrefix: "test-bucket", MaximumCapacity: 60, WindowSeconds: 60, TrackPeak: true}
+
+	_, err := bucket.Use(ctx, opts, 10)
+	assert.NoError(t, err)
+
+	// once the bucket refills, the peak remains
+	clock.Advance(30 * time.Second)
+	_, err = bucket.Use(ctx, opts, 2)
+	assert.NoError(t, err)
+
+	resp, err := bucket.Inspect(ctx, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, resp.Peak)
+
+	// the peak expires along with the bucket once it's idle
+	clock.Advance(time.Minute)
+	resp, err = bucket.Inspect(ctx, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, resp.Peak)
+}
+
+func TestSlidingWindow_Precision(t *testing.T) {
+	ctx := context.Background()
+	clock := fake.NewClock(time.UnixMilli(1700000000700))
+	window := fake.NewSlidingWindow(clock)
+	opts := &redis.SlidingWindowOptions{Key: "test-window", MaximumCapacity: 1, Window: time.Minute, Precision: time.Second}
+
+	resp, err := window.Use(ctx, opts)
+	assert.NoError(t, err)
+	assert.True(t, resp.Success)
+
+	clock.Advance(time.Minute - time.Millisecond*700)
+	resp, err = window.Use(ctx, opts)
+	assert.NoError(t, err)
+	assert.True(t, resp.Success, "the first token should expire a minute after the start of its second")
+}
+
+func TestSlidingWindow_TrimOnShrink(t *testing.T) {
+	ctx := context.Background()
+	clock := fake.NewClock(time.Unix(1700000000, 0))
+	window := fake.NewSlidingWindow(clock)
+	opts := &redis.SlidingWindowOptions{Key: "test-window", MaximumCapacity: 4, Window: time.Minute}
+
+	for i := 0; i < 4; i++ {
+		clock.Advance(time.Second)
+		_, err := window.Use(ctx, opts)
+		assert.NoError(t, err)
+	}
+
+	resp, err := window.Use(ctx, &redis.SlidingWindowOptions{Key: "test-window", MaximumCapacity: 2, Window: time.Minute, TrimOnShrink: true})
+	assert.NoError(t, err)
+	assert.False(t, resp.Success)
+
+	// the count may exceed a reduced capacity, until the excess expires
+	inspect, err := window.Inspect(ctx, &redis.SlidingWindowOptions{Key: "test-window", MaximumCapacity: 1, Window: time.Minute})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, inspect.RemainingCapacity)
+	assert.Equal(t, 2, inspect.CurrentCount)
+
+	// the oldest 2 tokens were discarded, so the next expires once the third token does
+	clock.Advance(time.Minute - time.Second)
+	inspect, err = window.Inspect(ctx, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, inspect.RemainingCapacity)
+}
+
+func TestSlidingWindow_Burst(t *testing.T) {
+	ctx := context.Background()
+	clock := fake.NewClock(time.Unix(1700000000, 0))
+	window := fake.NewSlidingWindow(clock)
+	opts := &redis.SlidingWindowOptions{
+		Key: "test-window", MaximumCapacity: 1, Window: time.Minute, BurstCapacity: 1, BurstRefill: time.Second * 10,
+	}
+
+	expected := []redis.UseSlidingWindowResponse{
+		{Success: true, CurrentCount: 1}, {Success: true, UsedBurst: true, CurrentCount: 1}, {Success: false, CurrentCount: 1},
+	}
+	for _, want := range expected {
+		resp, err := window.Use(ctx, opts)
+		assert.NoError(t, err)
+		assert.Equal(t, want, *resp)
+	}
+
+	// the burst pool refills while the window stays full
+	clock.Advance(time.Second * 10)
+	resp, err := window.Use(ctx, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, redis.UseSlidingWindowResponse{Success: true, UsedBurst: true, CurrentCount: 1}, *resp)
+}
+
+func TestWouldAllowAt(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+	clock := fake.NewClock(now)
+
+	bucket := fake.NewLeakyBucket(clock)
+	bucketOpts := &redis.LeakyBucketOptions{KeyPrefix: "test-bucket", MaximumCapacity: 60, WindowSeconds: 60}
+	_, err := bucket.Use(ctx, bucketOpts, 60)
+	assert.NoError(t, err)
+
+	{
+		resp, err := bucket.WouldAllowAt(ctx, bucketOpts, 3, now.Add(time.Second*5))
+		assert.NoError(t, err)
+		assert.Equal(t, &redis.WouldAllowResponse{Allowed: true, Remaining: 2}, resp)
+	}
+
+	window := fake.NewSlidingWindow(clock)
+	windowOpts := &redis.SlidingWindowOptions{Key: "test-window", MaximumCapacity: 1, Window: time.Minute}
+	_, err = window.Use(ctx, windowOpts)
+	assert.NoError(t, err)
+
+	{
+		resp, err := window.WouldAllowAt(ctx, windowOpts, now.Add(time.Second))
+		assert.NoError(t, err)
+		assert.Equal(t, &redis.WouldAllowResponse{Allowed: false, Remaining: 0}, resp)
+	}
+
+	{
+		resp, err := window.WouldAllowAt(ctx, windowOpts, now.Add(time.Minute))
+		assert.NoError(t, err)
+		assert.Equal(t, &redis.WouldAllowResponse{Allowed: true, Remaining: 0}, resp)
+	}
+
+	{
+		clock.Advance(time.Second * 5)
+		preview, err := bucket.Preview(ctx, bucketOpts, 3)
+		assert.NoError(t, err)
+		assert.True(t, preview.WouldSucceed)
+		assert.Equal(t, 2, preview.RemainingAfter)
+
+		// previewing doesn't take the tokens, and matches the result of taking them
+		use, err := bucket.Use(ctx, bucketOpts, 3)
+		assert.NoError(t, err)
+		assert.True(t, use.Success)
+		assert.Equal(t, preview.RemainingAfter, use.RemainingTokens)
+		assert.Equal(t, preview.ResetAt, use.ResetAt)
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	ctx := context.Background()
+	clock := fake.NewClock(time.Unix(1700000000, 0))
+	limiter := fake.NewSlidingWindow(clock)
+
+	opts := &redis.SlidingWindowOptions{Key: "test-bucket", MaximumCapacity: 3, SoftCapacity: 1, Window: time.Minute}
+
+	for i := 1; i <= 3; i++ {
+		resp, err := limiter.Use(ctx, opts)
+		assert.NoError(t, err)
+		assert.True(t, resp.Success)
+		assert.Equal(t, 3-i, resp.RemainingCapacity)
+		assert.Equal(t, i > 1, resp.OverSoftLimit)
+	}
+
+	{
+		resp, err := limiter.Use(ctx, opts)
+		assert.NoError(t, err)
+		assert.False(t, resp.Success)
+	}
+
+	clock.Advance(time.Minute)
+
+	{
+		resp, err := limiter.Inspect(ctx, opts)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, resp.RemainingCapacity)
+	}
+}
+
+func TestSlidingWindow_Reserve(t *testing.T) {
+	ctx := context.Background()
+	clock := fake.NewClock(time.Unix(1700000000, 0))
+	limiter := fake.NewSlidingWindow(clock)
+
+	opts := &redis.SlidingWindowOptions{Key: "test-bucket", MaximumCapacity: 2, Window: time.Minute, ReservationTTL: time.Second * 5}
+
+	committed, err := limiter.Reserve(ctx, opts)
+	assert.NoError(t, err)
+	assert.True(t, committed.Success)
+
+	cancelled, err := limiter.Reserve(ctx, opts)
+	assert.NoError(t, err)
+	assert.True(t, cancelled.Success)
+	assert.Equal(t, 0, cancelled.RemainingCapacity)
+
+	assert.NoError(t, committed.Commit(ctx))
+	assert.NoError(t, cancelled.Cancel(ctx))
+	assert.ErrorIs(t, cancelled.Commit(ctx), redis.ErrReservationExpired)
+
+	clock.Advance(time.Second * 10)
+
+	{
+		resp, err := limiter.Inspect(ctx, opts)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, resp.RemainingCapacity, "committed token should last the full window")
+	}
+
+	{
+		opts := *opts
+		opts.Granularity = time.Second
+		resp, err := limiter.Reserve(ctx, &opts)
+		assert.Nil(t, resp)
+		assert.ErrorIs(t, err, redis.ErrReservationsUnsupported)
+	}
+}
@@ -0,0 +1,358 @@
+package fake
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/aidenwallis/go-ratelimiting/redis"
+)
+
+// LeakyBucket is an in-memory implementation of redis.LeakyBucket, which behaves like redis.LeakyBucketImpl.
+type LeakyBucket struct {
+	clock   *Clock
+	m       sync.Mutex
+	buckets map[string]*leakyBucketState
+	quotas  map[string]*dailyQuota
+	peaks   peaks
+}
+
+var _ redis.LeakyBucket = (*LeakyBucket)(nil)
+
+type leakyBucketState struct {
+	tokens     int
+	lastFilled int64
+	remainder  int64
+	expiresAt  time.Time
+}
+
+type dailyQuota struct {
+	used int
+	day  time.Time
+}
+
+// peaks holds the high-water marks recorded with TrackPeak, which expire along with their buckets, like the Redis peak keys.
+type peaks map[string]peak
+
+type peak struct {
+	used      int
+	expiresAt time.Time
+}
+
+// get returns the high-water mark recorded for key, or 0 if it has expired.
+func (p peaks) get(key string, now time.Time) int {
+	if existing, ok := p[key]; ok && now.Before(existing.expiresAt) {
+		return existing.used
+	}
+	return 0
+}
+
+// record raises the high-water mark for key to used if it exceeds it, and keeps it until expiresAt.
+func (p peaks) record(key string, used int, now, expiresAt time.Time) {
+	if existing := p.get(key, now); existing > used {
+		used = existing
+	}
+	p[key] = peak{used: used, expiresAt: expiresAt}
+}
+
+// NewLeakyBucket creates a new fake leaky bucket, which reads the current time from clock.
+func NewLeakyBucket(clock *Clock) *LeakyBucket {
+	return &LeakyBucket{
+		clock:   clock,
+		buckets: map[string]*leakyBucketState{},
+		quotas:  map[string]*dailyQuota{},
+		peaks:   peaks{},
+	}
+}
+
+// Now returns the current time of the fake's clock.
+func (l *LeakyBucket) Now() time.Time {
+	return l.clock.Now()
+}
+
+// Inspect inspects the leaky bucket and returns the capacity available. It does not take any tokens.
+func (l *LeakyBucket) Inspect(_ context.Context, bucket *redis.LeakyBucketOptions) (*redis.InspectLeakyBucketResponse, error) {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	state := l.fill(bucket)
+
+	info := bucket.Describe()
+
+	return &redis.InspectLeakyBucketResponse{
+		RemainingTokens: state.tokens,
+		ResetAt:         leakyBucketResetAt(state, bucket),
+		Limit:           info.Capacity,
+		Window:          info.Window,
+		RefillInterval:  info.RefillInterval,
+		Peak:            l.peaks.get(bucket.KeyPrefix, l.clock.Now()),
+	}, nil
+}
+
+// Use attempts to use the leaky bucket, either all tokens are taken, or the ratelimit is unsuccessful.
+func (l *LeakyBucket) Use(_ context.Context, bucket *redis.LeakyBucketOptions, takeAmount int) (*redis.UseLeakyBucketResponse, error) {
+	if takeAmount < 0 {
+		return nil, redis.ErrInvalidTakeAmount
+	}
+	if takeAmount > bucket.MaximumCapacity {
+		return nil, redis.ErrTakeExceedsCapacity
+	}
+
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	state := l.fill(bucket)
+
+	if takeAmount == 0 {
+		// zero takes are an inspect, the filled state isn't stored
+		return &redis.UseLeakyBucketResponse{
+			Success:              true,
+			RemainingTokens:      state.tokens,
+			ResetAt:              leakyBucketResetAt(state, bucket),
+			RemainingTokensFloat: l.remainingTokensFloat(state, bucket),
+		}, nil
+	}
+
+	year, month, day := l.clock.Now().UTC().Date()
+	today := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	quota, ok := l.quotas[bucket.KeyPrefix]
+	if !ok || !quota.day.Equal(today) {
+		quota = &dailyQuota{day: today}
+	}
+
+	if bucket.PartialOK {
+		available := state.tokens - bucket.MinimumReserve
+		if bucket.DailyQuota > 0 && bucket.DailyQuota-quota.used < available {
+			available = bucket.DailyQuota - quota.used
+		}
+		if available > 0 && available < takeAmount {
+			takeAmount = available
+		}
+	}
+
+	success, deniedByReserve, deniedByQuota, taken := false, false, false, 0
+	switch {
+	case bucket.DailyQuota > 0 && quota.used+takeAmount > bucket.DailyQuota:
+		deniedByQuota = true
+	case state.tokens >= takeAmount && state.tokens-takeAmount < bucket.MinimumReserve:
+		deniedByReserve = true
+	case state.tokens >= takeAmount:
+		state.tokens -= takeAmount
+		success = true
+		taken = takeAmount
+		if bucket.DailyQuota > 0 {
+			quota.used += takeAmount
+			l.quotas[bucket.KeyPrefix] = quota
+		}
+	}
+
+	quotaRemaining := 0
+	if bucket.DailyQuota > quota.used {
+		quotaRemaining = bucket.DailyQuota - quota.used
+	}
+
+	state.expiresAt = l.clock.Now().Add(time.Duration(bucket.WindowSeconds) * time.Second)
+	l.buckets[bucket.KeyPrefix] = state
+
+	if bucket.TrackPeak {
+		l.peaks.record(bucket.KeyPrefix, bucket.MaximumCapacity-state.tokens, l.clock.Now(), state.expiresAt)
+	}
+
+	return &redis.UseLeakyBucketResponse{
+		Success:              success || bucket.DryRun,
+		RemainingTokens:      state.tokens,
+		ResetAt:              leakyBucketResetAt(state, bucket),
+		DeniedByReserve:      deniedByReserve,
+		WouldHaveBeenLimited: bucket.DryRun && !success,
+		DeniedByQuota:        deniedByQuota,
+		QuotaRemaining:       quotaRemaining,
+		RemainingTokensFloat: l.remainingTokensFloat(state, bucket),
+		Taken:                taken,
+	}, nil
+}
+
+// UseAny attempts to take takeAmount tokens from the least-loaded of buckets that has them all available, it returns the index of
+// the bucket used, or -1 if no bucket had enough tokens.
+func (l *LeakyBucket) UseAny(_ context.Context, buckets []*redis.LeakyBucketOptions, takeAmount int) (int, *redis.UseLeakyBucketResponse, error) {
+	if len(buckets) == 0 {
+		return -1, nil, redis.ErrNoBuckets
+	}
+
+	satisfiable := false
+	for _, bucket := range buckets {
+		if takeAmount <= bucket.MaximumCapacity {
+			satisfiable = true
+		}
+	}
+	if !satisfiable {
+		return -1, nil, redis.ErrTakeExceedsCapacity
+	}
+
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	states := make([]*leakyBucketState, len(buckets))
+	for i, bucket := range buckets {
+		states[i] = l.fill(bucket)
+	}
+
+	lessLoaded := func(a, b int) bool {
+		return states[a].tokens*buckets[b].MaximumCapacity > states[b].tokens*buckets[a].MaximumCapacity
+	}
+
+	chosen, best := -1, 0
+	for i := range buckets {
+		if states[i].tokens >= takeAmount && (chosen == -1 || lessLoaded(i, chosen)) {
+			chosen = i
+		}
+		if lessLoaded(i, best) {
+			best = i
+		}
+	}
+
+	if chosen == -1 {
+		return -1, &redis.UseLeakyBucketResponse{
+			RemainingTokens: states[best].tokens,
+			ResetAt:         leakyBucketResetAt(states[best], buckets[best]),
+		}, nil
+	}
+
+	bucket, state := buckets[chosen], states[chosen]
+	state.tokens -= takeAmount
+	state.expiresAt = l.clock.Now().Add(time.Duration(bucket.WindowSeconds) * time.Second)
+	l.buckets[bucket.KeyPrefix] = state
+
+	return chosen, &redis.UseLeakyBucketResponse{
+		Success:         true,
+		RemainingTokens: state.tokens,
+		ResetAt:         leakyBucketResetAt(state, bucket),
+	}, nil
+}
+
+// WouldAllowAt projects whether takeAmount tokens could be taken from the bucket at the given time. It does not take any tokens.
+func (l *LeakyBucket) WouldAllowAt(_ context.Context, bucket *redis.LeakyBucketOptions, takeAmount int, at time.Time) (*redis.WouldAllowResponse, error) {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	state := l.fillAt(bucket, at)
+
+	resp := &redis.WouldAllowResponse{Allowed: state.tokens-takeAmount >= bucket.MinimumReserve, Remaining: state.tokens}
+	if resp.Allowed {
+		resp.Remaining -= takeAmount
+	}
+	return resp, nil
+}
+
+// Preview computes what taking takeAmount tokens from the bucket right now would result in, without taking them.
+func (l *LeakyBucket) Preview(_ context.Context, bucket *redis.LeakyBucketOptions, takeAmount int) (*redis.PreviewLeakyBucketResponse, error) {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	state := l.fill(bucket)
+
+	resp := &redis.PreviewLeakyBucketResponse{WouldSucceed: state.tokens-takeAmount >= bucket.MinimumReserve}
+	if resp.WouldSucceed {
+		state.tokens -= takeAmount
+	}
+	resp.RemainingAfter = state.tokens
+	resp.ResetAt = leakyBucketResetAt(state, bucket)
+	return resp, nil
+}
+
+// RefundBatch gives back tokens to several buckets, never filling a bucket beyond its capacity. It returns how many tokens each
+// bucket holds afterwards, in the same order as refunds.
+func (l *LeakyBucket) RefundBatch(_ context.Context, refunds []redis.BucketRefund) ([]int, error) {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	remaining := make([]int, len(refunds))
+	for i, refund := range refunds {
+		bucket := refund.Bucket
+		state := l.fill(bucket)
+		if refund.Amount > 0 {
+			state.tokens += refund.Amount
+			if state.tokens >= bucket.MaximumCapacity {
+				state.tokens = bucket.MaximumCapacity
+				state.remainder = 0
+			}
+		}
+
+		state.expiresAt = l.clock.Now().Add(time.Duration(bucket.WindowSeconds) * time.Second)
+		l.buckets[bucket.KeyPrefix] = state
+		remaining[i] = state.tokens
+	}
+
+	return remaining, nil
+}
+
+// fill returns a copy of the bucket's state, refilled up to the current time.
+func (l *LeakyBucket) fill(bucket *redis.LeakyBucketOptions) *leakyBucketState {
+	return l.fillAt(bucket, l.clock.Now())
+}
+
+// fillAt returns a copy of the bucket's state, refilled up to now.
+func (l *LeakyBucket) fillAt(bucket *redis.LeakyBucketOptions, now time.Time) *leakyBucketState {
+	state := &leakyBucketState{}
+	if existing, ok := l.buckets[bucket.KeyPrefix]; ok && now.Before(existing.expiresAt) {
+		*state = *existing
+
+		// only fill for the look-back, rather than for however long the bucket has been idle
+		lookback := int64(math.Ceil(bucket.MaxFillLookback.Seconds()))
+		if lookback > 0 && now.UTC().Unix()-state.lastFilled > lookback {
+			state.lastFilled = now.UTC().Unix() - lookback
+		}
+	} else if bucket.StartEmpty {
+		// new buckets start empty when StartEmpty is set
+		state.lastFilled = now.UTC().Unix()
+	} else if bucket.WarmStart > 0 && bucket.WarmStart < 1 {
+		// new buckets start partially filled when WarmStart is set
+		state.tokens = int(bucket.WarmStart * float64(bucket.MaximumCapacity))
+		state.lastFilled = now.UTC().Unix()
+	}
+
+	if state.tokens > bucket.MaximumCapacity {
+		state.tokens = bucket.MaximumCapacity
+	}
+
+	if state.tokens < bucket.MaximumCapacity {
+		unix := now.UTC().Unix()
+		filled := (unix-state.lastFilled)*int64(bucket.MaximumCapacity) + state.remainder
+		if tokensToFill := filled / int64(bucket.WindowSeconds); tokensToFill > 0 {
+			state.tokens = int(math.Min(float64(bucket.MaximumCapacity), float64(int64(state.tokens)+tokensToFill)))
+			state.lastFilled = unix
+			state.remainder = filled % int64(bucket.WindowSeconds)
+			if state.tokens >= bucket.MaximumCapacity {
+				state.remainder = 0
+			}
+		}
+	}
+
+	return state
+}
+
+// remainingTokensFloat adds the progress towards the next token to the bucket's tokens.
+func (l *LeakyBucket) remainingTokensFloat(state *leakyBucketState, bucket *redis.LeakyBucketOptions) float64 {
+	remaining := float64(state.tokens)
+	if state.tokens < bucket.MaximumCapacity {
+		accrued := (l.clock.Now().UTC().Unix()-state.lastFilled)*int64(bucket.MaximumCapacity) + state.remainder
+		remaining += math.Min(float64(accrued), float64(bucket.WindowSeconds)) / float64(bucket.WindowSeconds)
+	}
+	return remaining
+}
+
+func leakyBucketResetAt(state *leakyBucketState, bucket *redis.LeakyBucketOptions) time.Time {
+	resetAt := state.lastFilled
+	if delta := bucket.MaximumCapacity - state.tokens; delta > 0 {
+		rate := float64(bucket.MaximumCapacity) / float64(bucket.WindowSeconds)
+
+		secondsTillRefill := int64(bucket.WindowSeconds)
+		if calculatedSeconds := int64(math.Ceil(float64(delta) / rate)); calculatedSeconds < secondsTillRefill {
+			secondsTillRefill = calculatedSeconds
+		}
+
+		resetAt += secondsTillRefill
+	}
+
+	return time.Unix(resetAt, 0)
+}
@@ -0,0 +1,239 @@
+package fake
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aidenwallis/go-ratelimiting/redis"
+)
+
+// SlidingWindow is an in-memory implementation of redis.SlidingWindow, which behaves like redis.SlidingWindowImpl.
+//
+// Tokens are always tracked exactly, SlidingWindowOptions.Granularity is ignored.
+type SlidingWindow struct {
+	clock   *Clock
+	m       sync.Mutex
+	nextID  int
+	windows map[string][]*slidingWindowToken
+	peaks   peaks
+	bursts  map[string]*burstPool
+}
+
+var _ redis.SlidingWindow = (*SlidingWindow)(nil)
+
+type slidingWindowToken struct {
+	id        int
+	expiresAt time.Time
+}
+
+type burstPool struct {
+	tokens   int
+	lastFill time.Time
+}
+
+// NewSlidingWindow creates a new fake sliding window, which reads the current time from clock.
+func NewSlidingWindow(clock *Clock) *SlidingWindow {
+	return &SlidingWindow{
+		clock:   clock,
+		windows: map[string][]*slidingWindowToken{},
+		peaks:   peaks{},
+		bursts:  map[string]*burstPool{},
+	}
+}
+
+// Now returns the current time of the fake's clock.
+func (s *SlidingWindow) Now() time.Time {
+	return s.clock.Now()
+}
+
+// Inspect inspects the current state of the sliding window bucket
+func (s *SlidingWindow) Inspect(_ context.Context, bucket *redis.SlidingWindowOptions) (*redis.InspectSlidingWindowResponse, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	tokens := len(s.clean(bucket.Key))
+	return &redis.InspectSlidingWindowResponse{
+		RemainingCapacity: remainingCapacity(bucket, tokens),
+		Limit:             bucket.MaximumCapacity,
+		Window:            bucket.Window,
+		Peak:              s.peaks.get(bucket.Key, s.clock.Now()),
+		CurrentCount:      tokens,
+	}, nil
+}
+
+// Use attempts to use the sliding window.
+func (s *SlidingWindow) Use(_ context.Context, bucket *redis.SlidingWindowOptions) (*redis.UseSlidingWindowResponse, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if bucket.TrimOnShrink {
+		s.trim(bucket)
+	}
+
+	takenAt := s.clock.Now()
+	if bucket.Precision > 0 {
+		takenAt = takenAt.Truncate(bucket.Precision)
+	}
+
+	success, tokens := s.add(bucket, takenAt.Add(bucket.Window))
+	usedBurst := !success && s.takeBurst(bucket)
+	if bucket.TrackPeak {
+		s.peaks.record(bucket.Key, tokens, s.clock.Now(), s.clock.Now().Add(bucket.Window))
+	}
+
+	return &redis.UseSlidingWindowResponse{
+		Success:              success || usedBurst || bucket.DryRun,
+		RemainingCapacity:    remainingCapacity(bucket, tokens),
+		OverSoftLimit:        bucket.SoftCapacity > 0 && tokens > bucket.SoftCapacity,
+		WouldHaveBeenLimited: bucket.DryRun && !success && !usedBurst,
+		UsedBurst:            usedBurst,
+		CurrentCount:         tokens,
+	}, nil
+}
+
+// Reserve attempts to tentatively take a token from the sliding window, which can later be committed or cancelled.
+func (s *SlidingWindow) Reserve(_ context.Context, bucket *redis.SlidingWindowOptions) (*redis.Reservation, error) {
+	if bucket.Granularity > 0 {
+		return nil, redis.ErrReservationsUnsupported
+	}
+
+	reservationTTL := bucket.ReservationTTL
+	if reservationTTL <= 0 {
+		reservationTTL = redis.DefaultReservationTTL
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	id := s.nextID
+	success, tokens := s.add(bucket, s.clock.Now().Add(reservationTTL))
+	key, window := bucket.Key, bucket.Window
+
+	commit := func(context.Context) error {
+		s.m.Lock()
+		defer s.m.Unlock()
+
+		for _, token := range s.clean(key) {
+			if token.id == id {
+				token.expiresAt = s.clock.Now().Add(window)
+				return nil
+			}
+		}
+		return redis.ErrReservationExpired
+	}
+
+	cancel := func(context.Context) error {
+		s.m.Lock()
+		defer s.m.Unlock()
+
+		tokens := s.clean(key)
+		for i, token := range tokens {
+			if token.id == id {
+				s.windows[key] = append(tokens[:i:i], tokens[i+1:]...)
+				break
+			}
+		}
+		return nil
+	}
+
+	return redis.NewReservation(success, remainingCapacity(bucket, tokens), commit, cancel), nil
+}
+
+// WouldAllowAt projects whether a token could be taken from the sliding window at the given time. It does not take any tokens.
+func (s *SlidingWindow) WouldAllowAt(_ context.Context, bucket *redis.SlidingWindowOptions, at time.Time) (*redis.WouldAllowResponse, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	tokens := 0
+	for _, token := range s.windows[bucket.Key] {
+		if token.expiresAt.After(at) {
+			tokens++
+		}
+	}
+
+	remaining := remainingCapacity(bucket, tokens)
+	resp := &redis.WouldAllowResponse{Allowed: remaining > 0, Remaining: remaining}
+	if resp.Allowed {
+		resp.Remaining--
+	}
+	return resp, nil
+}
+
+// add attempts to add a token to the window which expires at the given time, returning whether it was added and how many tokens
+// are now in the window. The lock must be held when calling it.
+func (s *SlidingWindow) add(bucket *redis.SlidingWindowOptions, expiresAt time.Time) (bool, int) {
+	window := s.clean(bucket.Key)
+	if len(window) >= bucket.MaximumCapacity {
+		return false, len(window)
+	}
+
+	s.windows[bucket.Key] = append(window, &slidingWindowToken{id: s.nextID, expiresAt: expiresAt})
+	s.nextID++
+
+	return true, len(window) + 1
+}
+
+// takeBurst attempts to take a token from the bucket's burst pool, which refills a token every BurstRefill up to BurstCapacity. The
+// lock must be held when calling it.
+func (s *SlidingWindow) takeBurst(bucket *redis.SlidingWindowOptions) bool {
+	if bucket.BurstCapacity <= 0 || bucket.BurstRefill <= 0 {
+		return false
+	}
+
+	now := s.clock.Now()
+	pool, ok := s.bursts[bucket.Key]
+	if !ok {
+		pool = &burstPool{tokens: bucket.BurstCapacity, lastFill: now}
+		s.bursts[bucket.Key] = pool
+	}
+
+	if refilled := int(now.Sub(pool.lastFill) / bucket.BurstRefill); refilled > 0 {
+		pool.tokens += refilled
+		pool.lastFill = pool.lastFill.Add(time.Duration(refilled) * bucket.BurstRefill)
+	}
+	if pool.tokens >= bucket.BurstCapacity {
+		pool.tokens = bucket.BurstCapacity
+		pool.lastFill = now
+	}
+
+	if pool.tokens < 1 {
+		return false
+	}
+	pool.tokens--
+	return true
+}
+
+// trim discards the tokens that expire soonest while the window holds more than MaximumCapacity. The lock must be held when calling it.
+func (s *SlidingWindow) trim(bucket *redis.SlidingWindowOptions) {
+	window := s.clean(bucket.Key)
+	if len(window) <= bucket.MaximumCapacity {
+		return
+	}
+
+	sort.SliceStable(window, func(i, j int) bool { return window[i].expiresAt.Before(window[j].expiresAt) })
+	s.windows[bucket.Key] = window[len(window)-bucket.MaximumCapacity:]
+}
+
+// clean removes expired tokens from the window, and returns the tokens that remain. The lock must be held when calling it.
+func (s *SlidingWindow) clean(key string) []*slidingWindowToken {
+	now := s.clock.Now()
+
+	window := make([]*slidingWindowToken, 0, len(s.windows[key]))
+	for _, token := range s.windows[key] {
+		if token.expiresAt.After(now) {
+			window = append(window, token)
+		}
+	}
+
+	s.windows[key] = window
+	return window
+}
+
+func remainingCapacity(bucket *redis.SlidingWindowOptions, tokens int) int {
+	if v := bucket.MaximumCapacity - tokens; v > 0 {
+		return v
+	}
+	return 0
+}
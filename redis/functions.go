@@ -0,0 +1,94 @@
+package redis
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aidenwallis/go-ratelimiting/redis/adapters"
+)
+
+// FunctionLibraryName is the name of the Redis function library registered by LoadFunctions.
+const FunctionLibraryName = "goratelimiting"
+
+// ErrFunctionsUnsupported is returned when UseFunctions is set, but the adapter does not implement adapters.FunctionAdapter.
+var ErrFunctionsUnsupported = errors.New("adapter does not support redis functions")
+
+// scripts holds every Lua script used by the ratelimiters, so they can be registered as a function library.
+var scripts []string
+
+// newScript registers a Lua script used by the ratelimiters, and returns it unchanged.
+func newScript(script string) string {
+	scripts = append(scripts, script)
+	return script
+}
+
+// functionName returns the name script is registered under in the function library. Names are derived from the script's hash, so
+// upgrading this package alongside a newly loaded library never calls a stale function.
+func functionName(script string) string {
+	return FunctionLibraryName + "_" + scriptSHA(script)
+}
+
+// scriptSHA returns the SHA1 digest of script, which is the same digest Redis uses to identify the script for EVALSHA.
+func scriptSHA(script string) string {
+	sum := sha1.Sum([]byte(script))
+	return hex.EncodeToString(sum[:])
+}
+
+// ScriptVersion returns a digest of every Lua script used by the ratelimiters, which changes whenever any of the algorithms do.
+// This is useful for telling which revision of the algorithms a deployed binary is running, such as when debugging a fleet that's
+// midway through a rollout.
+func ScriptVersion() string {
+	return scriptSHA(FunctionLibrary())
+}
+
+// parsingError wraps an error parsing the response of script, including the script's digest so unexpected responses can be
+// correlated with the revision of the script that returned them.
+func parsingError(script string, err error) error {
+	return fmt.Errorf("parsing redis response from script %s: %w", scriptSHA(script), err)
+}
+
+// FunctionLibrary returns the Lua source of the function library containing every script used by the ratelimiters. This is useful
+// if you'd rather load the library with your own deployment tooling than with LoadFunctions.
+func FunctionLibrary() string {
+	var b strings.Builder
+	b.WriteString("#!lua name=" + FunctionLibraryName + "\n")
+
+	seen := make(map[string]struct{}, len(scripts))
+	for _, script := range scripts {
+		name := functionName(script)
+		if _, ok := seen[name]; ok {
+			continue
+		}
+		seen[name] = struct{}{}
+
+		fmt.Fprintf(&b, "\nredis.register_function('%s', function(KEYS, ARGV)\n%s\nend)\n", name, strings.TrimSpace(script))
+	}
+
+	return b.String()
+}
+
+// LoadFunctions loads the function library into Redis, replacing any previously loaded version. This must be called before using
+// a ratelimiter with UseFunctions set, and again after upgrading this package.
+func LoadFunctions(ctx context.Context, adapter adapters.FunctionAdapter) error {
+	if err := adapter.FunctionLoad(ctx, FunctionLibrary()); err != nil {
+		return fmt.Errorf("loading function library: %w", err)
+	}
+	return nil
+}
+
+// evalScript runs script through the adapter with EVAL, or with FCALL when useFunctions is set.
+func evalScript(ctx context.Context, adapter adapters.Adapter, useFunctions bool, script string, keys []string, args []interface{}) (interface{}, error) {
+	if !useFunctions {
+		return adapter.Eval(ctx, script, keys, args)
+	}
+
+	functionAdapter, ok := adapter.(adapters.FunctionAdapter)
+	if !ok {
+		return nil, ErrFunctionsUnsupported
+	}
+	return functionAdapter.FCall(ctx, functionName(script), keys, args)
+}
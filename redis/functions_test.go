@@ -0,0 +1,89 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aidenwallis/go-ratelimiting/redis/adapters"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockFunctionAdapter struct {
+	mockAdapter
+	function    string
+	loaded      string
+	returnError error
+}
+
+var _ adapters.FunctionAdapter = (*mockFunctionAdapter)(nil)
+
+func (a *mockFunctionAdapter) FCall(_ context.Context, function string, _ []string, _ []interface{}) (interface{}, error) {
+	a.function = function
+	return a.returnValue, a.returnError
+}
+
+func (a *mockFunctionAdapter) FunctionLoad(_ context.Context, code string) error {
+	a.loaded = code
+	return a.returnError
+}
+
+func TestFunctionLibrary(t *testing.T) {
+	library := FunctionLibrary()
+	assert.True(t, strings.HasPrefix(library, "#!lua name=goratelimiting\n"))
+
+	for _, script := range []string{leakyBucketUseScript, slidingWindowUseScript, reserveScript, healthCheckScript, resetNamespaceScript} {
+		assert.Contains(t, library, "redis.register_function('"+functionName(script)+"', function(KEYS, ARGV)")
+	}
+	assert.Equal(t, len(scripts), strings.Count(library, "redis.register_function("))
+}
+
+func TestScriptVersion(t *testing.T) {
+	assert.Len(t, ScriptVersion(), 40)
+	assert.Equal(t, ScriptVersion(), ScriptVersion())
+
+	// the digest matches the one Redis uses for EVALSHA
+	assert.Equal(t, "e0e1f9fabfc9d4800c877a703b823ac0578ff8db", scriptSHA("return 1"))
+}
+
+func TestLoadFunctions(t *testing.T) {
+	t.Run("loads library", func(t *testing.T) {
+		adapter := &mockFunctionAdapter{}
+		assert.NoError(t, LoadFunctions(context.Background(), adapter))
+		assert.Equal(t, FunctionLibrary(), adapter.loaded)
+	})
+
+	t.Run("wraps errors", func(t *testing.T) {
+		adapter := &mockFunctionAdapter{returnError: errors.New("ERR unknown command 'FUNCTION'")}
+		assert.EqualError(t, LoadFunctions(context.Background(), adapter), "loading function library: ERR unknown command 'FUNCTION'")
+	})
+}
+
+func TestEvalScript(t *testing.T) {
+	t.Run("uses eval by default", func(t *testing.T) {
+		adapter := &mockFunctionAdapter{mockAdapter: mockAdapter{returnValue: int64(1)}}
+		out, err := evalScript(context.Background(), adapter, false, healthCheckScript, []string{}, []interface{}{})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), out)
+		assert.True(t, adapter.called)
+		assert.Empty(t, adapter.function)
+	})
+
+	t.Run("uses fcall when enabled", func(t *testing.T) {
+		adapter := &mockFunctionAdapter{mockAdapter: mockAdapter{returnValue: []interface{}{int64(1), int64(2)}}}
+		impl := NewLeakyBucket(adapter)
+		impl.UseFunctions = true
+
+		assert.NoError(t, impl.HealthCheck(context.Background()))
+		assert.False(t, adapter.called)
+		assert.Equal(t, functionName(healthCheckScript), adapter.function)
+	})
+
+	t.Run("errors when adapter lacks function support", func(t *testing.T) {
+		adapter := &mockAdapter{}
+		_, err := evalScript(context.Background(), adapter, true, healthCheckScript, []string{}, []interface{}{})
+		assert.ErrorIs(t, err, ErrFunctionsUnsupported)
+		assert.False(t, adapter.called)
+	})
+}
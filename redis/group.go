@@ -0,0 +1,311 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aidenwallis/go-ratelimiting/redis/adapters"
+)
+
+// GroupLimiter defines an interface compatible with GroupLimiterImpl
+//
+// A group limiter enforces a single limit shared by a group of members, while still attributing usage to each member, such as every
+// API key belonging to an organisation drawing from the organisation's quota. The limit is only enforced for the group, so a
+// single member may use all of its capacity, but the group's usage can be broken down by member for reporting.
+type GroupLimiter interface {
+	// Use atomically attempts to take a token from the group's window on behalf of memberKey, which is recorded against memberKey
+	// if it was taken.
+	Use(ctx context.Context, bucket *GroupOptions, groupKey, memberKey string) (*UseGroupResponse, error)
+
+	// Inspect atomically inspects the group's window, returning its remaining capacity, and how many tokens in the window each member
+	// took. It does not take any tokens.
+	Inspect(ctx context.Context, bucket *GroupOptions, groupKey string) (*InspectGroupResponse, error)
+}
+
+// GroupLimiterImpl implements a group limiter in Redis with Lua. This struct is compatible with the GroupLimiter interface.
+//
+// The group's tokens are stored in a sorted set at the group's key, like the sliding window, and each member's share is counted in
+// a companion hash, suffixed with ::members, which is decremented as the member's tokens leave the window.
+type GroupLimiterImpl struct {
+	// Adapter defines the Redis adapter
+	Adapter adapters.Adapter
+
+	// OnDecision is an optional hook which is called synchronously after every successful call to Redis that takes tokens, which is
+	// useful for audit logging. It is not called when Redis returns an error.
+	OnDecision func(DecisionEvent)
+
+	// Logger is optionally used to log debugging information, such as the raw response when Redis returns something unexpected.
+	Logger Logger
+
+	// UseFunctions runs the ratelimiter's scripts as Redis functions with FCALL rather than EVAL. The adapter must implement
+	// adapters.FunctionAdapter, and the library must be loaded with LoadFunctions() first.
+	UseFunctions bool
+
+	// nowFunc is a private helper used to mock out time changes in unit testing
+	//
+	// if this is not defined, it falls back to time.Now()
+	nowFunc func() time.Time
+}
+
+var _ GroupLimiter = (*GroupLimiterImpl)(nil)
+
+// GroupOptions defines the options available to a group limiter. The group and member are passed to each call, so the same options
+// can be shared by every group with the same limit.
+type GroupOptions struct {
+	// MaximumCapacity defines how many tokens the group's members may take between them within the window.
+	MaximumCapacity int
+
+	// Window defines how long a token counts against the group after it was taken, resolution is available up to milliseconds.
+	Window time.Duration
+}
+
+// NewGroupLimiter creates a new group limiter instance
+func NewGroupLimiter(adapter adapters.Adapter) *GroupLimiterImpl {
+	return &GroupLimiterImpl{
+		Adapter: adapter,
+		nowFunc: time.Now,
+	}
+}
+
+// HealthCheck verifies that the adapter is able to run Lua scripts against Redis, and that responses are returned in the shape
+// this ratelimiter expects. This is useful as a readiness probe, as some managed Redis variants disable scripting.
+func (r *GroupLimiterImpl) HealthCheck(ctx context.Context) error {
+	return healthCheck(ctx, r.Adapter, r.UseFunctions)
+}
+
+// Close releases the resources held by the adapter, if the adapter implements io.Closer. Otherwise, it does nothing.
+func (r *GroupLimiterImpl) Close() error {
+	return closeAdapter(r.Adapter)
+}
+
+// eval runs script through the adapter, using FCALL when UseFunctions is set.
+func (r *GroupLimiterImpl) eval(ctx context.Context, script string, keys []string, args []interface{}) (interface{}, error) {
+	return evalScript(ctx, r.Adapter, r.UseFunctions, script, keys, args)
+}
+
+func (r *GroupLimiterImpl) now() time.Time {
+	if r.nowFunc == nil {
+		return time.Now()
+	}
+	return r.nowFunc()
+}
+
+// UseGroupResponse defines the response parameters for GroupLimiter.Use()
+type UseGroupResponse struct {
+	// Success defines whether the token was taken from the group's window
+	Success bool
+
+	// RemainingCapacity defines how many more tokens the group's members may take between them
+	RemainingCapacity int
+
+	// MemberUsage is how many of the tokens in the window were taken by the member, including this one when it was taken
+	MemberUsage int
+}
+
+// InspectGroupResponse defines the response parameters for GroupLimiter.Inspect()
+type InspectGroupResponse struct {
+	// RemainingCapacity defines how many more tokens the group's members may take between them
+	RemainingCapacity int
+
+	// Limit is the group's MaximumCapacity
+	Limit int
+
+	// Usage is how many of the tokens in the window each member took, members without any tokens in the window are left out
+	Usage map[string]int
+}
+
+// groupExpireScript is concatenated into the group scripts to clear the tokens which have left the window, and stop attributing
+// them to their members. Tokens are stored as the token's id and the member, separated by a colon, and the id never contains one.
+const groupExpireScript = `
+local expired = redis.call("zrangebyscore", key, "-inf", now)
+for i = 1, #expired do
+	local member = string.sub(expired[i], string.find(expired[i], ":", 1, true) + 1)
+	if (redis.call("hincrby", usageKey, member, -1) <= 0) then
+		redis.call("hdel", usageKey, member)
+	end
+end
+redis.call("zremrangebyscore", key, "-inf", now)
+`
+
+// groupUseScript clears expired tokens, and adds a token for the member in ARGV[4] to the group's window if there is room available.
+var groupUseScript = newScript(`
+local key = KEYS[1]
+local usageKey = KEYS[2]
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local max = tonumber(ARGV[3])
+local member = ARGV[4]
+local token = ARGV[5]
+` + groupExpireScript + `
+local tokens = tonumber(redis.call("zcard", key))
+local usage = tonumber(redis.call("hget", usageKey, member) or "0")
+local success = 0
+
+if (tokens < max) then
+	-- room available: add a token, attribute it to the member, and include it in the counts
+	redis.call("zadd", key, now + window, token .. ":" .. member)
+	usage = redis.call("hincrby", usageKey, member, 1)
+	success = 1
+	tokens = tokens + 1
+end
+
+redis.call("pexpire", key, window)
+redis.call("pexpire", usageKey, window)
+
+return {success, tokens, usage}
+`)
+
+// groupInspectScript clears expired tokens, and returns how many tokens are in the group's window, alongside each member's share as
+// a flat list of members and their counts.
+var groupInspectScript = newScript(`
+local key = KEYS[1]
+local usageKey = KEYS[2]
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+` + groupExpireScript + `
+redis.call("pexpire", key, window)
+redis.call("pexpire", usageKey, window)
+
+local usage = redis.call("hgetall", usageKey)
+for i = 2, #usage, 2 do
+	usage[i] = tonumber(usage[i])
+end
+
+return {tonumber(redis.call("zcard", key)), usage}
+`)
+
+// Use atomically attempts to take a token from the group's window on behalf of memberKey, which is recorded against memberKey if it
+// was taken. The limit is enforced for the group as a whole, regardless of how the group's usage is split between its members.
+func (r *GroupLimiterImpl) Use(ctx context.Context, bucket *GroupOptions, groupKey, memberKey string) (*UseGroupResponse, error) {
+	id, err := newMemberID()
+	if err != nil {
+		return nil, fmt.Errorf("generating token id: %w", err)
+	}
+
+	args := []interface{}{r.now().UnixMilli(), bucket.Window.Milliseconds(), bucket.MaximumCapacity, memberKey, id}
+	resp, err := r.eval(ctx, groupUseScript, groupKeys(groupKey), args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query redis adapter: %w", err)
+	}
+
+	output, err := parseUseGroupResponse(resp)
+	if err != nil {
+		logUnexpectedResponse(r.Logger, groupKey, resp, err)
+		return nil, parsingError(groupUseScript, err)
+	}
+
+	remaining := 0
+	if v := bucket.MaximumCapacity - output.tokens; v > 0 {
+		remaining = v
+	}
+
+	emitDecision(r.OnDecision, DecisionEvent{
+		Key:        groupKey,
+		Allowed:    output.success,
+		Remaining:  remaining,
+		TakeAmount: 1,
+	})
+
+	return &UseGroupResponse{
+		Success:           output.success,
+		RemainingCapacity: remaining,
+		MemberUsage:       output.usage,
+	}, nil
+}
+
+// Inspect atomically inspects the group's window, returning its remaining capacity, and how many tokens in the window each member
+// took. It does not take any tokens.
+func (r *GroupLimiterImpl) Inspect(ctx context.Context, bucket *GroupOptions, groupKey string) (*InspectGroupResponse, error) {
+	args := []interface{}{r.now().UnixMilli(), bucket.Window.Milliseconds()}
+	resp, err := r.eval(adapters.WithIdempotent(ctx), groupInspectScript, groupKeys(groupKey), args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query redis adapter: %w", err)
+	}
+
+	tokens, usage, err := parseInspectGroupResponse(resp)
+	if err != nil {
+		logUnexpectedResponse(r.Logger, groupKey, resp, err)
+		return nil, parsingError(groupInspectScript, err)
+	}
+
+	remaining := 0
+	if v := bucket.MaximumCapacity - tokens; v > 0 {
+		remaining = v
+	}
+
+	return &InspectGroupResponse{
+		RemainingCapacity: remaining,
+		Limit:             bucket.MaximumCapacity,
+		Usage:             usage,
+	}, nil
+}
+
+func groupKeys(groupKey string) []string {
+	return []string{groupKey, groupKey + "::members"}
+}
+
+type useGroupOutput struct {
+	success bool
+	tokens  int
+	usage   int
+}
+
+func parseUseGroupResponse(v interface{}) (*useGroupOutput, error) {
+	ints, err := parseRedisInt64Slice(v)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ints) != 3 {
+		return nil, fmt.Errorf("expected 3 args but got %d", len(ints))
+	}
+
+	return &useGroupOutput{
+		success: ints[0] == 1,
+		tokens:  int(ints[1]),
+		usage:   int(ints[2]),
+	}, nil
+}
+
+func parseInspectGroupResponse(v interface{}) (int, map[string]int, error) {
+	args, ok := v.([]interface{})
+	if !ok {
+		return 0, nil, fmt.Errorf("expected []interface{} but got %T", v)
+	}
+
+	if len(args) != 2 {
+		return 0, nil, fmt.Errorf("expected 2 args but got %d", len(args))
+	}
+
+	tokens, ok := integer(args[0])
+	if !ok {
+		return 0, nil, fmt.Errorf("expected int64 in args[0] but got %T", args[0])
+	}
+
+	rawUsage, ok := args[1].([]interface{})
+	if !ok {
+		return 0, nil, fmt.Errorf("expected []interface{} in args[1] but got %T", args[1])
+	}
+
+	if len(rawUsage)%2 != 0 {
+		return 0, nil, fmt.Errorf("expected pairs in args[1] but got %d values", len(rawUsage))
+	}
+
+	usage := make(map[string]int, len(rawUsage)/2)
+	for i := 0; i < len(rawUsage); i += 2 {
+		member, ok := bulkString(rawUsage[i])
+		if !ok {
+			return 0, nil, fmt.Errorf("expected string in args[1][%d] but got %T", i, rawUsage[i])
+		}
+
+		count, ok := integer(rawUsage[i+1])
+		if !ok {
+			return 0, nil, fmt.Errorf("expected int64 in args[1][%d] but got %T", i+1, rawUsage[i+1])
+		}
+
+		usage[member] = int(count)
+	}
+
+	return int(tokens), usage, nil
+}
@@ -0,0 +1,153 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aidenwallis/go-ratelimiting/redis/adapters"
+	goredisadapter "github.com/aidenwallis/go-ratelimiting/redis/adapters/go-redis"
+	redigoadapter "github.com/aidenwallis/go-ratelimiting/redis/adapters/redigo"
+	"github.com/alicebob/miniredis/v2"
+	redigo "github.com/gomodule/redigo/redis"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func groupOptions() *GroupOptions {
+	return &GroupOptions{
+		MaximumCapacity: 3,
+		Window:          time.Hour,
+	}
+}
+
+func TestGroupLimiter(t *testing.T) {
+	testCases := map[string]func(*miniredis.Miniredis) adapters.Adapter{
+		"go-redis": func(t *miniredis.Miniredis) adapters.Adapter {
+			return goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: t.Addr()}))
+		},
+		"redigo": func(t *miniredis.Miniredis) adapters.Adapter {
+			conn, err := redigo.Dial("tcp", t.Addr())
+			if err != nil {
+				panic(err)
+			}
+			return redigoadapter.NewAdapter(conn)
+		},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Now().UTC()
+			mr := miniredis.RunT(t)
+			limiter := NewGroupLimiter(testCase(mr))
+			limiter.nowFunc = func() time.Time { return now }
+
+			use := func(groupKey, memberKey string, expected *UseGroupResponse) {
+				t.Helper()
+				resp, err := limiter.Use(ctx, groupOptions(), groupKey, memberKey)
+				assert.NoError(t, err)
+				assert.Equal(t, expected, resp)
+			}
+
+			inspect := func(groupKey string, expected *InspectGroupResponse) {
+				t.Helper()
+				resp, err := limiter.Inspect(ctx, groupOptions(), groupKey)
+				assert.NoError(t, err)
+				assert.Equal(t, expected, resp)
+			}
+
+			inspect("org", &InspectGroupResponse{RemainingCapacity: 3, Limit: 3, Usage: map[string]int{}})
+
+			// every member draws from the group's capacity
+			use("org", "key-a", &UseGroupResponse{Success: true, RemainingCapacity: 2, MemberUsage: 1})
+			use("org", "key-a", &UseGroupResponse{Success: true, RemainingCapacity: 1, MemberUsage: 2})
+			use("org", "key:b", &UseGroupResponse{Success: true, RemainingCapacity: 0, MemberUsage: 1})
+			use("org", "key:b", &UseGroupResponse{Success: false, RemainingCapacity: 0, MemberUsage: 1})
+			inspect("org", &InspectGroupResponse{RemainingCapacity: 0, Limit: 3, Usage: map[string]int{"key-a": 2, "key:b": 1}})
+			assert.Equal(t, time.Hour, mr.TTL("org"))
+			assert.Equal(t, time.Hour, mr.TTL("org::members"))
+
+			// other groups have their own capacity
+			use("other-org", "key-a", &UseGroupResponse{Success: true, RemainingCapacity: 2, MemberUsage: 1})
+
+			// tokens stop being attributed to their members once they leave the window
+			now = now.Add(time.Minute * 30)
+			use("org", "key-c", &UseGroupResponse{Success: false, RemainingCapacity: 0, MemberUsage: 0})
+			now = now.Add(time.Minute * 30)
+			use("org", "key:b", &UseGroupResponse{Success: true, RemainingCapacity: 2, MemberUsage: 1})
+			inspect("org", &InspectGroupResponse{RemainingCapacity: 2, Limit: 3, Usage: map[string]int{"key:b": 1}})
+		})
+	}
+}
+
+func TestGroupLimiter_Errors(t *testing.T) {
+	testCases := map[string]struct {
+		useErrorMessage     string
+		inspectErrorMessage string
+		mockAdapter         adapters.Adapter
+	}{
+		"redis error": {
+			useErrorMessage:     "failed to query redis adapter: " + assert.AnError.Error(),
+			inspectErrorMessage: "failed to query redis adapter: " + assert.AnError.Error(),
+			mockAdapter: &mockAdapter{
+				returnError: assert.AnError,
+			},
+		},
+		"parsing error": {
+			useErrorMessage:     "parsing redis response from script " + scriptSHA(groupUseScript) + ": expected 3 args but got 1",
+			inspectErrorMessage: "parsing redis response from script " + scriptSHA(groupInspectScript) + ": expected 2 args but got 1",
+			mockAdapter: &mockAdapter{
+				returnValue: []interface{}{int64(1)},
+			},
+		},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			limiter := NewGroupLimiter(testCase.mockAdapter)
+
+			useResp, err := limiter.Use(context.Background(), groupOptions(), "org", "key")
+			assert.Nil(t, useResp)
+			assert.EqualError(t, err, testCase.useErrorMessage)
+
+			inspectResp, err := limiter.Inspect(context.Background(), groupOptions(), "org")
+			assert.Nil(t, inspectResp)
+			assert.EqualError(t, err, testCase.inspectErrorMessage)
+		})
+	}
+}
+
+func TestParseInspectGroupResponse_Errors(t *testing.T) {
+	testCases := map[string]struct {
+		value        interface{}
+		errorMessage string
+	}{
+		"not a slice":    {value: int64(1), errorMessage: "expected []interface{} but got int64"},
+		"wrong length":   {value: []interface{}{int64(1)}, errorMessage: "expected 2 args but got 1"},
+		"bad tokens":     {value: []interface{}{"one", []interface{}{}}, errorMessage: "expected int64 in args[0] but got string"},
+		"bad usage":      {value: []interface{}{int64(1), "a"}, errorMessage: "expected []interface{} in args[1] but got string"},
+		"unpaired usage": {value: []interface{}{int64(1), []interface{}{"a"}}, errorMessage: "expected pairs in args[1] but got 1 values"},
+		"bad member": {
+			value:        []interface{}{int64(1), []interface{}{int64(1), int64(1)}},
+			errorMessage: "expected string in args[1][0] but got int64",
+		},
+		"bad count": {
+			value:        []interface{}{int64(1), []interface{}{"a", "one"}},
+			errorMessage: "expected int64 in args[1][1] but got string",
+		},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			_, _, err := parseInspectGroupResponse(testCase.value)
+			assert.EqualError(t, err, testCase.errorMessage)
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package redis
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+)
+
+// ToHeaders sets the X-RateLimit-Limit, X-RateLimit-Remaining and X-RateLimit-Reset headers on h from the response, and Retry-After
+// when the take was denied, using the same conventions as the httpratelimit middleware. bucket must be the options the response
+// was returned for, as the limit is its MaximumCapacity.
+//
+// Retry-After is set to how long it takes a single token to refill, or to when the caller's cool-down ends if they're penalized.
+func (r *UseLeakyBucketResponse) ToHeaders(h http.Header, bucket *LeakyBucketOptions) {
+	setHeaders(h, bucket.MaximumCapacity, r.Decision(bucket))
+}
+
+// ToHeaders sets the X-RateLimit-Limit and X-RateLimit-Remaining headers on h from the response, and Retry-After when the take was
+// denied, using the same conventions as the httpratelimit middleware. bucket must be the options the response was returned for,
+// as the limit is its MaximumCapacity.
+//
+// The sliding window doesn't report when its oldest token expires, so X-RateLimit-Reset is omitted, and Retry-After is set to the
+// window, or to when the caller's cool-down ends if they're penalized.
+func (r *UseSlidingWindowResponse) ToHeaders(h http.Header, bucket *SlidingWindowOptions) {
+	setHeaders(h, bucket.MaximumCapacity, r.Decision(bucket))
+}
+
+func setHeaders(h http.Header, limit int, d Decision) {
+	h.Set("X-RateLimit-Limit", strconv.Itoa(limit))
+	h.Set("X-RateLimit-Remaining", strconv.Itoa(d.Remaining))
+	if !d.ResetAt.IsZero() {
+		h.Set("X-RateLimit-Reset", strconv.FormatInt(d.ResetAt.Unix(), 10))
+	}
+	if !d.Success && d.RetryAfter > 0 {
+		// Retry-After only has a resolution of seconds, so round up to avoid callers retrying early
+		h.Set("Retry-After", strconv.Itoa(int(math.Ceil(d.RetryAfter.Seconds()))))
+	}
+}
@@ -0,0 +1,85 @@
+package redis
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToHeaders(t *testing.T) {
+	t.Parallel()
+
+	resetAt := time.Unix(1700000000, 0)
+
+	testCases := map[string]struct {
+		set      func(h http.Header)
+		expected http.Header
+	}{
+		"leaky bucket allowed": {
+			set: func(h http.Header) {
+				(&UseLeakyBucketResponse{Success: true, RemainingTokens: 59, ResetAt: resetAt}).ToHeaders(h, leakyBucketOptions())
+			},
+			expected: http.Header{
+				"X-Ratelimit-Limit":     {"60"},
+				"X-Ratelimit-Remaining": {"59"},
+				"X-Ratelimit-Reset":     {"1700000000"},
+			},
+		},
+		"leaky bucket denied": {
+			set: func(h http.Header) {
+				(&UseLeakyBucketResponse{ResetAt: resetAt}).ToHeaders(h, leakyBucketOptions())
+			},
+			expected: http.Header{
+				"X-Ratelimit-Limit":     {"60"},
+				"X-Ratelimit-Remaining": {"0"},
+				"X-Ratelimit-Reset":     {"1700000000"},
+				"Retry-After":           {"1"},
+			},
+		},
+		"leaky bucket penalized": {
+			set: func(h http.Header) {
+				resp := &UseLeakyBucketResponse{ResetAt: resetAt, PenaltyUntil: time.Now().Add(90 * time.Second)}
+				resp.ToHeaders(h, leakyBucketOptions())
+			},
+			expected: http.Header{
+				"X-Ratelimit-Limit":     {"60"},
+				"X-Ratelimit-Remaining": {"0"},
+				"X-Ratelimit-Reset":     {"1700000000"},
+				"Retry-After":           {"90"},
+			},
+		},
+		"sliding window allowed": {
+			set: func(h http.Header) {
+				(&UseSlidingWindowResponse{Success: true, RemainingCapacity: 12}).ToHeaders(h, slidingWindowOptions())
+			},
+			expected: http.Header{
+				"X-Ratelimit-Limit":     {"60"},
+				"X-Ratelimit-Remaining": {"12"},
+			},
+		},
+		"sliding window denied": {
+			set: func(h http.Header) {
+				(&UseSlidingWindowResponse{}).ToHeaders(h, slidingWindowOptions())
+			},
+			expected: http.Header{
+				"X-Ratelimit-Limit":     {"60"},
+				"X-Ratelimit-Remaining": {"0"},
+				"Retry-After":           {"60"},
+			},
+		},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			h := http.Header{}
+			testCase.set(h)
+			assert.Equal(t, testCase.expected, h)
+		})
+	}
+}
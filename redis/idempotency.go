@@ -0,0 +1,63 @@
+package redis
+
+import (
+	"context"
+	"time"
+
+	"github.com/aidenwallis/go-ratelimiting/redis/adapters"
+)
+
+// DefaultIdempotencyTTL is how long an idempotency key is remembered for when IdempotencyTTL is not set.
+const DefaultIdempotencyTTL = time.Minute
+
+// idempotencyCheckScript is concatenated into the Use scripts before tokens are taken, it looks up the decision made for a previous
+// attempt of the same request. The idempotency key is the companion key claimed after the penalty key, and its TTL is the argument
+// before the penalty arguments.
+const idempotencyCheckScript = `
+local idempotencyTTL = tonumber(ARGV[#ARGV - 3])
+local idempotencyKey = companionKey(idempotencyTTL > 0)
+local replayed = false
+local priorSuccess = 0
+
+if (idempotencyTTL > 0) then
+	local prior = redis.call("get", idempotencyKey)
+	if (prior) then
+		replayed = true
+		priorSuccess = tonumber(prior)
+	end
+end
+`
+
+// idempotencyRecordScript is concatenated into the Use scripts after tokens are taken, it remembers the decision for the request, or
+// restores the decision made previously if this attempt is a retry.
+const idempotencyRecordScript = `
+if (replayed) then
+	success = priorSuccess
+elseif (idempotencyTTL > 0) then
+	redis.call("set", idempotencyKey, success, "PX", idempotencyTTL, "NX")
+end
+`
+
+func idempotencyKey(prefix, key string) string {
+	return prefix + "::idempotency::" + key
+}
+
+// idempotentUse marks ctx with adapters.WithIdempotent when an IdempotencyKey is set, as a retry of the call replays the decision
+// rather than taking another token, so decorators such as the retry adapter may retry it.
+func idempotentUse(ctx context.Context, key string) context.Context {
+	if key == "" {
+		return ctx
+	}
+	return adapters.WithIdempotent(ctx)
+}
+
+// idempotencyArg returns the TTL in milliseconds read by idempotencyCheckScript, idempotency is disabled unless a key is set.
+func idempotencyArg(key string, ttl time.Duration) int64 {
+	if key == "" {
+		return 0
+	}
+	if ttl.Milliseconds() <= 0 {
+		ttl = DefaultIdempotencyTTL
+	}
+	return ttl.Milliseconds()
+}
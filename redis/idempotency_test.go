@@ -0,0 +1,134 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aidenwallis/go-ratelimiting/redis/adapters"
+	goredisadapter "github.com/aidenwallis/go-ratelimiting/redis/adapters/go-redis"
+	redigoadapter "github.com/aidenwallis/go-ratelimiting/redis/adapters/redigo"
+	"github.com/alicebob/miniredis/v2"
+	redigo "github.com/gomodule/redigo/redis"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUseLeakyBucket_IdempotencyKey(t *testing.T) {
+	testCases := map[string]func(*miniredis.Miniredis) adapters.Adapter{
+		"go-redis": func(t *miniredis.Miniredis) adapters.Adapter {
+			return goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: t.Addr()}))
+		},
+		"redigo": func(t *miniredis.Miniredis) adapters.Adapter {
+			conn, err := redigo.Dial("tcp", t.Addr())
+			if err != nil {
+				panic(err)
+			}
+			return redigoadapter.NewAdapter(conn)
+		},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Now().UTC()
+			mr := miniredis.RunT(t)
+			limiter := NewLeakyBucket(testCase(mr))
+			limiter.nowFunc = func() time.Time { return now }
+
+			opts := &LeakyBucketOptions{KeyPrefix: "test-bucket", MaximumCapacity: 2, WindowSeconds: 2, IdempotencyKey: "req-1"}
+
+			for i := 0; i < 2; i++ {
+				resp, err := limiter.Use(ctx, opts, 1)
+				assert.NoError(t, err)
+				assert.True(t, resp.Success, "attempt %d", i)
+				assert.Equal(t, 1, resp.RemainingTokens, "retries shouldn't take another token")
+			}
+			assert.Equal(t, DefaultIdempotencyTTL, mr.TTL(idempotencyKey(opts.KeyPrefix, "req-1")))
+
+			opts.IdempotencyKey = "req-2"
+			{
+				resp, err := limiter.Use(ctx, opts, 2)
+				assert.NoError(t, err)
+				assert.False(t, resp.Success)
+			}
+
+			// the bucket has refilled, but a retry should still be denied like the original
+			limiter.nowFunc = func() time.Time { return now.Add(time.Second * 2) }
+
+			{
+				resp, err := limiter.Use(ctx, opts, 2)
+				assert.NoError(t, err)
+				assert.False(t, resp.Success)
+				assert.Equal(t, 2, resp.RemainingTokens)
+			}
+
+			opts.IdempotencyKey = ""
+			{
+				resp, err := limiter.Use(ctx, opts, 2)
+				assert.NoError(t, err)
+				assert.True(t, resp.Success)
+			}
+		})
+	}
+}
+
+func TestUseSlidingWindow_IdempotencyKey(t *testing.T) {
+	testCases := map[string]time.Duration{
+		"exact":       0,
+		"approximate": time.Second,
+	}
+
+	for name, granularity := range testCases {
+		granularity := granularity
+
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			mr := miniredis.RunT(t)
+			limiter := NewSlidingWindow(goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: mr.Addr()})))
+
+			opts := slidingWindowOptions()
+			opts.MaximumCapacity = 1
+			opts.Granularity = granularity
+			opts.IdempotencyKey = "req-1"
+			opts.IdempotencyTTL = time.Second * 30
+
+			for i := 0; i < 2; i++ {
+				resp, err := limiter.Use(ctx, opts)
+				assert.NoError(t, err)
+				assert.True(t, resp.Success, "attempt %d", i)
+				assert.Equal(t, 0, resp.RemainingCapacity)
+			}
+			assert.Equal(t, opts.IdempotencyTTL, mr.TTL(idempotencyKey(opts.Key, "req-1")))
+
+			opts.IdempotencyKey = "req-2"
+			{
+				resp, err := limiter.Use(ctx, opts)
+				assert.NoError(t, err)
+				assert.False(t, resp.Success)
+			}
+		})
+	}
+}
+
+func TestUse_IdempotencyKeyMarksRetryable(t *testing.T) {
+	ctx := context.Background()
+
+	for _, key := range []string{"", "request"} {
+		leakyAdapter := &mockAdapter{returnValue: []interface{}{int64(1), int64(59), int64(0), int64(0), int64(0), int64(0), int64(0), int64(0), int64(1)}}
+		leakyOpts := leakyBucketOptions()
+		leakyOpts.IdempotencyKey = key
+		_, err := NewLeakyBucket(leakyAdapter).Use(ctx, leakyOpts, 1)
+		assert.NoError(t, err)
+		assert.Equal(t, key != "", leakyAdapter.idempotent)
+
+		windowAdapter := &mockAdapter{returnValue: []interface{}{int64(1), int64(1), int64(0), int64(0), int64(0)}}
+		windowOpts := slidingWindowOptions()
+		windowOpts.IdempotencyKey = key
+		_, err = NewSlidingWindow(windowAdapter).Use(ctx, windowOpts)
+		assert.NoError(t, err)
+		assert.Equal(t, key != "", windowAdapter.idempotent)
+	}
+}
@@ -0,0 +1,105 @@
+package redis
+
+import "time"
+
+// Algorithm names reported in LimiterInfo.
+const (
+	AlgorithmLeakyBucket   = "leaky_bucket"
+	AlgorithmSlidingWindow = "sliding_window"
+	AlgorithmComposite     = "composite"
+)
+
+// LimiterInfo describes a ratelimiter's effective configuration, it's JSON serializable so it can be logged, or rendered on debug
+// endpoints and dashboards.
+//
+// The Redis ratelimiters are configured per call, so LimiterInfo is returned by the options' Describe methods.
+type LimiterInfo struct {
+	// Algorithm is the name of the ratelimiting algorithm, such as AlgorithmLeakyBucket
+	Algorithm string `json:"algorithm"`
+
+	// Capacity is the max amount of tokens that may be taken per Window
+	Capacity int `json:"capacity"`
+
+	// Window is the duration Capacity applies to
+	Window time.Duration `json:"window"`
+
+	// RefillInterval is how often a single token is added back, for ratelimiters that refill at a constant rate
+	RefillInterval time.Duration `json:"refill_interval,omitempty"`
+
+	// Keys are the Redis keys the ratelimiter stores its state in
+	Keys []string `json:"keys,omitempty"`
+
+	// Components describes the ratelimiters that make up a composite ratelimiter
+	Components []LimiterInfo `json:"components,omitempty"`
+}
+
+// Describe will return the effective configuration of a leaky bucket using these options.
+func (o *LeakyBucketOptions) Describe() LimiterInfo {
+	info := LimiterInfo{
+		Algorithm: AlgorithmLeakyBucket,
+		Capacity:  o.MaximumCapacity,
+		Window:    time.Duration(o.WindowSeconds) * time.Second,
+		Keys:      o.keys(),
+	}
+
+	if o.TrackPeak {
+		info.Keys = append(info.Keys, peakKey(o.KeyPrefix))
+	}
+
+	if o.DailyQuota > 0 {
+		info.Keys = append(info.Keys, dailyQuotaKey(o.KeyPrefix))
+	}
+
+	if penaltyEnabled(o.PenaltyThreshold, o.PenaltyDuration) {
+		info.Keys = append(info.Keys, penaltyKey(o.KeyPrefix))
+	}
+
+	if o.MaximumCapacity > 0 {
+		info.RefillInterval = info.Window / time.Duration(o.MaximumCapacity)
+	}
+
+	return info
+}
+
+// Describe will return the effective configuration of a sliding window using these options.
+func (o *SlidingWindowOptions) Describe() LimiterInfo {
+	keys := slidingWindowKeys(o.Key)
+	if o.Granularity > 0 {
+		// approximate windows don't compact, so only use the main key
+		keys = keys[:1]
+	}
+
+	if o.BurstCapacity > 0 && o.BurstRefill > 0 {
+		keys = append(keys, burstKey(o.Key))
+	}
+
+	if o.TrackPeak {
+		keys = append(keys, peakKey(o.Key))
+	}
+
+	if penaltyEnabled(o.PenaltyThreshold, o.PenaltyDuration) {
+		keys = append(keys, penaltyKey(o.Key))
+	}
+
+	return LimiterInfo{
+		Algorithm: AlgorithmSlidingWindow,
+		Capacity:  o.MaximumCapacity,
+		Window:    o.Window,
+		Keys:      keys,
+	}
+}
+
+// Describe will return the effective configuration of a composite ratelimiter using these options, the leaky bucket and sliding
+// window are described in Components.
+func (o *CompositeOptions) Describe() LimiterInfo {
+	keys := compositeKeys(o.KeyPrefix)
+
+	return LimiterInfo{
+		Algorithm: AlgorithmComposite,
+		Keys:      keys,
+		Components: []LimiterInfo{
+			o.leakyBucket().Describe(),
+			(&SlidingWindowOptions{Key: keys[3], MaximumCapacity: o.WindowCapacity, Window: o.Window}).Describe(),
+		},
+	}
+}
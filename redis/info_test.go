@@ -0,0 +1,46 @@
+package redis
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDescribe(t *testing.T) {
+	assert.Equal(t, LimiterInfo{
+		Algorithm:      AlgorithmLeakyBucket,
+		Capacity:       10,
+		Window:         time.Second * 10,
+		RefillInterval: time.Second,
+		Keys:           []string{"foo::tokens", "foo::last_fill", "foo::remainder"},
+	}, (&LeakyBucketOptions{KeyPrefix: "foo", MaximumCapacity: 10, WindowSeconds: 10}).Describe())
+
+	assert.Equal(t, []string{"foo"}, (&LeakyBucketOptions{KeyPrefix: "foo", MaximumCapacity: 10, WindowSeconds: 10, SingleKey: true}).Describe().Keys)
+
+	assert.Equal(t, LimiterInfo{
+		Algorithm: AlgorithmSlidingWindow,
+		Capacity:  5,
+		Window:    time.Minute,
+		Keys:      []string{"bar", "bar::compacted"},
+	}, (&SlidingWindowOptions{Key: "bar", MaximumCapacity: 5, Window: time.Minute}).Describe())
+
+	assert.Equal(t, []string{"bar", "bar::compacted", "bar::penalty"}, (&SlidingWindowOptions{
+		Key: "bar", MaximumCapacity: 5, Window: time.Minute, PenaltyThreshold: 3, PenaltyDuration: time.Minute,
+	}).Describe().Keys)
+
+	assert.Equal(t, []string{"bar", "bar::compacted", "bar::burst"}, (&SlidingWindowOptions{
+		Key: "bar", MaximumCapacity: 5, Window: time.Minute, BurstCapacity: 2, BurstRefill: time.Second,
+	}).Describe().Keys)
+
+	composite := (&CompositeOptions{KeyPrefix: "baz", BucketCapacity: 10, BucketWindowSeconds: 10, WindowCapacity: 5, Window: time.Minute}).Describe()
+	assert.Equal(t, AlgorithmComposite, composite.Algorithm)
+	assert.Equal(t, compositeKeys("baz"), composite.Keys)
+	assert.Len(t, composite.Components, 2)
+	assert.Equal(t, []string{"baz::window", "baz::window::compacted"}, composite.Components[1].Keys)
+
+	out, err := json.Marshal((&SlidingWindowOptions{Key: "bar", MaximumCapacity: 5, Window: time.Minute, Granularity: time.Second}).Describe())
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"algorithm":"sliding_window","capacity":5,"window":60000000000,"keys":["bar"]}`, string(out))
+}
@@ -0,0 +1,143 @@
+//go:build integration
+
+package redis
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aidenwallis/go-ratelimiting/redis/adapters"
+	goredisadapter "github.com/aidenwallis/go-ratelimiting/redis/adapters/go-redis"
+	redigoadapter "github.com/aidenwallis/go-ratelimiting/redis/adapters/redigo"
+	redigo "github.com/gomodule/redigo/redis"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestIntegration runs the scripts against the real Redis server at REDIS_ADDR, as miniredis doesn't perfectly emulate how real
+// Redis runs Lua, such as how numbers are returned. Run it with: REDIS_ADDR=127.0.0.1:6379 go test -tags integration ./...
+func TestIntegration(t *testing.T) {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		t.Skip("REDIS_ADDR is not set, skipping integration test")
+	}
+
+	testCases := map[string]func(t *testing.T) adapters.Adapter{
+		"go-redis resp2": func(t *testing.T) adapters.Adapter {
+			return goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: addr, Protocol: 2}))
+		},
+		"go-redis resp3": func(t *testing.T) adapters.Adapter {
+			return goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: addr, Protocol: 3}))
+		},
+		"redigo": func(t *testing.T) adapters.Adapter {
+			conn, err := redigo.Dial("tcp", addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return redigoadapter.NewAdapter(conn)
+		},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			adapter := testCase(t)
+			t.Cleanup(func() { _ = closeAdapter(adapter) })
+
+			// every test uses its own namespace, so that they don't collide with each other or whatever else is in the database
+			prefix := fmt.Sprintf("go-ratelimiting:integration:%d:", time.Now().UnixNano())
+			t.Cleanup(func() {
+				_, err := NewLeakyBucket(adapter).ResetNamespace(context.Background(), prefix)
+				assert.NoError(t, err)
+			})
+
+			t.Run("leaky bucket", func(t *testing.T) {
+				limiter := NewLeakyBucket(adapter)
+				bucket := &LeakyBucketOptions{KeyPrefix: prefix + "leaky-bucket", MaximumCapacity: 10, WindowSeconds: 60}
+
+				resp, err := limiter.Use(ctx, bucket, 4)
+				assert.NoError(t, err)
+				assert.True(t, resp.Success)
+				assert.Equal(t, 6, resp.RemainingTokens)
+				assert.Equal(t, 4, resp.Taken)
+				assert.GreaterOrEqual(t, resp.RemainingTokensFloat, 6.0)
+				assert.Less(t, resp.RemainingTokensFloat, 7.0)
+
+				resp, err = limiter.Use(ctx, bucket, 7)
+				assert.NoError(t, err)
+				assert.False(t, resp.Success)
+				assert.Equal(t, 6, resp.RemainingTokens)
+
+				inspect, err := limiter.Inspect(ctx, bucket)
+				assert.NoError(t, err)
+				assert.Equal(t, 6, inspect.RemainingTokens)
+				assert.True(t, inspect.ResetAt.After(time.Now()))
+			})
+
+			t.Run("sliding window", func(t *testing.T) {
+				for _, serverClock := range []bool{false, true} {
+					limiter := NewSlidingWindow(adapter)
+					bucket := &SlidingWindowOptions{
+						Key:             fmt.Sprintf("%ssliding-window:%t", prefix, serverClock),
+						MaximumCapacity: 3,
+						Window:          time.Minute,
+						ServerClock:     serverClock,
+					}
+
+					for i := 2; i >= 0; i-- {
+						resp, err := limiter.Use(ctx, bucket)
+						assert.NoError(t, err)
+						assert.True(t, resp.Success)
+						assert.Equal(t, i, resp.RemainingCapacity)
+					}
+
+					resp, err := limiter.Use(ctx, bucket)
+					assert.NoError(t, err)
+					assert.False(t, resp.Success)
+
+					inspect, err := limiter.Inspect(ctx, bucket)
+					assert.NoError(t, err)
+					assert.Equal(t, 0, inspect.RemainingCapacity)
+				}
+			})
+
+			t.Run("min interval", func(t *testing.T) {
+				limiter := NewMinInterval(adapter)
+				bucket := &MinIntervalOptions{Key: prefix + "min-interval", Interval: time.Minute}
+
+				resp, err := limiter.Use(ctx, bucket)
+				assert.NoError(t, err)
+				assert.True(t, resp.Success)
+
+				resp, err = limiter.Use(ctx, bucket)
+				assert.NoError(t, err)
+				assert.False(t, resp.Success)
+				assert.Greater(t, resp.RetryAfter, time.Duration(0))
+			})
+
+			t.Run("functions", func(t *testing.T) {
+				functionAdapter, ok := adapter.(adapters.FunctionAdapter)
+				if !ok {
+					t.Skip("adapter doesn't support functions")
+				}
+				if err := LoadFunctions(ctx, functionAdapter); err != nil {
+					t.Skipf("server doesn't support functions: %s", err)
+				}
+
+				limiter := NewLeakyBucket(adapter)
+				limiter.UseFunctions = true
+				bucket := &LeakyBucketOptions{KeyPrefix: prefix + "functions", MaximumCapacity: 10, WindowSeconds: 60}
+
+				resp, err := limiter.Use(ctx, bucket, 1)
+				assert.NoError(t, err)
+				assert.True(t, resp.Success)
+				assert.Equal(t, 9, resp.RemainingTokens)
+			})
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"math"
+	"math/rand"
 	"time"
 
 	"github.com/aidenwallis/go-ratelimiting/redis/adapters"
@@ -26,6 +27,21 @@ type LeakyBucket interface {
 	// Use atomically attempts to use the leaky bucket. Use takeAmount to set how many tokens should be attempted to be removed
 	// from the bucket: they are atomic, either all tokens are taken, or the ratelimit is unsuccessful.
 	Use(ctx context.Context, bucket *LeakyBucketOptions, takeAmount int) (*UseLeakyBucketResponse, error)
+
+	// UseAny atomically attempts to take takeAmount tokens from the least-loaded of buckets that has them all available. It returns
+	// the index of the bucket used, or -1 if no bucket had enough tokens.
+	UseAny(ctx context.Context, buckets []*LeakyBucketOptions, takeAmount int) (int, *UseLeakyBucketResponse, error)
+
+	// WouldAllowAt projects whether takeAmount tokens could be taken from the bucket at the given time, assuming nothing else is
+	// taken in the meantime. It does not take any tokens.
+	WouldAllowAt(ctx context.Context, bucket *LeakyBucketOptions, takeAmount int, at time.Time) (*WouldAllowResponse, error)
+
+	// Preview atomically computes what taking takeAmount tokens from the bucket right now would result in, without taking them.
+	Preview(ctx context.Context, bucket *LeakyBucketOptions, takeAmount int) (*PreviewLeakyBucketResponse, error)
+
+	// RefundBatch atomically gives back tokens to several buckets in a single round trip, never filling a bucket beyond its
+	// capacity. It returns how many tokens each bucket holds afterwards, in the same order as refunds.
+	RefundBatch(ctx context.Context, refunds []BucketRefund) ([]int, error)
 }
 
 var _ LeakyBucket = (*LeakyBucketImpl)(nil)
@@ -34,11 +50,13 @@ var _ LeakyBucket = (*LeakyBucketImpl)(nil)
 type LeakyBucketOptions struct {
 	// KeyPrefix is the bucket key name in Redis.
 	//
-	// Note that this ratelimiter will create two keys in Redis, and suffix them with :last_fill and :tokens.
+	// Note that this ratelimiter will create three keys in Redis, and suffix them with ::last_fill, ::tokens and ::remainder, unless
+	// SingleKey is set.
 	KeyPrefix string
 
 	// MaximumCapacity defines the maximum number of tokens in the leaky bucket. If a bucket has expired or otherwise doesn't exist,
 	// the bucket is set to this size, it also ensures the bucket can never contain more than this number of tokens at any time.
+	// New buckets starting full matches local.NewLeakyBucket, use StartEmpty, WarmStart or Prime to start a bucket with fewer tokens.
 	//
 	// Note that if you decrease the number of tokens in an existing bucket, that bucket is automatically reduced to the new max size,
 	// however, if you increase the maximum capacity of the bucket, it will refill faster, but not immediately be placed to the new, higher
@@ -51,6 +69,84 @@ type LeakyBucketOptions struct {
 	//
 	// Windows have a maximum resolution of 1 second.
 	WindowSeconds int
+
+	// SingleKey stores the bucket in a single hash at KeyPrefix, rather than three separate keys. This reduces key count at scale,
+	// and means the bucket always lives in a single Redis Cluster slot. Options which store state in a companion key, such as
+	// PenaltyThreshold or DailyQuota, add keys outside that slot unless KeyPrefix contains a hash tag.
+	//
+	// The two layouts aren't compatible, so changing this for an existing bucket starts it again from full.
+	SingleKey bool
+
+	// TTLJitterPercent optionally adds a random amount, up to this percentage of WindowSeconds rounded up to whole seconds, to how
+	// long the bucket's keys are kept for. Otherwise, the keys for a burst of new callers all expire together a window later, which
+	// can cause a spike of expiry work in Redis. This doesn't affect how the bucket fills, only how long an idle bucket is retained.
+	TTLJitterPercent int
+
+	// PenaltyThreshold optionally defines how many consecutive denials a caller may receive before they're put into a cool-down,
+	// during which Use is denied even if tokens are available. Consecutive denials are counted in a companion key, suffixed with
+	// ::penalty, and any successful Use resets the count. Penalties are disabled unless both this and PenaltyDuration are set.
+	PenaltyThreshold int
+
+	// PenaltyDuration defines how long the cool-down lasts once PenaltyThreshold is reached, resolution is available up to
+	// milliseconds.
+	PenaltyDuration time.Duration
+
+	// IdempotencyKey optionally identifies the request, so that a retry of it doesn't take another token. If a request with the same
+	// IdempotencyKey was seen within IdempotencyTTL, Use returns the same decision it made the first time, without taking anything.
+	// The decision is remembered in a companion key, suffixed with ::idempotency:: and the IdempotencyKey. As retrying the call is
+	// safe, it's marked with adapters.WithIdempotent, so decorators such as the retry adapter retry it.
+	IdempotencyKey string
+
+	// IdempotencyTTL defines how long an IdempotencyKey is remembered for. If this is not set, DefaultIdempotencyTTL is used.
+	IdempotencyTTL time.Duration
+
+	// MinimumReserve optionally defines how many tokens Use must leave in the bucket, a take only succeeds if at least this many
+	// tokens would remain afterwards. This is useful to keep headroom for high-priority traffic, which can use the same bucket
+	// without a reserve, while normal traffic is throttled earlier. Denials caused by the reserve set DeniedByReserve on the
+	// response. UseAny ignores it.
+	MinimumReserve int
+
+	// DryRun runs Use in shadow mode, which is useful to measure the impact of a new limit before enforcing it. The bucket is used
+	// as normal, taking tokens when they're available, but Success is always true, and WouldHaveBeenLimited is set on the response
+	// when the take was denied.
+	DryRun bool
+
+	// DailyQuota optionally caps how many tokens may be taken from the bucket per day, on top of the rate MaximumCapacity and
+	// WindowSeconds enforce, such as "10 per second, and no more than 10,000 per day". Both are checked and taken atomically in
+	// the same script, and denials caused by the quota set DeniedByQuota on the response. The quota is counted in a companion key,
+	// suffixed with ::daily_quota, which resets at midnight UTC. UseAny ignores it.
+	DailyQuota int
+
+	// TrackPeak makes Use record the most tokens that have been in use at once, which Inspect reports as Peak. This is useful for
+	// tuning capacity: a peak far below MaximumCapacity means the limit could be lowered, and a peak at it means callers are
+	// regularly brushing the limit. The peak is stored in a companion key, suffixed with ::peak, which expires along with the
+	// bucket's own keys once it's idle, or when it's deleted, such as with ResetNamespace.
+	TrackPeak bool
+
+	// PartialOK makes Use take as many tokens as are available, up to takeAmount, rather than failing when fewer than takeAmount are
+	// available, which lets batch consumers drain whatever they can each tick. The response's Taken reports how many were taken.
+	// MinimumReserve and DailyQuota still apply, and the take is only denied when no tokens at all are available.
+	PartialOK bool
+
+	// WarmStart optionally sets the fraction of MaximumCapacity a new bucket starts with, such as 0.5 for half, rather than starting
+	// full. This is useful when a full bucket is too generous an initial allowance, while still letting new callers make some
+	// requests straight away. It only applies when none of the bucket's keys exist, from then on the bucket fills at its usual rate.
+	WarmStart float64
+
+	// StartEmpty makes a new bucket start with no tokens, rather than full, so new callers have to wait for tokens to refill, as a
+	// local leaky bucket does with local.WithInitialTokens(0). It takes precedence over WarmStart, and like it, only applies when
+	// none of the bucket's keys exist.
+	StartEmpty bool
+
+	// MaxFillLookback optionally caps how far back a fill looks when the bucket was last filled long ago, such as a key that barely
+	// survived its TTL, or after the clock jumped forwards, so the bucket gains at most MaxFillLookback worth of tokens in one fill,
+	// rather than jumping straight to full and erasing its throttling history. This is useful for anti-abuse, where a long-idle key
+	// shouldn't instantly regain its whole capacity. New buckets still start full, or as WarmStart sets. The resolution is seconds,
+	// like WindowSeconds, and shorter look-backs are rounded up to a second.
+	MaxFillLookback time.Duration
+
+	// compiled holds the values derived by Compile, if it was called
+	compiled *compiledLeakyBucketOptions
 }
 
 // LeakyBucketImpl implements a leaky bucket ratelimiter in Redis with Lua. This struct is compatible with the LeakyBucket interface
@@ -60,6 +156,21 @@ type LeakyBucketImpl struct {
 	// Adapter defines the Redis adapter
 	Adapter adapters.Adapter
 
+	// OnDecision is an optional hook which is called synchronously after every successful call to Redis that takes tokens, which is
+	// useful for audit logging. It is not called when Redis returns an error.
+	OnDecision func(DecisionEvent)
+
+	// OptionsResolver is an optional function which looks up the options for a bucket by its key, it's required to call UseKey().
+	// Any caching of options is left to the resolver.
+	OptionsResolver func(ctx context.Context, key string) (*LeakyBucketOptions, error)
+
+	// Logger is optionally used to log debugging information, such as the raw response when Redis returns something unexpected.
+	Logger Logger
+
+	// UseFunctions runs the ratelimiter's scripts as Redis functions with FCALL rather than EVAL. The adapter must implement
+	// adapters.FunctionAdapter, and the library must be loaded with LoadFunctions() first.
+	UseFunctions bool
+
 	// nowFunc is a private helper used to mock out time changes in unit testing
 	//
 	// if this is not defined, it falls back to time.Now()
@@ -74,6 +185,22 @@ func NewLeakyBucket(adapter adapters.Adapter) *LeakyBucketImpl {
 	}
 }
 
+// HealthCheck verifies that the adapter is able to run Lua scripts against Redis, and that responses are returned in the shape
+// this ratelimiter expects. This is useful as a readiness probe, as some managed Redis variants disable scripting.
+func (r *LeakyBucketImpl) HealthCheck(ctx context.Context) error {
+	return healthCheck(ctx, r.Adapter, r.UseFunctions)
+}
+
+// Close releases the resources held by the adapter, if the adapter implements io.Closer. Otherwise, it does nothing.
+func (r *LeakyBucketImpl) Close() error {
+	return closeAdapter(r.Adapter)
+}
+
+// eval runs script through the adapter, using FCALL when UseFunctions is set.
+func (r *LeakyBucketImpl) eval(ctx context.Context, script string, keys []string, args []interface{}) (interface{}, error) {
+	return evalScript(ctx, r.Adapter, r.UseFunctions, script, keys, args)
+}
+
 func (r *LeakyBucketImpl) now() time.Time {
 	if r.nowFunc == nil {
 		return time.Now()
@@ -88,22 +215,58 @@ type InspectLeakyBucketResponse struct {
 
 	// ResetAt is the time at which the bucket will be fully refilled
 	ResetAt time.Time
+
+	// Limit is the bucket's MaximumCapacity, it's echoed back alongside Window and RefillInterval so that clients can estimate
+	// their ratelimit locally between calls.
+	Limit int
+
+	// Window is how long it takes to fully refill the bucket
+	Window time.Duration
+
+	// RefillInterval is how often a single token is added to the bucket
+	RefillInterval time.Duration
+
+	// Peak is the most tokens that have been in use at once, when TrackPeak is set.
+	Peak int
 }
 
-// Inspect atomically inspects the leaky bucket and returns the capacity available. It does not take any tokens.
-func (r *LeakyBucketImpl) Inspect(ctx context.Context, bucket *LeakyBucketOptions) (*InspectLeakyBucketResponse, error) {
-	const script = `
-local tokensKey = KEYS[1]
-local lastFillKey = KEYS[2]
+// leakyBucketArgsScript reads the arguments shared by the leaky bucket scripts.
+const leakyBucketArgsScript = `
 local capacity = tonumber(ARGV[1])
-local rate = tonumber(ARGV[2])
+local window = tonumber(ARGV[2])
 local now = tonumber(ARGV[3])
+`
+
+// leakyBucketGetKeysScript reads the bucket's state from its three keys.
+const leakyBucketGetKeysScript = `
+local tokens = tonumber(redis.call("get", KEYS[1]))
+local lastFilled = tonumber(redis.call("get", KEYS[2]))
+local remainder = tonumber(redis.call("get", KEYS[3]))
+`
+
+// leakyBucketGetHashScript reads the bucket's state from a single hash, used when LeakyBucketOptions.SingleKey is set.
+const leakyBucketGetHashScript = `
+local state = redis.call("hmget", KEYS[1], "tokens", "last_fill", "remainder")
+local tokens = tonumber(state[1])
+local lastFilled = tonumber(state[2])
+local remainder = tonumber(state[3])
+`
 
-local tokens = tonumber(redis.call("get", tokensKey))
-local lastFilled = tonumber(redis.call("get", lastFillKey))
+// leakyBucketFillScript defaults any missing state, and fills the bucket. New buckets start with the warmStart tokens the script
+// defines, or full when it's negative. Existing buckets fill for at most the maxLookback seconds the script defines, when it's
+// positive.
+const leakyBucketFillScript = `
+if (tokens == nil and lastFilled == nil and warmStart >= 0) then
+	tokens = warmStart -- new buckets start partially filled when WarmStart is set
+	lastFilled = now
+end
+
+if (lastFilled ~= nil and maxLookback > 0 and now - lastFilled > maxLookback) then
+	lastFilled = now - maxLookback -- only fill for the look-back, rather than for however long the bucket has been idle
+end
 
 if (tokens == nil) then
-	tokens = 0 -- default empty buckets to 0
+	tokens = 0 -- missing buckets are filled from the epoch below, so they start full
 end
 
 if (tokens > capacity) then
@@ -114,33 +277,232 @@ if (lastFilled == nil) then
 	lastFilled = 0
 end
 
+if (remainder == nil) then
+	remainder = 0
+end
+
 if (tokens < capacity) then
-	local tokensToFill = math.floor((now - lastFilled) * rate)
+	-- the bucket fills at capacity/window tokens per second, partial tokens are carried in the remainder so they aren't
+	-- lost to rounding, which would otherwise cause the bucket to fill slower than it should over time.
+	local filled = (now - lastFilled) * capacity + remainder
+	local tokensToFill = math.floor(filled / window)
 	if (tokensToFill > 0) then
 		tokens = math.min(capacity, tokens + tokensToFill)
 		lastFilled = now
+		remainder = filled % window
+		if (tokens >= capacity) then
+			remainder = 0 -- full buckets can't carry partial tokens
+		end
+	end
+end
+`
+
+// leakyBucketTakeScript takes the tokens if they are all available without dipping below the reserve in ARGV[6] or exceeding the
+// daily quota in ARGV[7], the caller isn't cooling down, and the request isn't a retry. The quota is counted in the companion key
+// claimed after the idempotency key, and expires at ARGV[8]. When PartialOK is set in ARGV[10], the take is reduced to however many tokens are
+// available.
+const leakyBucketTakeScript = `
+local take = tonumber(ARGV[4])
+local reserve = tonumber(ARGV[6])
+local quota = tonumber(ARGV[7])
+local partialOK = tonumber(ARGV[10]) == 1
+local taken = 0
+local quotaKey = companionKey(quota > 0)
+local quotaUsed = 0
+local success = 0
+local deniedByReserve = 0
+local deniedByQuota = 0
+
+if (quota > 0) then
+	quotaUsed = tonumber(redis.call("get", quotaKey) or "0")
+end
+
+if (not replayed and penaltyUntil == 0) then
+	if (partialOK) then
+		local available = tokens - reserve
+		if (quota > 0 and quota - quotaUsed < available) then
+			available = quota - quotaUsed
+		end
+		if (available > 0 and available < take) then
+			take = available -- take whatever is available, if nothing is, the take is denied as normal
+		end
+	end
+
+	if (quota > 0 and quotaUsed + take > quota) then
+		deniedByQuota = 1 -- the daily quota is exhausted, regardless of whether the bucket has tokens
+	elseif (tokens >= take) then
+		if (tokens - take >= reserve) then
+			tokens = tokens - take
+			taken = take
+			success = 1
+			if (quota > 0) then
+				quotaUsed = redis.call("incrby", quotaKey, take)
+				redis.call("pexpireat", quotaKey, ARGV[8])
+			end
+		else
+			deniedByReserve = 1 -- the tokens are available, but taking them would dip into the reserve
+		end
 	end
 end
 
-return {tokens, lastFilled}
+local quotaRemaining = 0
+if (quota > quotaUsed) then
+	quotaRemaining = quota - quotaUsed
+end
+`
+
+// leakyBucketPeakScript records the high-water mark when TrackPeak is set in ARGV[9], keeping it for the bucket's TTL in ARGV[5].
+const leakyBucketPeakScript = `
+local trackPeak = tonumber(ARGV[9])
+local used = capacity - tokens
+local peakTTL = tonumber(ARGV[5])
+` + peakRecordScript
+
+// leakyBucketAccruedScript measures the progress towards the next token, in units of capacity/window, so it's a whole token once it
+// reaches window.
+const leakyBucketAccruedScript = `
+local accrued = 0
+if (tokens < capacity) then
+	accrued = math.min((now - lastFilled) * capacity + remainder, window)
+end
+`
+
+// leakyBucketSetKeysScript writes the bucket's state to its three keys, which are kept for the TTL in ARGV[5].
+const leakyBucketSetKeysScript = `
+local ttl = tonumber(ARGV[5])
+redis.call("set", KEYS[1], tostring(tokens), "EX", ttl)
+redis.call("set", KEYS[2], tostring(lastFilled), "EX", ttl)
+redis.call("set", KEYS[3], tostring(remainder), "EX", ttl)
+`
+
+// leakyBucketSetHashScript writes the bucket's state to a single hash, used when LeakyBucketOptions.SingleKey is set.
+const leakyBucketSetHashScript = `
+local ttl = tonumber(ARGV[5])
+redis.call("hset", KEYS[1], "tokens", tostring(tokens), "last_fill", tostring(lastFilled), "remainder", tostring(remainder))
+redis.call("expire", KEYS[1], ttl)
+`
+
+// leakyBucketInspectWarmStartScript reads the tokens new buckets start with, and the fill look-back, for the inspect scripts.
+const leakyBucketInspectWarmStartScript = `
+local warmStart = tonumber(ARGV[4])
+local maxLookback = tonumber(ARGV[5])
 `
-	refillRate := getRefillRate(bucket.MaximumCapacity, bucket.WindowSeconds)
-	now := r.now().UTC().Unix()
 
-	resp, err := r.Adapter.Eval(ctx, script, []string{tokensKey(bucket.KeyPrefix), lastFillKey(bucket.KeyPrefix)}, []interface{}{bucket.MaximumCapacity, refillRate, now})
+// leakyBucketUseWarmStartScript reads the tokens new buckets start with, and the fill look-back, for the use scripts.
+const leakyBucketUseWarmStartScript = `
+local warmStart = tonumber(ARGV[11])
+local maxLookback = tonumber(ARGV[12])
+`
+
+// leakyBucketInspectScript fills the bucket and returns its state, without taking any tokens.
+var leakyBucketInspectScript = newScript(leakyBucketArgsScript + leakyBucketInspectWarmStartScript + leakyBucketGetKeysScript +
+	leakyBucketFillScript + leakyBucketAccruedScript + `
+return {tokens, lastFilled, accrued}
+`)
+
+// leakyBucketHashInspectScript is the equivalent of the Inspect script when LeakyBucketOptions.SingleKey is set.
+var leakyBucketHashInspectScript = newScript(leakyBucketArgsScript + leakyBucketInspectWarmStartScript + leakyBucketGetHashScript +
+	leakyBucketFillScript + leakyBucketAccruedScript + `
+return {tokens, lastFilled, accrued}
+`)
+
+// Inspect atomically inspects the leaky bucket and returns the capacity available. It does not take any tokens.
+func (r *LeakyBucketImpl) Inspect(ctx context.Context, bucket *LeakyBucketOptions) (*InspectLeakyBucketResponse, error) {
+	output, err := r.inspectAt(ctx, bucket, r.now())
+	if err != nil {
+		return nil, err
+	}
+
+	info := bucket.Describe()
+
+	resp := &InspectLeakyBucketResponse{
+		RemainingTokens: output.remaining,
+		ResetAt:         bucket.resetAt(output.lastFilled, output.remaining),
+		Limit:           info.Capacity,
+		Window:          info.Window,
+		RefillInterval:  info.RefillInterval,
+	}
+
+	if bucket.TrackPeak {
+		if resp.Peak, err = readPeak(ctx, r.Adapter, r.UseFunctions, r.Logger, bucket.KeyPrefix); err != nil {
+			return nil, err
+		}
+	}
+
+	return resp, nil
+}
+
+// WouldAllowAt projects whether takeAmount tokens could be taken from the bucket at the given time, assuming nothing else is taken
+// in the meantime. It does not take any tokens, nor write to Redis, which is useful for capacity planning, and for asserting how a
+// bucket will behave in tests without advancing a clock. Penalties and idempotency keys are not considered.
+func (r *LeakyBucketImpl) WouldAllowAt(ctx context.Context, bucket *LeakyBucketOptions, takeAmount int, at time.Time) (*WouldAllowResponse, error) {
+	output, err := r.inspectAt(ctx, bucket, at)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &WouldAllowResponse{Allowed: output.remaining-takeAmount >= bucket.MinimumReserve, Remaining: output.remaining}
+	if resp.Allowed {
+		resp.Remaining -= takeAmount
+	}
+	return resp, nil
+}
+
+// PreviewLeakyBucketResponse defines the response parameters for LeakyBucket.Preview()
+type PreviewLeakyBucketResponse struct {
+	// WouldSucceed is true when the tokens could be taken right now
+	WouldSucceed bool
+
+	// RemainingAfter is how many tokens would be left in the bucket after taking the tokens, or how many are left now when
+	// WouldSucceed is false
+	RemainingAfter int
+
+	// ResetAt is the time at which the bucket would be fully refilled after taking the tokens
+	ResetAt time.Time
+}
+
+// Preview atomically computes what taking takeAmount tokens from the bucket right now would result in, without taking them or
+// writing to Redis. Unlike Inspect, which returns the bucket's current state, this returns the state the bucket would be left in,
+// which is useful for showing callers the cost of an action before they confirm it. Penalties, idempotency keys and DailyQuota are
+// not considered.
+func (r *LeakyBucketImpl) Preview(ctx context.Context, bucket *LeakyBucketOptions, takeAmount int) (*PreviewLeakyBucketResponse, error) {
+	output, err := r.inspectAt(ctx, bucket, r.now())
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &PreviewLeakyBucketResponse{
+		WouldSucceed:   output.remaining-takeAmount >= bucket.MinimumReserve,
+		RemainingAfter: output.remaining,
+	}
+	if resp.WouldSucceed {
+		resp.RemainingAfter -= takeAmount
+	}
+	resp.ResetAt = bucket.resetAt(output.lastFilled, resp.RemainingAfter)
+
+	return resp, nil
+}
+
+// inspectAt fills the bucket as of now and returns its state, the inspect scripts never write to Redis.
+func (r *LeakyBucketImpl) inspectAt(ctx context.Context, bucket *LeakyBucketOptions, now time.Time) (*inspectLeakyBucketOutput, error) {
+	script := leakyBucketInspectScript
+	if bucket.SingleKey {
+		script = leakyBucketHashInspectScript
+	}
+
+	args := []interface{}{bucket.MaximumCapacity, bucket.WindowSeconds, now.UTC().Unix(), bucket.warmStartTokens(), bucket.maxFillLookbackSeconds()}
+	resp, err := r.eval(adapters.WithIdempotent(ctx), script, bucket.keys(), args)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query redis adapter: %w", err)
 	}
 
 	output, err := parseInspectLeakyBucketResponse(resp)
 	if err != nil {
-		return nil, fmt.Errorf("parsing redis response: %w", err)
+		logUnexpectedResponse(r.Logger, bucket.KeyPrefix, resp, err)
+		return nil, parsingError(script, err)
 	}
 
-	return &InspectLeakyBucketResponse{
-		RemainingTokens: output.remaining,
-		ResetAt:         calculateLeakyBucketFillTime(output.lastFilled, output.remaining, bucket.MaximumCapacity, bucket.WindowSeconds),
-	}, nil
+	return output, nil
 }
 
 // UseLeakyBucketResponse defines the response parameters for LeakyBucket.Use()
@@ -153,78 +515,230 @@ type UseLeakyBucketResponse struct {
 
 	// ResetAt is the time at which the bucket will be fully refilled
 	ResetAt time.Time
-}
 
-// Use atomically attempts to use the leaky bucket. Use takeAmount to set how many tokens should be attempted to be removed
-// from the bucket: they are atomic, either all tokens are taken, or the ratelimit is unsuccessful.
-func (r *LeakyBucketImpl) Use(ctx context.Context, bucket *LeakyBucketOptions, takeAmount int) (*UseLeakyBucketResponse, error) {
-	const script = `
-local tokensKey = KEYS[1]
-local lastFillKey = KEYS[2]
-local capacity = tonumber(ARGV[1])
-local rate = tonumber(ARGV[2])
-local now = tonumber(ARGV[3])
-local take = tonumber(ARGV[4])
-local windowSeconds = ARGV[5]
+	// PenaltyUntil is the time at which the caller's cool-down ends, when PenaltyThreshold has been reached. It is zero when the
+	// caller isn't cooling down.
+	PenaltyUntil time.Time
 
-local tokens = tonumber(redis.call("get", tokensKey))
-local lastFilled = tonumber(redis.call("get", lastFillKey))
+	// DeniedByReserve is true when the tokens were available, but the take was denied as it would have left fewer than
+	// MinimumReserve tokens in the bucket.
+	DeniedByReserve bool
 
-if (tokens == nil) then
-	tokens = 0 -- default empty buckets to 0
-end
+	// WouldHaveBeenLimited is true when DryRun is set and the take was denied, in which case Success is overridden to true.
+	WouldHaveBeenLimited bool
 
-if (tokens > capacity) then
-	tokens = capacity -- shrink buckets if the capacity is reduced
-end
+	// DeniedByQuota is true when the take was denied as it would have exceeded DailyQuota, regardless of whether the bucket had
+	// the tokens available.
+	DeniedByQuota bool
 
-if (lastFilled == nil) then
-	lastFilled = 0
-end
+	// QuotaRemaining defines how many more tokens may be taken today, when DailyQuota is set.
+	QuotaRemaining int
 
-if (tokens < capacity) then
-	local tokensToFill = math.floor((now - lastFilled) * rate)
-	if (tokensToFill > 0) then
-		tokens = math.min(capacity, tokens + tokensToFill)
-		lastFilled = now
-	end
-end
+	// RemainingTokensFloat is RemainingTokens plus the progress towards the next token, such as 0.9 when the next token is 90% of
+	// the way to being filled. This is a smoother signal than RemainingTokens, which is always rounded down to whole tokens.
+	RemainingTokensFloat float64
 
-local success = 0
+	// Taken is how many tokens were taken, which is takeAmount on success, unless PartialOK is set and fewer were available. It's 0
+	// when the take is denied, or when the request is a retry of one made with the same IdempotencyKey.
+	Taken int
+}
 
-if (tokens >= take) then
-	tokens = tokens - take
-	success = 1
-end
+// leakyBucketUseScript fills the bucket, and atomically takes the tokens if they are all available.
+var leakyBucketUseScript = newScript(leakyBucketArgsScript + leakyBucketUseWarmStartScript + leakyBucketGetKeysScript +
+	leakyBucketFillScript + companionKeyScript + penaltyCheckScript + idempotencyCheckScript + leakyBucketTakeScript + leakyBucketPeakScript +
+	idempotencyRecordScript + penaltyRecordScript + leakyBucketSetKeysScript + leakyBucketAccruedScript + `
+return {success, tokens, lastFilled, penaltyUntil, deniedByReserve, deniedByQuota, quotaRemaining, accrued, taken}
+`)
 
-redis.call("set", tokensKey, tostring(tokens), "EX", windowSeconds)
-redis.call("set", lastFillKey, tostring(lastFilled), "EX", windowSeconds)
+// leakyBucketHashUseScript is the equivalent of the Use script when LeakyBucketOptions.SingleKey is set.
+var leakyBucketHashUseScript = newScript(leakyBucketArgsScript + leakyBucketUseWarmStartScript + leakyBucketGetHashScript +
+	leakyBucketFillScript + companionKeyScript + penaltyCheckScript + idempotencyCheckScript + leakyBucketTakeScript + leakyBucketPeakScript +
+	idempotencyRecordScript + penaltyRecordScript + leakyBucketSetHashScript + leakyBucketAccruedScript + `
+return {success, tokens, lastFilled, penaltyUntil, deniedByReserve, deniedByQuota, quotaRemaining, accrued, taken}
+`)
 
-return {success, tokens, lastFilled}
-	`
+// Use atomically attempts to use the leaky bucket. Use takeAmount to set how many tokens should be attempted to be removed
+// from the bucket: they are atomic, either all tokens are taken, or the ratelimit is unsuccessful.
+//
+// If takeAmount is more than the bucket's MaximumCapacity, ErrTakeExceedsCapacity is returned without querying Redis, as the
+// take could never succeed, and if it's negative, ErrInvalidTakeAmount is returned, as it would add tokens rather than take them.
+//
+// If takeAmount is 0, Use behaves as an inspect: the bucket is filled, and its tokens and ResetAt are returned with Success set,
+// but nothing is written to Redis, as the fill is recomputed identically by the next call. As with WouldAllowAt, penalties,
+// quotas and idempotency keys are not considered, and OnDecision isn't called.
+func (r *LeakyBucketImpl) Use(ctx context.Context, bucket *LeakyBucketOptions, takeAmount int) (*UseLeakyBucketResponse, error) {
+	if takeAmount < 0 {
+		return nil, ErrInvalidTakeAmount
+	}
+	if takeAmount > bucket.MaximumCapacity {
+		return nil, ErrTakeExceedsCapacity
+	}
 
-	refillRate := getRefillRate(bucket.MaximumCapacity, bucket.WindowSeconds)
-	now := r.now().UTC().Unix()
+	if takeAmount == 0 {
+		return r.peek(ctx, bucket)
+	}
 
-	resp, err := r.Adapter.Eval(ctx, script, []string{tokensKey(bucket.KeyPrefix), lastFillKey(bucket.KeyPrefix)}, []interface{}{
-		bucket.MaximumCapacity, refillRate, now, takeAmount, bucket.WindowSeconds,
-	})
+	script := leakyBucketUseScript
+	if bucket.SingleKey {
+		script = leakyBucketHashUseScript
+	}
+
+	now := r.now()
+	args := append([]interface{}{
+		bucket.MaximumCapacity, bucket.WindowSeconds, now.UTC().Unix(), takeAmount, bucket.ttl(), bucket.MinimumReserve,
+		bucket.DailyQuota, quotaResetAt(now).UnixMilli(), boolArg(bucket.TrackPeak), boolArg(bucket.PartialOK), bucket.warmStartTokens(),
+		bucket.maxFillLookbackSeconds(), idempotencyArg(bucket.IdempotencyKey, bucket.IdempotencyTTL),
+	}, penaltyArgs(now, bucket.PenaltyThreshold, bucket.PenaltyDuration)...)
+
+	resp, err := r.eval(idempotentUse(ctx, bucket.IdempotencyKey), script, bucket.useKeys(), args)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query redis adapter: %w", err)
 	}
 
 	output, err := parseUseLeakyBucketResponse(resp)
 	if err != nil {
-		return nil, fmt.Errorf("parsing redis response: %w", err)
+		logUnexpectedResponse(r.Logger, bucket.KeyPrefix, resp, err)
+		return nil, parsingError(script, err)
 	}
 
+	emitDecision(r.OnDecision, DecisionEvent{
+		Key:        bucket.KeyPrefix,
+		Allowed:    output.success,
+		Remaining:  output.remaining,
+		TakeAmount: takeAmount,
+		DryRun:     bucket.DryRun,
+	})
+
 	return &UseLeakyBucketResponse{
-		Success:         output.success,
-		RemainingTokens: output.remaining,
-		ResetAt:         calculateLeakyBucketFillTime(output.lastFilled, output.remaining, bucket.MaximumCapacity, bucket.WindowSeconds),
+		Success:              output.success || bucket.DryRun,
+		RemainingTokens:      output.remaining,
+		ResetAt:              bucket.resetAt(output.lastFilled, output.remaining),
+		PenaltyUntil:         output.penaltyUntil,
+		DeniedByReserve:      output.deniedByReserve,
+		WouldHaveBeenLimited: bucket.DryRun && !output.success,
+		DeniedByQuota:        output.deniedByQuota,
+		QuotaRemaining:       output.quotaRemaining,
+		RemainingTokensFloat: remainingTokensFloat(output.remaining, output.accrued, bucket.MaximumCapacity, bucket.WindowSeconds),
+		Taken:                output.taken,
 	}, nil
 }
 
+// peek is Use with a takeAmount of 0, which fills the bucket without writing to Redis.
+func (r *LeakyBucketImpl) peek(ctx context.Context, bucket *LeakyBucketOptions) (*UseLeakyBucketResponse, error) {
+	output, err := r.inspectAt(ctx, bucket, r.now())
+	if err != nil {
+		return nil, err
+	}
+
+	return &UseLeakyBucketResponse{
+		Success:              true,
+		RemainingTokens:      output.remaining,
+		ResetAt:              bucket.resetAt(output.lastFilled, output.remaining),
+		RemainingTokensFloat: remainingTokensFloat(output.remaining, output.accrued, bucket.MaximumCapacity, bucket.WindowSeconds),
+	}, nil
+}
+
+// keys returns the keys the bucket's state is stored in.
+func (o *LeakyBucketOptions) keys() []string {
+	if c := o.compiledOptions(); c != nil {
+		// the slice is shared between calls, so cap it to stop callers appending into it
+		return c.stateKeys[:len(c.stateKeys):len(c.stateKeys)]
+	}
+	if o.SingleKey {
+		return []string{o.KeyPrefix}
+	}
+	return leakyBucketKeys(o.KeyPrefix)
+}
+
+// maxFillLookbackSeconds returns MaxFillLookback in whole seconds, rounded up, or 0 when it's disabled.
+func (o *LeakyBucketOptions) maxFillLookbackSeconds() int64 {
+	if o.MaxFillLookback <= 0 {
+		return 0
+	}
+	return int64((o.MaxFillLookback + time.Second - 1) / time.Second)
+}
+
+// warmStartTokens returns how many tokens a new bucket starts with, or -1 when it starts full.
+func (o *LeakyBucketOptions) warmStartTokens() int {
+	if c := o.compiledOptions(); c != nil {
+		return c.warmStartTokens
+	}
+	if o.StartEmpty {
+		return 0
+	}
+	if o.WarmStart <= 0 || o.WarmStart >= 1 {
+		return -1
+	}
+	return int(o.WarmStart * float64(o.MaximumCapacity))
+}
+
+// ttl returns how many seconds the bucket's keys are kept for, which is the window plus up to TTLJitterPercent of it.
+func (o *LeakyBucketOptions) ttl() int {
+	maxJitter := (o.WindowSeconds*o.TTLJitterPercent + 99) / 100
+	if maxJitter <= 0 {
+		return o.WindowSeconds
+	}
+	return o.WindowSeconds + rand.Intn(maxJitter+1)
+}
+
+func leakyBucketKeys(prefix string) []string {
+	return []string{tokensKey(prefix), lastFillKey(prefix), remainderKey(prefix)}
+}
+
+// leakyBucketPrimeScript sets the bucket's tokens, as if it had just been filled.
+var leakyBucketPrimeScript = newScript(leakyBucketArgsScript + `
+local tokens = tonumber(ARGV[4])
+local lastFilled = now
+local remainder = 0
+` + leakyBucketSetKeysScript + `
+return tokens
+`)
+
+// leakyBucketHashPrimeScript is the equivalent of the Prime script when LeakyBucketOptions.SingleKey is set.
+var leakyBucketHashPrimeScript = newScript(leakyBucketArgsScript + `
+local tokens = tonumber(ARGV[4])
+local lastFilled = now
+local remainder = 0
+` + leakyBucketSetHashScript + `
+return tokens
+`)
+
+// Prime sets the bucket to hold tokens, as if it had just been filled, which is useful for granting an initial allowance, such as
+// starting known clients with full buckets after a migration, or for putting a bucket into a specific state in tests.
+//
+// If tokens is less than 0 or more than the bucket's MaximumCapacity, ErrTokensOutOfRange is returned without querying Redis.
+func (r *LeakyBucketImpl) Prime(ctx context.Context, bucket *LeakyBucketOptions, tokens int) error {
+	if tokens < 0 || tokens > bucket.MaximumCapacity {
+		return ErrTokensOutOfRange
+	}
+
+	script := leakyBucketPrimeScript
+	if bucket.SingleKey {
+		script = leakyBucketHashPrimeScript
+	}
+
+	args := []interface{}{bucket.MaximumCapacity, bucket.WindowSeconds, r.now().UTC().Unix(), tokens, bucket.ttl()}
+	if _, err := r.eval(adapters.WithIdempotent(ctx), script, bucket.keys(), args); err != nil {
+		return fmt.Errorf("failed to query redis adapter: %w", err)
+	}
+
+	return nil
+}
+
+// UseKey is equivalent to Use, except the bucket's options are looked up from key using the OptionsResolver.
+func (r *LeakyBucketImpl) UseKey(ctx context.Context, key string, takeAmount int) (*UseLeakyBucketResponse, error) {
+	if r.OptionsResolver == nil {
+		return nil, ErrNoOptionsResolver
+	}
+
+	bucket, err := r.OptionsResolver(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("resolving options: %w", err)
+	}
+
+	return r.Use(ctx, bucket, takeAmount)
+}
+
 func tokensKey(prefix string) string {
 	return prefix + "::tokens"
 }
@@ -233,12 +747,24 @@ func lastFillKey(prefix string) string {
 	return prefix + "::last_fill"
 }
 
+func remainderKey(prefix string) string {
+	return prefix + "::remainder"
+}
+
+// remainingTokensFloat adds the progress towards the next token to tokens, accrued is measured in units of capacity/windowSeconds,
+// the bucket's fill rate.
+func remainingTokensFloat(tokens, accrued, capacity, windowSeconds int) float64 {
+	return math.Min(float64(capacity), float64(tokens)+float64(accrued)/float64(windowSeconds))
+}
+
 func calculateLeakyBucketFillTime(lastFillUnix, currentTokens, maxCapacity, windowSeconds int) time.Time {
+	return leakyBucketFillTime(lastFillUnix, currentTokens, maxCapacity, windowSeconds, getRefillRate(maxCapacity, windowSeconds))
+}
+
+// leakyBucketFillTime is calculateLeakyBucketFillTime with the bucket's refill rate, in tokens per second, already worked out.
+func leakyBucketFillTime(lastFillUnix, currentTokens, maxCapacity, windowSeconds int, rate float64) time.Time {
 	resetAt := lastFillUnix // if delta is 0 (thus, all tokens are filled), then the bucket is already reset
 	if delta := maxCapacity - currentTokens; delta > 0 {
-		// determine how many tokens we add per second, we'll need to use that to calculate how long it'll take us to fill back up to max
-		rate := getRefillRate(maxCapacity, windowSeconds)
-
 		// calculate how long many seconds it takes to fill at the token rate we have, but if the full window is smaller, use that, as the
 		// bucket must be full by the time the window hits.
 		secondsTillRefill := windowSeconds
@@ -257,9 +783,15 @@ func getRefillRate(maxCapacity, windowSeconds int) float64 {
 }
 
 type useLeakyBucketOutput struct {
-	success    bool
-	remaining  int
-	lastFilled int
+	success         bool
+	remaining       int
+	lastFilled      int
+	penaltyUntil    time.Time
+	deniedByReserve bool
+	deniedByQuota   bool
+	quotaRemaining  int
+	accrued         int
+	taken           int
 }
 
 func parseUseLeakyBucketResponse(v interface{}) (*useLeakyBucketOutput, error) {
@@ -268,20 +800,27 @@ func parseUseLeakyBucketResponse(v interface{}) (*useLeakyBucketOutput, error) {
 		return nil, err
 	}
 
-	if len(ints) != 3 {
-		return nil, fmt.Errorf("expected 3 args but got %d", len(ints))
+	if len(ints) != 9 {
+		return nil, fmt.Errorf("expected 9 args but got %d", len(ints))
 	}
 
 	return &useLeakyBucketOutput{
-		success:    ints[0] == 1,
-		remaining:  int(ints[1]),
-		lastFilled: int(ints[2]),
+		success:         ints[0] == 1,
+		remaining:       int(ints[1]),
+		lastFilled:      int(ints[2]),
+		penaltyUntil:    parsePenaltyUntil(ints[3]),
+		deniedByReserve: ints[4] == 1,
+		deniedByQuota:   ints[5] == 1,
+		quotaRemaining:  int(ints[6]),
+		accrued:         int(ints[7]),
+		taken:           int(ints[8]),
 	}, nil
 }
 
 type inspectLeakyBucketOutput struct {
 	remaining  int
 	lastFilled int
+	accrued    int
 }
 
 func parseInspectLeakyBucketResponse(v interface{}) (*inspectLeakyBucketOutput, error) {
@@ -290,12 +829,13 @@ func parseInspectLeakyBucketResponse(v interface{}) (*inspectLeakyBucketOutput,
 		return nil, err
 	}
 
-	if len(ints) != 2 {
-		return nil, fmt.Errorf("expected 2 args but got %d", len(ints))
+	if len(ints) != 3 {
+		return nil, fmt.Errorf("expected 3 args but got %d", len(ints))
 	}
 
 	return &inspectLeakyBucketOutput{
 		remaining:  int(ints[0]),
 		lastFilled: int(ints[1]),
+		accrued:    int(ints[2]),
 	}, nil
 }
@@ -0,0 +1,180 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrNoBuckets is returned when calling UseAny without any buckets.
+var ErrNoBuckets = errors.New("at least one bucket is required")
+
+// leakyBucketUseAnyScript fills every bucket, and takes the tokens from the least-loaded bucket that has them all available. Each
+// bucket's arguments are its capacity, window, whether it's stored in a single key, which is used to find its keys, its TTL, the
+// tokens it starts with if it's new, and its fill look-back.
+var leakyBucketUseAnyScript = newScript(`
+local now = tonumber(ARGV[1])
+local take = tonumber(ARGV[2])
+
+local function fill(capacity, window, warmStart, maxLookback, tokens, lastFilled, remainder)
+` + leakyBucketFillScript + `
+	return tokens, lastFilled, remainder
+end
+
+local buckets = {}
+local offset = 1
+for i = 3, #ARGV, 6 do
+	local bucket = {capacity = tonumber(ARGV[i]), window = tonumber(ARGV[i + 1]), singleKey = ARGV[i + 2] == "1", ttl = tonumber(ARGV[i + 3]), key = offset}
+	local warmStart = tonumber(ARGV[i + 4])
+	local maxLookback = tonumber(ARGV[i + 5])
+	local tokens, lastFilled, remainder
+	if (bucket.singleKey) then
+		local state = redis.call("hmget", KEYS[offset], "tokens", "last_fill", "remainder")
+		tokens, lastFilled, remainder = tonumber(state[1]), tonumber(state[2]), tonumber(state[3])
+		offset = offset + 1
+	else
+		tokens = tonumber(redis.call("get", KEYS[offset]))
+		lastFilled = tonumber(redis.call("get", KEYS[offset + 1]))
+		remainder = tonumber(redis.call("get", KEYS[offset + 2]))
+		offset = offset + 3
+	end
+	bucket.tokens, bucket.lastFilled, bucket.remainder = fill(bucket.capacity, bucket.window, warmStart, maxLookback, tokens, lastFilled, remainder)
+	table.insert(buckets, bucket)
+end
+
+-- a is less loaded than b when more of its capacity is available, ties go to the earlier bucket
+local function lessLoaded(a, b)
+	return a.tokens * b.capacity > b.tokens * a.capacity
+end
+
+local chosen = 0
+local best = 1
+for i, bucket in ipairs(buckets) do
+	if (bucket.tokens >= take and (chosen == 0 or lessLoaded(bucket, buckets[chosen]))) then
+		chosen = i
+	end
+	if (lessLoaded(bucket, buckets[best])) then
+		best = i
+	end
+end
+
+if (chosen == 0) then
+	-- nothing can satisfy the take, so report on the least-loaded bucket without changing anything
+	return {0, best, buckets[best].tokens, buckets[best].lastFilled}
+end
+
+local bucket = buckets[chosen]
+bucket.tokens = bucket.tokens - take
+
+if (bucket.singleKey) then
+	local key = KEYS[bucket.key]
+	redis.call("hset", key, "tokens", tostring(bucket.tokens), "last_fill", tostring(bucket.lastFilled), "remainder", tostring(bucket.remainder))
+	redis.call("expire", key, bucket.ttl)
+else
+	redis.call("set", KEYS[bucket.key], tostring(bucket.tokens), "EX", bucket.ttl)
+	redis.call("set", KEYS[bucket.key + 1], tostring(bucket.lastFilled), "EX", bucket.ttl)
+	redis.call("set", KEYS[bucket.key + 2], tostring(bucket.remainder), "EX", bucket.ttl)
+end
+
+return {1, chosen, bucket.tokens, bucket.lastFilled}
+`)
+
+// UseAny atomically attempts to take takeAmount tokens from any one of buckets, which is useful for spreading load across shards
+// or regions. Of the buckets with enough tokens available, the least-loaded is used, that is, the one with the highest proportion
+// of its capacity available. Ties go to the bucket that comes first.
+//
+// The index of the bucket the tokens were taken from is returned alongside its response. If no bucket has enough tokens available,
+// index is -1, and the response describes the least-loaded bucket. Buckets with a MaximumCapacity less than takeAmount are never
+// used, and if that's all of them, ErrTakeExceedsCapacity is returned without querying Redis. Penalties are not applied by UseAny.
+//
+// As every bucket is evaluated in a single script, when using Redis Cluster all of the buckets' keys must hash to the same slot,
+// for example by using a hash tag in each KeyPrefix.
+func (r *LeakyBucketImpl) UseAny(ctx context.Context, buckets []*LeakyBucketOptions, takeAmount int) (int, *UseLeakyBucketResponse, error) {
+	if len(buckets) == 0 {
+		return -1, nil, ErrNoBuckets
+	}
+
+	keys := []string{}
+	args := []interface{}{r.now().UTC().Unix(), takeAmount}
+	satisfiable := false
+
+	for _, bucket := range buckets {
+		if takeAmount <= bucket.MaximumCapacity {
+			satisfiable = true
+		}
+
+		singleKey := 0
+		if bucket.SingleKey {
+			singleKey = 1
+		}
+
+		keys = append(keys, bucket.keys()...)
+		args = append(args, bucket.MaximumCapacity, bucket.WindowSeconds, singleKey, bucket.ttl(), bucket.warmStartTokens(), bucket.maxFillLookbackSeconds())
+	}
+
+	if !satisfiable {
+		return -1, nil, ErrTakeExceedsCapacity
+	}
+
+	resp, err := r.eval(ctx, leakyBucketUseAnyScript, keys, args)
+	if err != nil {
+		return -1, nil, fmt.Errorf("failed to query redis adapter: %w", err)
+	}
+
+	output, err := parseUseAnyLeakyBucketResponse(resp, len(buckets))
+	if err != nil {
+		logUnexpectedResponse(r.Logger, buckets[0].KeyPrefix, resp, err)
+		return -1, nil, parsingError(leakyBucketUseAnyScript, err)
+	}
+
+	bucket := buckets[output.index]
+
+	emitDecision(r.OnDecision, DecisionEvent{
+		Key:        bucket.KeyPrefix,
+		Allowed:    output.success,
+		Remaining:  output.remaining,
+		TakeAmount: takeAmount,
+	})
+
+	index := output.index
+	if !output.success {
+		index = -1
+	}
+
+	return index, &UseLeakyBucketResponse{
+		Success:         output.success,
+		RemainingTokens: output.remaining,
+		ResetAt:         calculateLeakyBucketFillTime(output.lastFilled, output.remaining, bucket.MaximumCapacity, bucket.WindowSeconds),
+	}, nil
+}
+
+type useAnyLeakyBucketOutput struct {
+	useLeakyBucketOutput
+	index int
+}
+
+func parseUseAnyLeakyBucketResponse(v interface{}, buckets int) (*useAnyLeakyBucketOutput, error) {
+	ints, err := parseRedisInt64Slice(v)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ints) != 4 {
+		return nil, fmt.Errorf("expected 4 args but got %d", len(ints))
+	}
+
+	// lua is 1-indexed
+	index := int(ints[1]) - 1
+	if index < 0 || index >= buckets {
+		return nil, fmt.Errorf("bucket index %d out of range", index)
+	}
+
+	return &useAnyLeakyBucketOutput{
+		useLeakyBucketOutput: useLeakyBucketOutput{
+			success:    ints[0] == 1,
+			remaining:  int(ints[2]),
+			lastFilled: int(ints[3]),
+		},
+		index: index,
+	}, nil
+}
@@ -0,0 +1,133 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aidenwallis/go-ratelimiting/redis/adapters"
+	goredisadapter "github.com/aidenwallis/go-ratelimiting/redis/adapters/go-redis"
+	redigoadapter "github.com/aidenwallis/go-ratelimiting/redis/adapters/redigo"
+	"github.com/alicebob/miniredis/v2"
+	redigo "github.com/gomodule/redigo/redis"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUseAnyLeakyBucket(t *testing.T) {
+	testCases := map[string]func(*miniredis.Miniredis) adapters.Adapter{
+		"go-redis": func(t *miniredis.Miniredis) adapters.Adapter {
+			return goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: t.Addr()}))
+		},
+		"redigo": func(t *miniredis.Miniredis) adapters.Adapter {
+			conn, err := redigo.Dial("tcp", t.Addr())
+			if err != nil {
+				panic(err)
+			}
+			return redigoadapter.NewAdapter(conn)
+		},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Now().UTC()
+			mr := miniredis.RunT(t)
+			limiter := NewLeakyBucket(testCase(mr))
+			limiter.nowFunc = func() time.Time { return now }
+
+			buckets := []*LeakyBucketOptions{
+				{KeyPrefix: "{shards}:a", MaximumCapacity: 10, WindowSeconds: 10},
+				{KeyPrefix: "{shards}:b", MaximumCapacity: 4, WindowSeconds: 4, SingleKey: true},
+			}
+
+			expected := []struct {
+				take      int
+				index     int
+				remaining int
+			}{
+				{take: 2, index: 0, remaining: 8}, // both are full, so the tie goes to the first bucket
+				{take: 2, index: 1, remaining: 2}, // b is now less loaded
+				{take: 2, index: 0, remaining: 6},
+				{take: 5, index: 0, remaining: 1},  // only a has enough tokens
+				{take: 3, index: -1, remaining: 2}, // neither has enough, so b is described as the least-loaded
+			}
+
+			for i, e := range expected {
+				index, resp, err := limiter.UseAny(ctx, buckets, e.take)
+				assert.NoError(t, err)
+				assert.Equal(t, e.index, index, "use %d", i)
+				assert.Equal(t, e.index != -1, resp.Success, "use %d", i)
+				assert.Equal(t, e.remaining, resp.RemainingTokens, "use %d", i)
+			}
+
+			// the buckets should be stored in their usual layouts
+			{
+				resp, err := limiter.Inspect(ctx, buckets[0])
+				assert.NoError(t, err)
+				assert.Equal(t, 1, resp.RemainingTokens)
+			}
+
+			{
+				resp, err := limiter.Inspect(ctx, buckets[1])
+				assert.NoError(t, err)
+				assert.Equal(t, 2, resp.RemainingTokens)
+			}
+		})
+	}
+}
+
+func TestUseAnyLeakyBucket_Errors(t *testing.T) {
+	testCases := map[string]struct {
+		errorMessage string
+		mockAdapter  adapters.Adapter
+	}{
+		"redis error": {
+			errorMessage: "failed to query redis adapter: " + assert.AnError.Error(),
+			mockAdapter: &mockAdapter{
+				returnError: assert.AnError,
+			},
+		},
+		"parsing error": {
+			errorMessage: "parsing redis response from script " + scriptSHA(leakyBucketUseAnyScript) + ": expected 4 args but got 3",
+			mockAdapter: &mockAdapter{
+				returnValue: []interface{}{int64(1), int64(1), int64(3)},
+			},
+		},
+		"index out of range": {
+			errorMessage: "parsing redis response from script " + scriptSHA(leakyBucketUseAnyScript) + ": bucket index 1 out of range",
+			mockAdapter: &mockAdapter{
+				returnValue: []interface{}{int64(1), int64(2), int64(3), int64(0)},
+			},
+		},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			index, out, err := NewLeakyBucket(testCase.mockAdapter).UseAny(context.Background(), []*LeakyBucketOptions{leakyBucketOptions()}, 1)
+			assert.Equal(t, -1, index)
+			assert.Nil(t, out)
+			assert.EqualError(t, err, testCase.errorMessage)
+		})
+	}
+
+	t.Run("no buckets", func(t *testing.T) {
+		adapter := &mockAdapter{}
+		_, out, err := NewLeakyBucket(adapter).UseAny(context.Background(), nil, 1)
+		assert.Nil(t, out)
+		assert.ErrorIs(t, err, ErrNoBuckets)
+		assert.False(t, adapter.called, "redis should not be queried")
+	})
+
+	t.Run("exceeds every capacity", func(t *testing.T) {
+		adapter := &mockAdapter{}
+		_, out, err := NewLeakyBucket(adapter).UseAny(context.Background(), []*LeakyBucketOptions{leakyBucketOptions()}, 61)
+		assert.Nil(t, out)
+		assert.ErrorIs(t, err, ErrTakeExceedsCapacity)
+		assert.False(t, adapter.called, "redis should not be queried")
+	})
+}
@@ -0,0 +1,120 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+)
+
+// BucketRefund describes tokens to give back to a leaky bucket with RefundBatch.
+type BucketRefund struct {
+	// Bucket is the leaky bucket to give the tokens back to
+	Bucket *LeakyBucketOptions
+
+	// Amount is how many tokens to give back, amounts less than or equal to 0 leave the bucket's tokens unchanged
+	Amount int
+}
+
+// leakyBucketRefundBatchScript fills every bucket, and gives back the tokens refunded to it, never filling it beyond its capacity.
+// Each bucket's arguments are the same as for UseAny, followed by how many tokens to give back.
+var leakyBucketRefundBatchScript = newScript(`
+local now = tonumber(ARGV[1])
+
+local function fill(capacity, window, warmStart, maxLookback, tokens, lastFilled, remainder)
+` + leakyBucketFillScript + `
+	return tokens, lastFilled, remainder
+end
+
+local remaining = {}
+local offset = 1
+for i = 2, #ARGV, 7 do
+	local capacity, window, singleKey, ttl = tonumber(ARGV[i]), tonumber(ARGV[i + 1]), ARGV[i + 2] == "1", tonumber(ARGV[i + 3])
+	local warmStart, maxLookback, amount = tonumber(ARGV[i + 4]), tonumber(ARGV[i + 5]), tonumber(ARGV[i + 6])
+	local tokens, lastFilled, remainder
+	if (singleKey) then
+		local state = redis.call("hmget", KEYS[offset], "tokens", "last_fill", "remainder")
+		tokens, lastFilled, remainder = tonumber(state[1]), tonumber(state[2]), tonumber(state[3])
+	else
+		tokens = tonumber(redis.call("get", KEYS[offset]))
+		lastFilled = tonumber(redis.call("get", KEYS[offset + 1]))
+		remainder = tonumber(redis.call("get", KEYS[offset + 2]))
+	end
+	tokens, lastFilled, remainder = fill(capacity, window, warmStart, maxLookback, tokens, lastFilled, remainder)
+
+	if (amount > 0) then
+		tokens = math.min(capacity, tokens + amount)
+		if (tokens >= capacity) then
+			remainder = 0 -- full buckets can't carry partial tokens
+		end
+	end
+
+	if (singleKey) then
+		redis.call("hset", KEYS[offset], "tokens", tostring(tokens), "last_fill", tostring(lastFilled), "remainder", tostring(remainder))
+		redis.call("expire", KEYS[offset], ttl)
+		offset = offset + 1
+	else
+		redis.call("set", KEYS[offset], tostring(tokens), "EX", ttl)
+		redis.call("set", KEYS[offset + 1], tostring(lastFilled), "EX", ttl)
+		redis.call("set", KEYS[offset + 2], tostring(remainder), "EX", ttl)
+		offset = offset + 3
+	end
+
+	table.insert(remaining, tokens)
+end
+
+return remaining
+`)
+
+// RefundBatch atomically gives back tokens to several leaky buckets in a single round trip, which is useful to unwind the earlier
+// successful takes of a request when a later step fails, rather than making a round trip per bucket. Each bucket is filled as Use
+// would fill it first, and is never filled beyond its MaximumCapacity. It returns how many tokens each bucket holds afterwards, in
+// the same order as refunds. The same bucket may appear more than once, in which case its refunds are given back in order.
+//
+// As every bucket is refunded in a single script, when using Redis Cluster all of the buckets' keys must hash to the same slot,
+// for example by using a hash tag in each KeyPrefix.
+func (r *LeakyBucketImpl) RefundBatch(ctx context.Context, refunds []BucketRefund) ([]int, error) {
+	if len(refunds) == 0 {
+		return []int{}, nil
+	}
+
+	keys := []string{}
+	args := []interface{}{r.now().UTC().Unix()}
+
+	for _, refund := range refunds {
+		bucket := refund.Bucket
+		keys = append(keys, bucket.keys()...)
+		args = append(args,
+			bucket.MaximumCapacity, bucket.WindowSeconds, boolArg(bucket.SingleKey), bucket.ttl(), bucket.warmStartTokens(),
+			bucket.maxFillLookbackSeconds(), refund.Amount,
+		)
+	}
+
+	resp, err := r.eval(ctx, leakyBucketRefundBatchScript, keys, args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query redis adapter: %w", err)
+	}
+
+	remaining, err := parseRefundBatchResponse(resp, len(refunds))
+	if err != nil {
+		logUnexpectedResponse(r.Logger, refunds[0].Bucket.KeyPrefix, resp, err)
+		return nil, parsingError(leakyBucketRefundBatchScript, err)
+	}
+
+	return remaining, nil
+}
+
+func parseRefundBatchResponse(v interface{}, buckets int) ([]int, error) {
+	ints, err := parseRedisInt64Slice(v)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ints) != buckets {
+		return nil, fmt.Errorf("expected %d args but got %d", buckets, len(ints))
+	}
+
+	remaining := make([]int, len(ints))
+	for i, tokens := range ints {
+		remaining[i] = int(tokens)
+	}
+	return remaining, nil
+}
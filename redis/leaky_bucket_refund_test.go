@@ -0,0 +1,107 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aidenwallis/go-ratelimiting/redis/adapters"
+	goredisadapter "github.com/aidenwallis/go-ratelimiting/redis/adapters/go-redis"
+	redigoadapter "github.com/aidenwallis/go-ratelimiting/redis/adapters/redigo"
+	"github.com/alicebob/miniredis/v2"
+	redigo "github.com/gomodule/redigo/redis"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRefundBatchLeakyBucket(t *testing.T) {
+	testCases := map[string]func(*miniredis.Miniredis) adapters.Adapter{
+		"go-redis": func(t *miniredis.Miniredis) adapters.Adapter {
+			return goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: t.Addr()}))
+		},
+		"redigo": func(t *miniredis.Miniredis) adapters.Adapter {
+			conn, err := redigo.Dial("tcp", t.Addr())
+			if err != nil {
+				panic(err)
+			}
+			return redigoadapter.NewAdapter(conn)
+		},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Now().UTC()
+			mr := miniredis.RunT(t)
+			limiter := NewLeakyBucket(testCase(mr))
+			limiter.nowFunc = func() time.Time { return now }
+
+			a := &LeakyBucketOptions{KeyPrefix: "{user}:a", MaximumCapacity: 10, WindowSeconds: 10}
+			b := &LeakyBucketOptions{KeyPrefix: "{user}:b", MaximumCapacity: 4, WindowSeconds: 4, SingleKey: true}
+
+			for _, bucket := range []*LeakyBucketOptions{a, b} {
+				resp, err := limiter.Use(ctx, bucket, 3)
+				assert.NoError(t, err)
+				assert.True(t, resp.Success)
+			}
+
+			remaining, err := limiter.RefundBatch(ctx, []BucketRefund{
+				{Bucket: a, Amount: 2},
+				{Bucket: b, Amount: 10}, // refunds never fill beyond the bucket's capacity
+				{Bucket: a, Amount: 0},
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, []int{9, 4, 9}, remaining)
+
+			// the buckets should be stored in their usual layouts
+			for bucket, expected := range map[*LeakyBucketOptions]int{a: 9, b: 4} {
+				resp, err := limiter.Inspect(ctx, bucket)
+				assert.NoError(t, err)
+				assert.Equal(t, expected, resp.RemainingTokens, bucket.KeyPrefix)
+			}
+			assert.Equal(t, time.Duration(a.WindowSeconds)*time.Second, mr.TTL(tokensKey(a.KeyPrefix)))
+			assert.Equal(t, time.Duration(b.WindowSeconds)*time.Second, mr.TTL(b.KeyPrefix))
+		})
+	}
+}
+
+func TestRefundBatchLeakyBucket_Errors(t *testing.T) {
+	testCases := map[string]struct {
+		errorMessage string
+		mockAdapter  adapters.Adapter
+	}{
+		"redis error": {
+			errorMessage: "failed to query redis adapter: " + assert.AnError.Error(),
+			mockAdapter: &mockAdapter{
+				returnError: assert.AnError,
+			},
+		},
+		"parsing error": {
+			errorMessage: "parsing redis response from script " + scriptSHA(leakyBucketRefundBatchScript) + ": expected 1 args but got 2",
+			mockAdapter: &mockAdapter{
+				returnValue: []interface{}{int64(1), int64(2)},
+			},
+		},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			refunds := []BucketRefund{{Bucket: leakyBucketOptions(), Amount: 1}}
+			remaining, err := NewLeakyBucket(testCase.mockAdapter).RefundBatch(context.Background(), refunds)
+			assert.Nil(t, remaining)
+			assert.EqualError(t, err, testCase.errorMessage)
+		})
+	}
+
+	t.Run("no refunds", func(t *testing.T) {
+		adapter := &mockAdapter{}
+		remaining, err := NewLeakyBucket(adapter).RefundBatch(context.Background(), nil)
+		assert.NoError(t, err)
+		assert.Empty(t, remaining)
+		assert.False(t, adapter.called, "redis should not be queried")
+	})
+}
@@ -2,9 +2,11 @@ package redis
 
 import (
 	"context"
+	"fmt"
 	"testing"
 	"time"
 
+	"github.com/aidenwallis/go-ratelimiting/local"
 	"github.com/aidenwallis/go-ratelimiting/redis/adapters"
 	goredisadapter "github.com/aidenwallis/go-ratelimiting/redis/adapters/go-redis"
 	redigoadapter "github.com/aidenwallis/go-ratelimiting/redis/adapters/redigo"
@@ -42,6 +44,9 @@ func TestInspectLeakyBucket(t *testing.T) {
 				assert.NoError(t, err)
 				assert.Equal(t, leakyBucketOptions().MaximumCapacity, resp.RemainingTokens)
 				assert.Equal(t, now.Unix(), resp.ResetAt.Unix())
+				assert.Equal(t, leakyBucketOptions().MaximumCapacity, resp.Limit)
+				assert.Equal(t, time.Minute, resp.Window)
+				assert.Equal(t, time.Second, resp.RefillInterval)
 			}
 
 			{
@@ -73,7 +78,7 @@ func TestInspectLeakyBucket_Errors(t *testing.T) {
 			},
 		},
 		"parsing error": {
-			errorMessage: "parsing redis response: expected []interface{} but got string",
+			errorMessage: "parsing redis response from script " + scriptSHA(leakyBucketInspectScript) + ": expected []interface{} but got string",
 			mockAdapter: &mockAdapter{
 				returnValue: "foo",
 			},
@@ -141,6 +146,620 @@ func TestUseLeakyBucket(t *testing.T) {
 	}
 }
 
+func TestUseLeakyBucket_SingleKey(t *testing.T) {
+	testCases := map[string]func(*miniredis.Miniredis) adapters.Adapter{
+		"go-redis": func(t *miniredis.Miniredis) adapters.Adapter {
+			return goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: t.Addr()}))
+		},
+		"redigo": func(t *miniredis.Miniredis) adapters.Adapter {
+			conn, err := redigo.Dial("tcp", t.Addr())
+			if err != nil {
+				panic(err)
+			}
+			return redigoadapter.NewAdapter(conn)
+		},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Now().UTC()
+			mr := miniredis.RunT(t)
+			limiter := NewLeakyBucket(testCase(mr))
+			limiter.nowFunc = func() time.Time { return now }
+
+			opts := leakyBucketOptions()
+			opts.SingleKey = true
+
+			{
+				resp, err := limiter.Use(ctx, opts, 2)
+				assert.NoError(t, err)
+				assert.True(t, resp.Success)
+				assert.Equal(t, opts.MaximumCapacity-2, resp.RemainingTokens)
+			}
+
+			assert.Equal(t, []string{opts.KeyPrefix}, mr.Keys(), "the bucket should be stored in a single key")
+			fields, err := mr.HKeys(opts.KeyPrefix)
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"last_fill", "remainder", "tokens"}, fields)
+			assert.Equal(t, time.Duration(opts.WindowSeconds)*time.Second, mr.TTL(opts.KeyPrefix))
+
+			// move forward 1 second, one token should be filled
+			limiter.nowFunc = func() time.Time { return now.Add(time.Second) }
+
+			{
+				resp, err := limiter.Inspect(ctx, opts)
+				assert.NoError(t, err)
+				assert.Equal(t, opts.MaximumCapacity-1, resp.RemainingTokens)
+				assert.Equal(t, now.Add(time.Second*2).Unix(), resp.ResetAt.Unix())
+			}
+		})
+	}
+}
+
+func TestUseLeakyBucket_NoFillDrift(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+	limiter := NewLeakyBucket(goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: miniredis.RunT(t).Addr()})))
+	limiter.nowFunc = func() time.Time { return now }
+
+	// 90 tokens every 60 seconds fills at 1.5 tokens per second, which can't be filled in whole tokens every second
+	opts := &LeakyBucketOptions{
+		KeyPrefix:       "test-bucket",
+		MaximumCapacity: 90,
+		WindowSeconds:   60,
+	}
+
+	// drain the bucket
+	resp, err := limiter.Use(ctx, opts, opts.MaximumCapacity)
+	assert.NoError(t, err)
+	assert.True(t, resp.Success)
+
+	taken := 0
+	for i := 1; i <= 120; i++ {
+		current := now.Add(time.Second * time.Duration(i))
+		limiter.nowFunc = func() time.Time { return current }
+
+		for {
+			resp, err := limiter.Use(ctx, opts, 1)
+			assert.NoError(t, err)
+			if !resp.Success {
+				break
+			}
+			taken++
+		}
+	}
+
+	// over 120 seconds at 1.5 tokens per second, exactly 180 tokens should have been filled
+	assert.Equal(t, 180, taken)
+}
+
+func TestUseLeakyBucket_RemainingTokensFloat(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+	limiter := NewLeakyBucket(goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: miniredis.RunT(t).Addr()})))
+	limiter.nowFunc = func() time.Time { return now }
+
+	opts := &LeakyBucketOptions{KeyPrefix: "test-bucket", MaximumCapacity: 10, WindowSeconds: 60}
+
+	resp, err := limiter.Use(ctx, opts, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(0), resp.RemainingTokensFloat)
+
+	// a token fills every 6 seconds, so the next is half way there
+	limiter.nowFunc = func() time.Time { return now.Add(time.Second * 3) }
+
+	resp, err = limiter.Use(ctx, opts, 1)
+	assert.NoError(t, err)
+	assert.False(t, resp.Success)
+	assert.Equal(t, 0, resp.RemainingTokens)
+	assert.Equal(t, 0.5, resp.RemainingTokensFloat)
+
+	limiter.nowFunc = func() time.Time { return now.Add(time.Second * 10) }
+
+	resp, err = limiter.Use(ctx, opts, 1)
+	assert.NoError(t, err)
+	assert.True(t, resp.Success)
+	assert.Equal(t, 0, resp.RemainingTokens)
+	assert.InDelta(t, 2.0/3, resp.RemainingTokensFloat, 0.0001)
+
+	assert.Equal(t, float64(10), remainingTokensFloat(10, 60, 10, 60), "full buckets can't accrue")
+}
+
+func TestUseLeakyBucket_PartialOK(t *testing.T) {
+	testCases := map[string]func(*miniredis.Miniredis) adapters.Adapter{
+		"go-redis": func(t *miniredis.Miniredis) adapters.Adapter {
+			return goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: t.Addr()}))
+		},
+		"redigo": func(t *miniredis.Miniredis) adapters.Adapter {
+			conn, err := redigo.Dial("tcp", t.Addr())
+			if err != nil {
+				panic(err)
+			}
+			return redigoadapter.NewAdapter(conn)
+		},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Now().UTC()
+			limiter := NewLeakyBucket(testCase(miniredis.RunT(t)))
+			limiter.nowFunc = func() time.Time { return now }
+
+			opts := leakyBucketOptions()
+			opts.MinimumReserve = 5
+
+			resp, err := limiter.Use(ctx, opts, 50)
+			assert.NoError(t, err)
+			assert.True(t, resp.Success)
+			assert.Equal(t, 50, resp.Taken)
+
+			// all-or-nothing by default
+			resp, err = limiter.Use(ctx, opts, 10)
+			assert.NoError(t, err)
+			assert.False(t, resp.Success)
+			assert.Equal(t, 0, resp.Taken)
+			assert.Equal(t, 10, resp.RemainingTokens)
+
+			opts.PartialOK = true
+
+			resp, err = limiter.Use(ctx, opts, 10)
+			assert.NoError(t, err)
+			assert.True(t, resp.Success)
+			assert.Equal(t, 5, resp.Taken, "the reserve should still be kept")
+			assert.Equal(t, 5, resp.RemainingTokens)
+
+			resp, err = limiter.Use(ctx, opts, 10)
+			assert.NoError(t, err)
+			assert.False(t, resp.Success)
+			assert.Equal(t, 0, resp.Taken)
+		})
+	}
+}
+
+func TestUseLeakyBucket_MaxFillLookback(t *testing.T) {
+	for _, singleKey := range []bool{false, true} {
+		singleKey := singleKey
+
+		t.Run(fmt.Sprintf("single key %t", singleKey), func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Now().UTC().Truncate(time.Second)
+			mr := miniredis.RunT(t)
+			limiter := NewLeakyBucket(goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: mr.Addr()})))
+			limiter.nowFunc = func() time.Time { return now }
+
+			opts := leakyBucketOptions()
+			opts.SingleKey = singleKey
+			opts.MaxFillLookback = 5 * time.Second
+
+			// new buckets still start full
+			inspect, err := limiter.Inspect(ctx, opts)
+			assert.NoError(t, err)
+			assert.Equal(t, 60, inspect.RemainingTokens)
+
+			resp, err := limiter.Use(ctx, opts, 60)
+			assert.NoError(t, err)
+			assert.True(t, resp.Success)
+
+			// the bucket has been idle for 30 seconds, but only fills for 5 of them
+			now = now.Add(30 * time.Second)
+			inspect, err = limiter.Inspect(ctx, opts)
+			assert.NoError(t, err)
+			assert.Equal(t, 5, inspect.RemainingTokens)
+
+			index, resp, err := limiter.UseAny(ctx, []*LeakyBucketOptions{opts}, 1)
+			assert.NoError(t, err)
+			assert.Equal(t, 0, index)
+			assert.Equal(t, 4, resp.RemainingTokens)
+
+			resp, err = limiter.Use(ctx, opts, 1)
+			assert.NoError(t, err)
+			assert.Equal(t, 3, resp.RemainingTokens)
+
+			// from then on the bucket fills as usual
+			now = now.Add(2 * time.Second)
+			resp, err = limiter.Use(ctx, opts, 1)
+			assert.NoError(t, err)
+			assert.Equal(t, 4, resp.RemainingTokens)
+		})
+	}
+}
+
+func TestUseLeakyBucket_WarmStart(t *testing.T) {
+	testCases := map[string]func(*miniredis.Miniredis) adapters.Adapter{
+		"go-redis": func(t *miniredis.Miniredis) adapters.Adapter {
+			return goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: t.Addr()}))
+		},
+		"redigo": func(t *miniredis.Miniredis) adapters.Adapter {
+			conn, err := redigo.Dial("tcp", t.Addr())
+			if err != nil {
+				panic(err)
+			}
+			return redigoadapter.NewAdapter(conn)
+		},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+
+		for _, singleKey := range []bool{false, true} {
+			singleKey := singleKey
+
+			t.Run(fmt.Sprintf("%s single key %t", name, singleKey), func(t *testing.T) {
+				ctx := context.Background()
+				now := time.Now().UTC().Truncate(time.Second)
+				limiter := NewLeakyBucket(testCase(miniredis.RunT(t)))
+				limiter.nowFunc = func() time.Time { return now }
+
+				opts := leakyBucketOptions()
+				opts.SingleKey = singleKey
+				opts.WarmStart = 0.5
+
+				inspect, err := limiter.Inspect(ctx, opts)
+				assert.NoError(t, err)
+				assert.Equal(t, 30, inspect.RemainingTokens)
+
+				resp, err := limiter.Use(ctx, opts, 1)
+				assert.NoError(t, err)
+				assert.True(t, resp.Success)
+				assert.Equal(t, 29, resp.RemainingTokens)
+
+				// from then on the bucket fills as usual
+				now = now.Add(2 * time.Second)
+				resp, err = limiter.Use(ctx, opts, 1)
+				assert.NoError(t, err)
+				assert.Equal(t, 30, resp.RemainingTokens)
+
+				// existing buckets aren't affected
+				existing := leakyBucketOptions()
+				existing.KeyPrefix = "existing-bucket"
+				existing.SingleKey = singleKey
+				_, err = limiter.Use(ctx, existing, 10)
+				assert.NoError(t, err)
+
+				existing.WarmStart = 0.5
+				resp, err = limiter.Use(ctx, existing, 10)
+				assert.NoError(t, err)
+				assert.Equal(t, 40, resp.RemainingTokens)
+
+				// UseAny starts new buckets warm too
+				other := leakyBucketOptions()
+				other.KeyPrefix = "other-bucket"
+				other.SingleKey = singleKey
+				other.WarmStart = 0.25
+				_, resp, err = limiter.UseAny(ctx, []*LeakyBucketOptions{other}, 1)
+				assert.NoError(t, err)
+				assert.Equal(t, 14, resp.RemainingTokens)
+			})
+		}
+	}
+}
+
+func TestUseLeakyBucket_ZeroTake(t *testing.T) {
+	testCases := map[string]func(*miniredis.Miniredis) adapters.Adapter{
+		"go-redis": func(t *miniredis.Miniredis) adapters.Adapter {
+			return goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: t.Addr()}))
+		},
+		"redigo": func(t *miniredis.Miniredis) adapters.Adapter {
+			conn, err := redigo.Dial("tcp", t.Addr())
+			if err != nil {
+				panic(err)
+			}
+			return redigoadapter.NewAdapter(conn)
+		},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Now().UTC().Truncate(time.Second)
+			mr := miniredis.RunT(t)
+			limiter := NewLeakyBucket(testCase(mr))
+			limiter.nowFunc = func() time.Time { return now }
+			limiter.OnDecision = func(DecisionEvent) { t.Error("zero takes shouldn't emit decisions") }
+
+			opts := leakyBucketOptions()
+			opts.MinimumReserve = 55
+
+			// peeking at a missing bucket doesn't create it
+			resp, err := limiter.Use(ctx, opts, 0)
+			assert.NoError(t, err)
+			assert.True(t, resp.Success)
+			assert.Equal(t, 60, resp.RemainingTokens)
+			assert.Empty(t, mr.Keys())
+
+			limiter.OnDecision = nil
+			_, err = limiter.Use(ctx, opts, 5)
+			assert.NoError(t, err)
+			limiter.OnDecision = func(DecisionEvent) { t.Error("zero takes shouldn't emit decisions") }
+
+			now = now.Add(3 * time.Second)
+
+			// the bucket is filled, but the fill isn't written back, and the reserve doesn't deny a peek
+			resp, err = limiter.Use(ctx, opts, 0)
+			assert.NoError(t, err)
+			assert.True(t, resp.Success)
+			assert.Equal(t, 0, resp.Taken)
+			assert.Equal(t, 58, resp.RemainingTokens)
+			assert.Equal(t, 58.0, resp.RemainingTokensFloat)
+			tokens, err := mr.Get(tokensKey(opts.KeyPrefix))
+			assert.NoError(t, err)
+			assert.Equal(t, "55", tokens)
+		})
+	}
+}
+
+func TestWouldAllowAtLeakyBucket(t *testing.T) {
+	testCases := map[string]func(*miniredis.Miniredis) adapters.Adapter{
+		"go-redis": func(t *miniredis.Miniredis) adapters.Adapter {
+			return goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: t.Addr()}))
+		},
+		"redigo": func(t *miniredis.Miniredis) adapters.Adapter {
+			conn, err := redigo.Dial("tcp", t.Addr())
+			if err != nil {
+				panic(err)
+			}
+			return redigoadapter.NewAdapter(conn)
+		},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Now().UTC()
+			mr := miniredis.RunT(t)
+			limiter := NewLeakyBucket(testCase(mr))
+			limiter.nowFunc = func() time.Time { return now }
+
+			opts := leakyBucketOptions()
+			_, err := limiter.Use(ctx, opts, opts.MaximumCapacity)
+			assert.NoError(t, err)
+			tokens, err := mr.Get(tokensKey(opts.KeyPrefix))
+			assert.NoError(t, err)
+
+			{
+				resp, err := limiter.WouldAllowAt(ctx, opts, 1, now)
+				assert.NoError(t, err)
+				assert.Equal(t, &WouldAllowResponse{Allowed: false, Remaining: 0}, resp)
+			}
+
+			{
+				// the bucket fills a token a second
+				resp, err := limiter.WouldAllowAt(ctx, opts, 3, now.Add(time.Second*5))
+				assert.NoError(t, err)
+				assert.Equal(t, &WouldAllowResponse{Allowed: true, Remaining: 2}, resp)
+			}
+
+			after, err := mr.Get(tokensKey(opts.KeyPrefix))
+			assert.NoError(t, err)
+			assert.Equal(t, tokens, after, "projecting shouldn't write to the bucket")
+		})
+	}
+}
+
+func TestPreviewLeakyBucket(t *testing.T) {
+	testCases := map[string]func(*LeakyBucketOptions){
+		"keys":       func(*LeakyBucketOptions) {},
+		"single key": func(o *LeakyBucketOptions) { o.SingleKey = true },
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Now().UTC()
+			mr := miniredis.RunT(t)
+			limiter := NewLeakyBucket(goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: mr.Addr()})))
+			limiter.nowFunc = func() time.Time { return now }
+
+			opts := leakyBucketOptions()
+			testCase(opts)
+			_, err := limiter.Use(ctx, opts, opts.MaximumCapacity)
+			assert.NoError(t, err)
+
+			{
+				resp, err := limiter.Preview(ctx, opts, 1)
+				assert.NoError(t, err)
+				assert.False(t, resp.WouldSucceed)
+				assert.Equal(t, 0, resp.RemainingAfter)
+			}
+
+			// the bucket fills a token a second
+			now = now.Add(time.Second * 5)
+			keys := mr.Keys()
+			preview, err := limiter.Preview(ctx, opts, 3)
+			assert.NoError(t, err)
+			assert.True(t, preview.WouldSucceed)
+			assert.Equal(t, 2, preview.RemainingAfter)
+			assert.Equal(t, keys, mr.Keys())
+
+			// previewing doesn't take the tokens, and matches the result of taking them
+			use, err := limiter.Use(ctx, opts, 3)
+			assert.NoError(t, err)
+			assert.True(t, use.Success)
+			assert.Equal(t, preview.RemainingAfter, use.RemainingTokens)
+			assert.Equal(t, preview.ResetAt, use.ResetAt)
+		})
+	}
+}
+
+func TestPreviewLeakyBucket_Reserve(t *testing.T) {
+	ctx := context.Background()
+	limiter := NewLeakyBucket(goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: miniredis.RunT(t).Addr()})))
+
+	opts := leakyBucketOptions()
+	opts.MinimumReserve = opts.MaximumCapacity - 1
+
+	resp, err := limiter.Preview(ctx, opts, 2)
+	assert.NoError(t, err)
+	assert.False(t, resp.WouldSucceed)
+	assert.Equal(t, opts.MaximumCapacity, resp.RemainingAfter)
+}
+
+func TestUseLeakyBucket_TTLJitter(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	limiter := NewLeakyBucket(goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: mr.Addr()})))
+
+	ttls := map[time.Duration]bool{}
+	for i := 0; i < 50; i++ {
+		opts := leakyBucketOptions()
+		opts.KeyPrefix = fmt.Sprintf("bucket-%d", i)
+		opts.TTLJitterPercent = 10
+
+		_, err := limiter.Use(ctx, opts, 1)
+		assert.NoError(t, err)
+
+		ttl := mr.TTL(tokensKey(opts.KeyPrefix))
+		assert.Equal(t, ttl, mr.TTL(lastFillKey(opts.KeyPrefix)), "a bucket's keys should expire together")
+		assert.True(t, ttl >= time.Minute && ttl <= time.Minute+time.Second*6, "ttl %s should be within 10%% of the window", ttl)
+		ttls[ttl] = true
+	}
+
+	assert.Greater(t, len(ttls), 1, "expiries should be spread out")
+}
+
+func TestUseLeakyBucket_MinimumReserve(t *testing.T) {
+	testCases := map[string]bool{
+		"separate keys": false,
+		"single key":    true,
+	}
+
+	for name, singleKey := range testCases {
+		singleKey := singleKey
+
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Now().UTC()
+			mr := miniredis.RunT(t)
+			limiter := NewLeakyBucket(goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: mr.Addr()})))
+			limiter.nowFunc = func() time.Time { return now }
+
+			opts := leakyBucketOptions()
+			opts.SingleKey = singleKey
+			opts.MinimumReserve = 10
+
+			{
+				resp, err := limiter.Use(ctx, opts, 50)
+				assert.NoError(t, err)
+				assert.True(t, resp.Success)
+				assert.False(t, resp.DeniedByReserve)
+				assert.Equal(t, 10, resp.RemainingTokens)
+			}
+
+			{
+				resp, err := limiter.Use(ctx, opts, 1)
+				assert.NoError(t, err)
+				assert.False(t, resp.Success)
+				assert.True(t, resp.DeniedByReserve)
+				assert.Equal(t, 10, resp.RemainingTokens)
+			}
+
+			{
+				// high-priority traffic without a reserve can still drain the bucket
+				priority := *opts
+				priority.MinimumReserve = 0
+				resp, err := limiter.Use(ctx, &priority, 10)
+				assert.NoError(t, err)
+				assert.True(t, resp.Success)
+				assert.Equal(t, 0, resp.RemainingTokens)
+			}
+
+			{
+				// genuine exhaustion isn't attributed to the reserve
+				resp, err := limiter.Use(ctx, opts, 1)
+				assert.NoError(t, err)
+				assert.False(t, resp.Success)
+				assert.False(t, resp.DeniedByReserve)
+			}
+		})
+	}
+}
+
+func TestUseLeakyBucket_DailyQuota(t *testing.T) {
+	testCases := map[string]bool{
+		"separate keys": false,
+		"single key":    true,
+	}
+
+	for name, singleKey := range testCases {
+		singleKey := singleKey
+
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Date(2023, 6, 1, 18, 0, 0, 0, time.UTC)
+			mr := miniredis.RunT(t)
+			mr.SetTime(now)
+			limiter := NewLeakyBucket(goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: mr.Addr()})))
+			limiter.nowFunc = func() time.Time { return now }
+
+			opts := leakyBucketOptions()
+			opts.SingleKey = singleKey
+			opts.DailyQuota = 3
+
+			{
+				resp, err := limiter.Use(ctx, opts, 2)
+				assert.NoError(t, err)
+				assert.True(t, resp.Success)
+				assert.Equal(t, 1, resp.QuotaRemaining)
+				assert.Equal(t, time.Hour*6, mr.TTL(dailyQuotaKey(opts.KeyPrefix)), "the quota should reset at midnight")
+			}
+
+			{
+				resp, err := limiter.Use(ctx, opts, 2)
+				assert.NoError(t, err)
+				assert.False(t, resp.Success)
+				assert.True(t, resp.DeniedByQuota)
+				assert.Equal(t, 58, resp.RemainingTokens, "tokens shouldn't be taken when the quota denies")
+				assert.Equal(t, 1, resp.QuotaRemaining)
+			}
+
+			{
+				resp, err := limiter.Use(ctx, opts, 1)
+				assert.NoError(t, err)
+				assert.True(t, resp.Success)
+				assert.Equal(t, 0, resp.QuotaRemaining)
+			}
+
+			{
+				// the bucket still has tokens, but the quota is exhausted
+				resp, err := limiter.Use(ctx, opts, 1)
+				assert.NoError(t, err)
+				assert.False(t, resp.Success)
+				assert.True(t, resp.DeniedByQuota)
+			}
+		})
+	}
+
+	t.Run("rate denials aren't attributed to the quota", func(t *testing.T) {
+		ctx := context.Background()
+		mr := miniredis.RunT(t)
+		limiter := NewLeakyBucket(goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: mr.Addr()})))
+
+		opts := leakyBucketOptions()
+		opts.DailyQuota = 1000
+
+		_, err := limiter.Use(ctx, opts, 60)
+		assert.NoError(t, err)
+
+		resp, err := limiter.Use(ctx, opts, 1)
+		assert.NoError(t, err)
+		assert.False(t, resp.Success)
+		assert.False(t, resp.DeniedByQuota)
+		assert.Equal(t, 940, resp.QuotaRemaining)
+	})
+}
+
 func TestLeakyBucket_Now(t *testing.T) {
 	adapter := NewLeakyBucket(nil)
 	adapter.nowFunc = nil
@@ -159,7 +778,7 @@ func TestUseLeakyBucket_Errors(t *testing.T) {
 			},
 		},
 		"parsing error": {
-			errorMessage: "parsing redis response: expected []interface{} but got string",
+			errorMessage: "parsing redis response from script " + scriptSHA(leakyBucketUseScript) + ": expected []interface{} but got string",
 			mockAdapter: &mockAdapter{
 				returnValue: "foo",
 			},
@@ -177,6 +796,130 @@ func TestUseLeakyBucket_Errors(t *testing.T) {
 	}
 }
 
+func TestUseLeakyBucket_ExceedsCapacity(t *testing.T) {
+	adapter := &mockAdapter{}
+	out, err := NewLeakyBucket(adapter).Use(context.Background(), leakyBucketOptions(), leakyBucketOptions().MaximumCapacity+1)
+	assert.Nil(t, out)
+	assert.ErrorIs(t, err, ErrTakeExceedsCapacity)
+	assert.False(t, adapter.called, "redis should not be queried")
+}
+
+func TestUseLeakyBucket_NegativeTake(t *testing.T) {
+	adapter := &mockAdapter{}
+	out, err := NewLeakyBucket(adapter).Use(context.Background(), leakyBucketOptions(), -1)
+	assert.Nil(t, out)
+	assert.ErrorIs(t, err, ErrInvalidTakeAmount)
+	assert.False(t, adapter.called, "redis should not be queried")
+}
+
+func TestPrimeLeakyBucket(t *testing.T) {
+	testCases := map[string]func(*miniredis.Miniredis) adapters.Adapter{
+		"go-redis": func(t *miniredis.Miniredis) adapters.Adapter {
+			return goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: t.Addr()}))
+		},
+		"redigo": func(t *miniredis.Miniredis) adapters.Adapter {
+			conn, err := redigo.Dial("tcp", t.Addr())
+			if err != nil {
+				panic(err)
+			}
+			return redigoadapter.NewAdapter(conn)
+		},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+
+		for _, singleKey := range []bool{false, true} {
+			singleKey := singleKey
+
+			t.Run(fmt.Sprintf("%s single key %t", name, singleKey), func(t *testing.T) {
+				ctx := context.Background()
+				now := time.Now().UTC()
+				limiter := NewLeakyBucket(testCase(miniredis.RunT(t)))
+				limiter.nowFunc = func() time.Time { return now }
+
+				opts := leakyBucketOptions()
+				opts.SingleKey = singleKey
+
+				_, err := limiter.Use(ctx, opts, opts.MaximumCapacity)
+				assert.NoError(t, err)
+
+				assert.NoError(t, limiter.Prime(ctx, opts, 10))
+
+				resp, err := limiter.Inspect(ctx, opts)
+				assert.NoError(t, err)
+				assert.Equal(t, 10, resp.RemainingTokens)
+
+				// the bucket should fill from the time it was primed
+				limiter.nowFunc = func() time.Time { return now.Add(time.Second * 5) }
+
+				resp, err = limiter.Inspect(ctx, opts)
+				assert.NoError(t, err)
+				assert.Equal(t, 15, resp.RemainingTokens)
+			})
+		}
+	}
+}
+
+func TestLeakyBucket_MatchesLocalColdStart(t *testing.T) {
+	testCases := map[string]struct {
+		local      []local.Option
+		prime      bool
+		startEmpty bool
+	}{
+		"full":        {},
+		"start empty": {local: []local.Option{local.WithInitialTokens(0)}, startEmpty: true},
+		"primed":      {local: []local.Option{local.WithInitialTokens(0)}, prime: true},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Now().UTC()
+			limiter := NewLeakyBucket(goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: miniredis.RunT(t).Addr()})))
+			limiter.nowFunc = func() time.Time { return now }
+
+			opts := leakyBucketOptions()
+			opts.StartEmpty = testCase.startEmpty
+			if testCase.prime {
+				assert.NoError(t, limiter.Prime(ctx, opts, 0))
+			}
+
+			bucket := local.NewLeakyBucket(opts.MaximumCapacity, time.Duration(opts.WindowSeconds)*time.Second, testCase.local...)
+
+			redisTakes, localTakes := 0, 0
+			for i := 0; i <= opts.MaximumCapacity; i++ {
+				resp, err := limiter.Use(ctx, opts, 1)
+				assert.NoError(t, err)
+				if resp.Success {
+					redisTakes++
+				}
+				if bucket.TryTake() {
+					localTakes++
+				}
+			}
+
+			assert.Equal(t, localTakes, redisTakes)
+		})
+	}
+}
+
+func TestPrimeLeakyBucket_Errors(t *testing.T) {
+	t.Run("redis error", func(t *testing.T) {
+		err := NewLeakyBucket(&mockAdapter{returnError: assert.AnError}).Prime(context.Background(), leakyBucketOptions(), 1)
+		assert.EqualError(t, err, "failed to query redis adapter: "+assert.AnError.Error())
+	})
+
+	for _, tokens := range []int{-1, leakyBucketOptions().MaximumCapacity + 1} {
+		adapter := &mockAdapter{}
+		err := NewLeakyBucket(adapter).Prime(context.Background(), leakyBucketOptions(), tokens)
+		assert.ErrorIs(t, err, ErrTokensOutOfRange)
+		assert.False(t, adapter.called, "redis should not be queried")
+	}
+}
+
 func TestRefillRate(t *testing.T) {
 	assert.EqualValues(t, 1.5, getRefillRate(90, 60))
 	assert.EqualValues(t, 1, getRefillRate(60, 60))
@@ -193,7 +936,7 @@ func TestParseUseLeakyBucketResponse_Errors(t *testing.T) {
 			in:           "foo",
 		},
 		"invalid length": {
-			errorMessage: "expected 3 args but got 2",
+			errorMessage: "expected 9 args but got 2",
 			in:           []interface{}{int64(1), int64(2)},
 		},
 	}
@@ -219,8 +962,8 @@ func TestParseInspectLeakyBucketResponse_Errors(t *testing.T) {
 			in:           "foo",
 		},
 		"invalid length": {
-			errorMessage: "expected 2 args but got 3",
-			in:           []interface{}{int64(1), int64(2), int64(3)},
+			errorMessage: "expected 3 args but got 2",
+			in:           []interface{}{int64(1), int64(2)},
 		},
 	}
 
@@ -0,0 +1,162 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aidenwallis/go-ratelimiting/redis/adapters"
+)
+
+// MinInterval defines an interface compatible with MinIntervalImpl
+//
+// A minimum interval ratelimiter enforces a gap between successive takes for a key, regardless of overall volume, such as "no two
+// requests within 500ms", which neither the leaky bucket nor the sliding window expresses directly.
+type MinInterval interface {
+	// Use atomically attempts to take a token, which only succeeds if the interval has passed since the last successful take.
+	Use(ctx context.Context, bucket *MinIntervalOptions) (*UseMinIntervalResponse, error)
+}
+
+// MinIntervalImpl implements a minimum interval ratelimiter in Redis with Lua. This struct is compatible with the MinInterval
+// interface.
+//
+// The time of the last successful take is stored in a single key, which expires once the interval has passed.
+type MinIntervalImpl struct {
+	// Adapter defines the Redis adapter
+	Adapter adapters.Adapter
+
+	// OnDecision is an optional hook which is called synchronously after every successful call to Redis that takes tokens, which is
+	// useful for audit logging. It is not called when Redis returns an error.
+	OnDecision func(DecisionEvent)
+
+	// Logger is optionally used to log debugging information, such as the raw response when Redis returns something unexpected.
+	Logger Logger
+
+	// UseFunctions runs the ratelimiter's scripts as Redis functions with FCALL rather than EVAL. The adapter must implement
+	// adapters.FunctionAdapter, and the library must be loaded with LoadFunctions() first.
+	UseFunctions bool
+
+	// nowFunc is a private helper used to mock out time changes in unit testing
+	//
+	// if this is not defined, it falls back to time.Now()
+	nowFunc func() time.Time
+}
+
+var _ MinInterval = (*MinIntervalImpl)(nil)
+
+// MinIntervalOptions defines the options available to a minimum interval ratelimiter.
+type MinIntervalOptions struct {
+	// Key defines the Redis key used for this ratelimiter
+	Key string
+
+	// Interval defines the minimum gap between successive takes, resolution is available up to milliseconds. Intervals shorter than
+	// a millisecond are rejected with ErrIntervalTooShort.
+	Interval time.Duration
+}
+
+// NewMinInterval creates a new minimum interval ratelimiter instance
+func NewMinInterval(adapter adapters.Adapter) *MinIntervalImpl {
+	return &MinIntervalImpl{
+		Adapter: adapter,
+		nowFunc: time.Now,
+	}
+}
+
+// HealthCheck verifies that the adapter is able to run Lua scripts against Redis, and that responses are returned in the shape
+// this ratelimiter expects. This is useful as a readiness probe, as some managed Redis variants disable scripting.
+func (r *MinIntervalImpl) HealthCheck(ctx context.Context) error {
+	return healthCheck(ctx, r.Adapter, r.UseFunctions)
+}
+
+// Close releases the resources held by the adapter, if the adapter implements io.Closer. Otherwise, it does nothing.
+func (r *MinIntervalImpl) Close() error {
+	return closeAdapter(r.Adapter)
+}
+
+// eval runs script through the adapter, using FCALL when UseFunctions is set.
+func (r *MinIntervalImpl) eval(ctx context.Context, script string, keys []string, args []interface{}) (interface{}, error) {
+	return evalScript(ctx, r.Adapter, r.UseFunctions, script, keys, args)
+}
+
+func (r *MinIntervalImpl) now() time.Time {
+	if r.nowFunc == nil {
+		return time.Now()
+	}
+	return r.nowFunc()
+}
+
+// UseMinIntervalResponse defines the response parameters for MinInterval.Use()
+type UseMinIntervalResponse struct {
+	// Success is true when the token was taken
+	Success bool
+
+	// RetryAfter is how long until the next take is permitted, it's 0 when Success is true.
+	RetryAfter time.Duration
+}
+
+// minIntervalUseScript takes a token if the interval in ARGV[2] has passed since the last take, which is stored in KEYS[1] in
+// milliseconds.
+var minIntervalUseScript = newScript(`
+local now = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+local lastTake = tonumber(redis.call("get", KEYS[1]))
+
+if (lastTake == nil or now - lastTake >= interval) then
+	redis.call("set", KEYS[1], tostring(now), "PX", interval)
+	return {1, 0}
+end
+
+return {0, lastTake + interval - now}
+`)
+
+// Use atomically attempts to take a token, which only succeeds if the interval has passed since the last successful take.
+//
+// If the bucket's Interval is shorter than a millisecond, ErrIntervalTooShort is returned without querying Redis.
+func (r *MinIntervalImpl) Use(ctx context.Context, bucket *MinIntervalOptions) (*UseMinIntervalResponse, error) {
+	if bucket.Interval < time.Millisecond {
+		return nil, ErrIntervalTooShort
+	}
+
+	resp, err := r.eval(ctx, minIntervalUseScript, []string{bucket.Key}, []interface{}{r.now().UnixMilli(), bucket.Interval.Milliseconds()})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query redis adapter: %w", err)
+	}
+
+	output, err := parseUseMinIntervalResponse(resp)
+	if err != nil {
+		logUnexpectedResponse(r.Logger, bucket.Key, resp, err)
+		return nil, parsingError(minIntervalUseScript, err)
+	}
+
+	emitDecision(r.OnDecision, DecisionEvent{
+		Key:        bucket.Key,
+		Allowed:    output.success,
+		TakeAmount: 1,
+	})
+
+	return &UseMinIntervalResponse{
+		Success:    output.success,
+		RetryAfter: output.retryAfter,
+	}, nil
+}
+
+type useMinIntervalOutput struct {
+	success    bool
+	retryAfter time.Duration
+}
+
+func parseUseMinIntervalResponse(v interface{}) (*useMinIntervalOutput, error) {
+	ints, err := parseRedisInt64Slice(v)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ints) != 2 {
+		return nil, fmt.Errorf("expected 2 args but got %d", len(ints))
+	}
+
+	return &useMinIntervalOutput{
+		success:    ints[0] == 1,
+		retryAfter: time.Duration(ints[1]) * time.Millisecond,
+	}, nil
+}
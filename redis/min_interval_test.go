@@ -0,0 +1,114 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aidenwallis/go-ratelimiting/redis/adapters"
+	goredisadapter "github.com/aidenwallis/go-ratelimiting/redis/adapters/go-redis"
+	redigoadapter "github.com/aidenwallis/go-ratelimiting/redis/adapters/redigo"
+	"github.com/alicebob/miniredis/v2"
+	redigo "github.com/gomodule/redigo/redis"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func minIntervalOptions() *MinIntervalOptions {
+	return &MinIntervalOptions{
+		Key:      "min-interval",
+		Interval: time.Millisecond * 500,
+	}
+}
+
+func TestUseMinInterval(t *testing.T) {
+	testCases := map[string]func(*miniredis.Miniredis) adapters.Adapter{
+		"go-redis": func(t *miniredis.Miniredis) adapters.Adapter {
+			return goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: t.Addr()}))
+		},
+		"redigo": func(t *miniredis.Miniredis) adapters.Adapter {
+			conn, err := redigo.Dial("tcp", t.Addr())
+			if err != nil {
+				panic(err)
+			}
+			return redigoadapter.NewAdapter(conn)
+		},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Now().UTC()
+			mr := miniredis.RunT(t)
+			limiter := NewMinInterval(testCase(mr))
+			limiter.nowFunc = func() time.Time { return now }
+
+			{
+				resp, err := limiter.Use(ctx, minIntervalOptions())
+				assert.NoError(t, err)
+				assert.True(t, resp.Success)
+				assert.Equal(t, time.Duration(0), resp.RetryAfter)
+				assert.Equal(t, time.Millisecond*500, mr.TTL("min-interval"))
+			}
+
+			limiter.nowFunc = func() time.Time { return now.Add(time.Millisecond * 200) }
+
+			{
+				resp, err := limiter.Use(ctx, minIntervalOptions())
+				assert.NoError(t, err)
+				assert.False(t, resp.Success)
+				assert.Equal(t, time.Millisecond*300, resp.RetryAfter)
+			}
+
+			limiter.nowFunc = func() time.Time { return now.Add(time.Millisecond * 500) }
+
+			{
+				resp, err := limiter.Use(ctx, minIntervalOptions())
+				assert.NoError(t, err)
+				assert.True(t, resp.Success)
+			}
+		})
+	}
+}
+
+func TestUseMinInterval_IntervalTooShort(t *testing.T) {
+	for _, interval := range []time.Duration{0, time.Microsecond * 999} {
+		adapter := &mockAdapter{}
+		out, err := NewMinInterval(adapter).Use(context.Background(), &MinIntervalOptions{Key: "test-bucket", Interval: interval})
+		assert.Nil(t, out)
+		assert.ErrorIs(t, err, ErrIntervalTooShort)
+		assert.False(t, adapter.called, "redis should not be queried")
+	}
+}
+
+func TestUseMinInterval_Errors(t *testing.T) {
+	testCases := map[string]struct {
+		errorMessage string
+		mockAdapter  adapters.Adapter
+	}{
+		"redis error": {
+			errorMessage: "failed to query redis adapter: " + assert.AnError.Error(),
+			mockAdapter: &mockAdapter{
+				returnError: assert.AnError,
+			},
+		},
+		"parsing error": {
+			errorMessage: "parsing redis response from script " + scriptSHA(minIntervalUseScript) + ": expected 2 args but got 3",
+			mockAdapter: &mockAdapter{
+				returnValue: []interface{}{int64(1), int64(2), int64(3)},
+			},
+		},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			out, err := NewMinInterval(testCase.mockAdapter).Use(context.Background(), minIntervalOptions())
+			assert.Nil(t, out)
+			assert.EqualError(t, err, testCase.errorMessage)
+		})
+	}
+}
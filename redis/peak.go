@@ -0,0 +1,57 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aidenwallis/go-ratelimiting/redis/adapters"
+)
+
+// peakRecordScript is concatenated into the Use scripts after tokens are taken, it raises the high-water mark in the peak key when
+// used, the amount of capacity currently in use, exceeds it. The peak key is the last companion key claimed, and it's kept for as
+// long as the bucket's own keys, so it expires with them once the bucket is idle. It expects trackPeak, used and peakTTL, in
+// seconds, to be defined.
+const peakRecordScript = `
+local peakKey = companionKey(trackPeak == 1)
+if (trackPeak == 1) then
+	local peak = tonumber(redis.call("get", peakKey) or "0")
+	if (used > peak) then
+		redis.call("set", peakKey, tostring(used), "EX", peakTTL)
+	else
+		redis.call("expire", peakKey, peakTTL)
+	end
+end
+`
+
+// peakScript returns the high-water mark recorded in a peak key.
+var peakScript = newScript(`
+return tonumber(redis.call("get", KEYS[1]) or "0")
+`)
+
+func peakKey(key string) string {
+	return key + "::peak"
+}
+
+// readPeak returns the high-water mark recorded for key.
+func readPeak(ctx context.Context, adapter adapters.Adapter, useFunctions bool, logger Logger, key string) (int, error) {
+	resp, err := evalScript(adapters.WithIdempotent(ctx), adapter, useFunctions, peakScript, []string{peakKey(key)}, []interface{}{})
+	if err != nil {
+		return 0, fmt.Errorf("failed to query redis adapter: %w", err)
+	}
+
+	peak, ok := integer(resp)
+	if !ok {
+		err := fmt.Errorf("expecting int64 but got %T", resp)
+		logUnexpectedResponse(logger, key, resp, err)
+		return 0, parsingError(peakScript, err)
+	}
+
+	return int(peak), nil
+}
+
+func boolArg(v bool) int {
+	if v {
+		return 1
+	}
+	return 0
+}
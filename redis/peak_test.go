@@ -0,0 +1,130 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aidenwallis/go-ratelimiting/redis/adapters"
+	goredisadapter "github.com/aidenwallis/go-ratelimiting/redis/adapters/go-redis"
+	redigoadapter "github.com/aidenwallis/go-ratelimiting/redis/adapters/redigo"
+	"github.com/alicebob/miniredis/v2"
+	redigo "github.com/gomodule/redigo/redis"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPeak(t *testing.T) {
+	testCases := map[string]func(*miniredis.Miniredis) adapters.Adapter{
+		"go-redis": func(t *miniredis.Miniredis) adapters.Adapter {
+			return goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: t.Addr()}))
+		},
+		"redigo": func(t *miniredis.Miniredis) adapters.Adapter {
+			conn, err := redigo.Dial("tcp", t.Addr())
+			if err != nil {
+				panic(err)
+			}
+			return redigoadapter.NewAdapter(conn)
+		},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(name+" leaky bucket", func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Now().UTC()
+			mr := miniredis.RunT(t)
+			limiter := NewLeakyBucket(testCase(mr))
+			limiter.nowFunc = func() time.Time { return now }
+
+			opts := leakyBucketOptions()
+			opts.TrackPeak = true
+
+			_, err := limiter.Use(ctx, opts, 10)
+			assert.NoError(t, err)
+
+			// once the bucket refills, the peak remains
+			now = now.Add(time.Minute)
+			_, err = limiter.Use(ctx, opts, 2)
+			assert.NoError(t, err)
+
+			resp, err := limiter.Inspect(ctx, opts)
+			assert.NoError(t, err)
+			assert.Equal(t, 10, resp.Peak)
+
+			// the peak is kept for as long as the bucket
+			assert.Equal(t, time.Duration(opts.ttl())*time.Second, mr.TTL(peakKey(opts.KeyPrefix)))
+
+			_, err = limiter.ResetNamespace(ctx, opts.KeyPrefix)
+			assert.NoError(t, err)
+
+			resp, err = limiter.Inspect(ctx, opts)
+			assert.NoError(t, err)
+			assert.Equal(t, 0, resp.Peak)
+		})
+
+		for _, granularity := range []time.Duration{0, time.Second} {
+			granularity := granularity
+
+			t.Run(name+" sliding window "+granularity.String(), func(t *testing.T) {
+				ctx := context.Background()
+				now := time.Now().UTC()
+				mr := miniredis.RunT(t)
+				limiter := NewSlidingWindow(testCase(mr))
+				limiter.nowFunc = func() time.Time { return now }
+
+				opts := slidingWindowOptions()
+				opts.Granularity = granularity
+				opts.TrackPeak = true
+
+				for i := 0; i < 3; i++ {
+					_, err := limiter.Use(ctx, opts)
+					assert.NoError(t, err)
+				}
+
+				now = now.Add(time.Minute * 2)
+				_, err := limiter.Use(ctx, opts)
+				assert.NoError(t, err)
+
+				resp, err := limiter.Inspect(ctx, opts)
+				assert.NoError(t, err)
+				assert.Equal(t, 59, resp.RemainingCapacity)
+				assert.Equal(t, 3, resp.Peak)
+
+				// the peak is kept for as long as the window, so it expires with it once it's idle
+				assert.Equal(t, mr.TTL(opts.Key), mr.TTL(peakKey(opts.Key)))
+				mr.FastForward(mr.TTL(opts.Key))
+				assert.False(t, mr.Exists(peakKey(opts.Key)))
+
+				_, err = limiter.ResetNamespace(ctx, opts.Key)
+				assert.NoError(t, err)
+
+				resp, err = limiter.Inspect(ctx, opts)
+				assert.NoError(t, err)
+				assert.Equal(t, 0, resp.Peak)
+			})
+		}
+	}
+
+	t.Run("untracked", func(t *testing.T) {
+		ctx := context.Background()
+		mr := miniredis.RunT(t)
+		limiter := NewLeakyBucket(goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: mr.Addr()})))
+
+		_, err := limiter.Use(ctx, leakyBucketOptions(), 10)
+		assert.NoError(t, err)
+		assert.False(t, mr.Exists(peakKey("test-bucket")))
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		opts := slidingWindowOptions()
+		opts.TrackPeak = true
+
+		_, err := readPeak(context.Background(), &mockAdapter{returnError: assert.AnError}, false, nil, opts.Key)
+		assert.EqualError(t, err, "failed to query redis adapter: "+assert.AnError.Error())
+
+		_, err = readPeak(context.Background(), &mockAdapter{returnValue: "one"}, false, nil, opts.Key)
+		assert.EqualError(t, err, "parsing redis response from script "+scriptSHA(peakScript)+": expecting int64 but got string")
+	})
+}
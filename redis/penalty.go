@@ -0,0 +1,62 @@
+package redis
+
+import "time"
+
+// penaltyCheckScript is concatenated into the Use scripts before tokens are taken, it looks up whether the caller is currently
+// cooling down. The penalty key is the first companion key claimed, and the penalty arguments are always the last three arguments.
+const penaltyCheckScript = `
+local penaltyNow = tonumber(ARGV[#ARGV - 2])
+local penaltyThreshold = tonumber(ARGV[#ARGV - 1])
+local penaltyDuration = tonumber(ARGV[#ARGV])
+local penaltyKey = companionKey(penaltyThreshold > 0)
+local penaltyUntil = 0
+
+if (penaltyThreshold > 0) then
+	penaltyUntil = tonumber(redis.call("hget", penaltyKey, "until") or "0")
+	if (penaltyUntil <= penaltyNow) then
+		penaltyUntil = 0 -- the cool-down has passed
+	end
+end
+`
+
+// penaltyRecordScript is concatenated into the Use scripts after tokens are taken, it counts consecutive denials and starts the
+// cool-down once the threshold is reached. Any success clears the count, and retries replayed by idempotencyCheckScript are ignored.
+const penaltyRecordScript = `
+if (penaltyThreshold > 0 and not replayed) then
+	if (success == 1) then
+		redis.call("del", penaltyKey)
+	elseif (penaltyUntil == 0) then
+		local denials = redis.call("hincrby", penaltyKey, "denials", 1)
+		if (denials >= penaltyThreshold) then
+			penaltyUntil = penaltyNow + penaltyDuration
+			redis.call("hset", penaltyKey, "denials", 0, "until", penaltyUntil)
+		end
+		redis.call("pexpire", penaltyKey, penaltyDuration)
+	end
+end
+`
+
+func penaltyKey(key string) string {
+	return key + "::penalty"
+}
+
+// penaltyArgs returns the trailing arguments read by penaltyCheckScript, penalties are disabled unless both the threshold and
+// duration are set.
+func penaltyArgs(now time.Time, threshold int, duration time.Duration) []interface{} {
+	if !penaltyEnabled(threshold, duration) {
+		threshold = 0
+	}
+	return []interface{}{now.UnixMilli(), threshold, duration.Milliseconds()}
+}
+
+func penaltyEnabled(threshold int, duration time.Duration) bool {
+	return threshold > 0 && duration.Milliseconds() > 0
+}
+
+// parsePenaltyUntil converts the cool-down returned by the scripts, which is 0 when there's no cool-down.
+func parsePenaltyUntil(v int64) time.Time {
+	if v <= 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(v)
+}
@@ -0,0 +1,166 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aidenwallis/go-ratelimiting/redis/adapters"
+	goredisadapter "github.com/aidenwallis/go-ratelimiting/redis/adapters/go-redis"
+	redigoadapter "github.com/aidenwallis/go-ratelimiting/redis/adapters/redigo"
+	"github.com/alicebob/miniredis/v2"
+	redigo "github.com/gomodule/redigo/redis"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPenalty(t *testing.T) {
+	testCases := map[string]func(*miniredis.Miniredis) adapters.Adapter{
+		"go-redis": func(t *miniredis.Miniredis) adapters.Adapter {
+			return goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: t.Addr()}))
+		},
+		"redigo": func(t *miniredis.Miniredis) adapters.Adapter {
+			conn, err := redigo.Dial("tcp", t.Addr())
+			if err != nil {
+				panic(err)
+			}
+			return redigoadapter.NewAdapter(conn)
+		},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(name+" leaky bucket", func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Now().UTC()
+			mr := miniredis.RunT(t)
+			limiter := NewLeakyBucket(testCase(mr))
+			limiter.nowFunc = func() time.Time { return now }
+
+			opts := &LeakyBucketOptions{
+				KeyPrefix:        "test-bucket",
+				MaximumCapacity:  2,
+				WindowSeconds:    2,
+				PenaltyThreshold: 2,
+				PenaltyDuration:  time.Second * 5,
+			}
+			penaltyUntil := now.Add(opts.PenaltyDuration).UnixMilli()
+
+			{
+				resp, err := limiter.Use(ctx, opts, 2)
+				assert.NoError(t, err)
+				assert.True(t, resp.Success)
+				assert.True(t, resp.PenaltyUntil.IsZero())
+			}
+
+			{
+				resp, err := limiter.Use(ctx, opts, 1)
+				assert.NoError(t, err)
+				assert.False(t, resp.Success)
+				assert.True(t, resp.PenaltyUntil.IsZero(), "the threshold hasn't been reached yet")
+			}
+
+			{
+				resp, err := limiter.Use(ctx, opts, 1)
+				assert.NoError(t, err)
+				assert.False(t, resp.Success)
+				assert.Equal(t, penaltyUntil, resp.PenaltyUntil.UnixMilli())
+			}
+
+			// the bucket has refilled, but the caller is still cooling down
+			limiter.nowFunc = func() time.Time { return now.Add(time.Second * 3) }
+
+			{
+				resp, err := limiter.Use(ctx, opts, 1)
+				assert.NoError(t, err)
+				assert.False(t, resp.Success)
+				assert.Equal(t, penaltyUntil, resp.PenaltyUntil.UnixMilli(), "denials during a cool-down shouldn't extend it")
+			}
+
+			limiter.nowFunc = func() time.Time { return now.Add(opts.PenaltyDuration) }
+
+			{
+				resp, err := limiter.Use(ctx, opts, 1)
+				assert.NoError(t, err)
+				assert.True(t, resp.Success)
+				assert.True(t, resp.PenaltyUntil.IsZero())
+				assert.False(t, mr.Exists(penaltyKey(opts.KeyPrefix)), "success should clear the penalty key")
+			}
+		})
+
+		t.Run(name+" sliding window", func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Now().UTC()
+			mr := miniredis.RunT(t)
+			limiter := NewSlidingWindow(testCase(mr))
+			limiter.nowFunc = func() time.Time { return now }
+
+			opts := &SlidingWindowOptions{
+				Key:              "test-bucket",
+				MaximumCapacity:  1,
+				Window:           time.Second * 2,
+				PenaltyThreshold: 2,
+				PenaltyDuration:  time.Second * 5,
+			}
+			penaltyUntil := now.Add(opts.PenaltyDuration).UnixMilli()
+
+			expected := []struct {
+				success      bool
+				penaltyUntil int64
+			}{
+				{success: true},
+				{success: false},
+				{success: false, penaltyUntil: penaltyUntil},
+			}
+
+			for i, e := range expected {
+				resp, err := limiter.Use(ctx, opts)
+				assert.NoError(t, err)
+				assert.Equal(t, e.success, resp.Success, "use %d", i)
+				if e.penaltyUntil == 0 {
+					assert.True(t, resp.PenaltyUntil.IsZero(), "use %d", i)
+				} else {
+					assert.Equal(t, e.penaltyUntil, resp.PenaltyUntil.UnixMilli(), "use %d", i)
+				}
+			}
+
+			// the window has room, but the caller is still cooling down
+			limiter.nowFunc = func() time.Time { return now.Add(time.Second * 3) }
+
+			{
+				resp, err := limiter.Use(ctx, opts)
+				assert.NoError(t, err)
+				assert.False(t, resp.Success)
+				assert.Equal(t, 1, resp.RemainingCapacity)
+				assert.Equal(t, penaltyUntil, resp.PenaltyUntil.UnixMilli())
+			}
+
+			limiter.nowFunc = func() time.Time { return now.Add(opts.PenaltyDuration) }
+
+			{
+				resp, err := limiter.Use(ctx, opts)
+				assert.NoError(t, err)
+				assert.True(t, resp.Success)
+				assert.True(t, resp.PenaltyUntil.IsZero())
+			}
+		})
+	}
+
+	t.Run("disabled without a duration", func(t *testing.T) {
+		ctx := context.Background()
+		mr := miniredis.RunT(t)
+		limiter := NewSlidingWindow(goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: mr.Addr()})))
+
+		opts := slidingWindowOptions()
+		opts.MaximumCapacity = 1
+		opts.PenaltyThreshold = 1
+
+		for i := 0; i < 3; i++ {
+			resp, err := limiter.Use(ctx, opts)
+			assert.NoError(t, err)
+			assert.True(t, resp.PenaltyUntil.IsZero())
+		}
+		assert.False(t, mr.Exists(penaltyKey(opts.Key)))
+	})
+}
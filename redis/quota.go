@@ -0,0 +1,13 @@
+package redis
+
+import "time"
+
+func dailyQuotaKey(prefix string) string {
+	return prefix + "::daily_quota"
+}
+
+// quotaResetAt returns when the daily quota counted at now resets, which is the following midnight UTC.
+func quotaResetAt(now time.Time) time.Time {
+	year, month, day := now.UTC().Date()
+	return time.Date(year, month, day+1, 0, 0, 0, 0, time.UTC)
+}
@@ -1,22 +1,127 @@
 package redis
 
-import "fmt"
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
 
-func parseRedisInt64Slice(v interface{}) ([]int64, error) {
-	args, ok := v.([]interface{})
-	if !ok {
-		return nil, fmt.Errorf("expected []interface{} but got %T", v)
+	"github.com/aidenwallis/go-ratelimiting/redis/adapters"
+	"github.com/aidenwallis/go-ratelimiting/redis/script"
+)
+
+var (
+	// ErrTakeExceedsCapacity is returned when more tokens are requested than the bucket could ever hold, meaning the request can never succeed.
+	ErrTakeExceedsCapacity = errors.New("take amount exceeds maximum capacity")
+
+	// ErrInvalidTakeAmount is returned when a take amount is below what the ratelimiter accepts, such as a negative one, which would
+	// otherwise add tokens back rather than taking them.
+	ErrInvalidTakeAmount = errors.New("take amount is too small")
+
+	// ErrNoOptionsResolver is returned when calling UseKey on a ratelimiter without an OptionsResolver.
+	ErrNoOptionsResolver = errors.New("no options resolver defined")
+
+	// ErrTokensOutOfRange is returned when priming a bucket with fewer than 0 tokens, or more than it could ever hold.
+	ErrTokensOutOfRange = errors.New("tokens must be between 0 and maximum capacity")
+
+	// ErrEmptySchedule is returned when a scheduled ratelimiter has no options to choose between.
+	ErrEmptySchedule = errors.New("schedule has no entries")
+
+	// ErrIntervalTooShort is returned when a minimum interval is shorter than a millisecond, which is the finest resolution Redis can
+	// expire its key with.
+	ErrIntervalTooShort = errors.New("interval must be at least 1ms")
+)
+
+// WouldAllowResponse defines the response parameters for WouldAllowAt(), which projects a decision without taking any tokens.
+type WouldAllowResponse struct {
+	// Allowed is true when the tokens could be taken at the given time
+	Allowed bool
+
+	// Remaining is how many tokens would be left at the given time, after taking the tokens if Allowed is true
+	Remaining int
+}
+
+// DecisionEvent describes the outcome of an attempt to use a ratelimiter, it is passed to the OnDecision hook.
+type DecisionEvent struct {
+	// Key is the bucket's key, for leaky buckets this is the KeyPrefix
+	Key string
+
+	// Allowed is true when the tokens were taken
+	Allowed bool
+
+	// Remaining is how many tokens are left in the bucket after the decision
+	Remaining int
+
+	// TakeAmount is how many tokens were requested
+	TakeAmount int
+
+	// DryRun is true when the decision wasn't enforced, as the options have DryRun set. Allowed still reflects whether the tokens
+	// were taken, so denials can be counted to measure a limit before it's enforced.
+	DryRun bool
+}
+
+// Logger is an optional logger the ratelimiters use to report debugging information, such as the raw response when Redis returns
+// something that can't be parsed. Fields are passed as alternating keys and values, which makes *slog.Logger compatible.
+type Logger interface {
+	Debug(msg string, fields ...interface{})
+}
+
+// logUnexpectedResponse logs the raw response that failed to parse, if a logger is defined.
+func logUnexpectedResponse(logger Logger, key string, resp interface{}, err error) {
+	if logger != nil {
+		logger.Debug("unexpected redis response", "key", key, "response", resp, "type", fmt.Sprintf("%T", resp), "error", err)
+	}
+}
+
+// emitDecision calls hook with event, if a hook is defined.
+func emitDecision(hook func(DecisionEvent), event DecisionEvent) {
+	if hook != nil {
+		hook(event)
+	}
+}
+
+// healthCheckScript is a trivial script used to check scripting works.
+var healthCheckScript = newScript(`return {1, 2}`)
+
+// healthCheck runs a trivial script through the adapter, ensuring scripting is available in Redis, and that the adapter returns
+// responses in the shape the ratelimiters expect.
+func healthCheck(ctx context.Context, adapter adapters.Adapter, useFunctions bool) error {
+	resp, err := evalScript(adapters.WithIdempotent(ctx), adapter, useFunctions, healthCheckScript, []string{}, []interface{}{})
+	if err != nil {
+		return fmt.Errorf("redis scripting is unavailable: %w", err)
+	}
+
+	ints, err := parseRedisInt64Slice(resp)
+	if err != nil {
+		return fmt.Errorf("unexpected health check response: %w", err)
 	}
 
-	out := make([]int64, len(args))
-	for i, arg := range args {
-		value, ok := arg.(int64)
-		if !ok {
-			return nil, fmt.Errorf("expected int64 in args[%d] but got %T", i, arg)
-		}
+	if len(ints) != 2 || ints[0] != 1 || ints[1] != 2 {
+		return fmt.Errorf("unexpected health check response: expected [1 2] but got %v", ints)
+	}
 
-		out[i] = value
+	return nil
+}
+
+// newMemberID generates a random id, used to keep sorted set members unique.
+func newMemberID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
 	}
+	return hex.EncodeToString(b), nil
+}
 
-	return out, nil
+// closeAdapter closes the adapter if it implements io.Closer, otherwise it does nothing.
+func closeAdapter(adapter adapters.Adapter) error {
+	if closer, ok := adapter.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func parseRedisInt64Slice(v interface{}) ([]int64, error) {
+	return script.Int64s(v, nil)
 }
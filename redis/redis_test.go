@@ -2,22 +2,31 @@ package redis
 
 import (
 	"context"
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/aidenwallis/go-ratelimiting/redis/adapters"
+	goredisadapter "github.com/aidenwallis/go-ratelimiting/redis/adapters/go-redis"
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
 )
 
 type mockAdapter struct {
 	called      bool
+	idempotent  bool
+	keys        []string
 	returnValue interface{}
 	returnError error
 }
 
 var _ adapters.Adapter = (*mockAdapter)(nil)
 
-func (a *mockAdapter) Eval(_ context.Context, _ string, _ []string, _ []interface{}) (interface{}, error) {
+func (a *mockAdapter) Eval(ctx context.Context, _ string, keys []string, _ []interface{}) (interface{}, error) {
 	a.called = true
+	a.idempotent = adapters.IsIdempotent(ctx)
+	a.keys = keys
 	return a.returnValue, a.returnError
 }
 
@@ -53,4 +62,317 @@ func TestParseRedisInt64Slice(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Equal(t, []int64{1, 2, 3}, out)
 	})
+
+	t.Run("numbers as strings", func(t *testing.T) {
+		// some clients return numbers as strings or bytes
+		out, err := parseRedisInt64Slice([]interface{}{int64(1), "2", []byte("3")})
+		assert.NoError(t, err)
+		assert.Equal(t, []int64{1, 2, 3}, out)
+	})
+}
+
+func FuzzParseResponses(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte{0})
+	f.Add([]byte{4, 2, 1, 0, 0, 0, 0, 0, 0, 0, 1, 2, 1, '0'})
+	f.Add([]byte{4, 9, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1})
+	f.Add([]byte{4, 2, 3, 1, '0', 4, 2, 2, 1, 'a', 0})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		v, _ := fuzzReply(data, 0)
+
+		// however malformed the reply, the parsers must return an error rather than panic
+		_, _ = parseRedisInt64Slice(v)
+		_, _ = parseUseLeakyBucketResponse(v)
+		_, _ = parseInspectLeakyBucketResponse(v)
+		_, _ = parseUseAnyLeakyBucketResponse(v, 2)
+		_, _ = parseSlidingWindowResponse(v)
+		_, _ = parseReserveSlidingWindowResponse(v)
+		_, _ = parseSlidingWindowTrendResponse(v)
+		_, _ = parseUseCompositeResponse(v)
+		_, _ = parseUseMinIntervalResponse(v)
+		_, _ = parseUseDistinctResponse(v)
+		_, _ = parseUseGroupResponse(v)
+		_, _, _ = parseInspectGroupResponse(v)
+		_, _, _ = parseEnumerateKeysResponse(v)
+		_, _, _ = parseResetNamespaceResponse(v)
+		_, _ = integer(v)
+		_, _ = bulkString(v)
+	})
+}
+
+// fuzzReply decodes data into a reply in any of the shapes adapters return, nested up to a few levels deep, alongside whatever's
+// left of data.
+func fuzzReply(data []byte, depth int) (interface{}, []byte) {
+	if len(data) == 0 {
+		return nil, data
+	}
+
+	kind, data := data[0]%6, data[1:]
+	switch kind {
+	case 1:
+		var n int64
+		for i := 0; i < 8 && len(data) > 0; i++ {
+			n, data = n<<8|int64(data[0]), data[1:]
+		}
+		return n, data
+	case 2, 3:
+		size := 0
+		if len(data) > 0 {
+			size, data = int(data[0])%16, data[1:]
+		}
+		if size > len(data) {
+			size = len(data)
+		}
+		if kind == 2 {
+			return string(data[:size]), data[size:]
+		}
+		return data[:size], data[size:]
+	case 4:
+		if depth >= 3 {
+			return nil, data
+		}
+		size := 0
+		if len(data) > 0 {
+			size, data = int(data[0])%12, data[1:]
+		}
+		out := make([]interface{}, 0, size)
+		for i := 0; i < size; i++ {
+			var v interface{}
+			v, data = fuzzReply(data, depth+1)
+			out = append(out, v)
+		}
+		return out, data
+	case 5:
+		return float64(len(data)) / 2, data
+	default:
+		return nil, data
+	}
+}
+
+type closableMockAdapter struct {
+	mockAdapter
+	closed     bool
+	closeError error
+}
+
+func (a *closableMockAdapter) Close() error {
+	a.closed = true
+	return a.closeError
+}
+
+func TestCloseAdapter(t *testing.T) {
+	t.Run("closes closers", func(t *testing.T) {
+		adapter := &closableMockAdapter{closeError: assert.AnError}
+		assert.ErrorIs(t, NewLeakyBucket(adapter).Close(), assert.AnError)
+		assert.True(t, adapter.closed)
+
+		adapter = &closableMockAdapter{}
+		assert.NoError(t, NewSlidingWindow(adapter).Close())
+		assert.True(t, adapter.closed)
+	})
+
+	t.Run("ignores non closers", func(t *testing.T) {
+		assert.NoError(t, NewLeakyBucket(&mockAdapter{}).Close())
+		assert.NoError(t, NewSlidingWindow(&mockAdapter{}).Close())
+	})
+}
+
+func TestDryRun(t *testing.T) {
+	t.Run("leaky bucket", func(t *testing.T) {
+		events := []DecisionEvent{}
+		limiter := NewLeakyBucket(&mockAdapter{returnValue: []interface{}{int64(0), int64(0), int64(0), int64(0), int64(0), int64(0), int64(0), int64(0), int64(0)}})
+		limiter.OnDecision = func(e DecisionEvent) { events = append(events, e) }
+
+		opts := leakyBucketOptions()
+		opts.DryRun = true
+		resp, err := limiter.Use(context.Background(), opts, 1)
+		assert.NoError(t, err)
+		assert.True(t, resp.Success)
+		assert.True(t, resp.WouldHaveBeenLimited)
+		assert.Equal(t, []DecisionEvent{{Key: "test-bucket", Allowed: false, Remaining: 0, TakeAmount: 1, DryRun: true}}, events)
+	})
+
+	t.Run("sliding window", func(t *testing.T) {
+		events := []DecisionEvent{}
+		limiter := NewSlidingWindow(&mockAdapter{returnValue: []interface{}{int64(0), int64(60), int64(0), int64(0), int64(0)}})
+		limiter.OnDecision = func(e DecisionEvent) { events = append(events, e) }
+
+		opts := slidingWindowOptions()
+		opts.DryRun = true
+		resp, err := limiter.Use(context.Background(), opts)
+		assert.NoError(t, err)
+		assert.True(t, resp.Success)
+		assert.True(t, resp.WouldHaveBeenLimited)
+		assert.Equal(t, []DecisionEvent{{Key: "test-bucket", Allowed: false, Remaining: 0, TakeAmount: 1, DryRun: true}}, events)
+	})
+
+	t.Run("allowed", func(t *testing.T) {
+		limiter := NewSlidingWindow(&mockAdapter{returnValue: []interface{}{int64(1), int64(1), int64(0), int64(0), int64(0)}})
+
+		opts := slidingWindowOptions()
+		opts.DryRun = true
+		resp, err := limiter.Use(context.Background(), opts)
+		assert.NoError(t, err)
+		assert.True(t, resp.Success)
+		assert.False(t, resp.WouldHaveBeenLimited)
+	})
+}
+
+func TestOnDecision(t *testing.T) {
+	t.Run("leaky bucket", func(t *testing.T) {
+		events := []DecisionEvent{}
+		limiter := NewLeakyBucket(&mockAdapter{returnValue: []interface{}{int64(1), int64(57), int64(0), int64(0), int64(0), int64(0), int64(0), int64(0), int64(0)}})
+		limiter.OnDecision = func(e DecisionEvent) { events = append(events, e) }
+
+		_, err := limiter.Use(context.Background(), leakyBucketOptions(), 3)
+		assert.NoError(t, err)
+		assert.Equal(t, []DecisionEvent{{Key: "test-bucket", Allowed: true, Remaining: 57, TakeAmount: 3}}, events)
+	})
+
+	t.Run("sliding window", func(t *testing.T) {
+		events := []DecisionEvent{}
+		limiter := NewSlidingWindow(&mockAdapter{returnValue: []interface{}{int64(0), int64(60), int64(0), int64(0), int64(0)}})
+		limiter.OnDecision = func(e DecisionEvent) { events = append(events, e) }
+
+		_, err := useSlidingWindow(context.Background(), limiter)
+		assert.NoError(t, err)
+		assert.Equal(t, []DecisionEvent{{Key: "test-bucket", Allowed: false, Remaining: 0, TakeAmount: 1}}, events)
+	})
+
+	t.Run("reservation", func(t *testing.T) {
+		events := []DecisionEvent{}
+		limiter := NewSlidingWindow(&mockAdapter{returnValue: []interface{}{int64(1), int64(1)}})
+		limiter.OnDecision = func(e DecisionEvent) { events = append(events, e) }
+
+		_, err := limiter.Reserve(context.Background(), slidingWindowOptions())
+		assert.NoError(t, err)
+		assert.Equal(t, []DecisionEvent{{Key: "test-bucket", Allowed: true, Remaining: 59, TakeAmount: 1}}, events)
+	})
+
+	t.Run("not called on error", func(t *testing.T) {
+		called := false
+		limiter := NewLeakyBucket(&mockAdapter{returnError: assert.AnError})
+		limiter.OnDecision = func(DecisionEvent) { called = true }
+
+		_, err := useLeakyBucket(context.Background(), limiter)
+		assert.Error(t, err)
+		assert.False(t, called)
+	})
+}
+
+func TestHealthCheck(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		mr := miniredis.RunT(t)
+		adapter := goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: mr.Addr()}))
+
+		assert.NoError(t, NewLeakyBucket(adapter).HealthCheck(context.Background()))
+		assert.NoError(t, NewSlidingWindow(adapter).HealthCheck(context.Background()))
+	})
+
+	testCases := map[string]struct {
+		errorMessage string
+		mockAdapter  adapters.Adapter
+	}{
+		"scripting unavailable": {
+			errorMessage: "redis scripting is unavailable: " + assert.AnError.Error(),
+			mockAdapter:  &mockAdapter{returnError: assert.AnError},
+		},
+		"invalid type": {
+			errorMessage: "unexpected health check response: expected []interface{} but got string",
+			mockAdapter:  &mockAdapter{returnValue: "foo"},
+		},
+		"invalid values": {
+			errorMessage: "unexpected health check response: expected [1 2] but got [1]",
+			mockAdapter:  &mockAdapter{returnValue: []interface{}{int64(1)}},
+		},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			assert.EqualError(t, NewLeakyBucket(testCase.mockAdapter).HealthCheck(context.Background()), testCase.errorMessage)
+		})
+	}
+}
+
+func TestUseKey(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	adapter := goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: mr.Addr()}))
+
+	t.Run("leaky bucket", func(t *testing.T) {
+		limiter := NewLeakyBucket(adapter)
+
+		_, err := limiter.UseKey(ctx, "tenant", 1)
+		assert.ErrorIs(t, err, ErrNoOptionsResolver)
+
+		limiter.OptionsResolver = func(_ context.Context, key string) (*LeakyBucketOptions, error) {
+			if key != "tenant" {
+				return nil, assert.AnError
+			}
+			return &LeakyBucketOptions{KeyPrefix: "leaky:" + key, MaximumCapacity: 5, WindowSeconds: 60}, nil
+		}
+
+		resp, err := limiter.UseKey(ctx, "tenant", 2)
+		assert.NoError(t, err)
+		assert.True(t, resp.Success)
+		assert.Equal(t, 3, resp.RemainingTokens)
+
+		_, err = limiter.UseKey(ctx, "other", 1)
+		assert.EqualError(t, err, "resolving options: "+assert.AnError.Error())
+	})
+
+	t.Run("sliding window", func(t *testing.T) {
+		limiter := NewSlidingWindow(adapter)
+
+		_, err := limiter.UseKey(ctx, "tenant")
+		assert.ErrorIs(t, err, ErrNoOptionsResolver)
+
+		limiter.OptionsResolver = func(_ context.Context, key string) (*SlidingWindowOptions, error) {
+			if key != "tenant" {
+				return nil, assert.AnError
+			}
+			return &SlidingWindowOptions{Key: "sliding:" + key, MaximumCapacity: 5, Window: time.Minute}, nil
+		}
+
+		resp, err := limiter.UseKey(ctx, "tenant")
+		assert.NoError(t, err)
+		assert.True(t, resp.Success)
+		assert.Equal(t, 4, resp.RemainingCapacity)
+
+		_, err = limiter.UseKey(ctx, "other")
+		assert.EqualError(t, err, "resolving options: "+assert.AnError.Error())
+	})
+}
+
+type recordingLogger struct {
+	messages []string
+	fields   [][]interface{}
+}
+
+func (l *recordingLogger) Debug(msg string, fields ...interface{}) {
+	l.messages = append(l.messages, msg)
+	l.fields = append(l.fields, fields)
+}
+
+func TestLogUnexpectedResponse(t *testing.T) {
+	logger := &recordingLogger{}
+	limiter := NewLeakyBucket(&mockAdapter{returnValue: []interface{}{int64(1), "2.5", int64(3)}})
+	limiter.Logger = logger
+
+	_, err := limiter.Use(context.Background(), leakyBucketOptions(), 1)
+	assert.EqualError(t, err, "parsing redis response from script "+scriptSHA(leakyBucketUseScript)+": expected int64 in args[1] but got string")
+
+	assert.Equal(t, []string{"unexpected redis response"}, logger.messages)
+	assert.Equal(t, []interface{}{
+		"key", leakyBucketOptions().KeyPrefix,
+		"response", []interface{}{int64(1), "2.5", int64(3)},
+		"type", "[]interface {}",
+		"error", errors.Unwrap(err),
+	}, logger.fields[0])
+
+	// no logger is fine
+	assert.NotPanics(t, func() { logUnexpectedResponse(nil, "foo", "bar", assert.AnError) })
 }
@@ -0,0 +1,105 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aidenwallis/go-ratelimiting/redis/adapters"
+)
+
+// resetNamespaceBatchSize is the COUNT hint given to each SCAN
+const resetNamespaceBatchSize = 500
+
+// ResetNamespace deletes every key starting with prefix, such as when purging all ratelimits for a tenant. It returns how many keys were deleted.
+//
+// Keys are found using SCAN in batches and removed with UNLINK, one batch per script call, so Redis is never blocked by a full KEYS
+// sweep. As SCAN only covers a single node, when running against Redis Cluster this only resets keys on the node the adapter is
+// connected to.
+func (r *LeakyBucketImpl) ResetNamespace(ctx context.Context, prefix string) (int, error) {
+	return resetNamespace(ctx, r.Adapter, r.UseFunctions, prefix)
+}
+
+// ResetNamespace deletes every key starting with prefix, such as when purging all ratelimits for a tenant. It returns how many keys were deleted.
+//
+// Keys are found using SCAN in batches and removed with UNLINK, one batch per script call, so Redis is never blocked by a full KEYS
+// sweep. As SCAN only covers a single node, when running against Redis Cluster this only resets keys on the node the adapter is
+// connected to.
+func (r *SlidingWindowImpl) ResetNamespace(ctx context.Context, prefix string) (int, error) {
+	return resetNamespace(ctx, r.Adapter, r.UseFunctions, prefix)
+}
+
+// resetNamespaceScript runs a single SCAN iteration, and unlinks every key it finds.
+var resetNamespaceScript = newScript(`
+local cursor = ARGV[1]
+local pattern = ARGV[2]
+local count = ARGV[3]
+
+local resp = redis.call("scan", cursor, "match", pattern, "count", count)
+local keys = resp[2]
+for i = 1, #keys do
+	redis.call("unlink", keys[i])
+end
+
+return {resp[1], #keys}
+`)
+
+func resetNamespace(ctx context.Context, adapter adapters.Adapter, useFunctions bool, prefix string) (int, error) {
+	pattern := escapeGlob(prefix) + "*"
+	cursor := "0"
+	deleted := 0
+
+	for {
+		resp, err := evalScript(adapters.WithIdempotent(ctx), adapter, useFunctions, resetNamespaceScript, []string{}, []interface{}{cursor, pattern, resetNamespaceBatchSize})
+		if err != nil {
+			return deleted, fmt.Errorf("failed to query redis adapter: %w", err)
+		}
+
+		next, count, err := parseResetNamespaceResponse(resp)
+		if err != nil {
+			return deleted, parsingError(resetNamespaceScript, err)
+		}
+
+		deleted += count
+		if next == "0" {
+			return deleted, nil
+		}
+		cursor = next
+	}
+}
+
+// escapeGlob escapes the characters that have special meaning in a Redis glob pattern
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		switch c {
+		case '*', '?', '[', ']', '\\':
+			b.WriteRune('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+func parseResetNamespaceResponse(v interface{}) (string, int, error) {
+	args, ok := v.([]interface{})
+	if !ok {
+		return "", 0, fmt.Errorf("expected []interface{} but got %T", v)
+	}
+
+	if len(args) != 2 {
+		return "", 0, fmt.Errorf("expected 2 args but got %d", len(args))
+	}
+
+	cursor, ok := bulkString(args[0])
+	if !ok {
+		return "", 0, fmt.Errorf("expected string in args[0] but got %T", args[0])
+	}
+
+	count, ok := integer(args[1])
+	if !ok {
+		return "", 0, fmt.Errorf("expected int64 in args[1] but got %T", args[1])
+	}
+
+	return cursor, int(count), nil
+}
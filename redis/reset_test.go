@@ -0,0 +1,98 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/aidenwallis/go-ratelimiting/redis/adapters"
+	goredisadapter "github.com/aidenwallis/go-ratelimiting/redis/adapters/go-redis"
+	redigoadapter "github.com/aidenwallis/go-ratelimiting/redis/adapters/redigo"
+	"github.com/alicebob/miniredis/v2"
+	redigo "github.com/gomodule/redigo/redis"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResetNamespace(t *testing.T) {
+	testCases := map[string]func(*miniredis.Miniredis) adapters.Adapter{
+		"go-redis": func(t *miniredis.Miniredis) adapters.Adapter {
+			return goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: t.Addr()}))
+		},
+		"redigo": func(t *miniredis.Miniredis) adapters.Adapter {
+			conn, err := redigo.Dial("tcp", t.Addr())
+			if err != nil {
+				panic(err)
+			}
+			return redigoadapter.NewAdapter(conn)
+		},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			mr := miniredis.RunT(t)
+			adapter := testCase(mr)
+
+			// more keys than a single batch, to ensure we follow the cursor
+			for i := 0; i < resetNamespaceBatchSize+10; i++ {
+				assert.NoError(t, mr.Set(fmt.Sprintf("tenant:[1]:%d", i), "1"))
+			}
+			assert.NoError(t, mr.Set("tenant:[2]:0", "1"))
+
+			limiter := NewLeakyBucket(adapter)
+			_, err := limiter.Use(ctx, &LeakyBucketOptions{KeyPrefix: "tenant:[1]:bucket", MaximumCapacity: 10, WindowSeconds: 10}, 1)
+			assert.NoError(t, err)
+
+			deleted, err := limiter.ResetNamespace(ctx, "tenant:[1]:")
+			assert.NoError(t, err)
+			assert.Equal(t, resetNamespaceBatchSize+10+3, deleted)
+			assert.Equal(t, []string{"tenant:[2]:0"}, mr.Keys())
+
+			deleted, err = NewSlidingWindow(adapter).ResetNamespace(ctx, "tenant:[2]:")
+			assert.NoError(t, err)
+			assert.Equal(t, 1, deleted)
+			assert.Empty(t, mr.Keys())
+		})
+	}
+}
+
+func TestResetNamespace_Errors(t *testing.T) {
+	testCases := map[string]struct {
+		errorMessage string
+		mockAdapter  adapters.Adapter
+	}{
+		"redis error": {
+			errorMessage: "failed to query redis adapter: " + assert.AnError.Error(),
+			mockAdapter:  &mockAdapter{returnError: assert.AnError},
+		},
+		"invalid type": {
+			errorMessage: "parsing redis response from script " + scriptSHA(resetNamespaceScript) + ": expected []interface{} but got string",
+			mockAdapter:  &mockAdapter{returnValue: "foo"},
+		},
+		"invalid length": {
+			errorMessage: "parsing redis response from script " + scriptSHA(resetNamespaceScript) + ": expected 2 args but got 1",
+			mockAdapter:  &mockAdapter{returnValue: []interface{}{"0"}},
+		},
+		"invalid cursor": {
+			errorMessage: "parsing redis response from script " + scriptSHA(resetNamespaceScript) + ": expected string in args[0] but got int64",
+			mockAdapter:  &mockAdapter{returnValue: []interface{}{int64(0), int64(0)}},
+		},
+		"invalid count": {
+			errorMessage: "parsing redis response from script " + scriptSHA(resetNamespaceScript) + ": expected int64 in args[1] but got string",
+			mockAdapter:  &mockAdapter{returnValue: []interface{}{"0", "zero"}},
+		},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			deleted, err := resetNamespace(context.Background(), testCase.mockAdapter, false, "foo")
+			assert.Equal(t, 0, deleted)
+			assert.EqualError(t, err, testCase.errorMessage)
+		})
+	}
+}
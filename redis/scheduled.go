@@ -0,0 +1,174 @@
+package redis
+
+import (
+	"context"
+	"time"
+)
+
+// LeakyBucketScheduleEntry defines the options a ScheduledLeakyBucket uses from a time of day.
+type LeakyBucketScheduleEntry struct {
+	// From is the time of day the options take effect, as an offset from midnight. They remain in effect until the From of the
+	// next entry, the latest entry wraps around past midnight until the earliest.
+	From time.Duration
+
+	// Options are the bucket's options while the entry is in effect, their KeyPrefix is ignored in favour of the key passed to
+	// the ScheduledLeakyBucket.
+	Options *LeakyBucketOptions
+}
+
+// ScheduledLeakyBucket wraps a LeakyBucket, choosing the bucket's options by the time of day from a schedule, such as to allow more
+// requests during business hours.
+//
+// The same key is used across the schedule, so the bucket carries its tokens over when its options change, the same as when a
+// bucket's MaximumCapacity is changed: a raised capacity fills towards the new maximum at the new rate, and a lowered capacity
+// shrinks the bucket down to it.
+type ScheduledLeakyBucket struct {
+	// Limiter is the ratelimiter the calls are delegated to.
+	Limiter LeakyBucket
+
+	// Schedule are the options to choose between, in any order.
+	Schedule []LeakyBucketScheduleEntry
+
+	// Location is the time zone the schedule's times of day are in, it defaults to UTC.
+	Location *time.Location
+}
+
+// NewScheduledLeakyBucket creates a new ScheduledLeakyBucket, which delegates to limiter with the options from schedule.
+func NewScheduledLeakyBucket(limiter LeakyBucket, schedule []LeakyBucketScheduleEntry) *ScheduledLeakyBucket {
+	return &ScheduledLeakyBucket{Limiter: limiter, Schedule: schedule}
+}
+
+// Resolve returns the options in effect for the bucket at key. It is compatible with LeakyBucketImpl.OptionsResolver.
+func (s *ScheduledLeakyBucket) Resolve(_ context.Context, key string) (*LeakyBucketOptions, error) {
+	i, err := activeScheduleEntry(len(s.Schedule), func(i int) time.Duration { return s.Schedule[i].From }, s.Location, limiterNow(s.Limiter))
+	if err != nil {
+		return nil, err
+	}
+
+	options := *s.Schedule[i].Options
+	options.KeyPrefix = key
+	return &options, nil
+}
+
+// Inspect inspects the bucket at key with the options currently in effect. It does not take any tokens.
+func (s *ScheduledLeakyBucket) Inspect(ctx context.Context, key string) (*InspectLeakyBucketResponse, error) {
+	bucket, err := s.Resolve(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return s.Limiter.Inspect(ctx, bucket)
+}
+
+// Use attempts to take takeAmount tokens from the bucket at key, with the options currently in effect.
+func (s *ScheduledLeakyBucket) Use(ctx context.Context, key string, takeAmount int) (*UseLeakyBucketResponse, error) {
+	bucket, err := s.Resolve(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return s.Limiter.Use(ctx, bucket, takeAmount)
+}
+
+// SlidingWindowScheduleEntry defines the options a ScheduledSlidingWindow uses from a time of day.
+type SlidingWindowScheduleEntry struct {
+	// From is the time of day the options take effect, as an offset from midnight. They remain in effect until the From of the
+	// next entry, the latest entry wraps around past midnight until the earliest.
+	From time.Duration
+
+	// Options are the window's options while the entry is in effect, their Key is ignored in favour of the key passed to the
+	// ScheduledSlidingWindow.
+	Options *SlidingWindowOptions
+}
+
+// ScheduledSlidingWindow wraps a SlidingWindow, choosing the window's options by the time of day from a schedule, such as to allow
+// more requests during business hours.
+//
+// The same key is used across the schedule, so the tokens already in the window still count when its options change, the same as
+// when a window's MaximumCapacity is changed. See SlidingWindowOptions.TrimOnShrink for how lowering the capacity behaves.
+type ScheduledSlidingWindow struct {
+	// Limiter is the ratelimiter the calls are delegated to.
+	Limiter SlidingWindow
+
+	// Schedule are the options to choose between, in any order.
+	Schedule []SlidingWindowScheduleEntry
+
+	// Location is the time zone the schedule's times of day are in, it defaults to UTC.
+	Location *time.Location
+}
+
+// NewScheduledSlidingWindow creates a new ScheduledSlidingWindow, which delegates to limiter with the options from schedule.
+func NewScheduledSlidingWindow(limiter SlidingWindow, schedule []SlidingWindowScheduleEntry) *ScheduledSlidingWindow {
+	return &ScheduledSlidingWindow{Limiter: limiter, Schedule: schedule}
+}
+
+// Resolve returns the options in effect for the window at key.
+func (s *ScheduledSlidingWindow) Resolve(_ context.Context, key string) (*SlidingWindowOptions, error) {
+	i, err := activeScheduleEntry(len(s.Schedule), func(i int) time.Duration { return s.Schedule[i].From }, s.Location, limiterNow(s.Limiter))
+	if err != nil {
+		return nil, err
+	}
+
+	options := *s.Schedule[i].Options
+	options.Key = key
+	return &options, nil
+}
+
+// Inspect inspects the window at key with the options currently in effect. It does not take any tokens.
+func (s *ScheduledSlidingWindow) Inspect(ctx context.Context, key string) (*InspectSlidingWindowResponse, error) {
+	bucket, err := s.Resolve(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return s.Limiter.Inspect(ctx, bucket)
+}
+
+// Use attempts to take a token from the window at key, with the options currently in effect.
+func (s *ScheduledSlidingWindow) Use(ctx context.Context, key string) (*UseSlidingWindowResponse, error) {
+	bucket, err := s.Resolve(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return s.Limiter.Use(ctx, bucket)
+}
+
+// limiterNow reads the current time from the limiter's clock, such as the nowFunc of the Impls or the Clock of the fakes, so that
+// schedules can be tested without waiting for the time of day to change.
+func limiterNow(limiter interface{}) time.Time {
+	switch clock := limiter.(type) {
+	case interface{ now() time.Time }:
+		return clock.now()
+	case interface{ Now() time.Time }:
+		return clock.Now()
+	default:
+		return time.Now()
+	}
+}
+
+// activeScheduleEntry returns the index of the entry with the latest from that has passed by now's time of day, or the latest
+// entry overall if none have, as it wraps around from the previous day.
+func activeScheduleEntry(n int, from func(int) time.Duration, location *time.Location, now time.Time) (int, error) {
+	if n == 0 {
+		return -1, ErrEmptySchedule
+	}
+
+	if location == nil {
+		location = time.UTC
+	}
+	now = now.In(location)
+	year, month, day := now.Date()
+	timeOfDay := now.Sub(time.Date(year, month, day, 0, 0, 0, 0, location))
+
+	active, latest := -1, 0
+	for i := 0; i < n; i++ {
+		if from(i) <= timeOfDay && (active == -1 || from(i) > from(active)) {
+			active = i
+		}
+		if from(i) > from(latest) {
+			latest = i
+		}
+	}
+
+	if active == -1 {
+		return latest, nil
+	}
+	return active, nil
+}
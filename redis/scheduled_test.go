@@ -0,0 +1,166 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aidenwallis/go-ratelimiting/redis/adapters"
+	goredisadapter "github.com/aidenwallis/go-ratelimiting/redis/adapters/go-redis"
+	redigoadapter "github.com/aidenwallis/go-ratelimiting/redis/adapters/redigo"
+	"github.com/alicebob/miniredis/v2"
+	redigo "github.com/gomodule/redigo/redis"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestActiveScheduleEntry(t *testing.T) {
+	froms := []time.Duration{17 * time.Hour, 9 * time.Hour, 12 * time.Hour}
+	from := func(i int) time.Duration { return froms[i] }
+	day := time.Date(2023, 11, 14, 0, 0, 0, 0, time.UTC)
+
+	testCases := map[string]struct {
+		now      time.Time
+		location *time.Location
+		expected int
+	}{
+		"before the first entry wraps around": {now: day.Add(3 * time.Hour), expected: 0},
+		"at an entry":                         {now: day.Add(9 * time.Hour), expected: 1},
+		"between entries":                     {now: day.Add(13 * time.Hour), expected: 2},
+		"after the last entry":                {now: day.Add(23 * time.Hour), expected: 0},
+		"in the schedule's location":          {now: day.Add(18 * time.Hour), location: time.FixedZone("UTC-5", -5*60*60), expected: 2},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			i, err := activeScheduleEntry(len(froms), from, testCase.location, testCase.now)
+			assert.NoError(t, err)
+			assert.Equal(t, testCase.expected, i)
+		})
+	}
+
+	t.Run("empty", func(t *testing.T) {
+		_, err := activeScheduleEntry(0, from, nil, day)
+		assert.ErrorIs(t, err, ErrEmptySchedule)
+	})
+}
+
+type clockLeakyBucket struct {
+	LeakyBucket
+	clock time.Time
+}
+
+func (c *clockLeakyBucket) Now() time.Time {
+	return c.clock
+}
+
+func TestLimiterNow(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	impl := NewLeakyBucket(&mockAdapter{})
+	impl.nowFunc = func() time.Time { return now }
+	assert.Equal(t, now, limiterNow(impl))
+
+	assert.Equal(t, now, limiterNow(&clockLeakyBucket{clock: now}))
+	assert.WithinDuration(t, time.Now(), limiterNow(&mockAdapter{}), time.Second)
+}
+
+func TestScheduledLeakyBucket(t *testing.T) {
+	testCases := map[string]func(*miniredis.Miniredis) adapters.Adapter{
+		"go-redis": func(t *miniredis.Miniredis) adapters.Adapter {
+			return goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: t.Addr()}))
+		},
+		"redigo": func(t *miniredis.Miniredis) adapters.Adapter {
+			conn, err := redigo.Dial("tcp", t.Addr())
+			if err != nil {
+				panic(err)
+			}
+			return redigoadapter.NewAdapter(conn)
+		},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Date(2023, 11, 14, 8, 59, 0, 0, time.UTC)
+			impl := NewLeakyBucket(testCase(miniredis.RunT(t)))
+			impl.nowFunc = func() time.Time { return now }
+
+			limiter := NewScheduledLeakyBucket(impl, []LeakyBucketScheduleEntry{
+				{From: 9 * time.Hour, Options: &LeakyBucketOptions{KeyPrefix: "ignored", MaximumCapacity: 100, WindowSeconds: 60}},
+				{From: 17 * time.Hour, Options: &LeakyBucketOptions{KeyPrefix: "ignored", MaximumCapacity: 10, WindowSeconds: 60}},
+			})
+
+			resp, err := limiter.Use(ctx, "test-bucket", 10)
+			assert.NoError(t, err)
+			assert.True(t, resp.Success)
+			assert.Equal(t, 0, resp.RemainingTokens)
+
+			// business hours start, the same bucket fills towards its new capacity rather than starting afresh
+			now = now.Add(time.Minute)
+			inspect, err := limiter.Inspect(ctx, "test-bucket")
+			assert.NoError(t, err)
+			assert.Equal(t, 100, inspect.Limit)
+			assert.Equal(t, 100, inspect.RemainingTokens)
+
+			resp, err = limiter.Use(ctx, "test-bucket", 90)
+			assert.NoError(t, err)
+			assert.True(t, resp.Success)
+			assert.Equal(t, 10, resp.RemainingTokens)
+
+			// the resolver plugs into UseKey
+			impl.OptionsResolver = limiter.Resolve
+			resp, err = impl.UseKey(ctx, "test-bucket", 10)
+			assert.NoError(t, err)
+			assert.True(t, resp.Success)
+			assert.Equal(t, 0, resp.RemainingTokens)
+		})
+	}
+
+	t.Run("empty schedule", func(t *testing.T) {
+		limiter := NewScheduledLeakyBucket(NewLeakyBucket(&mockAdapter{}), nil)
+
+		_, err := limiter.Use(context.Background(), "test-bucket", 1)
+		assert.ErrorIs(t, err, ErrEmptySchedule)
+
+		_, err = limiter.Inspect(context.Background(), "test-bucket")
+		assert.ErrorIs(t, err, ErrEmptySchedule)
+	})
+}
+
+func TestScheduledSlidingWindow(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2023, 11, 14, 16, 59, 0, 0, time.UTC)
+	impl := NewSlidingWindow(goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: miniredis.RunT(t).Addr()})))
+	impl.nowFunc = func() time.Time { return now }
+
+	limiter := NewScheduledSlidingWindow(impl, []SlidingWindowScheduleEntry{
+		{From: 9 * time.Hour, Options: &SlidingWindowOptions{MaximumCapacity: 3, Window: time.Hour}},
+		{From: 17 * time.Hour, Options: &SlidingWindowOptions{MaximumCapacity: 1, Window: time.Hour}},
+	})
+
+	for i := 0; i < 2; i++ {
+		resp, err := limiter.Use(ctx, "test-window")
+		assert.NoError(t, err)
+		assert.True(t, resp.Success)
+	}
+
+	// out of hours, the tokens already in the window still count towards the lower capacity
+	now = now.Add(time.Minute)
+	resp, err := limiter.Use(ctx, "test-window")
+	assert.NoError(t, err)
+	assert.False(t, resp.Success)
+
+	inspect, err := limiter.Inspect(ctx, "test-window")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, inspect.Limit)
+
+	_, err = NewScheduledSlidingWindow(impl, nil).Use(ctx, "test-window")
+	assert.ErrorIs(t, err, ErrEmptySchedule)
+	_, err = NewScheduledSlidingWindow(impl, nil).Inspect(ctx, "test-window")
+	assert.ErrorIs(t, err, ErrEmptySchedule)
+}
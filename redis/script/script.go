@@ -0,0 +1,111 @@
+// Package script runs your own Lua scripts through the same adapters as the ratelimiters, and decodes the common shapes of their
+// return values, so you can build your own algorithms on top of the adapter layer.
+//
+// The decoders take the reply and error of a call, in the same manner as redigo's reply helpers, so they can wrap it directly:
+//
+//	tokens, err := script.Int64(script.Eval(ctx, adapter, `return redis.call("incr", KEYS[1])`, []string{"key"}, nil))
+package script
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/aidenwallis/go-ratelimiting/redis/adapters"
+)
+
+// Eval runs script through adapter with EVAL, and returns the raw Lua return value as decoded by the adapter.
+func Eval(ctx context.Context, adapter adapters.Adapter, script string, keys []string, args []interface{}) (interface{}, error) {
+	if keys == nil {
+		keys = []string{}
+	}
+	if args == nil {
+		args = []interface{}{}
+	}
+
+	out, err := adapter.Eval(ctx, script, keys, args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query redis adapter: %w", err)
+	}
+	return out, nil
+}
+
+// Int64 decodes a script returning a Lua number. Redis converts Lua numbers to integers, dropping their fraction, so return
+// fractional values as strings instead. Some clients return numbers as a string or []byte, these are accepted as long as they hold
+// a whole number.
+func Int64(v interface{}, err error) (int64, error) {
+	if err != nil {
+		return 0, err
+	}
+
+	value, ok := int64Value(v)
+	if !ok {
+		return 0, fmt.Errorf("expected int64 but got %s", typeName(v))
+	}
+	return value, nil
+}
+
+// Int64s decodes a script returning a table of Lua numbers, each of which is decoded in the same manner as Int64.
+func Int64s(v interface{}, err error) ([]int64, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	args, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected []interface{} but got %s", typeName(v))
+	}
+
+	out := make([]int64, len(args))
+	for i, arg := range args {
+		value, ok := int64Value(arg)
+		if !ok {
+			return nil, fmt.Errorf("expected int64 in args[%d] but got %s", i, typeName(arg))
+		}
+
+		out[i] = value
+	}
+
+	return out, nil
+}
+
+// String decodes a script returning a Lua string. Some clients return these as a string, and others as a []byte, both are
+// accepted.
+func String(v interface{}, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	default:
+		return "", fmt.Errorf("expected string but got %s", typeName(v))
+	}
+}
+
+// int64Value converts a Lua number to an int64, accepting whole numbers encoded as a string or []byte, as some clients return them.
+func int64Value(v interface{}) (int64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return v, true
+	case string:
+		value, err := strconv.ParseInt(v, 10, 64)
+		return value, err == nil
+	case []byte:
+		value, err := strconv.ParseInt(string(v), 10, 64)
+		return value, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// typeName describes the type of v for errors, naming a nil reply, which Redis returns for a Lua nil or false, rather than <nil>.
+func typeName(v interface{}) string {
+	if v == nil {
+		return "nil"
+	}
+	return fmt.Sprintf("%T", v)
+}
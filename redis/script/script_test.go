@@ -0,0 +1,110 @@
+package script_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aidenwallis/go-ratelimiting/redis/adapters"
+	goredisadapter "github.com/aidenwallis/go-ratelimiting/redis/adapters/go-redis"
+	redigoadapter "github.com/aidenwallis/go-ratelimiting/redis/adapters/redigo"
+	"github.com/aidenwallis/go-ratelimiting/redis/script"
+	"github.com/alicebob/miniredis/v2"
+	redigo "github.com/gomodule/redigo/redis"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+type errorAdapter struct{}
+
+func (errorAdapter) Eval(context.Context, string, []string, []interface{}) (interface{}, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestEval(t *testing.T) {
+	testCases := map[string]func(*miniredis.Miniredis) adapters.Adapter{
+		"go-redis": func(t *miniredis.Miniredis) adapters.Adapter {
+			return goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: t.Addr()}))
+		},
+		"redigo": func(t *miniredis.Miniredis) adapters.Adapter {
+			conn, err := redigo.Dial("tcp", t.Addr())
+			if err != nil {
+				panic(err)
+			}
+			return redigoadapter.NewAdapter(conn)
+		},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			adapter := testCase(miniredis.RunT(t))
+
+			n, err := script.Int64(script.Eval(ctx, adapter, `return redis.call("incrby", KEYS[1], ARGV[1])`, []string{"key"}, []interface{}{5}))
+			assert.NoError(t, err)
+			assert.Equal(t, int64(5), n)
+
+			ns, err := script.Int64s(script.Eval(ctx, adapter, `return {1, tonumber(redis.call("get", KEYS[1]))}`, []string{"key"}, nil))
+			assert.NoError(t, err)
+			assert.Equal(t, []int64{1, 5}, ns)
+
+			s, err := script.String(script.Eval(ctx, adapter, `return redis.call("get", KEYS[1])`, []string{"key"}, nil))
+			assert.NoError(t, err)
+			assert.Equal(t, "5", s)
+		})
+	}
+
+	t.Run("wraps errors", func(t *testing.T) {
+		_, err := script.Int64(script.Eval(context.Background(), errorAdapter{}, "return 1", nil, nil))
+		assert.EqualError(t, err, "failed to query redis adapter: connection refused")
+	})
+}
+
+func TestDecoders_Errors(t *testing.T) {
+	_, err := script.Int64("foo", nil)
+	assert.EqualError(t, err, "expected int64 but got string")
+
+	_, err = script.Int64s("foo", nil)
+	assert.EqualError(t, err, "expected []interface{} but got string")
+
+	_, err = script.Int64s([]interface{}{int64(1), "foo"}, nil)
+	assert.EqualError(t, err, "expected int64 in args[1] but got string")
+
+	_, err = script.Int64s([]interface{}{int64(1), nil}, nil)
+	assert.EqualError(t, err, "expected int64 in args[1] but got nil")
+
+	_, err = script.Int64s([]interface{}{[]interface{}{int64(1)}}, nil)
+	assert.EqualError(t, err, "expected int64 in args[0] but got []interface {}")
+
+	_, err = script.Int64(nil, nil)
+	assert.EqualError(t, err, "expected int64 but got nil")
+
+	_, err = script.Int64("1.5", nil)
+	assert.EqualError(t, err, "expected int64 but got string")
+
+	// some clients return numbers as strings or bytes
+	n, err := script.Int64([]byte("-5"), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-5), n)
+
+	ns, err := script.Int64s([]interface{}{int64(1), "2", []byte("3")}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{1, 2, 3}, ns)
+
+	_, err = script.String(int64(1), nil)
+	assert.EqualError(t, err, "expected string but got int64")
+
+	s, err := script.String([]byte("foo"), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "foo", s)
+
+	callErr := errors.New("boom")
+	_, err = script.Int64(int64(1), callErr)
+	assert.ErrorIs(t, err, callErr)
+	_, err = script.Int64s([]interface{}{}, callErr)
+	assert.ErrorIs(t, err, callErr)
+	_, err = script.String("foo", callErr)
+	assert.ErrorIs(t, err, callErr)
+}
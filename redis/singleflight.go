@@ -0,0 +1,129 @@
+package redis
+
+import (
+	"context"
+	"sync"
+)
+
+// SingleflightLeakyBucket decorates a LeakyBucket so that concurrent Use calls with the same options and takeAmount are collapsed
+// into a single call to Redis, and every caller shares its result. This protects Redis from a stampede of identical requests, such as
+// when a cache entry expires.
+//
+// This changes the ratelimit's accounting: the callers that piggyback on an in-flight call don't take any tokens of their own, so
+// a burst of simultaneous callers only costs the tokens of one. Calls are only shared while one is in flight, results are never
+// cached. Only calls with identical options are shared, so calls with a different IdempotencyKey, DryRun or capacity always make their
+// own call. The first caller's context is used for the shared call, so if it's cancelled, every caller sharing it gets the error,
+// while the callers sharing it return early with their own context's error if theirs is cancelled.
+type SingleflightLeakyBucket struct {
+	LeakyBucket
+
+	group singleflightGroup
+}
+
+var _ LeakyBucket = (*SingleflightLeakyBucket)(nil)
+
+// NewSingleflightLeakyBucket creates a new SingleflightLeakyBucket, deduplicating concurrent Use calls to limiter.
+func NewSingleflightLeakyBucket(limiter LeakyBucket) *SingleflightLeakyBucket {
+	return &SingleflightLeakyBucket{LeakyBucket: limiter}
+}
+
+// Use attempts to use the leaky bucket, sharing the result of any concurrent call already in flight with the same options and
+// takeAmount.
+func (s *SingleflightLeakyBucket) Use(ctx context.Context, bucket *LeakyBucketOptions, takeAmount int) (*UseLeakyBucketResponse, error) {
+	v, err := s.group.do(ctx, singleflightLeakyBucketKey{options: *bucket, takeAmount: takeAmount}, func() (interface{}, error) {
+		return s.LeakyBucket.Use(ctx, bucket, takeAmount)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// every caller gets their own copy, so that one modifying it doesn't affect the others
+	resp := *v.(*UseLeakyBucketResponse)
+	return &resp, nil
+}
+
+// singleflightLeakyBucketKey identifies the calls a SingleflightLeakyBucket can share.
+type singleflightLeakyBucketKey struct {
+	options    LeakyBucketOptions
+	takeAmount int
+}
+
+// SingleflightSlidingWindow decorates a SlidingWindow so that concurrent Use calls with the same options are collapsed into a single
+// call to Redis, and every caller shares its result. This protects Redis from a stampede of identical requests, such as when a
+// cache entry expires.
+//
+// This changes the ratelimit's accounting: the callers that piggyback on an in-flight call don't take a token of their own, so a
+// burst of simultaneous callers only costs one token. Calls are only shared while one is in flight, results are never cached. Only
+// calls with identical options are shared, so calls with a different IdempotencyKey, DryRun or capacity always make their own call.
+// The first caller's context is used for the shared call, so if it's cancelled, every caller sharing it gets the error, while the
+// callers sharing it return early with their own context's error if theirs is cancelled.
+type SingleflightSlidingWindow struct {
+	SlidingWindow
+
+	group singleflightGroup
+}
+
+var _ SlidingWindow = (*SingleflightSlidingWindow)(nil)
+
+// NewSingleflightSlidingWindow creates a new SingleflightSlidingWindow, deduplicating concurrent Use calls to limiter.
+func NewSingleflightSlidingWindow(limiter SlidingWindow) *SingleflightSlidingWindow {
+	return &SingleflightSlidingWindow{SlidingWindow: limiter}
+}
+
+// Use attempts to use the sliding window, sharing the result of any concurrent call already in flight with the same options.
+func (s *SingleflightSlidingWindow) Use(ctx context.Context, bucket *SlidingWindowOptions) (*UseSlidingWindowResponse, error) {
+	v, err := s.group.do(ctx, *bucket, func() (interface{}, error) {
+		return s.SlidingWindow.Use(ctx, bucket)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// every caller gets their own copy, so that one modifying it doesn't affect the others
+	resp := *v.(*UseSlidingWindowResponse)
+	return &resp, nil
+}
+
+// singleflightGroup collapses concurrent calls with the same key into one, in the same manner as golang.org/x/sync/singleflight.
+type singleflightGroup struct {
+	mu    sync.Mutex
+	calls map[interface{}]*singleflightCall
+}
+
+type singleflightCall struct {
+	done chan struct{}
+	val  interface{}
+	err  error
+}
+
+// do calls fn, unless a call for key is already in flight, in which case it waits for it and returns its result instead, or ctx's
+// error if ctx is cancelled first. Keys must be comparable.
+func (g *singleflightGroup) do(ctx context.Context, key interface{}, fn func() (interface{}, error)) (interface{}, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = map[interface{}]*singleflightCall{}
+	}
+	if call, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		select {
+		case <-call.done:
+			return call.val, call.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	call := &singleflightCall{done: make(chan struct{})}
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(call.done)
+	}()
+
+	call.val, call.err = fn()
+	return call.val, call.err
+}
@@ -0,0 +1,214 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// blockingLeakyBucket counts calls to Use, and blocks them until release is closed
+type blockingLeakyBucket struct {
+	LeakyBucket
+	calls   int32
+	started chan struct{}
+	release chan struct{}
+	err     error
+}
+
+func (b *blockingLeakyBucket) Use(_ context.Context, _ *LeakyBucketOptions, takeAmount int) (*UseLeakyBucketResponse, error) {
+	atomic.AddInt32(&b.calls, 1)
+	b.started <- struct{}{}
+	<-b.release
+	if b.err != nil {
+		return nil, b.err
+	}
+	return &UseLeakyBucketResponse{Success: true, Taken: takeAmount}, nil
+}
+
+type blockingSlidingWindow struct {
+	SlidingWindow
+	calls   int32
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingSlidingWindow) Use(_ context.Context, _ *SlidingWindowOptions) (*UseSlidingWindowResponse, error) {
+	atomic.AddInt32(&b.calls, 1)
+	b.started <- struct{}{}
+	<-b.release
+	return &UseSlidingWindowResponse{Success: true, RemainingCapacity: 59}, nil
+}
+
+func TestSingleflightLeakyBucket(t *testing.T) {
+	t.Parallel()
+
+	t.Run("collapses concurrent calls", func(t *testing.T) {
+		t.Parallel()
+
+		inner := &blockingLeakyBucket{started: make(chan struct{}, 10), release: make(chan struct{})}
+		limiter := NewSingleflightLeakyBucket(inner)
+		bucket := leakyBucketOptions()
+
+		ctx := newWaitingContext(context.Background())
+		responses := make([]*UseLeakyBucketResponse, 5)
+		wg := sync.WaitGroup{}
+		for i := range responses {
+			i := i
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				resp, err := limiter.Use(ctx, bucket, 1)
+				assert.NoError(t, err)
+				responses[i] = resp
+			}()
+		}
+
+		<-inner.started
+		ctx.waitFor(len(responses) - 1)
+		close(inner.release)
+		wg.Wait()
+
+		assert.EqualValues(t, 1, atomic.LoadInt32(&inner.calls))
+		for _, resp := range responses {
+			assert.Equal(t, &UseLeakyBucketResponse{Success: true, Taken: 1}, resp)
+		}
+		responses[0].Success = false
+		assert.True(t, responses[1].Success)
+	})
+
+	t.Run("different calls aren't shared", func(t *testing.T) {
+		t.Parallel()
+
+		inner := &blockingLeakyBucket{started: make(chan struct{}, 10), release: make(chan struct{})}
+		limiter := NewSingleflightLeakyBucket(inner)
+
+		idempotent := leakyBucketOptions()
+		idempotent.IdempotencyKey = "request-1"
+		dryRun := leakyBucketOptions()
+		dryRun.DryRun = true
+		resized := leakyBucketOptions()
+		resized.MaximumCapacity = 10
+
+		calls := []struct {
+			bucket     *LeakyBucketOptions
+			takeAmount int
+		}{
+			{leakyBucketOptions(), 1},
+			{leakyBucketOptions(), 2},
+			{idempotent, 1},
+			{dryRun, 1},
+			{resized, 1},
+		}
+
+		wg := sync.WaitGroup{}
+		for _, call := range calls {
+			call := call
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				resp, err := limiter.Use(context.Background(), call.bucket, call.takeAmount)
+				assert.NoError(t, err)
+				assert.Equal(t, call.takeAmount, resp.Taken)
+			}()
+		}
+
+		for range calls {
+			<-inner.started
+		}
+		close(inner.release)
+		wg.Wait()
+
+		assert.EqualValues(t, len(calls), atomic.LoadInt32(&inner.calls))
+	})
+
+	t.Run("callers stop waiting when their context is cancelled", func(t *testing.T) {
+		t.Parallel()
+
+		inner := &blockingLeakyBucket{started: make(chan struct{}, 10), release: make(chan struct{})}
+		limiter := NewSingleflightLeakyBucket(inner)
+		defer close(inner.release)
+
+		go func() {
+			_, _ = limiter.Use(context.Background(), leakyBucketOptions(), 1)
+		}()
+		<-inner.started
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		resp, err := limiter.Use(ctx, leakyBucketOptions(), 1)
+		assert.Nil(t, resp)
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.EqualValues(t, 1, atomic.LoadInt32(&inner.calls))
+	})
+
+	t.Run("shares errors", func(t *testing.T) {
+		t.Parallel()
+
+		inner := &blockingLeakyBucket{started: make(chan struct{}, 10), release: make(chan struct{}), err: errors.New("boom")}
+		limiter := NewSingleflightLeakyBucket(inner)
+		close(inner.release)
+
+		resp, err := limiter.Use(context.Background(), leakyBucketOptions(), 1)
+		assert.Nil(t, resp)
+		assert.EqualError(t, err, "boom")
+
+		// calls aren't cached once they've finished
+		_, err = limiter.Use(context.Background(), leakyBucketOptions(), 1)
+		assert.Error(t, err)
+		assert.EqualValues(t, 2, atomic.LoadInt32(&inner.calls))
+	})
+}
+
+func TestSingleflightSlidingWindow(t *testing.T) {
+	t.Parallel()
+
+	inner := &blockingSlidingWindow{started: make(chan struct{}, 10), release: make(chan struct{})}
+	limiter := NewSingleflightSlidingWindow(inner)
+	bucket := slidingWindowOptions()
+
+	ctx := newWaitingContext(context.Background())
+	wg := sync.WaitGroup{}
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := limiter.Use(ctx, bucket)
+			assert.NoError(t, err)
+			assert.Equal(t, &UseSlidingWindowResponse{Success: true, RemainingCapacity: 59}, resp)
+		}()
+	}
+
+	<-inner.started
+	ctx.waitFor(4)
+	close(inner.release)
+	wg.Wait()
+
+	assert.EqualValues(t, 1, atomic.LoadInt32(&inner.calls))
+}
+
+// waitingContext signals each time a caller starts waiting on it
+type waitingContext struct {
+	context.Context
+	waiting chan struct{}
+}
+
+func newWaitingContext(ctx context.Context) *waitingContext {
+	return &waitingContext{Context: ctx, waiting: make(chan struct{}, 100)}
+}
+
+func (c *waitingContext) Done() <-chan struct{} {
+	c.waiting <- struct{}{}
+	return c.Context.Done()
+}
+
+// waitFor waits until n callers have started waiting on the context
+func (c *waitingContext) waitFor(n int) {
+	for i := 0; i < n; i++ {
+		<-c.waiting
+	}
+}
@@ -18,8 +18,16 @@ type SlidingWindow interface {
 	Inspect(ctx context.Context, bucket *SlidingWindowOptions) (*InspectSlidingWindowResponse, error)
 
 	// Use atomically attempts to use the sliding window. Sliding window ratelimiters always take 1 token at a time, as the key is inferred
-	// from when it would expire in nanoseconds.
+	// from when it would expire.
 	Use(ctx context.Context, bucket *SlidingWindowOptions) (*UseSlidingWindowResponse, error)
+
+	// Reserve atomically attempts to tentatively take a token from the sliding window, which can later be committed or cancelled.
+	// Reservations that are never committed expire on their own after ReservationTTL.
+	Reserve(ctx context.Context, bucket *SlidingWindowOptions) (*Reservation, error)
+
+	// WouldAllowAt projects whether a token could be taken from the sliding window at the given time, assuming nothing else is taken
+	// in the meantime. It does not take any tokens.
+	WouldAllowAt(ctx context.Context, bucket *SlidingWindowOptions, at time.Time) (*WouldAllowResponse, error)
 }
 
 var _ SlidingWindow = (*SlidingWindowImpl)(nil)
@@ -31,6 +39,21 @@ type SlidingWindowImpl struct {
 	// Adapter defines the Redis adapter
 	Adapter adapters.Adapter
 
+	// OnDecision is an optional hook which is called synchronously after every successful call to Redis that takes tokens, which is
+	// useful for audit logging. It is not called when Redis returns an error.
+	OnDecision func(DecisionEvent)
+
+	// OptionsResolver is an optional function which looks up the options for a sliding window by its key, it's required to call
+	// UseKey(). Any caching of options is left to the resolver.
+	OptionsResolver func(ctx context.Context, key string) (*SlidingWindowOptions, error)
+
+	// Logger is optionally used to log debugging information, such as the raw response when Redis returns something unexpected.
+	Logger Logger
+
+	// UseFunctions runs the ratelimiter's scripts as Redis functions with FCALL rather than EVAL. The adapter must implement
+	// adapters.FunctionAdapter, and the library must be loaded with LoadFunctions() first.
+	UseFunctions bool
+
 	// nowFunc is a private helper used to mock out time changes in unit testing
 	//
 	// if this is not defined, it falls back to time.Now()
@@ -46,8 +69,107 @@ type SlidingWindowOptions struct {
 	// window at any time.
 	MaximumCapacity int
 
-	// Window defines the size of the sliding window, resolution is available up to nanoseconds.
+	// Window defines the size of the sliding window, resolution is available up to milliseconds.
 	Window time.Duration
+
+	// SoftCapacity optionally defines a soft cap on the sliding window. Exceeding the soft cap does not cause the ratelimit to fail,
+	// instead, OverSoftLimit is set on the response. This is useful for allowing bursts up to MaximumCapacity while still
+	// being able to log or alert on callers who routinely exceed their nominal quota.
+	//
+	// If this is not set, the soft cap is disabled.
+	SoftCapacity int
+
+	// Granularity optionally enables approximate counting, which is useful for very large windows. When set, tokens are grouped
+	// into sub-windows of this size, and a single counter is stored per sub-window rather than one sorted set member per token,
+	// meaning memory stays roughly constant at Window/Granularity entries regardless of how many tokens are taken.
+	//
+	// The tradeoff is accuracy: each token's expiry is rounded up to the end of its sub-window, so tokens may remain in the window
+	// for up to Granularity longer than Window. The ratelimiter will never allow more than MaximumCapacity tokens, but may be
+	// slightly stricter than an exact sliding window.
+	//
+	// Approximate buckets are stored in a different format, so changing this for an existing key is not supported. If this is
+	// not set, every token is tracked exactly.
+	Granularity time.Duration
+
+	// Precision optionally snaps each token's timestamp down to a multiple of this duration, such as time.Second, so the window's
+	// notion of "the last minute" lines up with reporting that buckets requests by whole seconds. A token taken at 12:00:00.7 then
+	// expires at 12:01:00 rather than 12:01:00.7.
+	//
+	// The tradeoff is accuracy: tokens may leave the window up to Precision earlier than an exact sliding window would free them, so
+	// the window may briefly allow slightly more than MaximumCapacity tokens in any exact Window. Combine this with an equal
+	// Granularity to also share a single counter between the tokens taken in each snapped interval. This only applies to Use, and
+	// is ignored when ServerClock is set. If this is not set, tokens are tracked with millisecond precision.
+	Precision time.Duration
+
+	// ReservationTTL defines how long a token taken by Reserve() is held for before it's discarded, unless it is committed.
+	//
+	// If this is not set, DefaultReservationTTL is used.
+	ReservationTTL time.Duration
+
+	// ReadOnlyInspect makes Inspect() count only the tokens that haven't expired, rather than removing the expired tokens from Redis.
+	// This means Inspect() never writes to Redis, so it can be run against read replicas, leaving cleanup and bumping the key's ttl to
+	// Use().
+	ReadOnlyInspect bool
+
+	// CompactionThreshold optionally bounds how many members are stored in Redis for this sliding window, which is useful to bound
+	// memory when many keys sit at a high MaximumCapacity. Once Use() pushes the window above this many members, the oldest members
+	// are merged into a single counted sentinel member, so the window never holds more than CompactionThreshold members.
+	//
+	// Compaction preserves the count of tokens in the window, but merged tokens all expire together with the newest token that was
+	// merged, so capacity is freed later than an exact sliding window would free it. Compaction only applies to exact windows (it's
+	// ignored when Granularity is set), reservations that are merged can no longer be committed, and values below 2 disable it.
+	CompactionThreshold int
+
+	// PenaltyThreshold optionally defines how many consecutive denials a caller may receive before they're put into a cool-down,
+	// during which Use is denied even if the window has room. Consecutive denials are counted in a companion key, suffixed with
+	// ::penalty, and any successful Use resets the count. Penalties are disabled unless both this and PenaltyDuration are set.
+	PenaltyThreshold int
+
+	// PenaltyDuration defines how long the cool-down lasts once PenaltyThreshold is reached, resolution is available up to
+	// milliseconds.
+	PenaltyDuration time.Duration
+
+	// IdempotencyKey optionally identifies the request, so that a retry of it doesn't take another token. If a request with the same
+	// IdempotencyKey was seen within IdempotencyTTL, Use returns the same decision it made the first time, without taking anything.
+	// The decision is remembered in a companion key, suffixed with ::idempotency:: and the IdempotencyKey. As retrying the call is
+	// safe, it's marked with adapters.WithIdempotent, so decorators such as the retry adapter retry it.
+	IdempotencyKey string
+
+	// IdempotencyTTL defines how long an IdempotencyKey is remembered for. If this is not set, DefaultIdempotencyTTL is used.
+	IdempotencyTTL time.Duration
+
+	// ServerClock makes Inspect() and Use() read the current time from Redis with the TIME command, rather than from the client. This
+	// means clock skew between your servers can't cause tokens to be stored with expiries that are inconsistent with each other.
+	//
+	// Reservations and penalties are still measured with the client's clock.
+	ServerClock bool
+
+	// TrimOnShrink makes Use() discard the oldest tokens when the window holds more than MaximumCapacity, which happens when
+	// MaximumCapacity is reduced for an existing key. Otherwise, the window stays over capacity, denying every call, until enough
+	// of the tokens taken under the old capacity expire, which can take up to a full window.
+	TrimOnShrink bool
+
+	// DryRun runs Use in shadow mode, which is useful to measure the impact of a new limit before enforcing it. The window is used
+	// as normal, taking a token when there's room, but Success is always true, and WouldHaveBeenLimited is set on the response when
+	// the take was denied.
+	DryRun bool
+
+	// TrackPeak makes Use record the most tokens that have been in the window at once, which Inspect reports as Peak. This is useful
+	// for tuning capacity: a peak far below MaximumCapacity means the limit could be lowered, and a peak at it means callers are
+	// regularly brushing the limit. The peak is stored in a companion key, suffixed with ::peak, which expires along with the
+	// window once it's idle, or when it's deleted, such as with ResetNamespace.
+	TrackPeak bool
+
+	// BurstCapacity optionally allows occasional bursts beyond MaximumCapacity, without permanently raising the steady limit. When
+	// the window is full, Use draws a token from a separate burst pool instead, and sets UsedBurst on the response. The pool starts
+	// full, and refills a token every BurstRefill, up to BurstCapacity. It's stored in a companion key, suffixed with ::burst.
+	//
+	// Burst tokens aren't added to the window, so they don't delay it freeing up. The pool is disabled unless both this and
+	// BurstRefill are set.
+	BurstCapacity int
+
+	// BurstRefill defines how often a token is added back to the burst pool, resolution is available up to milliseconds.
+	BurstRefill time.Duration
 }
 
 // NewSlidingWindow creates a new sliding window instance
@@ -58,6 +180,31 @@ func NewSlidingWindow(adapter adapters.Adapter) *SlidingWindowImpl {
 	}
 }
 
+// HealthCheck verifies that the adapter is able to run Lua scripts against Redis, and that responses are returned in the shape
+// this ratelimiter expects. This is useful as a readiness probe, as some managed Redis variants disable scripting.
+func (r *SlidingWindowImpl) HealthCheck(ctx context.Context) error {
+	return healthCheck(ctx, r.Adapter, r.UseFunctions)
+}
+
+// Close releases the resources held by the adapter, if the adapter implements io.Closer. Otherwise, it does nothing.
+func (r *SlidingWindowImpl) Close() error {
+	return closeAdapter(r.Adapter)
+}
+
+// eval runs script through the adapter, using FCALL when UseFunctions is set.
+func (r *SlidingWindowImpl) eval(ctx context.Context, script string, keys []string, args []interface{}) (interface{}, error) {
+	return evalScript(ctx, r.Adapter, r.UseFunctions, script, keys, args)
+}
+
+// nowArg returns the current time in milliseconds to pass to the scripts, or 0 when ServerClock is set, which makes the scripts read
+// the time from Redis instead.
+func (r *SlidingWindowImpl) nowArg(bucket *SlidingWindowOptions) int64 {
+	if bucket.ServerClock {
+		return 0
+	}
+	return r.now().UnixMilli()
+}
+
 func (r *SlidingWindowImpl) now() time.Time {
 	if r.nowFunc == nil {
 		return time.Now()
@@ -69,42 +216,114 @@ func (r *SlidingWindowImpl) now() time.Time {
 type InspectSlidingWindowResponse struct {
 	// RemainingCapacity defines the remaining amount of capacity left in the bucket
 	RemainingCapacity int
+
+	// Limit is the window's MaximumCapacity, it's echoed back alongside Window so that clients can estimate their ratelimit locally
+	// between calls.
+	Limit int
+
+	// Window is the size of the sliding window
+	Window time.Duration
+
+	// Peak is the most tokens that have been in the window at once, when TrackPeak is set.
+	Peak int
+
+	// CurrentCount is how many tokens are in the window. Unlike RemainingCapacity it isn't clamped, so it may exceed
+	// MaximumCapacity, such as just after the capacity was reduced, which makes it useful to tell how far over its limit a key is.
+	CurrentCount int
 }
 
-// Inspect inspects the current state of the sliding window bucket
-func (r *SlidingWindowImpl) Inspect(ctx context.Context, bucket *SlidingWindowOptions) (*InspectSlidingWindowResponse, error) {
-	const script = `
+// slidingWindowInspectScript clears expired tokens, bumps the key's ttl, and returns how many tokens are in the window.
+var slidingWindowInspectScript = newScript(`
 local key = KEYS[1]
+local compactedKey = KEYS[2]
 local now = ARGV[1]
-
+local window = ARGV[2]
+` + serverClockScript + legacyScoresScript + `
 redis.call("zremrangebyscore", key, "-inf", now) -- clear expired tokens
+redis.call("expire", key, window)
 
 local tokens = tonumber(redis.call("zcard", key))
 if (tokens == nil) then
 	tokens = 0
 end
-
+` + compactedTokensScript + `
 return tokens
-`
+`)
 
-	resp, err := r.Adapter.Eval(ctx, script, []string{bucket.Key}, []interface{}{r.now().UnixNano()})
+// Inspect inspects the current state of the sliding window bucket
+func (r *SlidingWindowImpl) Inspect(ctx context.Context, bucket *SlidingWindowOptions) (*InspectSlidingWindowResponse, error) {
+	script := slidingWindowInspectScript
+	switch {
+	case bucket.Granularity > 0 && bucket.ReadOnlyInspect:
+		script = readOnlyApproximateInspectScript
+	case bucket.Granularity > 0:
+		script = approximateInspectScript
+	case bucket.ReadOnlyInspect:
+		script = readOnlyInspectScript
+	}
+
+	remaining, count, err := r.remainingCapacity(ctx, script, bucket, r.nowArg(bucket), slidingWindowTTL(bucket))
 	if err != nil {
-		return nil, fmt.Errorf("failed to query redis adapter: %w", err)
+		return nil, err
+	}
+
+	resp := &InspectSlidingWindowResponse{
+		RemainingCapacity: remaining,
+		Limit:             bucket.MaximumCapacity,
+		Window:            bucket.Window,
+		CurrentCount:      count,
+	}
+
+	if bucket.TrackPeak {
+		if resp.Peak, err = readPeak(ctx, r.Adapter, r.UseFunctions, r.Logger, bucket.Key); err != nil {
+			return nil, err
+		}
+	}
+
+	return resp, nil
+}
+
+// WouldAllowAt projects whether a token could be taken from the sliding window at the given time, assuming nothing else is taken in
+// the meantime. It does not take any tokens, nor write to Redis, which is useful for capacity planning, and for asserting how a window
+// will behave in tests without advancing a clock. Penalties and idempotency keys are not considered.
+func (r *SlidingWindowImpl) WouldAllowAt(ctx context.Context, bucket *SlidingWindowOptions, at time.Time) (*WouldAllowResponse, error) {
+	script := readOnlyInspectScript
+	if bucket.Granularity > 0 {
+		script = readOnlyApproximateInspectScript
+	}
+
+	remaining, _, err := r.remainingCapacity(ctx, script, bucket, at.UnixMilli(), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &WouldAllowResponse{Allowed: remaining > 0, Remaining: remaining}
+	if resp.Allowed {
+		resp.Remaining--
 	}
+	return resp, nil
+}
 
-	tokens, ok := resp.(int64)
+// remainingCapacity runs one of the inspect scripts as of now, and returns how many more tokens may be taken from the window,
+// alongside how many tokens are in it. ttl is what the key's ttl is bumped to, in seconds, which the read only scripts ignore.
+func (r *SlidingWindowImpl) remainingCapacity(ctx context.Context, script string, bucket *SlidingWindowOptions, now int64, ttl int) (int, int, error) {
+	resp, err := r.eval(adapters.WithIdempotent(ctx), script, slidingWindowKeys(bucket.Key), []interface{}{now, ttl})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to query redis adapter: %w", err)
+	}
+
+	tokens, ok := integer(resp)
 	if !ok {
-		return nil, fmt.Errorf("expecting int64 but got %T", resp)
+		err := fmt.Errorf("expecting int64 but got %T", resp)
+		logUnexpectedResponse(r.Logger, bucket.Key, resp, err)
+		return 0, 0, err
 	}
 
 	remaining := 0
 	if v := bucket.MaximumCapacity - int(tokens); v > 0 {
 		remaining = v
 	}
-
-	return &InspectSlidingWindowResponse{
-		RemainingCapacity: remaining,
-	}, nil
+	return remaining, int(tokens), nil
 }
 
 // UseSlidingWindowResponse defines the response parameters for SlidingWindow.Use()
@@ -114,52 +333,173 @@ type UseSlidingWindowResponse struct {
 
 	// RemainingCapacity defines the remaining amount of capacity left in the bucket
 	RemainingCapacity int
+
+	// OverSoftLimit is true when the number of tokens in the window exceeds SlidingWindowOptions.SoftCapacity
+	OverSoftLimit bool
+
+	// PenaltyUntil is the time at which the caller's cool-down ends, when PenaltyThreshold has been reached. It is zero when the
+	// caller isn't cooling down.
+	PenaltyUntil time.Time
+
+	// WouldHaveBeenLimited is true when DryRun is set and the take was denied, in which case Success is overridden to true.
+	WouldHaveBeenLimited bool
+
+	// UsedBurst is true when the window was full, so the token was taken from the burst pool instead, see BurstCapacity.
+	UsedBurst bool
+
+	// CurrentCount is how many tokens are in the window, including this one when it was taken. Unlike RemainingCapacity it isn't
+	// clamped, so it may exceed MaximumCapacity, such as just after the capacity was reduced, which makes it useful to tell how
+	// far over its limit a key is.
+	CurrentCount int
 }
 
-// Use atomically attempts to use the sliding window.
-func (r *SlidingWindowImpl) Use(ctx context.Context, bucket *SlidingWindowOptions) (*UseSlidingWindowResponse, error) {
-	const script = `
+// slidingWindowUseScript clears expired tokens, and adds a token to the window if there is room available, the caller isn't cooling
+// down, and the request isn't a retry. When the window is full, a token may be taken from the burst pool instead. The key's ttl is
+// bumped either way, so a key that's always denied isn't evicted before its tokens expire, which would reset its count.
+var slidingWindowUseScript = newScript(`
 local key = KEYS[1]
+local compactedKey = KEYS[2]
 local now = ARGV[1]
 local expiresAt = ARGV[2]
 local window = ARGV[3]
 local max = tonumber(ARGV[4])
-
+local softMax = tonumber(ARGV[5])
+local compactAt = tonumber(ARGV[6])
+local member = ARGV[7]
+local trim = tonumber(ARGV[9])
+local trackPeak = tonumber(ARGV[10])
+` + serverClockScript + `
+if (serverClock) then
+	expiresAt = now + tonumber(expiresAt) -- expiresAt is relative to the server clock
+end
+` + legacyScoresScript + `
 redis.call("zremrangebyscore", key, "-inf", now) -- clear expired tokens
 
 local tokens = tonumber(redis.call("zcard", key))
 if (tokens == nil) then
 	tokens = 0 -- default tokens to 0
 end
-
+` + compactedTokensScript + `
+if (trim == 1 and tokens > max) then
+	-- capacity was reduced: discard the oldest tokens, drawing down the compacted sentinel's count before removing it
+	local excess = tokens - max
+	local oldest = redis.call("zrange", key, 0, excess - 1)
+	for i = 1, #oldest do
+		if (oldest[i] == "compacted") then
+			local count = tonumber(redis.call("get", compactedKey) or "0")
+			if (count > excess) then
+				redis.call("decrby", compactedKey, excess)
+				excess = 0
+			else
+				redis.call("zrem", key, "compacted")
+				redis.call("del", compactedKey)
+				excess = excess - count
+			end
+		elseif (excess > 0) then
+			redis.call("zrem", key, oldest[i])
+			excess = excess - 1
+		end
+	end
+	tokens = max
+end
+` + companionKeyScript + penaltyCheckScript + idempotencyCheckScript + `
 local success = 0
 
-if (tokens < max) then
-	-- room available: add a token, bump ttl, and include newly added token in count
-	redis.call("zadd", key, expiresAt, expiresAt)
-	redis.call("expire", key, window)
+if (not replayed and penaltyUntil == 0 and tokens < max) then
+	-- room available: add a token, and include newly added token in count
+	redis.call("zadd", key, expiresAt, member)
 	success = 1
 	tokens = tokens + 1
 end
 
-return {success, tokens}
-	`
+redis.call("expire", key, window)
+` + slidingWindowBurstScript + `
+local used = tokens
+local peakTTL = window
+` + peakRecordScript + idempotencyRecordScript + `
+local members = redis.call("zcard", key)
+if (compactAt > 1 and members > compactAt) then
+	-- merge the oldest members, including any existing sentinel, into a single sentinel which expires with the newest merged member
+	local oldest = redis.call("zrange", key, 0, members - compactAt, "WITHSCORES")
+	local merged = 0
+	local mergedExpiry = now
+	for i = 1, #oldest, 2 do
+		if (oldest[i] == "compacted") then
+			merged = merged + tonumber(redis.call("get", compactedKey) or "0")
+		else
+			merged = merged + 1
+		end
+		mergedExpiry = oldest[i + 1]
+		redis.call("zrem", key, oldest[i])
+	end
+
+	redis.call("zadd", key, mergedExpiry, "compacted")
+	redis.call("set", compactedKey, tostring(merged), "EX", window)
+end
+` + penaltyRecordScript + `
+local overSoftLimit = 0
 
+if (softMax > 0 and tokens > softMax) then
+	overSoftLimit = 1
+end
+
+return {success, tokens, overSoftLimit, penaltyUntil, usedBurst}
+`)
+
+// Use atomically attempts to use the sliding window.
+func (r *SlidingWindowImpl) Use(ctx context.Context, bucket *SlidingWindowOptions) (*UseSlidingWindowResponse, error) {
+	script := slidingWindowUseScript
 	now := r.now()
-	current := now.UnixNano()
-	expiresAt := now.Add(bucket.Window).UnixNano()
-	windowTTL := int(math.Ceil(bucket.Window.Seconds()))
+	current := now.UnixMilli()
+	expiresAt := now.Add(bucket.Window).UnixMilli()
+	windowTTL := slidingWindowTTL(bucket)
+	granularity := bucket.Granularity.Milliseconds()
 
-	resp, err := r.Adapter.Eval(ctx, script, []string{bucket.Key}, []interface{}{
-		current, expiresAt, windowTTL, bucket.MaximumCapacity,
-	})
+	if precision := bucket.Precision.Milliseconds(); precision > 0 {
+		expiresAt = current/precision*precision + bucket.Window.Milliseconds()
+	}
+
+	if bucket.Granularity > 0 {
+		// round the expiry up to the end of its sub-window, and keep the key around long enough for the last sub-window to expire
+		script = approximateUseScript
+		if granularity < 1 {
+			granularity = 1
+		}
+		expiresAt = (expiresAt + granularity - 1) / granularity * granularity
+	}
+
+	// the score is the expiry, but members must be unique, otherwise tokens taken in the same millisecond would overwrite each other
+	id, err := newMemberID()
+	if err != nil {
+		return nil, fmt.Errorf("generating member id: %w", err)
+	}
+	member := fmt.Sprintf("%d-%s", expiresAt, id)
+
+	if bucket.ServerClock {
+		// the script reads the time from Redis, so the expiry is passed relative to it
+		current, expiresAt = 0, bucket.Window.Milliseconds()
+	}
+
+	args := append([]interface{}{
+		current, expiresAt, windowTTL, bucket.MaximumCapacity, bucket.SoftCapacity, bucket.CompactionThreshold, member, granularity,
+		boolArg(bucket.TrimOnShrink), boolArg(bucket.TrackPeak),
+	}, burstArgs(bucket.BurstCapacity, bucket.BurstRefill)...)
+	args = append(args, idempotencyArg(bucket.IdempotencyKey, bucket.IdempotencyTTL))
+	args = append(args, penaltyArgs(now, bucket.PenaltyThreshold, bucket.PenaltyDuration)...)
+	keys := append(slidingWindowKeys(bucket.Key), companionKeys(
+		bucket.Key, bucket.TrackPeak, burstEnabled(bucket.BurstCapacity, bucket.BurstRefill), false, bucket.IdempotencyKey,
+		penaltyEnabled(bucket.PenaltyThreshold, bucket.PenaltyDuration),
+	)...)
+
+	resp, err := r.eval(idempotentUse(ctx, bucket.IdempotencyKey), script, keys, args)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query redis adapter: %w", err)
 	}
 
 	output, err := parseSlidingWindowResponse(resp)
 	if err != nil {
-		return nil, fmt.Errorf("parsing redis response: %w", err)
+		logUnexpectedResponse(r.Logger, bucket.Key, resp, err)
+		return nil, parsingError(script, err)
 	}
 
 	remaining := 0
@@ -167,15 +507,237 @@ return {success, tokens}
 		remaining = v
 	}
 
+	emitDecision(r.OnDecision, DecisionEvent{
+		Key:        bucket.Key,
+		Allowed:    output.success,
+		Remaining:  remaining,
+		TakeAmount: 1,
+		DryRun:     bucket.DryRun,
+	})
+
 	return &UseSlidingWindowResponse{
-		Success:           output.success,
-		RemainingCapacity: remaining,
+		Success:              output.success || bucket.DryRun,
+		RemainingCapacity:    remaining,
+		OverSoftLimit:        output.overSoftLimit,
+		PenaltyUntil:         output.penaltyUntil,
+		WouldHaveBeenLimited: bucket.DryRun && !output.success,
+		UsedBurst:            output.usedBurst,
+		CurrentCount:         output.tokens,
 	}, nil
 }
 
+// approximateInspectScript is the equivalent of the Inspect script for sliding windows with Granularity set. Sub-windows are stored
+// in a hash, where the field is when the sub-window expires, and the value is how many tokens were taken in it.
+var approximateInspectScript = newScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local window = ARGV[2]
+` + serverClockScript + legacySubWindowScript + `
+local tokens = 0
+local subWindows = redis.call("hgetall", key)
+for i = 1, #subWindows, 2 do
+	if (subWindowExpiry(subWindows[i]) <= now) then
+		redis.call("hdel", key, subWindows[i]) -- clear expired sub-windows
+	else
+		tokens = tokens + tonumber(subWindows[i + 1])
+	end
+end
+
+redis.call("expire", key, window)
+
+return tokens
+`)
+
+// UseKey is equivalent to Use, except the sliding window's options are looked up from key using the OptionsResolver.
+func (r *SlidingWindowImpl) UseKey(ctx context.Context, key string) (*UseSlidingWindowResponse, error) {
+	if r.OptionsResolver == nil {
+		return nil, ErrNoOptionsResolver
+	}
+
+	bucket, err := r.OptionsResolver(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("resolving options: %w", err)
+	}
+
+	return r.Use(ctx, bucket)
+}
+
+// compactedTokensScript adjusts the tokens counted in an exact sliding window for the compacted sentinel member, which stands in for
+// the count stored in compactedKey rather than a single token. It expects key, compactedKey, now and tokens to be defined, where tokens
+// only includes unexpired members.
+const compactedTokensScript = `
+local compactedExpiry = redis.call("zscore", key, "compacted")
+if (compactedExpiry and tonumber(compactedExpiry) > tonumber(now)) then
+	tokens = tokens - 1 + tonumber(redis.call("get", compactedKey) or "0")
+end
+`
+
+// serverClockScript is concatenated into the sliding window scripts once now has been read. A now of 0 means ServerClock is set,
+// in which case the current time is read from Redis in milliseconds instead, and serverClock is set so scripts can adjust any
+// relative arguments.
+const serverClockScript = `
+local serverClock = tonumber(now) == 0
+if (serverClock) then
+	redis.replicate_commands() -- Redis versions older than 5 refuse writes after TIME unless effects are replicated
+	local time = redis.call("time")
+	now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+end
+`
+
+// legacyScoresScript is concatenated into the exact scripts before expired tokens are cleared. Scores used to be stored in
+// nanoseconds, which can't be represented exactly as a double, so any left over from older versions are rescaled to milliseconds.
+const legacyScoresScript = `
+local legacy = redis.call("zrangebyscore", key, "1000000000000000", "+inf", "WITHSCORES")
+for i = 1, #legacy, 2 do
+	redis.call("zadd", key, math.floor(tonumber(legacy[i + 1]) / 1000000), legacy[i])
+end
+`
+
+// legacySubWindowScript is concatenated into the approximate scripts, it reads a sub-window's expiry from its field. Sub-windows
+// used to be keyed in nanoseconds, so any left over from older versions are read as milliseconds.
+const legacySubWindowScript = `
+local function subWindowExpiry(field)
+	local expiry = tonumber(field)
+	if (expiry > 1000000000000000) then
+		expiry = math.floor(expiry / 1000000)
+	end
+	return expiry
+end
+`
+
+// readOnlyInspectScript is the equivalent of the Inspect script when ReadOnlyInspect is set, it counts the unexpired tokens without
+// removing the expired ones. Scores left in nanoseconds by older versions can't be rescaled without writing, see legacyScoresScript,
+// so they're counted separately, against now in nanoseconds.
+var readOnlyInspectScript = newScript(`
+local key = KEYS[1]
+local compactedKey = KEYS[2]
+local now = ARGV[1]
+` + serverClockScript + `
+local tokens = tonumber(redis.call("zcount", key, "(" .. now, "(1000000000000000"))
+if (tokens == nil) then
+	tokens = 0
+end
+
+-- a legacy score is unexpired when it's still after now once rescaled to milliseconds
+local legacyTokens = tonumber(redis.call("zcount", key, (tonumber(now) + 1) * 1000000, "+inf"))
+if (legacyTokens ~= nil) then
+	tokens = tokens + legacyTokens
+end
+` + compactedTokensScript + `
+return tokens
+`)
+
+// readOnlyApproximateInspectScript is the equivalent of the approximate Inspect script when ReadOnlyInspect is set.
+var readOnlyApproximateInspectScript = newScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+` + serverClockScript + legacySubWindowScript + `
+local tokens = 0
+local subWindows = redis.call("hgetall", key)
+for i = 1, #subWindows, 2 do
+	if (subWindowExpiry(subWindows[i]) > now) then
+		tokens = tokens + tonumber(subWindows[i + 1])
+	end
+end
+
+return tokens
+`)
+
+// approximateUseScript is the equivalent of the Use script for sliding windows with Granularity set.
+var approximateUseScript = newScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+` + legacySubWindowScript + `local expiresAt = ARGV[2]
+local window = ARGV[3]
+local max = tonumber(ARGV[4])
+local softMax = tonumber(ARGV[5])
+local granularity = tonumber(ARGV[8])
+local trim = tonumber(ARGV[9])
+local trackPeak = tonumber(ARGV[10])
+` + serverClockScript + `
+if (serverClock) then
+	-- expiresAt is relative to the server clock, so round it up to the end of its sub-window
+	expiresAt = math.ceil((now + tonumber(expiresAt)) / granularity) * granularity
+end
+
+local tokens = 0
+local subWindows = redis.call("hgetall", key)
+for i = 1, #subWindows, 2 do
+	if (subWindowExpiry(subWindows[i]) <= now) then
+		redis.call("hdel", key, subWindows[i]) -- clear expired sub-windows
+	else
+		tokens = tokens + tonumber(subWindows[i + 1])
+	end
+end
+
+if (trim == 1 and tokens > max) then
+	-- capacity was reduced: discard tokens from the sub-windows that expire soonest
+	local expiries = {}
+	local live = redis.call("hgetall", key) -- expired sub-windows were removed above
+	for i = 1, #live, 2 do
+		table.insert(expiries, {subWindowExpiry(live[i]), live[i], tonumber(live[i + 1])})
+	end
+	table.sort(expiries, function(a, b) return a[1] < b[1] end)
+
+	local excess = tokens - max
+	for _, subWindow in ipairs(expiries) do
+		if (excess == 0) then
+			break
+		end
+		if (subWindow[3] > excess) then
+			redis.call("hincrby", key, subWindow[2], -excess)
+			excess = 0
+		else
+			redis.call("hdel", key, subWindow[2])
+			excess = excess - subWindow[3]
+		end
+	end
+	tokens = max
+end
+` + companionKeyScript + penaltyCheckScript + idempotencyCheckScript + `
+local success = 0
+
+if (not replayed and penaltyUntil == 0 and tokens < max) then
+	-- room available: count the token in its sub-window, and include newly added token in count
+	redis.call("hincrby", key, expiresAt, 1)
+	success = 1
+	tokens = tokens + 1
+end
+
+redis.call("expire", key, window)
+` + slidingWindowBurstScript + `
+local used = tokens
+local peakTTL = window
+` + peakRecordScript + idempotencyRecordScript + penaltyRecordScript + `
+local overSoftLimit = 0
+
+if (softMax > 0 and tokens > softMax) then
+	overSoftLimit = 1
+end
+
+return {success, tokens, overSoftLimit, penaltyUntil, usedBurst}
+`)
+
+// slidingWindowTTL returns the ttl for the sliding window's key, in seconds, which is bumped whenever the window is accessed. With
+// Granularity set, it covers the extra time that tokens can spend in their sub-window, so the last sub-window can expire first.
+func slidingWindowTTL(bucket *SlidingWindowOptions) int {
+	return int(math.Ceil((bucket.Window + bucket.Granularity).Seconds()))
+}
+
+func slidingWindowKeys(key string) []string {
+	return []string{key, compactedKey(key)}
+}
+
+func compactedKey(key string) string {
+	return key + "::compacted"
+}
+
 type slidingWindowOutput struct {
-	success bool
-	tokens  int
+	success       bool
+	tokens        int
+	overSoftLimit bool
+	penaltyUntil  time.Time
+	usedBurst     bool
 }
 
 func parseSlidingWindowResponse(v interface{}) (*slidingWindowOutput, error) {
@@ -184,12 +746,15 @@ func parseSlidingWindowResponse(v interface{}) (*slidingWindowOutput, error) {
 		return nil, err
 	}
 
-	if len(ints) != 2 {
-		return nil, fmt.Errorf("expected 2 args but got %d", len(ints))
+	if len(ints) != 5 {
+		return nil, fmt.Errorf("expected 5 args but got %d", len(ints))
 	}
 
 	return &slidingWindowOutput{
-		success: ints[0] == 1,
-		tokens:  int(ints[1]),
+		success:       ints[0] == 1,
+		tokens:        int(ints[1]),
+		overSoftLimit: ints[2] == 1,
+		penaltyUntil:  parsePenaltyUntil(ints[3]),
+		usedBurst:     ints[4] == 1,
 	}, nil
 }
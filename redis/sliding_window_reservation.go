@@ -0,0 +1,231 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/aidenwallis/go-ratelimiting/redis/adapters"
+)
+
+// DefaultReservationTTL is how long a sliding window reservation is held for when SlidingWindowOptions.ReservationTTL is not set.
+const DefaultReservationTTL = time.Second * 10
+
+var (
+	// ErrReservationsUnsupported is returned when attempting to reserve a token in an approximate sliding window, as approximate
+	// windows do not track individual tokens.
+	ErrReservationsUnsupported = errors.New("reservations are not supported with approximate counting")
+
+	// ErrReservationFailed is returned when attempting to commit a reservation that was not successful.
+	ErrReservationFailed = errors.New("reservation was not successful")
+
+	// ErrReservationExpired is returned when attempting to commit a reservation that has already expired or been cancelled.
+	ErrReservationExpired = errors.New("reservation has expired")
+)
+
+// Reservation is a tentative token in a sliding window, created by SlidingWindow.Reserve(). The token counts towards the window's
+// capacity until it is either committed, cancelled, or the reservation TTL passes.
+type Reservation struct {
+	// Success defines whether a token was successfully reserved
+	Success bool
+
+	// RemainingCapacity defines the remaining amount of capacity left in the bucket, including the reserved token
+	RemainingCapacity int
+
+	commit func(ctx context.Context) error
+	cancel func(ctx context.Context) error
+}
+
+// NewReservation creates a reservation which calls commit and cancel when it's committed or cancelled. This is only needed if
+// you're building your own SlidingWindow implementation, such as a fake for testing.
+//
+// commit and cancel are only called if the reservation was successful.
+func NewReservation(success bool, remainingCapacity int, commit, cancel func(ctx context.Context) error) *Reservation {
+	return &Reservation{
+		Success:           success,
+		RemainingCapacity: remainingCapacity,
+		commit:            commit,
+		cancel:            cancel,
+	}
+}
+
+// reserveScript clears expired tokens, bumps the key's ttl, and adds a tentative token to the window if there is room available.
+var reserveScript = newScript(`
+local key = KEYS[1]
+local compactedKey = KEYS[2]
+local now = ARGV[1]
+local expiresAt = ARGV[2]
+local window = ARGV[3]
+local max = tonumber(ARGV[4])
+local member = ARGV[5]
+` + legacyScoresScript + `
+redis.call("zremrangebyscore", key, "-inf", now) -- clear expired tokens
+
+local tokens = tonumber(redis.call("zcard", key))
+if (tokens == nil) then
+	tokens = 0 -- default tokens to 0
+end
+` + compactedTokensScript + `
+local success = 0
+
+if (tokens < max) then
+	-- room available: add a tentative token, and include newly added token in count
+	redis.call("zadd", key, expiresAt, member)
+	success = 1
+	tokens = tokens + 1
+end
+
+redis.call("expire", key, window)
+
+return {success, tokens}
+`)
+
+// Reserve atomically attempts to tentatively take a token from the sliding window. The token is held for ReservationTTL, after which
+// it expires on its own unless Commit() is called, which extends the token to the full window. Cancel() releases the token early.
+//
+// This allows you to check capacity and hold a token while doing some work, without racing other callers for the last token.
+func (r *SlidingWindowImpl) Reserve(ctx context.Context, bucket *SlidingWindowOptions) (*Reservation, error) {
+	if bucket.Granularity > 0 {
+		return nil, ErrReservationsUnsupported
+	}
+
+	reservationTTL := bucket.ReservationTTL
+	if reservationTTL <= 0 {
+		reservationTTL = DefaultReservationTTL
+	}
+
+	id, err := newMemberID()
+	if err != nil {
+		return nil, fmt.Errorf("generating reservation id: %w", err)
+	}
+	member := "reservation:" + id
+
+	now := r.now()
+	keyTTL := bucket.Window
+	if reservationTTL > keyTTL {
+		keyTTL = reservationTTL
+	}
+
+	resp, err := r.eval(ctx, reserveScript, slidingWindowKeys(bucket.Key), []interface{}{
+		now.UnixMilli(), now.Add(reservationTTL).UnixMilli(), int(math.Ceil(keyTTL.Seconds())), bucket.MaximumCapacity, member,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query redis adapter: %w", err)
+	}
+
+	output, err := parseReserveSlidingWindowResponse(resp)
+	if err != nil {
+		logUnexpectedResponse(r.Logger, bucket.Key, resp, err)
+		return nil, parsingError(reserveScript, err)
+	}
+
+	remaining := 0
+	if v := bucket.MaximumCapacity - output.tokens; v > remaining {
+		remaining = v
+	}
+
+	key, window := bucket.Key, bucket.Window
+	commit := func(ctx context.Context) error { return r.commitReservation(ctx, key, window, member) }
+	cancel := func(ctx context.Context) error { return r.cancelReservation(ctx, key, member) }
+
+	emitDecision(r.OnDecision, DecisionEvent{
+		Key:        bucket.Key,
+		Allowed:    output.success,
+		Remaining:  remaining,
+		TakeAmount: 1,
+	})
+
+	return NewReservation(output.success, remaining, commit, cancel), nil
+}
+
+// Commit converts the reservation into a regular token, which expires a full window from now. ErrReservationExpired is returned
+// if the reservation has already expired or been cancelled.
+func (r *Reservation) Commit(ctx context.Context) error {
+	if !r.Success {
+		return ErrReservationFailed
+	}
+	return r.commit(ctx)
+}
+
+// Cancel releases the reserved token back to the sliding window. Cancelling an unsuccessful or expired reservation does nothing.
+func (r *Reservation) Cancel(ctx context.Context) error {
+	if !r.Success {
+		return nil
+	}
+	return r.cancel(ctx)
+}
+
+// commitReservationScript extends a reservation to the full window, if it has not expired.
+var commitReservationScript = newScript(`
+local key = KEYS[1]
+local now = ARGV[1]
+local expiresAt = ARGV[2]
+local window = ARGV[3]
+local member = ARGV[4]
+
+local score = redis.call("zscore", key, member)
+if (score == false or tonumber(score) <= tonumber(now)) then
+	return 0 -- reservation has expired
+end
+
+redis.call("zadd", key, expiresAt, member)
+redis.call("expire", key, window)
+
+return 1
+`)
+
+func (r *SlidingWindowImpl) commitReservation(ctx context.Context, key string, window time.Duration, member string) error {
+	now := r.now()
+
+	resp, err := r.eval(adapters.WithIdempotent(ctx), commitReservationScript, []string{key}, []interface{}{
+		now.UnixMilli(), now.Add(window).UnixMilli(), int(math.Ceil(window.Seconds())), member,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to query redis adapter: %w", err)
+	}
+
+	committed, ok := integer(resp)
+	if !ok {
+		err := fmt.Errorf("expecting int64 but got %T", resp)
+		logUnexpectedResponse(r.Logger, key, resp, err)
+		return err
+	}
+
+	if committed != 1 {
+		return ErrReservationExpired
+	}
+
+	return nil
+}
+
+// cancelReservationScript removes a reservation from the window.
+var cancelReservationScript = newScript(`
+redis.call("zrem", KEYS[1], ARGV[1])
+return 1
+`)
+
+func (r *SlidingWindowImpl) cancelReservation(ctx context.Context, key, member string) error {
+	if _, err := r.eval(adapters.WithIdempotent(ctx), cancelReservationScript, []string{key}, []interface{}{member}); err != nil {
+		return fmt.Errorf("failed to query redis adapter: %w", err)
+	}
+
+	return nil
+}
+
+func parseReserveSlidingWindowResponse(v interface{}) (*slidingWindowOutput, error) {
+	ints, err := parseRedisInt64Slice(v)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ints) != 2 {
+		return nil, fmt.Errorf("expected 2 args but got %d", len(ints))
+	}
+
+	return &slidingWindowOutput{
+		success: ints[0] == 1,
+		tokens:  int(ints[1]),
+	}, nil
+}
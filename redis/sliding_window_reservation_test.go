@@ -0,0 +1,191 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aidenwallis/go-ratelimiting/redis/adapters"
+	goredisadapter "github.com/aidenwallis/go-ratelimiting/redis/adapters/go-redis"
+	redigoadapter "github.com/aidenwallis/go-ratelimiting/redis/adapters/redigo"
+	"github.com/alicebob/miniredis/v2"
+	redigo "github.com/gomodule/redigo/redis"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReserveSlidingWindow(t *testing.T) {
+	testCases := map[string]func(*miniredis.Miniredis) adapters.Adapter{
+		"go-redis": func(t *miniredis.Miniredis) adapters.Adapter {
+			return goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: t.Addr()}))
+		},
+		"redigo": func(t *miniredis.Miniredis) adapters.Adapter {
+			conn, err := redigo.Dial("tcp", t.Addr())
+			if err != nil {
+				panic(err)
+			}
+			return redigoadapter.NewAdapter(conn)
+		},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Now().UTC()
+			limiter := NewSlidingWindow(testCase(miniredis.RunT(t)))
+			limiter.nowFunc = func() time.Time { return now }
+
+			opts := slidingWindowOptions()
+			opts.MaximumCapacity = 2
+			opts.ReservationTTL = time.Second * 5
+
+			committed, err := limiter.Reserve(ctx, opts)
+			assert.NoError(t, err)
+			assert.True(t, committed.Success)
+			assert.Equal(t, 1, committed.RemainingCapacity)
+
+			cancelled, err := limiter.Reserve(ctx, opts)
+			assert.NoError(t, err)
+			assert.True(t, cancelled.Success)
+			assert.Equal(t, 0, cancelled.RemainingCapacity)
+
+			{
+				// the reservations should hold the capacity
+				resp, err := limiter.Reserve(ctx, opts)
+				assert.NoError(t, err)
+				assert.False(t, resp.Success)
+				assert.ErrorIs(t, resp.Commit(ctx), ErrReservationFailed)
+				assert.NoError(t, resp.Cancel(ctx))
+			}
+
+			assert.NoError(t, committed.Commit(ctx))
+			assert.NoError(t, cancelled.Cancel(ctx))
+			assert.ErrorIs(t, cancelled.Commit(ctx), ErrReservationExpired)
+
+			{
+				resp, err := limiter.Inspect(ctx, opts)
+				assert.NoError(t, err)
+				assert.Equal(t, 1, resp.RemainingCapacity, "only the committed token should remain")
+			}
+
+			// move past the reservation ttl, the committed token should last the full window
+			limiter.nowFunc = func() time.Time { return now.Add(time.Second * 10) }
+
+			abandoned, err := limiter.Reserve(ctx, opts)
+			assert.NoError(t, err)
+			assert.True(t, abandoned.Success)
+			assert.Equal(t, 0, abandoned.RemainingCapacity)
+
+			// abandoned reservations expire on their own
+			limiter.nowFunc = func() time.Time { return now.Add(time.Second * 20) }
+
+			{
+				resp, err := limiter.Inspect(ctx, opts)
+				assert.NoError(t, err)
+				assert.Equal(t, 1, resp.RemainingCapacity)
+				assert.ErrorIs(t, abandoned.Commit(ctx), ErrReservationExpired)
+			}
+		})
+	}
+}
+
+func TestReserveSlidingWindow_Errors(t *testing.T) {
+	testCases := map[string]struct {
+		errorMessage string
+		mockAdapter  adapters.Adapter
+	}{
+		"redis error": {
+			errorMessage: "failed to query redis adapter: " + assert.AnError.Error(),
+			mockAdapter: &mockAdapter{
+				returnError: assert.AnError,
+			},
+		},
+		"parsing error": {
+			errorMessage: "parsing redis response from script " + scriptSHA(reserveScript) + ": expected []interface{} but got string",
+			mockAdapter: &mockAdapter{
+				returnValue: "foo",
+			},
+		},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			out, err := NewSlidingWindow(testCase.mockAdapter).Reserve(context.Background(), slidingWindowOptions())
+			assert.Nil(t, out)
+			assert.EqualError(t, err, testCase.errorMessage)
+		})
+	}
+
+	t.Run("approximate", func(t *testing.T) {
+		opts := slidingWindowOptions()
+		opts.Granularity = time.Second
+
+		out, err := NewSlidingWindow(&mockAdapter{}).Reserve(context.Background(), opts)
+		assert.Nil(t, out)
+		assert.ErrorIs(t, err, ErrReservationsUnsupported)
+	})
+}
+
+func TestReservation_Errors(t *testing.T) {
+	testCases := map[string]struct {
+		errorMessage string
+		mockAdapter  adapters.Adapter
+	}{
+		"redis error": {
+			errorMessage: "failed to query redis adapter: " + assert.AnError.Error(),
+			mockAdapter: &mockAdapter{
+				returnError: assert.AnError,
+			},
+		},
+		"parsing error": {
+			errorMessage: "expecting int64 but got string",
+			mockAdapter: &mockAdapter{
+				returnValue: "foo",
+			},
+		},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			err := NewSlidingWindow(testCase.mockAdapter).commitReservation(context.Background(), "test-bucket", time.Minute, "member")
+			assert.EqualError(t, err, testCase.errorMessage)
+		})
+	}
+
+	t.Run("cancel redis error", func(t *testing.T) {
+		err := NewSlidingWindow(&mockAdapter{returnError: assert.AnError}).cancelReservation(context.Background(), "test-bucket", "member")
+		assert.EqualError(t, err, "failed to query redis adapter: "+assert.AnError.Error())
+	})
+}
+
+func TestParseReserveSlidingWindowResponse_Errors(t *testing.T) {
+	testCases := map[string]struct {
+		errorMessage string
+		in           interface{}
+	}{
+		"invalid type": {
+			errorMessage: "expected []interface{} but got string",
+			in:           "foo",
+		},
+		"invalid length": {
+			errorMessage: "expected 2 args but got 3",
+			in:           []interface{}{int64(1), int64(2), int64(3)},
+		},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			out, err := parseReserveSlidingWindowResponse(testCase.in)
+			assert.Nil(t, out)
+			assert.EqualError(t, err, testCase.errorMessage)
+		})
+	}
+}
@@ -2,6 +2,7 @@ package redis
 
 import (
 	"context"
+	"strconv"
 	"testing"
 	"time"
 
@@ -48,6 +49,9 @@ func TestInspectSlidingWindow(t *testing.T) {
 				resp, err := limiter.Inspect(ctx, slidingWindowOptions())
 				assert.NoError(t, err)
 				assert.Equal(t, leakyBucketOptions().MaximumCapacity, resp.RemainingCapacity)
+				assert.Equal(t, slidingWindowOptions().MaximumCapacity, resp.Limit)
+				assert.Equal(t, slidingWindowOptions().Window, resp.Window)
+				assert.Equal(t, 0, resp.CurrentCount)
 			}
 
 			{
@@ -63,11 +67,65 @@ func TestInspectSlidingWindow(t *testing.T) {
 				resp, err := limiter.Inspect(ctx, slidingWindowOptions())
 				assert.NoError(t, err)
 				assert.Equal(t, leakyBucketOptions().MaximumCapacity-1, resp.RemainingCapacity)
+				assert.Equal(t, 1, resp.CurrentCount)
 			}
 		})
 	}
 }
 
+func TestInspectSlidingWindow_ReadOnly(t *testing.T) {
+	testCases := map[string]struct {
+		granularity time.Duration
+		members     func(*miniredis.Miniredis, string) int
+	}{
+		"exact": {
+			members: func(mr *miniredis.Miniredis, key string) int {
+				members, _ := mr.ZMembers(key)
+				return len(members)
+			},
+		},
+		"approximate": {
+			granularity: time.Second,
+			members: func(mr *miniredis.Miniredis, key string) int {
+				fields, _ := mr.HKeys(key)
+				return len(fields)
+			},
+		},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Now().UTC()
+			mr := miniredis.RunT(t)
+			limiter := NewSlidingWindow(goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: mr.Addr()})))
+			limiter.nowFunc = func() time.Time { return now }
+
+			opts := slidingWindowOptions()
+			opts.Granularity = testCase.granularity
+			opts.ReadOnlyInspect = true
+
+			_, err := limiter.Use(ctx, opts)
+			assert.NoError(t, err)
+
+			// move forward 30 seconds, and take another token
+			limiter.nowFunc = func() time.Time { return now.Add(time.Second * 30) }
+			_, err = limiter.Use(ctx, opts)
+			assert.NoError(t, err)
+
+			// move forward 70 seconds, the first token has expired
+			limiter.nowFunc = func() time.Time { return now.Add(time.Second * 70) }
+
+			resp, err := limiter.Inspect(ctx, opts)
+			assert.NoError(t, err)
+			assert.Equal(t, opts.MaximumCapacity-1, resp.RemainingCapacity)
+			assert.Equal(t, 2, testCase.members(mr, opts.Key), "expired tokens should not have been removed")
+		})
+	}
+}
+
 func TestInspectSlidingWindow_Errors(t *testing.T) {
 	testCases := map[string]struct {
 		errorMessage string
@@ -161,6 +219,689 @@ func TestUseSlidingWindow(t *testing.T) {
 	}
 }
 
+func TestUseSlidingWindow_FrozenClock(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+	mr := miniredis.RunT(t)
+	limiter := NewSlidingWindow(goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: mr.Addr()})))
+	limiter.nowFunc = func() time.Time { return now }
+
+	// every take lands on the same millisecond, they should all still count
+	for i := 1; i <= 20; i++ {
+		resp, err := useSlidingWindow(ctx, limiter)
+		assert.NoError(t, err)
+		assert.True(t, resp.Success)
+		assert.Equal(t, slidingWindowOptions().MaximumCapacity-i, resp.RemainingCapacity)
+	}
+
+	members, err := mr.ZMembers(slidingWindowOptions().Key)
+	assert.NoError(t, err)
+	assert.Len(t, members, 20)
+}
+
+func TestUseSlidingWindow_DeniedAcrossTTL(t *testing.T) {
+	testCases := map[string]struct {
+		granularity time.Duration
+		ttl         time.Duration
+	}{
+		"exact":       {ttl: time.Minute},
+		"approximate": {granularity: time.Second, ttl: time.Minute + time.Second},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Now().UTC()
+			mr := miniredis.RunT(t)
+			limiter := NewSlidingWindow(goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: mr.Addr()})))
+			limiter.nowFunc = func() time.Time { return now }
+
+			bucket := slidingWindowOptions()
+			bucket.MaximumCapacity = 2
+			bucket.Granularity = testCase.granularity
+
+			for i := 0; i < 2; i++ {
+				resp, err := limiter.Use(ctx, bucket)
+				assert.NoError(t, err)
+				assert.True(t, resp.Success)
+			}
+
+			// the key is hit constantly while it's at capacity, which bumps its ttl even though every take is denied
+			mr.FastForward(time.Second * 30)
+			limiter.nowFunc = func() time.Time { return now.Add(time.Second * 30) }
+			resp, err := limiter.Use(ctx, bucket)
+			assert.NoError(t, err)
+			assert.False(t, resp.Success)
+			assert.Equal(t, testCase.ttl, mr.TTL(bucket.Key))
+
+			// inspecting bumps the ttl too
+			mr.FastForward(time.Second * 10)
+			limiter.nowFunc = func() time.Time { return now.Add(time.Second * 40) }
+			_, err = limiter.Inspect(ctx, bucket)
+			assert.NoError(t, err)
+			assert.Equal(t, testCase.ttl, mr.TTL(bucket.Key))
+
+			// redis' clock runs ahead of ours, so the tokens haven't expired yet, but the key would have been evicted, resetting its
+			// count, had its ttl only been set by the successful takes
+			mr.FastForward(time.Second * 40)
+			limiter.nowFunc = func() time.Time { return now.Add(time.Second * 50) }
+			resp, err = limiter.Use(ctx, bucket)
+			assert.NoError(t, err)
+			assert.False(t, resp.Success)
+			assert.Equal(t, 0, resp.RemainingCapacity)
+		})
+	}
+}
+
+func TestUseSlidingWindow_FarFutureScores(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2200, time.January, 1, 0, 0, 0, 123456789, time.UTC)
+	mr := miniredis.RunT(t)
+	limiter := NewSlidingWindow(goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: mr.Addr()})))
+	limiter.nowFunc = func() time.Time { return now }
+
+	_, err := useSlidingWindow(ctx, limiter)
+	assert.NoError(t, err)
+
+	members, err := mr.ZMembers(slidingWindowOptions().Key)
+	assert.NoError(t, err)
+	assert.Len(t, members, 1)
+
+	// the score should round-trip exactly, rather than being rounded as a double
+	score, err := mr.ZScore(slidingWindowOptions().Key, members[0])
+	assert.NoError(t, err)
+	assert.Equal(t, now.Add(slidingWindowOptions().Window).UnixMilli(), int64(score))
+	assert.Equal(t, float64(int64(score)), score)
+}
+
+func TestUseSlidingWindow_Precision(t *testing.T) {
+	ctx := context.Background()
+	now := time.UnixMilli(1700000000700)
+	mr := miniredis.RunT(t)
+	limiter := NewSlidingWindow(goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: mr.Addr()})))
+	limiter.nowFunc = func() time.Time { return now }
+
+	opts := slidingWindowOptions()
+	opts.Precision = time.Second
+
+	_, err := limiter.Use(ctx, opts)
+	assert.NoError(t, err)
+
+	members, err := mr.ZMembers(opts.Key)
+	assert.NoError(t, err)
+	score, err := mr.ZScore(opts.Key, members[0])
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1700000060000), int64(score), "the token should expire a window after the start of its second")
+
+	// the token leaves the window once the second it was taken in is over a minute ago
+	limiter.nowFunc = func() time.Time { return time.UnixMilli(1700000060000) }
+
+	resp, err := limiter.Inspect(ctx, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, opts.MaximumCapacity, resp.RemainingCapacity)
+
+	t.Run("shares counters with an equal granularity", func(t *testing.T) {
+		limiter.nowFunc = func() time.Time { return now }
+		opts := slidingWindowOptions()
+		opts.Key = "precision-approximate"
+		opts.Precision = time.Second
+		opts.Granularity = time.Second
+
+		for i := 0; i < 2; i++ {
+			_, err := limiter.Use(ctx, opts)
+			assert.NoError(t, err)
+		}
+
+		fields, err := mr.HKeys(opts.Key)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"1700000060000"}, fields)
+	})
+}
+
+func TestUseSlidingWindow_ServerClock(t *testing.T) {
+	testCases := map[string]time.Duration{
+		"exact":       0,
+		"approximate": time.Second,
+	}
+
+	for name, granularity := range testCases {
+		granularity := granularity
+
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			serverNow := time.Date(2024, time.January, 1, 0, 0, 0, 123456789, time.UTC)
+			mr := miniredis.RunT(t)
+			mr.SetTime(serverNow)
+
+			// the client's clock is an hour behind, which shouldn't affect the window
+			limiter := NewSlidingWindow(goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: mr.Addr()})))
+			limiter.nowFunc = func() time.Time { return serverNow.Add(-time.Hour) }
+
+			opts := slidingWindowOptions()
+			opts.MaximumCapacity = 1
+			opts.Granularity = granularity
+			opts.ServerClock = true
+
+			{
+				resp, err := limiter.Use(ctx, opts)
+				assert.NoError(t, err)
+				assert.True(t, resp.Success)
+			}
+
+			expiresAt := serverNow.Add(opts.Window).UnixMilli()
+			if granularity > 0 {
+				fields, err := mr.HKeys(opts.Key)
+				assert.NoError(t, err)
+				expiresAt = (expiresAt + granularity.Milliseconds() - 1) / granularity.Milliseconds() * granularity.Milliseconds()
+				assert.Equal(t, []string{strconv.FormatInt(expiresAt, 10)}, fields)
+			} else {
+				members, err := mr.ZMembers(opts.Key)
+				assert.NoError(t, err)
+				score, err := mr.ZScore(opts.Key, members[0])
+				assert.NoError(t, err)
+				assert.Equal(t, expiresAt, int64(score))
+			}
+
+			{
+				resp, err := limiter.Inspect(ctx, opts)
+				assert.NoError(t, err)
+				assert.Equal(t, 0, resp.RemainingCapacity)
+			}
+
+			// only the server's clock moves past the window
+			mr.SetTime(time.UnixMilli(expiresAt))
+
+			{
+				resp, err := limiter.Inspect(ctx, opts)
+				assert.NoError(t, err)
+				assert.Equal(t, 1, resp.RemainingCapacity)
+			}
+
+			{
+				resp, err := limiter.Use(ctx, opts)
+				assert.NoError(t, err)
+				assert.True(t, resp.Success)
+			}
+		})
+	}
+}
+
+func TestWouldAllowAtSlidingWindow(t *testing.T) {
+	testCases := map[string]time.Duration{
+		"exact":       0,
+		"approximate": time.Second,
+	}
+
+	for name, granularity := range testCases {
+		granularity := granularity
+
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Now().UTC()
+			mr := miniredis.RunT(t)
+			limiter := NewSlidingWindow(goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: mr.Addr()})))
+			limiter.nowFunc = func() time.Time { return now }
+
+			opts := slidingWindowOptions()
+			opts.MaximumCapacity = 2
+			opts.Granularity = granularity
+
+			for i := 0; i < 2; i++ {
+				_, err := limiter.Use(ctx, opts)
+				assert.NoError(t, err)
+			}
+
+			{
+				resp, err := limiter.WouldAllowAt(ctx, opts, now.Add(time.Second))
+				assert.NoError(t, err)
+				assert.Equal(t, &WouldAllowResponse{Allowed: false, Remaining: 0}, resp)
+			}
+
+			{
+				resp, err := limiter.WouldAllowAt(ctx, opts, now.Add(opts.Window+granularity))
+				assert.NoError(t, err)
+				assert.Equal(t, &WouldAllowResponse{Allowed: true, Remaining: 1}, resp)
+			}
+
+			// projecting past the window shouldn't have cleared the tokens
+			resp, err := limiter.Inspect(ctx, opts)
+			assert.NoError(t, err)
+			assert.Equal(t, 0, resp.RemainingCapacity)
+		})
+	}
+}
+
+func TestUseSlidingWindow_TrimOnShrink(t *testing.T) {
+	testCases := map[string]func(*SlidingWindowOptions){
+		"exact":       func(*SlidingWindowOptions) {},
+		"approximate": func(o *SlidingWindowOptions) { o.Granularity = time.Second },
+		"compacted":   func(o *SlidingWindowOptions) { o.CompactionThreshold = 2 },
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Now().UTC()
+			mr := miniredis.RunT(t)
+			limiter := NewSlidingWindow(goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: mr.Addr()})))
+			limiter.nowFunc = func() time.Time { return now }
+
+			opts := slidingWindowOptions()
+			opts.MaximumCapacity = 4
+			testCase(opts)
+
+			for i := 0; i < 4; i++ {
+				now = now.Add(time.Second)
+				resp, err := limiter.Use(ctx, opts)
+				assert.NoError(t, err)
+				assert.True(t, resp.Success)
+			}
+
+			shrunk := *opts
+			shrunk.MaximumCapacity = 2
+			shrunk.TrimOnShrink = true
+
+			resp, err := limiter.Use(ctx, &shrunk)
+			assert.NoError(t, err)
+			assert.False(t, resp.Success)
+			assert.Equal(t, 0, resp.RemainingCapacity)
+
+			// only the newest 2 tokens should be left in the window
+			inspect, err := limiter.Inspect(ctx, opts)
+			assert.NoError(t, err)
+			assert.Equal(t, 2, inspect.RemainingCapacity)
+		})
+	}
+}
+
+func TestSlidingWindow_CurrentCount(t *testing.T) {
+	testCases := map[string]func(*SlidingWindowOptions){
+		"exact":       func(*SlidingWindowOptions) {},
+		"approximate": func(o *SlidingWindowOptions) { o.Granularity = time.Second },
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Now().UTC()
+			mr := miniredis.RunT(t)
+			limiter := NewSlidingWindow(goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: mr.Addr()})))
+			limiter.nowFunc = func() time.Time { return now }
+
+			opts := slidingWindowOptions()
+			opts.MaximumCapacity = 4
+			testCase(opts)
+
+			for i := 0; i < 4; i++ {
+				resp, err := limiter.Use(ctx, opts)
+				assert.NoError(t, err)
+				assert.True(t, resp.Success)
+				assert.Equal(t, i+1, resp.CurrentCount)
+			}
+
+			// after the capacity is reduced, the count goes beyond it, while the remaining capacity stays clamped
+			shrunk := *opts
+			shrunk.MaximumCapacity = 2
+
+			resp, err := limiter.Use(ctx, &shrunk)
+			assert.NoError(t, err)
+			assert.False(t, resp.Success)
+			assert.Equal(t, 0, resp.RemainingCapacity)
+			assert.Equal(t, 4, resp.CurrentCount)
+
+			inspect, err := limiter.Inspect(ctx, &shrunk)
+			assert.NoError(t, err)
+			assert.Equal(t, 0, inspect.RemainingCapacity)
+			assert.Equal(t, 4, inspect.CurrentCount)
+		})
+	}
+}
+
+func TestUseSlidingWindow_Burst(t *testing.T) {
+	testCases := map[string]func(*SlidingWindowOptions){
+		"exact":       func(*SlidingWindowOptions) {},
+		"approximate": func(o *SlidingWindowOptions) { o.Granularity = time.Second },
+		"with companion keys": func(o *SlidingWindowOptions) {
+			// the burst key has to be found among the other features' keys
+			o.TrackPeak = true
+			o.PenaltyThreshold = 100
+			o.PenaltyDuration = time.Minute
+		},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Now().UTC()
+			mr := miniredis.RunT(t)
+			limiter := NewSlidingWindow(goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: mr.Addr()})))
+			limiter.nowFunc = func() time.Time { return now }
+
+			opts := slidingWindowOptions()
+			opts.MaximumCapacity = 2
+			opts.BurstCapacity = 2
+			opts.BurstRefill = time.Second * 10
+			testCase(opts)
+
+			use := func(success, usedBurst bool) {
+				t.Helper()
+				resp, err := limiter.Use(ctx, opts)
+				assert.NoError(t, err)
+				assert.Equal(t, success, resp.Success)
+				assert.Equal(t, usedBurst, resp.UsedBurst)
+			}
+
+			use(true, false)
+			use(true, false)
+
+			// the window is full, so the burst pool is drawn from until it's empty
+			use(true, true)
+			use(true, true)
+			use(false, false)
+
+			// the pool refills a token every 10 seconds, but burst tokens don't take up room in the window
+			now = now.Add(time.Second * 10)
+			use(true, true)
+			use(false, false)
+
+			inspect, err := limiter.Inspect(ctx, opts)
+			assert.NoError(t, err)
+			assert.Equal(t, 0, inspect.RemainingCapacity)
+
+			// once the window frees up, tokens are taken from it again, and the pool has refilled in the meantime
+			now = now.Add(time.Minute + time.Second)
+			use(true, false)
+			use(true, false)
+			use(true, true)
+			use(true, true)
+			use(false, false)
+		})
+	}
+}
+
+func TestUseSlidingWindow_LegacyScores(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+	mr := miniredis.RunT(t)
+	limiter := NewSlidingWindow(goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: mr.Addr()})))
+	limiter.nowFunc = func() time.Time { return now }
+
+	// tokens written in nanoseconds by older versions, one still in the window and one expired
+	key := slidingWindowOptions().Key
+	_, _ = mr.ZAdd(key, float64(now.Add(time.Second).UnixNano()), "live")
+	_, _ = mr.ZAdd(key, float64(now.Add(-time.Second).UnixNano()), "expired")
+
+	resp, err := useSlidingWindow(ctx, limiter)
+	assert.NoError(t, err)
+	assert.Equal(t, slidingWindowOptions().MaximumCapacity-2, resp.RemainingCapacity)
+
+	score, err := mr.ZScore(key, "live")
+	assert.NoError(t, err)
+	assert.Equal(t, float64(now.Add(time.Second).UnixMilli()), score, "legacy scores should be rescaled to milliseconds")
+}
+
+func TestInspectSlidingWindow_ReadOnlyLegacyScores(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+	mr := miniredis.RunT(t)
+	limiter := NewSlidingWindow(goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: mr.Addr()})))
+	limiter.nowFunc = func() time.Time { return now }
+
+	opts := slidingWindowOptions()
+	opts.ReadOnlyInspect = true
+
+	// tokens written in nanoseconds by older versions, one still in the window and one expired, alongside one in milliseconds
+	_, _ = mr.ZAdd(opts.Key, float64(now.Add(time.Second).UnixNano()), "live")
+	_, _ = mr.ZAdd(opts.Key, float64(now.Add(-time.Second).UnixNano()), "expired")
+	_, _ = mr.ZAdd(opts.Key, float64(now.Add(time.Second).UnixMilli()), "current")
+
+	resp, err := limiter.Inspect(ctx, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, opts.MaximumCapacity-2, resp.RemainingCapacity)
+
+	score, err := mr.ZScore(opts.Key, "live")
+	assert.NoError(t, err)
+	assert.Equal(t, float64(now.Add(time.Second).UnixNano()), score, "read only inspects shouldn't rescale legacy scores")
+
+	// once the legacy token has expired, it's no longer counted
+	now = now.Add(2 * time.Second)
+	resp, err = limiter.Inspect(ctx, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, opts.MaximumCapacity, resp.RemainingCapacity)
+}
+
+func TestInspectSlidingWindow_LegacySubWindows(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+	mr := miniredis.RunT(t)
+	limiter := NewSlidingWindow(goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: mr.Addr()})))
+	limiter.nowFunc = func() time.Time { return now }
+
+	// sub-windows keyed in nanoseconds by older versions, one still in the window and one expired
+	opts := slidingWindowOptions()
+	opts.Granularity = time.Second * 10
+	mr.HSet(opts.Key, strconv.FormatInt(now.Add(time.Second).UnixNano(), 10), "2")
+	mr.HSet(opts.Key, strconv.FormatInt(now.Add(-time.Second).UnixNano(), 10), "3")
+
+	resp, err := limiter.Inspect(ctx, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, opts.MaximumCapacity-2, resp.RemainingCapacity)
+
+	fields, err := mr.HKeys(opts.Key)
+	assert.NoError(t, err)
+	assert.Len(t, fields, 1, "the expired legacy sub-window should be cleared")
+}
+
+func TestUseSlidingWindow_Approximate(t *testing.T) {
+	testCases := map[string]func(*miniredis.Miniredis) adapters.Adapter{
+		"go-redis": func(t *miniredis.Miniredis) adapters.Adapter {
+			return goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: t.Addr()}))
+		},
+		"redigo": func(t *miniredis.Miniredis) adapters.Adapter {
+			conn, err := redigo.Dial("tcp", t.Addr())
+			if err != nil {
+				panic(err)
+			}
+			return redigoadapter.NewAdapter(conn)
+		},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Unix(1700000005, 0)
+			mr := miniredis.RunT(t)
+			limiter := NewSlidingWindow(testCase(mr))
+			limiter.nowFunc = func() time.Time { return now }
+
+			opts := slidingWindowOptions()
+			opts.Granularity = time.Second * 10
+
+			for i := 1; i <= 2; i++ {
+				resp, err := limiter.Use(ctx, opts)
+				assert.NoError(t, err)
+				assert.True(t, resp.Success)
+				assert.Equal(t, opts.MaximumCapacity-i, resp.RemainingCapacity)
+			}
+
+			{
+				resp, err := limiter.Inspect(ctx, opts)
+				assert.NoError(t, err)
+				assert.Equal(t, opts.MaximumCapacity-2, resp.RemainingCapacity)
+
+				fields, err := mr.HKeys(opts.Key)
+				assert.NoError(t, err)
+				assert.Equal(t, []string{"1700000070000"}, fields, "both tokens should share one sub-window, rounded up to its end")
+			}
+
+			// move forward 60 seconds, the window has passed, but the sub-window has not expired yet
+			limiter.nowFunc = func() time.Time { return now.Add(time.Second * 60) }
+
+			{
+				resp, err := limiter.Use(ctx, opts)
+				assert.NoError(t, err)
+				assert.True(t, resp.Success)
+				assert.Equal(t, opts.MaximumCapacity-3, resp.RemainingCapacity)
+			}
+
+			// move forward 70 seconds, the first sub-window has now expired
+			limiter.nowFunc = func() time.Time { return now.Add(time.Second * 70) }
+
+			{
+				resp, err := limiter.Inspect(ctx, opts)
+				assert.NoError(t, err)
+				assert.Equal(t, opts.MaximumCapacity-1, resp.RemainingCapacity)
+			}
+		})
+	}
+}
+
+func TestUseSlidingWindow_ApproximateCapacity(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	limiter := NewSlidingWindow(goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: mr.Addr()})))
+
+	opts := slidingWindowOptions()
+	opts.MaximumCapacity = 2
+	opts.Granularity = time.Second
+
+	for i := 0; i < 2; i++ {
+		resp, err := limiter.Use(ctx, opts)
+		assert.NoError(t, err)
+		assert.True(t, resp.Success)
+	}
+
+	resp, err := limiter.Use(ctx, opts)
+	assert.NoError(t, err)
+	assert.False(t, resp.Success)
+	assert.Equal(t, 0, resp.RemainingCapacity)
+}
+
+func TestUseSlidingWindow_SoftCapacity(t *testing.T) {
+	testCases := map[string]time.Duration{
+		"exact":       0,
+		"approximate": time.Second,
+	}
+
+	for name, granularity := range testCases {
+		granularity := granularity
+
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			mr := miniredis.RunT(t)
+			limiter := NewSlidingWindow(goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: mr.Addr()})))
+
+			opts := slidingWindowOptions()
+			opts.MaximumCapacity = 3
+			opts.SoftCapacity = 1
+			opts.Granularity = granularity
+
+			expected := []struct {
+				success       bool
+				overSoftLimit bool
+			}{
+				{success: true, overSoftLimit: false},
+				{success: true, overSoftLimit: true},
+				{success: true, overSoftLimit: true},
+				{success: false, overSoftLimit: true},
+			}
+
+			for i, e := range expected {
+				resp, err := limiter.Use(ctx, opts)
+				assert.NoError(t, err)
+				assert.Equal(t, e.success, resp.Success, "use %d", i)
+				assert.Equal(t, e.overSoftLimit, resp.OverSoftLimit, "use %d", i)
+			}
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		ctx := context.Background()
+		mr := miniredis.RunT(t)
+		limiter := NewSlidingWindow(goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: mr.Addr()})))
+
+		for i := 0; i < 3; i++ {
+			resp, err := useSlidingWindow(ctx, limiter)
+			assert.NoError(t, err)
+			assert.False(t, resp.OverSoftLimit)
+		}
+	})
+}
+
+func TestUseSlidingWindow_Compaction(t *testing.T) {
+	testCases := map[string]func(*miniredis.Miniredis) adapters.Adapter{
+		"go-redis": func(t *miniredis.Miniredis) adapters.Adapter {
+			return goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: t.Addr()}))
+		},
+		"redigo": func(t *miniredis.Miniredis) adapters.Adapter {
+			conn, err := redigo.Dial("tcp", t.Addr())
+			if err != nil {
+				panic(err)
+			}
+			return redigoadapter.NewAdapter(conn)
+		},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Now().UTC()
+			mr := miniredis.RunT(t)
+			limiter := NewSlidingWindow(testCase(mr))
+
+			opts := slidingWindowOptions()
+			opts.MaximumCapacity = 10
+			opts.CompactionThreshold = 3
+
+			for i := 0; i < 5; i++ {
+				current := now.Add(time.Second * time.Duration(i))
+				limiter.nowFunc = func() time.Time { return current }
+
+				resp, err := limiter.Use(ctx, opts)
+				assert.NoError(t, err)
+				assert.True(t, resp.Success)
+				assert.Equal(t, opts.MaximumCapacity-i-1, resp.RemainingCapacity, "compaction should preserve the count")
+
+				members, err := mr.ZMembers(opts.Key)
+				assert.NoError(t, err)
+				assert.LessOrEqual(t, len(members), opts.CompactionThreshold)
+			}
+
+			// the first token would've expired in an exact window, but the compacted tokens expire with the newest merged token
+			limiter.nowFunc = func() time.Time { return now.Add(time.Second*60 + time.Millisecond*500) }
+
+			for _, readOnly := range []bool{true, false} {
+				opts.ReadOnlyInspect = readOnly
+				resp, err := limiter.Inspect(ctx, opts)
+				assert.NoError(t, err)
+				assert.Equal(t, opts.MaximumCapacity-5, resp.RemainingCapacity)
+			}
+
+			// now the compacted tokens have expired
+			limiter.nowFunc = func() time.Time { return now.Add(time.Second*62 + time.Millisecond*500) }
+
+			for _, readOnly := range []bool{true, false} {
+				opts.ReadOnlyInspect = readOnly
+				resp, err := limiter.Inspect(ctx, opts)
+				assert.NoError(t, err)
+				assert.Equal(t, opts.MaximumCapacity-2, resp.RemainingCapacity)
+			}
+		})
+	}
+}
+
 func TestUseSlidingWindow_Errors(t *testing.T) {
 	testCases := map[string]struct {
 		errorMessage string
@@ -173,7 +914,7 @@ func TestUseSlidingWindow_Errors(t *testing.T) {
 			},
 		},
 		"parsing error": {
-			errorMessage: "parsing redis response: expected []interface{} but got string",
+			errorMessage: "parsing redis response from script " + scriptSHA(slidingWindowUseScript) + ": expected []interface{} but got string",
 			mockAdapter: &mockAdapter{
 				returnValue: "foo",
 			},
@@ -201,8 +942,8 @@ func TestParseSlidingWindowResponse_Errors(t *testing.T) {
 			in:           "foo",
 		},
 		"invalid length": {
-			errorMessage: "expected 2 args but got 3",
-			in:           []interface{}{int64(1), int64(2), int64(3)},
+			errorMessage: "expected 5 args but got 2",
+			in:           []interface{}{int64(1), int64(2)},
 		},
 	}
 
@@ -0,0 +1,105 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aidenwallis/go-ratelimiting/redis/adapters"
+)
+
+// SlidingWindowTrend defines the response parameters for SlidingWindowImpl.InspectTrend()
+type SlidingWindowTrend struct {
+	// Recent is how many tokens were taken in the most recent interval
+	Recent int
+
+	// Previous is how many tokens were taken in the interval before that
+	Previous int
+
+	// Interval is the length of each interval that was counted
+	Interval time.Duration
+}
+
+// slidingWindowTrendScript counts the tokens taken in the most recent interval, and in the interval before that. Scores are when
+// tokens expire, so tokens taken in an interval have scores in the same interval shifted forward by the window.
+var slidingWindowTrendScript = newScript(`
+local key = KEYS[1]
+local now = ARGV[1]
+local window = tonumber(ARGV[2])
+local interval = tonumber(ARGV[3])
+` + serverClockScript + `
+local recentFrom = tonumber(now) + window - interval
+local recent = redis.call("zcount", key, "(" .. recentFrom, tonumber(now) + window)
+local previous = redis.call("zcount", key, "(" .. (recentFrom - interval), recentFrom)
+
+return {recent, previous}
+`)
+
+// approximateTrendScript is the equivalent of the trend script for sliding windows with Granularity set.
+var approximateTrendScript = newScript(`
+local key = KEYS[1]
+local now = ARGV[1]
+local window = tonumber(ARGV[2])
+local interval = tonumber(ARGV[3])
+` + serverClockScript + legacySubWindowScript + `
+local recentFrom = tonumber(now) + window - interval
+local recent = 0
+local previous = 0
+
+local subWindows = redis.call("hgetall", key)
+for i = 1, #subWindows, 2 do
+	local expiry = subWindowExpiry(subWindows[i])
+	if (expiry > recentFrom and expiry <= recentFrom + interval) then
+		recent = recent + tonumber(subWindows[i + 1])
+	elseif (expiry > recentFrom - interval and expiry <= recentFrom) then
+		previous = previous + tonumber(subWindows[i + 1])
+	end
+end
+
+return {recent, previous}
+`)
+
+// InspectTrend counts the tokens taken from the sliding window in the most recent interval, and in the interval before that, so
+// that callers can work out whether the rate they're being used at is accelerating, such as to trip a circuit breaker on a spike
+// before MaximumCapacity is reached. It does not take any tokens, nor write to Redis. interval should be no more than half of the
+// window, as tokens taken before that have already left it.
+//
+// Tokens are counted by when they'll expire, so tokens whose expiry was rounded by Granularity or Precision may be counted in the
+// neighbouring interval, tokens merged by compaction are counted as one, and tokens held by uncommitted reservations aren't counted.
+func (r *SlidingWindowImpl) InspectTrend(ctx context.Context, bucket *SlidingWindowOptions, interval time.Duration) (*SlidingWindowTrend, error) {
+	script := slidingWindowTrendScript
+	if bucket.Granularity > 0 {
+		script = approximateTrendScript
+	}
+
+	args := []interface{}{r.nowArg(bucket), bucket.Window.Milliseconds(), interval.Milliseconds()}
+	resp, err := r.eval(adapters.WithIdempotent(ctx), script, []string{bucket.Key}, args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query redis adapter: %w", err)
+	}
+
+	trend, err := parseSlidingWindowTrendResponse(resp)
+	if err != nil {
+		logUnexpectedResponse(r.Logger, bucket.Key, resp, err)
+		return nil, parsingError(script, err)
+	}
+
+	trend.Interval = interval
+	return trend, nil
+}
+
+func parseSlidingWindowTrendResponse(v interface{}) (*SlidingWindowTrend, error) {
+	ints, err := parseRedisInt64Slice(v)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ints) != 2 {
+		return nil, fmt.Errorf("expected 2 args but got %d", len(ints))
+	}
+
+	return &SlidingWindowTrend{
+		Recent:   int(ints[0]),
+		Previous: int(ints[1]),
+	}, nil
+}
@@ -0,0 +1,106 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aidenwallis/go-ratelimiting/redis/adapters"
+	goredisadapter "github.com/aidenwallis/go-ratelimiting/redis/adapters/go-redis"
+	redigoadapter "github.com/aidenwallis/go-ratelimiting/redis/adapters/redigo"
+	"github.com/alicebob/miniredis/v2"
+	redigo "github.com/gomodule/redigo/redis"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInspectTrendSlidingWindow(t *testing.T) {
+	adapterCases := map[string]func(*miniredis.Miniredis) adapters.Adapter{
+		"go-redis": func(t *miniredis.Miniredis) adapters.Adapter {
+			return goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: t.Addr()}))
+		},
+		"redigo": func(t *miniredis.Miniredis) adapters.Adapter {
+			conn, err := redigo.Dial("tcp", t.Addr())
+			if err != nil {
+				panic(err)
+			}
+			return redigoadapter.NewAdapter(conn)
+		},
+	}
+
+	optionCases := map[string]func(*SlidingWindowOptions){
+		"exact":       func(*SlidingWindowOptions) {},
+		"approximate": func(o *SlidingWindowOptions) { o.Granularity = time.Second },
+	}
+
+	for adapterName, adapterCase := range adapterCases {
+		for optionName, optionCase := range optionCases {
+			adapterCase, optionCase := adapterCase, optionCase
+
+			t.Run(adapterName+"/"+optionName, func(t *testing.T) {
+				ctx := context.Background()
+				now := time.Unix(1700000000, 0)
+				limiter := NewSlidingWindow(adapterCase(miniredis.RunT(t)))
+				limiter.nowFunc = func() time.Time { return now }
+
+				opts := slidingWindowOptions()
+				optionCase(opts)
+
+				use := func(n int) {
+					for i := 0; i < n; i++ {
+						_, err := limiter.Use(ctx, opts)
+						assert.NoError(t, err)
+					}
+				}
+
+				// 2 tokens are taken 25 seconds ago, 1 token 15 seconds ago, then 5 tokens 5 seconds ago
+				use(2)
+				now = now.Add(time.Second * 10)
+				use(1)
+				now = now.Add(time.Second * 10)
+				use(5)
+				now = now.Add(time.Second * 5)
+
+				trend, err := limiter.InspectTrend(ctx, opts, time.Second*10)
+				assert.NoError(t, err)
+				assert.Equal(t, &SlidingWindowTrend{Recent: 5, Previous: 1, Interval: time.Second * 10}, trend)
+
+				// nothing was taken in the last 10 seconds
+				now = now.Add(time.Second * 10)
+				trend, err = limiter.InspectTrend(ctx, opts, time.Second*10)
+				assert.NoError(t, err)
+				assert.Equal(t, &SlidingWindowTrend{Recent: 0, Previous: 5, Interval: time.Second * 10}, trend)
+			})
+		}
+	}
+}
+
+func TestInspectTrendSlidingWindow_Errors(t *testing.T) {
+	testCases := map[string]struct {
+		errorMessage string
+		mockAdapter  adapters.Adapter
+	}{
+		"redis error": {
+			errorMessage: "failed to query redis adapter: " + assert.AnError.Error(),
+			mockAdapter: &mockAdapter{
+				returnError: assert.AnError,
+			},
+		},
+		"parsing error": {
+			errorMessage: "parsing redis response from script " + scriptSHA(slidingWindowTrendScript) + ": expected 2 args but got 1",
+			mockAdapter: &mockAdapter{
+				returnValue: []interface{}{int64(1)},
+			},
+		},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			out, err := NewSlidingWindow(testCase.mockAdapter).InspectTrend(context.Background(), slidingWindowOptions(), time.Second)
+			assert.Nil(t, out)
+			assert.EqualError(t, err, testCase.errorMessage)
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package redis
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// waitJitterPercent is the most that WaitUse adds to each delay, as a percentage of it, so that callers denied at the same time by
+// different instances don't all retry at once.
+const waitJitterPercent = 10
+
+// WaitUse is equivalent to Use, except when the take is denied, it blocks the goroutine until the tokens should be available, and
+// tries again, until the take succeeds. This gives the same blocking behaviour as Wait on the local ratelimiters. You can use
+// context to cancel the wait, in which case its error is returned.
+//
+// The delay is worked out from RemainingTokensFloat, or PenaltyUntil when the caller is cooling down, or the following midnight
+// UTC when DailyQuota is exhausted, and a little jitter is added so instances that were denied together don't retry together.
+//
+// If the take can never succeed, because takeAmount plus MinimumReserve is more than MaximumCapacity, ErrTakeExceedsCapacity is
+// returned without querying Redis, rather than waiting forever. With PartialOK, only one token needs to fit alongside the reserve.
+func (r *LeakyBucketImpl) WaitUse(ctx context.Context, bucket *LeakyBucketOptions, takeAmount int) (*UseLeakyBucketResponse, error) {
+	needed := takeAmount
+	if bucket.PartialOK && needed > 1 {
+		needed = 1
+	}
+	if needed+bucket.MinimumReserve > bucket.MaximumCapacity {
+		return nil, ErrTakeExceedsCapacity
+	}
+
+	for {
+		resp, err := r.Use(ctx, bucket, takeAmount)
+		if err != nil || resp.Success {
+			return resp, err
+		}
+
+		if err := sleepContext(ctx, leakyBucketRetryAfter(r.now(), bucket, takeAmount, resp)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// WaitUse is equivalent to Use, except when the take is denied, it blocks the goroutine until a token should be available, and
+// tries again, until the take succeeds. This gives the same blocking behaviour as Wait on the local ratelimiters. You can use
+// context to cancel the wait, in which case its error is returned.
+//
+// The sliding window doesn't report when its oldest token expires, so unless the caller is cooling down, it tries again every
+// Window divided by MaximumCapacity, which is how often a token expires on average from a full window, with a little jitter added
+// so instances that were denied together don't retry together.
+func (r *SlidingWindowImpl) WaitUse(ctx context.Context, bucket *SlidingWindowOptions) (*UseSlidingWindowResponse, error) {
+	for {
+		resp, err := r.Use(ctx, bucket)
+		if err != nil || resp.Success {
+			return resp, err
+		}
+
+		delay := bucket.Window
+		if bucket.MaximumCapacity > 0 {
+			delay /= time.Duration(bucket.MaximumCapacity)
+		}
+		if !resp.PenaltyUntil.IsZero() {
+			delay = resp.PenaltyUntil.Sub(r.now())
+		}
+
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// leakyBucketRetryAfter returns how long after now a denied take from the leaky bucket should be tried again, it's shared by WaitUse
+// and UseLeakyBucketResponse.Decision so they always agree.
+func leakyBucketRetryAfter(now time.Time, bucket *LeakyBucketOptions, takeAmount int, resp *UseLeakyBucketResponse) time.Duration {
+	switch {
+	case !resp.PenaltyUntil.IsZero():
+		return resp.PenaltyUntil.Sub(now)
+	case resp.DeniedByQuota:
+		return quotaResetAt(now).Sub(now)
+	}
+
+	interval := bucket.Describe().RefillInterval
+	missing := float64(takeAmount+bucket.MinimumReserve) - resp.RemainingTokensFloat
+	if delay := time.Duration(missing * float64(interval)); delay > 0 {
+		return delay
+	}
+
+	// the tokens look to be available already, such as when a denial is replayed for an IdempotencyKey, so don't spin
+	return interval
+}
+
+// sleepContext blocks for d plus up to waitJitterPercent of it, returning early with the context's error if ctx is cancelled first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		d = time.Millisecond
+	}
+	d += time.Duration(rand.Int63n(int64(d)*waitJitterPercent/100 + 1))
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
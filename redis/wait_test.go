@@ -0,0 +1,131 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	goredisadapter "github.com/aidenwallis/go-ratelimiting/redis/adapters/go-redis"
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWaitUseLeakyBucket(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	limiter := NewLeakyBucket(goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: mr.Addr()})))
+
+	opts := &LeakyBucketOptions{KeyPrefix: "test-bucket", MaximumCapacity: 1, WindowSeconds: 1}
+	resp, err := limiter.Use(ctx, opts, 1)
+	assert.NoError(t, err)
+	assert.True(t, resp.Success)
+
+	// the bucket is empty, and fills in whole seconds, so the take waits for up to a second for the token to refill
+	start := time.Now()
+	resp, err = limiter.WaitUse(ctx, opts, 1)
+	assert.NoError(t, err)
+	assert.True(t, resp.Success)
+	assert.Equal(t, 0, resp.RemainingTokens)
+
+	duration := time.Since(start)
+	assert.True(t, duration > 0 && duration <= time.Millisecond*1300, "took %s", duration)
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(ctx, time.Millisecond*50)
+		defer cancel()
+
+		resp, err := limiter.WaitUse(ctx, &LeakyBucketOptions{KeyPrefix: "test-bucket", MaximumCapacity: 1, WindowSeconds: 3600}, 1)
+		assert.Nil(t, resp)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("never succeeds", func(t *testing.T) {
+		resp, err := limiter.WaitUse(ctx, opts, 2)
+		assert.Nil(t, resp)
+		assert.ErrorIs(t, err, ErrTakeExceedsCapacity)
+	})
+
+	t.Run("never succeeds with the reserve", func(t *testing.T) {
+		adapter := &mockAdapter{}
+		limiter := NewLeakyBucket(adapter)
+
+		opts := &LeakyBucketOptions{KeyPrefix: "test-reserve", MaximumCapacity: 5, WindowSeconds: 1, MinimumReserve: 3}
+		resp, err := limiter.WaitUse(ctx, opts, 3)
+		assert.Nil(t, resp)
+		assert.ErrorIs(t, err, ErrTakeExceedsCapacity)
+		assert.False(t, adapter.called)
+
+		// a partial take only needs one token to fit alongside the reserve
+		resp, err = limiter.WaitUse(ctx, &LeakyBucketOptions{KeyPrefix: "test-reserve", MaximumCapacity: 5, WindowSeconds: 1, MinimumReserve: 5, PartialOK: true}, 3)
+		assert.Nil(t, resp)
+		assert.ErrorIs(t, err, ErrTakeExceedsCapacity)
+	})
+}
+
+func TestWaitUseSlidingWindow(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	limiter := NewSlidingWindow(goredisadapter.NewAdapter(goredis.NewClient(&goredis.Options{Addr: mr.Addr()})))
+
+	opts := &SlidingWindowOptions{Key: "test-window", MaximumCapacity: 2, Window: time.Millisecond * 200}
+	for i := 0; i < 2; i++ {
+		resp, err := limiter.Use(ctx, opts)
+		assert.NoError(t, err)
+		assert.True(t, resp.Success)
+	}
+
+	// the window is full until the first token expires, 200ms after it was taken
+	start := time.Now()
+	resp, err := limiter.WaitUse(ctx, opts)
+	assert.NoError(t, err)
+	assert.True(t, resp.Success)
+
+	duration := time.Since(start)
+	assert.True(t, duration >= time.Millisecond*150 && duration <= time.Millisecond*400, "took %s", duration)
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(ctx, time.Millisecond*50)
+		defer cancel()
+
+		opts := &SlidingWindowOptions{Key: "test-window", MaximumCapacity: 1, Window: time.Hour}
+		resp, err := limiter.WaitUse(ctx, opts)
+		assert.Nil(t, resp)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
+
+func TestLeakyBucketRetryAfter(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	opts := leakyBucketOptions()
+
+	testCases := map[string]struct {
+		expected time.Duration
+		resp     *UseLeakyBucketResponse
+	}{
+		"missing tokens": {
+			expected: time.Millisecond * 1500,
+			resp:     &UseLeakyBucketResponse{RemainingTokensFloat: 0.5},
+		},
+		"penalized": {
+			expected: time.Minute,
+			resp:     &UseLeakyBucketResponse{PenaltyUntil: now.Add(time.Minute)},
+		},
+		"quota exhausted": {
+			expected: time.Hour*24 - time.Hour*22 - time.Minute*13 - time.Second*20,
+			resp:     &UseLeakyBucketResponse{DeniedByQuota: true, RemainingTokensFloat: 60},
+		},
+		"replayed denial": {
+			expected: time.Second,
+			resp:     &UseLeakyBucketResponse{RemainingTokensFloat: 60},
+		},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, testCase.expected, leakyBucketRetryAfter(now, opts, 2, testCase.resp))
+		})
+	}
+}